@@ -3,6 +3,7 @@ package v1alpha1
 import (
 	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
 	"github.com/krateoplatformops/provider-runtime/pkg/resource"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -32,13 +33,30 @@ type Credentials struct {
 
 // +kubebuilder:validation:XValidation:rule="!has(oldSelf.version) || has(self.version)", message="Version is required once set"
 // +kubebuilder:validation:XValidation:rule="!has(oldSelf.repo) || has(self.repo)", message="Repo is required once set"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || !has(self.verify.provenance) || !self.url.startsWith('oci://')", message="Provenance verification is not supported for OCI charts, use cosign"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || !has(self.verify.cosign) || self.url.startsWith('oci://')", message="Cosign verification is only supported for OCI charts"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || !has(self.verify.provenance) || !(self.url.startsWith('configmap://') || self.url.startsWith('secret://') || self.url.startsWith('git+'))", message="Provenance verification is only supported for Helm repo and tgz charts"
+// +kubebuilder:validation:XValidation:rule="(has(self.credentials) ? 1 : 0) + (has(self.bearerTokenRef) ? 1 : 0) + (has(self.pullSecretRef) ? 1 : 0) <= 1", message="At most one of credentials, bearerTokenRef and pullSecretRef can be set"
 type ChartInfo struct {
-	// Url: oci or tgz full url
+	// Url: oci or tgz full url. It can also reference a chart archive in the binaryData of a ConfigMap or in a Secret,
+	// as configmap://<namespace>/<name>/<key> or secret://<namespace>/<name>/<key>, or a chart in a Git repository,
+	// as git+<http|https|file>://<repository>[//<path>][?ref=<branch|tag|commit>]
 	Url string `json:"url"`
-	// Version: desired chart version, needed for oci charts and for helm repo urls
+	// Version: desired chart version, needed for oci charts and for helm repo urls.
+	// It can be a semver range, such as ~1.4 or >=2.0 <3.0, resolved against the Helm repo index or the OCI tags:
+	// see UpgradePolicy for how newer versions matching the range are applied
 	// +kubebuilder:validation:Optional
-	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:MaxLength=64
 	Version string `json:"version,omitempty"`
+	// UpgradePolicy: when Version is a range, which newer versions matching it are applied automatically.
+	// Manual keeps the resolved version as long as it matches the range, Patch applies newer patch versions,
+	// Minor applies newer minor and patch versions. Defaults to Manual
+	// +optional
+	UpgradePolicy UpgradePolicy `json:"upgradePolicy,omitempty"`
+	// MaintenanceWindows: when set, automatic upgrades are applied only within one of the windows
+	// +optional
+	// +kubebuilder:validation:MaxItems=16
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
 	// Repo: Helm repo name
 	// Should be set only for helm repo urls
 	// If specified with OCI registries, it will be used as the repository name, instead the URL should contain the full path to the chart.
@@ -51,9 +69,125 @@ type ChartInfo struct {
 	// +optional
 	InsecureSkipVerifyTLS bool `json:"insecureSkipVerifyTLS,omitempty"`
 
+	// Digest: pins the content of the chart, as the sha256 digest of the chart archive or, for OCI charts, of the
+	// manifest. A chart whose content does not match is not used
+	// +optional
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	Digest string `json:"digest,omitempty"`
+
 	// Credentials: credentials for private repos
 	// +optional
 	Credentials *Credentials `json:"credentials,omitempty"`
+
+	// BearerTokenRef: reference to the secret key holding a bearer token sent to the chart source.
+	// For OCI registries it is sent as the access token when the registry asks for bearer authentication
+	// +optional
+	BearerTokenRef *rtv1.SecretKeySelector `json:"bearerTokenRef,omitempty"`
+
+	// PullSecretRef: reference to a kubernetes.io/dockerconfigjson secret. The credentials of the entry
+	// matching the host of the chart source are used
+	// +optional
+	PullSecretRef *rtv1.Reference `json:"pullSecretRef,omitempty"`
+
+	// TLS: client certificate and certificate authorities used to connect to the chart source
+	// +optional
+	TLS *SourceTLS `json:"tls,omitempty"`
+
+	// ProxyURL: HTTP proxy used to reach the chart source, instead of the proxy configured in the environment
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(http|https|socks5)://`
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// Timeout: timeout of each request made to the chart source, e.g. 30s. Defaults to 60s
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Verify: verifies the authenticity of the chart before it is used. A chart that fails verification is not used
+	// to generate the CRD nor deployed
+	// +optional
+	Verify *ChartVerification `json:"verify,omitempty"`
+}
+
+// SourceTLS configures the TLS connections to a chart source.
+type SourceTLS struct {
+	// ClientCertificateRef: reference to a kubernetes.io/tls secret whose tls.crt and tls.key are presented as the client certificate
+	// +optional
+	ClientCertificateRef *rtv1.Reference `json:"clientCertificateRef,omitempty"`
+
+	// CABundleRef: PEM encoded certificate authorities trusted in addition to the system ones
+	// +optional
+	CABundleRef *CABundleRef `json:"caBundleRef,omitempty"`
+}
+
+// CABundleRef selects the key of a secret or of a configmap holding a CA bundle. Exactly one must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.secretKeyRef) != has(self.configMapKeyRef)", message="Exactly one of secretKeyRef and configMapKeyRef must be set"
+type CABundleRef struct {
+	// SecretKeyRef: reference to the secret key holding the CA bundle
+	// +optional
+	SecretKeyRef *rtv1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+
+	// ConfigMapKeyRef: reference to the configmap key holding the CA bundle
+	// +optional
+	ConfigMapKeyRef *rtv1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// ChartVerification selects how the authenticity of a chart is verified. Exactly one method must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.provenance) != has(self.cosign)", message="Exactly one of provenance and cosign must be set"
+type ChartVerification struct {
+	// Provenance: verifies the Helm provenance file (.prov) published next to the chart archive with the keys of a PGP keyring.
+	// Supported for Helm repo and tgz charts
+	// +optional
+	Provenance *ProvenanceVerification `json:"provenance,omitempty"`
+
+	// Cosign: verifies the cosign signature of an OCI chart with a public key
+	// +optional
+	Cosign *CosignVerification `json:"cosign,omitempty"`
+}
+
+type ProvenanceVerification struct {
+	// KeyringRef: reference to the secret key holding the PGP keyring, armored or binary (e.g. the output of gpg --export)
+	KeyringRef rtv1.SecretKeySelector `json:"keyringRef"`
+}
+
+type CosignVerification struct {
+	// PublicKeyRef: reference to the secret key holding the PEM encoded cosign public key
+	PublicKeyRef rtv1.SecretKeySelector `json:"publicKeyRef"`
+}
+
+// UpgradePolicy selects the newer chart versions matching a version range that are applied automatically.
+// +kubebuilder:validation:Enum=Manual;Patch;Minor
+type UpgradePolicy string
+
+const (
+	// UpgradePolicyManual never applies a newer version automatically.
+	UpgradePolicyManual UpgradePolicy = "Manual"
+	// UpgradePolicyPatch applies newer versions with the same major and minor version.
+	UpgradePolicyPatch UpgradePolicy = "Patch"
+	// UpgradePolicyMinor applies newer versions with the same major version.
+	UpgradePolicyMinor UpgradePolicy = "Minor"
+)
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
+// MaintenanceWindow is a recurring period of time in which automatic upgrades are applied.
+type MaintenanceWindow struct {
+	// Days: the days of the week the window opens on, every day when empty
+	// +optional
+	// +kubebuilder:validation:MaxItems=7
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start: the time of the day the window opens, as HH:MM
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Duration: how long the window stays open, e.g. 2h
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone: the IANA time zone of Start, e.g. Europe/Rome. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 type ChartInfoProps struct {
@@ -75,10 +209,289 @@ type ChartInfoProps struct {
 	// Credentials: credentials for private repos
 	// +optional
 	Credentials *Credentials `json:"credentials,omitempty"`
+
+	// BearerTokenRef: reference to the secret key holding a bearer token sent to the chart source
+	// +optional
+	BearerTokenRef *rtv1.SecretKeySelector `json:"bearerTokenRef,omitempty"`
+
+	// PullSecretRef: reference to a kubernetes.io/dockerconfigjson secret
+	// +optional
+	PullSecretRef *rtv1.Reference `json:"pullSecretRef,omitempty"`
+
+	// TLS: client certificate and certificate authorities used to connect to the chart source
+	// +optional
+	TLS *SourceTLS `json:"tls,omitempty"`
+}
+
+// ConversionOperationType is the kind of field operation applied by a conversion rule.
+// +kubebuilder:validation:Enum=move;default;drop;split;join
+type ConversionOperationType string
+
+const (
+	// ConversionOperationMove moves (or renames) the field at Path to To. A value already at To is overwritten.
+	ConversionOperationMove ConversionOperationType = "move"
+	// ConversionOperationDefault sets Value at Path when the field is not set.
+	ConversionOperationDefault ConversionOperationType = "default"
+	// ConversionOperationDrop removes the field at Path.
+	ConversionOperationDrop ConversionOperationType = "drop"
+	// ConversionOperationSplit splits the string at Path into the fields listed in Paths.
+	ConversionOperationSplit ConversionOperationType = "split"
+	// ConversionOperationJoin joins the strings listed in Paths into the field at Path.
+	ConversionOperationJoin ConversionOperationType = "join"
+)
+
+// +kubebuilder:validation:XValidation:rule="self.type != 'move' || has(self.to)", message="To is required for move operations"
+// +kubebuilder:validation:XValidation:rule="self.type != 'default' || has(self.value)", message="Value is required for default operations"
+// +kubebuilder:validation:XValidation:rule="(self.type != 'split' && self.type != 'join') || (has(self.paths) && size(self.paths) > 0)", message="Paths is required for split and join operations"
+type ConversionOperation struct {
+	// Type: the operation to apply
+	Type ConversionOperationType `json:"type"`
+
+	// Path: dot separated path of the field, rooted at spec or status (e.g. spec.image.tag).
+	// For join operations it is the destination field.
+	// +kubebuilder:validation:Pattern=`^(spec|status)(\.[^.]+)+$`
+	Path string `json:"path"`
+
+	// To: dot separated destination path for move operations
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^(spec|status)(\.[^.]+)+$`
+	To string `json:"to,omitempty"`
+
+	// Paths: destination fields for split operations, source fields for join operations
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+
+	// Separator: the separator used by split and join operations
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=","
+	Separator string `json:"separator,omitempty"`
+
+	// Value: the value set by default operations
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Value *apiextensionsv1.JSON `json:"value,omitempty"`
 }
+
+// ConversionRule describes how compositions are converted between two versions of the generated CRD.
+// Rules are written in the From -> To direction and are applied in reverse when converting back.
+type ConversionRule struct {
+	// From: the source version of the generated CRD (e.g. v1-0-0)
+	From string `json:"from"`
+
+	// To: the destination version of the generated CRD (e.g. v1-1-0)
+	To string `json:"to"`
+
+	// Operations: the field operations applied, in order, when converting From -> To
+	Operations []ConversionOperation `json:"operations"`
+}
+
+// VersionRetentionPolicy selects the versions of the generated CRD that are retained.
+// +kubebuilder:validation:Enum=KeepLast;KeepInUse
+type VersionRetentionPolicy string
+
+const (
+	// VersionRetentionKeepLast keeps the last Keep versions of the generated CRD.
+	VersionRetentionKeepLast VersionRetentionPolicy = "KeepLast"
+	// VersionRetentionKeepInUse keeps only the versions of the generated CRD that still have compositions.
+	VersionRetentionKeepInUse VersionRetentionPolicy = "KeepInUse"
+)
+
+// VersionRetention describes which versions of the generated CRD are retained.
+// The latest version, the storage version and the versions of other CompositionDefinitions of the same kind are always retained.
+// Versions outside the policy are unserved first, then removed from the CRD once no compositions are left on them.
+// +kubebuilder:validation:XValidation:rule="self.policy != 'KeepLast' || has(self.keep)", message="Keep is required for the KeepLast policy"
+type VersionRetention struct {
+	// Policy: KeepLast keeps the last Keep versions, KeepInUse keeps only the versions that still have compositions
+	Policy VersionRetentionPolicy `json:"policy"`
+
+	// Keep: the number of versions retained by the KeepLast policy
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Keep int `json:"keep,omitempty"`
+}
+
+// VersionStrategy selects how the version of the generated CRD is derived from the chart version.
+// +kubebuilder:validation:Enum=ChartVersion;Major;MajorMinor
+type VersionStrategy string
+
+const (
+	// VersionStrategyChartVersion names the version after the full chart version (e.g. 1.2.3 -> v1-2-3).
+	VersionStrategyChartVersion VersionStrategy = "ChartVersion"
+	// VersionStrategyMajor names the version after the major chart version (e.g. 1.2.3 -> v1).
+	VersionStrategyMajor VersionStrategy = "Major"
+	// VersionStrategyMajorMinor names the version after the major and minor chart version (e.g. 1.2.3 -> v1-2).
+	VersionStrategyMajorMinor VersionStrategy = "MajorMinor"
+)
+
+// CRDScope is the scope of the generated CRD.
+// +kubebuilder:validation:Enum=Namespaced;Cluster
+type CRDScope string
+
+const (
+	// CRDScopeNamespaced generates a namespaced CRD.
+	CRDScopeNamespaced CRDScope = "Namespaced"
+	// CRDScopeCluster generates a cluster-scoped CRD, for compositions describing platform-wide resources.
+	CRDScopeCluster CRDScope = "Cluster"
+)
+
+// CRDInfo customizes the generated CRD.
+// Names that are not set fall back to the krateo.io/crd-* annotations of the Chart.yaml, then to the defaults:
+// the composition.krateo.io group, a kind derived from the chart name and the ChartVersion strategy.
+type CRDInfo struct {
+	// Group: the API group of the generated CRD
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)+$`
+	Group string `json:"group,omitempty"`
+
+	// Kind: the kind of the generated CRD
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[A-Z][A-Za-z0-9]*$`
+	Kind string `json:"kind,omitempty"`
+
+	// Plural: the plural name of the generated CRD, used as resource name. When not set it is inferred from the kind
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	Plural string `json:"plural,omitempty"`
+
+	// VersionStrategy: how the version of the generated CRD is derived from the chart version
+	// +optional
+	VersionStrategy VersionStrategy `json:"versionStrategy,omitempty"`
+
+	// Scope: the scope of the generated CRD, Namespaced when not set. It cannot be changed once set
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf", message="Scope is immutable"
+	Scope CRDScope `json:"scope,omitempty"`
+
+	// ShortNames: short names of the generated CRD, added to the ones declared by the chart
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	ShortNames []string `json:"shortNames,omitempty"`
+
+	// Categories: categories of the generated CRD, added to compositions, comps and the ones declared by the chart
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	Categories []string `json:"categories,omitempty"`
+
+	// PrinterColumns: additional printer columns of every version of the generated CRD.
+	// A column replaces a chart or default column with the same name
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	PrinterColumns []PrinterColumn `json:"printerColumns,omitempty"`
+}
+
+// PrinterColumnType is the type of the values of a printer column.
+// +kubebuilder:validation:Enum=string;integer;number;boolean;date
+type PrinterColumnType string
+
+// PrinterColumn is an additional printer column of the generated CRD.
+type PrinterColumn struct {
+	// Name: the header of the column
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Type: the OpenAPI type of the values of the column
+	// +kubebuilder:validation:Required
+	Type PrinterColumnType `json:"type"`
+
+	// JSONPath: the simple JSON path into the spec or the status of the composition evaluated to produce the value of the column
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^\.(spec|status)([.\[].*)?$`
+	JSONPath string `json:"jsonPath"`
+
+	// Description: a human readable description of the column
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Format: an optional OpenAPI format of the values of the column
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Priority: the importance of the column. Columns with a priority greater than 0 are only shown in wide output
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// ValidationRule is a CEL validation rule added to the spec schema of the generated CRD,
+// along with the x-kubernetes-validations rules of the values schema of the chart.
+type ValidationRule struct {
+	// Path: dot separated path of the field the rule is set on, rooted at spec (e.g. spec.ports).
+	// A * segment selects the items of an array or the values of a map
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=spec
+	// +kubebuilder:validation:Pattern=`^spec(\.[^.]+)*$`
+	Path string `json:"path,omitempty"`
+
+	// Rule: the CEL expression, where self is the field at Path
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Rule string `json:"rule"`
+
+	// Message: the message returned when the rule is not satisfied
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// MessageExpression: a CEL expression evaluating to the message returned when the rule is not satisfied
+	// +optional
+	MessageExpression string `json:"messageExpression,omitempty"`
+
+	// FieldPath: the path of the field reported when the rule is not satisfied, relative to the field at Path
+	// +optional
+	FieldPath string `json:"fieldPath,omitempty"`
+}
+
 type CompositionDefinitionSpec struct {
 	// rtv1.ManagedSpec `json:",inline"`
 	Chart *ChartInfo `json:"chart,omitempty"`
+
+	// CRD: customizes the names, scope and printer columns of the generated CRD
+	// +optional
+	CRD *CRDInfo `json:"crd,omitempty"`
+
+	// Validations: CEL validation rules added to the spec schema of the generated CRD
+	// +optional
+	Validations []ValidationRule `json:"validations,omitempty"`
+
+	// Conversions: field level migrations applied by the conversion webhook between versions of the generated CRD
+	// +optional
+	Conversions []ConversionRule `json:"conversions,omitempty"`
+
+	// VersionRetention: the policy used to prune old versions of the generated CRD. When not set, all versions are retained
+	// +optional
+	VersionRetention *VersionRetention `json:"versionRetention,omitempty"`
+
+	// Admission: optional checks the validating webhook runs on the compositions, besides the values schema
+	// +optional
+	Admission *AdmissionChecks `json:"admission,omitempty"`
+}
+
+// AdmissionChecks configures the optional checks the validating webhook runs on the compositions.
+type AdmissionChecks struct {
+	// Render: renders the chart with the spec of the composition as values, denying the compositions the chart fails to render
+	// +optional
+	Render *RenderCheck `json:"render,omitempty"`
+}
+
+// RenderCheck configures the rendering of the chart at admission time.
+// Only compositions of the version generated from the current chart are rendered.
+type RenderCheck struct {
+	// Enabled: whether compositions are rendered on create and update
+	Enabled bool `json:"enabled"`
+
+	// Timeout: bounds the fetch and the rendering of the chart, e.g. 3s. Defaults to 5s.
+	// A rendering that times out is allowed with a warning
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
 type VersionDetail struct {
@@ -99,11 +512,64 @@ type VersionDetail struct {
 	Chart *ChartInfoProps `json:"chart"`
 }
 
+// StorageMigrationState is the state of the migration of the stored compositions.
+// +kubebuilder:validation:Enum=Pending;Held;Succeeded;Failed
+type StorageMigrationState string
+
+const (
+	// StorageMigrationPending: the storage version has been switched, stored compositions are not all rewritten yet
+	StorageMigrationPending StorageMigrationState = "Pending"
+	// StorageMigrationHeld: the storage is held on the vacuum version, the latest version drops fields that the conversion rules do not carry
+	StorageMigrationHeld StorageMigrationState = "Held"
+	// StorageMigrationSucceeded: all the compositions are stored in the storage version
+	StorageMigrationSucceeded StorageMigrationState = "Succeeded"
+	// StorageMigrationFailed: the last migration attempt failed, or compositions could not be rewritten, it is retried on the next reconcile
+	StorageMigrationFailed StorageMigrationState = "Failed"
+)
+
+type StorageMigration struct {
+	// StorageVersion: the version the compositions are migrated to
+	// +optional
+	StorageVersion string `json:"storageVersion,omitempty"`
+
+	// State: the state of the migration
+	// +optional
+	State StorageMigrationState `json:"state,omitempty"`
+
+	// Migrated: the number of compositions rewritten in the storage version
+	// +optional
+	Migrated int `json:"migrated"`
+
+	// Total: the number of compositions to migrate
+	// +optional
+	Total int `json:"total"`
+
+	// Continue: the continue token of the list of the compositions left to migrate, a partial migration resumes from it
+	// +optional
+	Continue string `json:"continue,omitempty"`
+
+	// Failed: the number of compositions that could not be rewritten in the storage version
+	// +optional
+	Failed int `json:"failed,omitempty"`
+
+	// Failures: the first compositions that could not be rewritten, with the reason
+	// +optional
+	Failures []string `json:"failures,omitempty"`
+
+	// Error: the error of the last failed migration attempt
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
 type Managed struct {
 	// VersionInfo: the version information of the chart
 	// +optional
 	VersionInfo []VersionDetail `json:"versionInfo,omitempty"`
 
+	// StorageMigration: the progress of the migration of the stored compositions to the storage version of the CRD
+	// +optional
+	StorageMigration *StorageMigration `json:"storageMigration,omitempty"`
+
 	// Group: the generated custom resource Group
 	// +optional
 	Group string `json:"group,omitempty"`
@@ -136,6 +602,52 @@ type CompositionDefinitionStatus struct {
 	// Digest: the digest of the managed resources
 	// +optional
 	Digest string `json:"digest,omitempty"`
+
+	// ChartDigest: the sha256 digest of the chart archive in use
+	// +optional
+	ChartDigest string `json:"chartDigest,omitempty"`
+
+	// ChartMirror: the mirror that served the chart in use, empty when it was served by its source
+	// +optional
+	ChartMirror string `json:"chartMirror,omitempty"`
+
+	// ResolvedVersion: the chart version in use, resolved from spec.chart.version when it is a range
+	// +optional
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+
+	// AvailableVersions: the published chart versions newer than the resolved version, set when spec.chart.version is a range
+	// +optional
+	AvailableVersions []string `json:"availableVersions,omitempty"`
+
+	// Verification: the result of the verification of the chart, set when spec.chart.verify is set
+	// +optional
+	Verification *ChartVerificationStatus `json:"verification,omitempty"`
+}
+
+// ChartVerificationStatus is the result of the verification of the chart.
+type ChartVerificationStatus struct {
+	// Method: the verification method, provenance or cosign
+	Method string `json:"method"`
+
+	// Verified: whether the chart passed verification
+	Verified bool `json:"verified"`
+
+	// Signer: the identity of the signer, the user ID of the PGP key for provenance files,
+	// the fingerprint of the public key for cosign signatures
+	// +optional
+	Signer string `json:"signer,omitempty"`
+
+	// KeyFingerprint: the fingerprint of the key that verified the signature
+	// +optional
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	// Digest: the sha256 digest of the verified chart archive
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Message: why the chart failed verification
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -49,11 +49,13 @@ type CertManager struct {
 	log                         func(msg string, keysAndValues ...any)
 	pluralizer                  pluralizer.PluralizerInterface
 	mutatingWebhookTemplatePath string
-	certPath                    string
-	caBundleMu                  sync.RWMutex
-	caBundle                    []byte
-	webhookServiceMeta          types.NamespacedName
-	certGenMu                   sync.Mutex // Serializes certificate generation to prevent file system races
+	// validatingWebhookTemplatePath is optional: the configuration is skipped when the template is not installed.
+	validatingWebhookTemplatePath string
+	certPath                      string
+	caBundleMu                    sync.RWMutex
+	caBundle                      []byte
+	webhookServiceMeta            types.NamespacedName
+	certGenMu                     sync.Mutex // Serializes certificate generation to prevent file system races
 }
 
 const (
@@ -68,8 +70,11 @@ type Opts struct {
 	WebhookServiceName          string
 	WebhookServiceNamespace     string
 	MutatingWebhookTemplatePath string
-	CertOpts                    certs.GenerateClientCertAndKeyOpts
-	RestConfig                  *rest.Config
+	// ValidatingWebhookTemplatePath is the template of the ValidatingWebhookConfiguration of the /validate webhook.
+	// The CA bundle is propagated to it only when the template exists.
+	ValidatingWebhookTemplatePath string
+	CertOpts                      certs.GenerateClientCertAndKeyOpts
+	RestConfig                    *rest.Config
 }
 
 func NewCertManager(o Opts, optsFuncs ...FuncOption) (*CertManager, error) {
@@ -100,13 +105,14 @@ func NewCertManager(o Opts, optsFuncs ...FuncOption) (*CertManager, error) {
 	}
 
 	mgr := &CertManager{
-		kube:                        kube,
-		client:                      client,
-		certOpts:                    o.CertOpts,
-		log:                         opts.log,
-		pluralizer:                  opts.pluralizer,
-		mutatingWebhookTemplatePath: o.MutatingWebhookTemplatePath,
-		certPath:                    opts.path,
+		kube:                          kube,
+		client:                        client,
+		certOpts:                      o.CertOpts,
+		log:                           opts.log,
+		pluralizer:                    opts.pluralizer,
+		mutatingWebhookTemplatePath:   o.MutatingWebhookTemplatePath,
+		validatingWebhookTemplatePath: o.ValidatingWebhookTemplatePath,
+		certPath:                      opts.path,
 		webhookServiceMeta: types.NamespacedName{
 			Name:      o.WebhookServiceName,
 			Namespace: o.WebhookServiceNamespace,
@@ -382,6 +388,12 @@ func (m *CertManager) propagateCABundle(ctx context.Context, cabundle []byte, gv
 		}
 	}
 
+	// The rules of the compositions cover the groups of all the generated CRDs
+	groups, err := compositionGroups(ctx, m.kube, gvr)
+	if err != nil {
+		return err
+	}
+
 	// Update the mutating webhook config with the new CA bundle
 	mutatingWebhookConfig := admissionregistrationv1.MutatingWebhookConfiguration{}
 	err = objects.CreateK8sObject(&mutatingWebhookConfig,
@@ -392,11 +404,39 @@ func (m *CertManager) propagateCABundle(ctx context.Context, cabundle []byte, gv
 	if err != nil {
 		return fmt.Errorf("error creating mutating webhook config: %w", err)
 	}
+	for i := range mutatingWebhookConfig.Webhooks {
+		addCompositionGroups(mutatingWebhookConfig.Webhooks[i].Rules, groups)
+	}
 	m.log("Updating CA bundle for MutatingWebhookConfiguration", "Name", mutatingWebhookConfig.Name)
 	err = kube.Apply(ctx, m.kube, &mutatingWebhookConfig, kube.ApplyOptions{})
 	if err != nil {
 		return fmt.Errorf("error applying mutating webhook config: %w", err)
 	}
 
+	// Update the validating webhook config with the new CA bundle, when it is installed
+	if m.validatingWebhookTemplatePath == "" {
+		return nil
+	}
+	if _, err := os.Stat(m.validatingWebhookTemplatePath); os.IsNotExist(err) {
+		return nil
+	}
+	validatingWebhookConfig := admissionregistrationv1.ValidatingWebhookConfiguration{}
+	err = objects.CreateK8sObject(&validatingWebhookConfig,
+		schema.GroupVersionResource{},
+		types.NamespacedName{},
+		m.validatingWebhookTemplatePath,
+		"caBundle", base64.StdEncoding.EncodeToString(cabundle))
+	if err != nil {
+		return fmt.Errorf("error creating validating webhook config: %w", err)
+	}
+	for i := range validatingWebhookConfig.Webhooks {
+		addCompositionGroups(validatingWebhookConfig.Webhooks[i].Rules, groups)
+	}
+	m.log("Updating CA bundle for ValidatingWebhookConfiguration", "Name", validatingWebhookConfig.Name)
+	err = kube.Apply(ctx, m.kube, &validatingWebhookConfig, kube.ApplyOptions{})
+	if err != nil {
+		return fmt.Errorf("error applying validating webhook config: %w", err)
+	}
+
 	return nil
 }
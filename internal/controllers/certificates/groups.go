@@ -0,0 +1,58 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// compositionGroup is the default group of the generated CRDs. The webhook rules matching it are the rules of the
+// compositions.
+const compositionGroup = "composition.krateo.io"
+
+// compositionGroups returns the groups of the compositions: the group of gvr and the groups of the CRDs generated
+// by the CompositionDefinitions, which differ from compositionGroup when spec.crd.group is set.
+func compositionGroups(ctx context.Context, cli client.Reader, gvr schema.GroupVersionResource) ([]string, error) {
+	var cdList compositiondefinitionsv1alpha1.CompositionDefinitionList
+	if err := cli.List(ctx, &cdList, &client.ListOptions{Namespace: metav1.NamespaceAll}); err != nil {
+		return nil, fmt.Errorf("error listing CompositionDefinitions: %w", err)
+	}
+
+	groups := []string{}
+	if gvr.Group != "" {
+		groups = append(groups, gvr.Group)
+	}
+	for i := range cdList.Items {
+		if cdList.Items[i].Status.ApiVersion == "" {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(cdList.Items[i].Status.ApiVersion)
+		if err != nil || gv.Group == "" {
+			continue
+		}
+		groups = append(groups, gv.Group)
+	}
+	slices.Sort(groups)
+	return slices.Compact(groups), nil
+}
+
+// addCompositionGroups adds groups to the rules matching compositionGroup, so that the compositions of the CRDs
+// generated in another group reach the webhooks too. The other rules are left untouched.
+func addCompositionGroups(rules []admissionregistrationv1.RuleWithOperations, groups []string) {
+	for i := range rules {
+		if !slices.Contains(rules[i].APIGroups, compositionGroup) {
+			continue
+		}
+		for _, group := range groups {
+			if !slices.Contains(rules[i].APIGroups, group) {
+				rules[i].APIGroups = append(rules[i].APIGroups, group)
+			}
+		}
+	}
+}
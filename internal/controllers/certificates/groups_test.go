@@ -0,0 +1,59 @@
+package certificates
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCompositionGroups(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := compositiondefinitionsv1alpha1.SchemeBuilder.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	definition := func(namespace, name, apiVersion string) *compositiondefinitionsv1alpha1.CompositionDefinition {
+		cd := &compositiondefinitionsv1alpha1.CompositionDefinition{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		cd.Status.ApiVersion = apiVersion
+		return cd
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		definition("demo", "default-group", "composition.krateo.io/v1-0-0"),
+		definition("demo", "custom-group", "apps.example.org/v1-0-0"),
+		definition("other", "same-custom-group", "apps.example.org/v2-0-0"),
+		definition("other", "not-generated-yet", ""),
+	).Build()
+
+	groups, err := compositionGroups(context.Background(), cli, schema.GroupVersionResource{Group: "infra.example.org", Version: "v1-0-0", Resource: "clusters"})
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	expected := []string{"apps.example.org", "composition.krateo.io", "infra.example.org"}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected groups %v, got %v", expected, groups)
+	}
+}
+
+func TestAddCompositionGroups(t *testing.T) {
+	rules := []admissionregistrationv1.RuleWithOperations{
+		{Rule: admissionregistrationv1.Rule{APIGroups: []string{"composition.krateo.io"}, Resources: []string{"*"}}},
+		{Rule: admissionregistrationv1.Rule{APIGroups: []string{"core.krateo.io"}, Resources: []string{"compositiondefinitions"}}},
+	}
+
+	addCompositionGroups(rules, []string{"apps.example.org", "composition.krateo.io"})
+	addCompositionGroups(rules, []string{"apps.example.org"})
+
+	if expected := []string{"composition.krateo.io", "apps.example.org"}; !reflect.DeepEqual(rules[0].APIGroups, expected) {
+		t.Fatalf("expected the composition rule to match %v, got %v", expected, rules[0].APIGroups)
+	}
+	if expected := []string{"core.krateo.io"}; !reflect.DeepEqual(rules[1].APIGroups, expected) {
+		t.Fatalf("expected the other rules to be left untouched, got %v", rules[1].APIGroups)
+	}
+}
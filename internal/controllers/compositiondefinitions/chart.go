@@ -0,0 +1,118 @@
+package compositiondefinitions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartfs"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/krateoplatformops/provider-runtime/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fetchChart downloads the chart of the CompositionDefinition, at the version resolved from spec.chart.version,
+// and records in the status its digest, the mirror that served it and the result of its verification. A chart that does not match the pinned digest or fails verification is never returned,
+// so it cannot reach CRD generation or deploy. Neither is an archive rejected by tgzfs, which fails with a terminal error.
+// The chart of a deleted CompositionDefinition is neither pinned nor verified, it is only used to undeploy what was deployed.
+func (e *external) fetchChart(ctx context.Context, cr *compositiondefinitionsv1alpha1.CompositionDefinition) (*chartfs.ChartFS, error) {
+	nfo, err := e.resolveChartVersion(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	deleted := meta.WasDeleted(cr)
+	if deleted && nfo != nil && (nfo.Verify != nil || nfo.Digest != "") {
+		nfo = nfo.DeepCopy()
+		nfo.Verify, nfo.Digest = nil, ""
+	}
+
+	pkg, err := chart.Fetch(ctx, e.kube, nfo, chart.WithLimits(e.limits))
+	if errors.Is(err, tgzfs.ErrRejected) {
+		return nil, e.rejectChartArchive(cr, err)
+	}
+	var mismatch *chart.DigestMismatchError
+	if errors.As(err, &mismatch) {
+		cr.SetConditions(chartDigestMismatch(mismatch.Error()))
+		return nil, err
+	}
+	var verr *verify.Error
+	if errors.As(err, &verr) {
+		cr.Status.Verification = &compositiondefinitionsv1alpha1.ChartVerificationStatus{
+			Method:   verr.Method,
+			Verified: false,
+			Message:  verr.Reason,
+		}
+		cr.SetConditions(chartVerificationFailed(verr.Error()))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		e.observeChartDigest(cr, pkg)
+		cr.Status.ChartMirror = pkg.Mirror
+	}
+
+	switch {
+	case pkg.Verification != nil:
+		cr.Status.Verification = &compositiondefinitionsv1alpha1.ChartVerificationStatus{
+			Method:         pkg.Verification.Method,
+			Verified:       true,
+			Signer:         pkg.Verification.Signer,
+			KeyFingerprint: pkg.Verification.KeyFingerprint,
+			Digest:         pkg.Digest,
+		}
+		cr.SetConditions(chartVerified(fmt.Sprintf("chart verified with %s, signed by %s", pkg.Verification.Method, pkg.Verification.Signer)))
+	case !deleted:
+		cr.Status.Verification = nil
+		cr.Status.Conditions = slices.DeleteFunc(cr.Status.Conditions, func(c rtv1.Condition) bool {
+			return c.Type == TypeChartVerified
+		})
+	}
+
+	fsys, err := chartfs.FromReaderWithLimits(bytes.NewReader(pkg.Data), pkg.PackageURL, e.limits)
+	if errors.Is(err, tgzfs.ErrRejected) {
+		return nil, e.rejectChartArchive(cr, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr.Status.Conditions = slices.DeleteFunc(cr.Status.Conditions, func(c rtv1.Condition) bool {
+		return c.Type == TypeChartArchiveValid
+	})
+	return fsys, nil
+}
+
+// rejectChartArchive reports a chart archive rejected for exceeding the archive limits, while it was downloaded or read.
+// The same archive is rejected the same way until the chart changes: the error is terminal instead of retried.
+func (e *external) rejectChartArchive(cr *compositiondefinitionsv1alpha1.CompositionDefinition, err error) error {
+	cr.SetConditions(chartArchiveRejected(err.Error()))
+	e.event(cr, corev1.EventTypeWarning, string(ReasonChartArchiveRejected), err.Error())
+	return reconcile.TerminalError(err)
+}
+
+// observeChartDigest records the digest of the chart in the status and flags a chart whose content changed
+// while its package URL, and so its version, did not. The flag is cleared once the chart moves to another
+// version or its content is pinned with spec.chart.digest, and a digest mismatch is cleared once the chart matches again.
+func (e *external) observeChartDigest(cr *compositiondefinitionsv1alpha1.CompositionDefinition, pkg *chart.Package) {
+	prev, sameURL := cr.Status.ChartDigest, cr.Status.PackageURL == pkg.PackageURL
+	cr.Status.ChartDigest = pkg.Digest
+
+	switch cond := cr.GetCondition(TypeChartContentChanged); {
+	case prev != "" && sameURL && prev != pkg.Digest:
+		msg := fmt.Sprintf("the content of %s changed under the same version, from %s to %s", pkg.PackageURL, prev, pkg.Digest)
+		cr.SetConditions(chartContentChanged(msg))
+		e.event(cr, corev1.EventTypeWarning, string(ReasonChartContentChanged), msg)
+	case cond.Status == metav1.ConditionTrue && (!sameURL || cr.Spec.Chart.Digest != "" || cond.Reason == ReasonChartDigestMismatch):
+		cr.SetConditions(chartUnchanged())
+	}
+}
@@ -0,0 +1,145 @@
+package compositiondefinitions
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestObserveChartDigest(t *testing.T) {
+	const (
+		packageURL = "https://charts.example.com/fireworks-app-1.1.0.tgz"
+		digestV1   = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		digestV2   = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+
+	tests := []struct {
+		name       string
+		packageURL string
+		digest     string
+		pinned     string
+		condition  rtv1.Condition
+		reason     rtv1.ConditionReason
+		status     metav1.ConditionStatus
+	}{
+		{
+			name:       "First observed digest",
+			packageURL: packageURL,
+			status:     metav1.ConditionUnknown,
+		},
+		{
+			name:       "Same content",
+			packageURL: packageURL,
+			digest:     digestV1,
+			status:     metav1.ConditionUnknown,
+		},
+		{
+			name:       "Content changed under the same version",
+			packageURL: packageURL,
+			digest:     digestV2,
+			reason:     ReasonChartContentChanged,
+			status:     metav1.ConditionTrue,
+		},
+		{
+			name:       "New version with new content",
+			packageURL: "https://charts.example.com/fireworks-app-1.0.0.tgz",
+			digest:     digestV2,
+			status:     metav1.ConditionUnknown,
+		},
+		{
+			name:       "Change stays flagged while the version does not change",
+			packageURL: packageURL,
+			digest:     digestV1,
+			condition:  chartContentChanged("changed"),
+			reason:     ReasonChartContentChanged,
+			status:     metav1.ConditionTrue,
+		},
+		{
+			name:       "Change is cleared by a new version",
+			packageURL: "https://charts.example.com/fireworks-app-1.0.0.tgz",
+			digest:     digestV1,
+			condition:  chartContentChanged("changed"),
+			reason:     ReasonChartUnchanged,
+			status:     metav1.ConditionFalse,
+		},
+		{
+			name:       "Change is cleared by pinning the digest",
+			packageURL: packageURL,
+			digest:     digestV1,
+			pinned:     digestV1,
+			condition:  chartContentChanged("changed"),
+			reason:     ReasonChartUnchanged,
+			status:     metav1.ConditionFalse,
+		},
+		{
+			name:       "Digest mismatch is cleared once the chart matches",
+			packageURL: packageURL,
+			digest:     digestV1,
+			condition:  chartDigestMismatch("mismatch"),
+			reason:     ReasonChartUnchanged,
+			status:     metav1.ConditionFalse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newTestCompositionDefinition()
+			cr.Spec.Chart = &compositiondefinitionsv1alpha1.ChartInfo{Url: packageURL, Digest: tt.pinned}
+			cr.Status.PackageURL = tt.packageURL
+			cr.Status.ChartDigest = tt.digest
+			if tt.condition.Type != "" {
+				cr.SetConditions(tt.condition)
+			}
+
+			e := &external{}
+			e.observeChartDigest(cr, &chart.Package{PackageURL: packageURL, Digest: digestV1})
+
+			assert.Equal(t, digestV1, cr.Status.ChartDigest)
+			cond := cr.GetCondition(TypeChartContentChanged)
+			assert.Equal(t, tt.reason, cond.Reason)
+			assert.Equal(t, tt.status, cond.Status)
+		})
+	}
+}
+
+func TestFetchChartRejectsUnsafeArchives(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "demo/../../etc/cron.d/evil", Typeflag: tar.TypeReg, Mode: 0o644}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	kube := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "charts"},
+		BinaryData: map[string][]byte{"demo.tgz": buf.Bytes()},
+	}).Build()
+	cr := &compositiondefinitionsv1alpha1.CompositionDefinition{
+		Spec: compositiondefinitionsv1alpha1.CompositionDefinitionSpec{
+			Chart: &compositiondefinitionsv1alpha1.ChartInfo{Url: "configmap://charts/demo/demo.tgz"},
+		},
+	}
+
+	e := &external{kube: kube}
+	_, err := e.fetchChart(context.Background(), cr)
+	assert.ErrorIs(t, err, tgzfs.ErrRejected)
+	assert.ErrorIs(t, err, reconcile.TerminalError(nil))
+
+	cond := cr.GetCondition(TypeChartArchiveValid)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, ReasonChartArchiveRejected, cond.Reason)
+	assert.Contains(t, cond.Message, "path traversal")
+}
@@ -13,16 +13,26 @@ import (
 
 	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
 	"github.com/krateoplatformops/core-provider/internal/controllers/certificates"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/crdopts"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/getters"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/retention"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/status"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/conversion"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/mutation"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/preflight"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/crdcache"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/validation"
 	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
 	"github.com/krateoplatformops/core-provider/internal/tools/chart"
-	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartfs"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/mirrors"
 	contexttools "github.com/krateoplatformops/core-provider/internal/tools/context"
 	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/celrules"
 	crdutils "github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/krateoplatformops/core-provider/internal/tools/deploy"
@@ -57,6 +67,7 @@ var (
 	CDCtemplateConfigmapPath        = filepath.Join(os.TempDir(), "assets/cdc-configmap/configmap.yaml")
 	CDCrbacConfigFolder             = filepath.Join(os.TempDir(), "assets/cdc-rbac/")
 	MutatingWebhookPath             = filepath.Join(os.TempDir(), "assets/mutating-webhook-configuration/mutating-webhook.yaml")
+	ValidatingWebhookPath           = filepath.Join(os.TempDir(), "assets/validating-webhook-configuration/validating-webhook.yaml")
 	JSONSchemaTemplateConfigmapPath = filepath.Join(os.TempDir(), "assets/json-schema-configmap/configmap.yaml")
 	ServiceTemplatePath             = filepath.Join(os.TempDir(), "assets/cdc-service/service.yaml")
 	CertsPath                       = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
@@ -65,8 +76,14 @@ var (
 type Options struct {
 	ControllerOptions controller.Options
 	// Metrics records reconcile telemetry for the CompositionDefinition controller.
-	Metrics                 reconciler.MetricsRecorder
-	WebhookMetrics          *webhooktelemetry.Metrics
+	Metrics        reconciler.MetricsRecorder
+	WebhookMetrics *webhooktelemetry.Metrics
+	// ChartCache is shared by the chart downloads of every reconcile. A nil cache disables caching.
+	ChartCache *chartcache.Cache
+	// ChartMirrors holds the mirror rules applied to every chart source. A nil source disables mirrors.
+	ChartMirrors *mirrors.Source
+	// ArchiveLimits bounds the chart archives read by the provider. Zero limits are replaced by the tgzfs defaults.
+	ArchiveLimits           tgzfs.Limits
 	CertManager             certificates.CertManagerInterface
 	Pluralizer              pluralizerlib.PluralizerInterface
 	CertificateSyncInterval time.Duration
@@ -87,6 +104,9 @@ func Setup(mgr ctrl.Manager, o Options) error {
 		return fmt.Errorf("error creating event recorder: %w", err)
 	}
 
+	chart.SetCache(o.ChartCache)
+	chart.SetMirrors(o.ChartMirrors)
+
 	cli := mgr.GetClient()
 	apiReader := mgr.GetAPIReader()
 
@@ -98,8 +118,18 @@ func Setup(mgr ctrl.Manager, o Options) error {
 		l.Debug("Failed to cleanup obsolete finalizer labels on startup", "error", err)
 	}
 
-	compositionConversionWebhook := conversion.NewWebhookHandler(runtime.NewScheme(), o.WebhookMetrics)
-	mgr.GetWebhookServer().Register("/mutate", mutation.NewWebhookHandler(apiReader, o.WebhookMetrics))
+	compositionConversionWebhook := conversion.NewWebhookHandler(cli, runtime.NewScheme(), o.WebhookMetrics)
+	crdClient, err := apiextensionsclientset.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("error creating CRD client: %w", err)
+	}
+	crds := crdcache.New(crdClient, apiReader, crdcache.DefaultResyncPeriod, o.WebhookMetrics)
+	if err := mgr.Add(crds); err != nil {
+		return fmt.Errorf("error adding CRD cache: %w", err)
+	}
+	mgr.GetWebhookServer().Register("/mutate", mutation.NewWebhookHandler(crds, o.WebhookMetrics))
+	mgr.GetWebhookServer().Register("/validate", validation.NewWebhookHandler(cli, o.ArchiveLimits, o.WebhookMetrics))
+	mgr.GetWebhookServer().Register("/validate-compositiondefinition", preflight.NewWebhookHandler(apiReader, cli, o.ArchiveLimits, o.WebhookMetrics))
 	mgr.GetWebhookServer().Register("/convert", compositionConversionWebhook)
 
 	r := reconciler.NewReconciler(mgr,
@@ -112,6 +142,7 @@ func Setup(mgr ctrl.Manager, o Options) error {
 			recorder:    recorder,
 			pluralizer:  o.Pluralizer,
 			certManager: o.CertManager,
+			limits:      o.ArchiveLimits,
 		}),
 		reconciler.WithTimeout(reconcileTimeout),
 		reconciler.WithPollInterval(o.ControllerOptions.PollInterval),
@@ -193,6 +224,7 @@ type connector struct {
 	recorder    record.EventRecorder
 	pluralizer  pluralizerlib.PluralizerInterface
 	certManager certificates.CertManagerInterface
+	limits      tgzfs.Limits
 }
 
 func (c *connector) Connect(ctx context.Context, mg resource.Managed) (reconciler.ExternalClient, error) {
@@ -211,6 +243,7 @@ func (c *connector) Connect(ctx context.Context, mg resource.Managed) (reconcile
 		rec:         c.recorder,
 		pluralizer:  c.pluralizer,
 		certManager: c.certManager,
+		limits:      c.limits,
 	}, nil
 }
 
@@ -222,6 +255,7 @@ type external struct {
 	rec         record.EventRecorder
 	pluralizer  pluralizerlib.PluralizerInterface
 	certManager certificates.CertManagerInterface
+	limits      tgzfs.Limits
 }
 
 func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler.ExternalObservation, error) {
@@ -235,17 +269,22 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 
 	log.Info("Observing CompositionDefinition")
 
-	pkgInfo, dir, err := chart.ChartInfoFromSpec(ctx, e.kube, cr.Spec.Chart)
+	if err := e.observeConversionRules(cr, deleted); err != nil {
+		return reconciler.ExternalObservation{}, err
+	}
+
+	pkg, err := e.fetchChart(ctx, cr)
 	if err != nil {
 		return reconciler.ExternalObservation{}, fmt.Errorf("error getting chart info: %w", err)
 	}
+	pkgInfo, dir := pkg.FS(), pkg.RootDir()
 
-	pkg, err := chartfs.ForSpec(ctx, e.kube, cr.Spec.Chart)
+	names, err := chart.CRDNames(pkgInfo, dir, cr.Spec.CRD)
 	if err != nil {
 		return reconciler.ExternalObservation{}, err
 	}
-
-	chartGVK, err := chartfs.GroupVersionKind(pkg)
+	chartGVK := names.GVK
+	genOpts, err := crdopts.Generate(pkgInfo, dir, cr, names)
 	if err != nil {
 		return reconciler.ExternalObservation{}, err
 	}
@@ -254,7 +293,7 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		return reconciler.ExternalObservation{}, fmt.Errorf("error getting spec schema: %w", err)
 	}
 
-	gvr, err := e.pluralizer.GVKtoGVR(chartGVK)
+	gvr, err := e.resolveGVR(ctx, names)
 	if err != nil {
 		if deleted {
 			if apierrors.IsNotFound(err) {
@@ -269,7 +308,7 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		}
 
 		if apierrors.IsNotFound(err) {
-			gvr, err = crdutils.GetGVRFromGeneratedCRD(specSchemaBytes, chartGVK)
+			gvr, err = crdutils.GetGVRFromGeneratedCRD(specSchemaBytes, chartGVK, genOpts)
 			if err != nil {
 				return reconciler.ExternalObservation{}, fmt.Errorf("error getting GVR from generated CRD for GVR fallback: %w", err)
 			}
@@ -308,7 +347,7 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		}, nil
 	}
 
-	genCRD, err := crdutils.GenerateCRD(specSchemaBytes, chartGVK)
+	genCRD, err := generateCRD(cr, specSchemaBytes, chartGVK, genOpts)
 	if err != nil {
 		return reconciler.ExternalObservation{}, fmt.Errorf("error generating CRD: %w", err)
 	}
@@ -326,6 +365,41 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		}, nil
 	}
 
+	drift := crdclient.Drift(crd, genCRD, crdclient.ApplyOpts{
+		CABundle:                e.certManager.GetCABundle(),
+		WebhookServiceNamespace: e.certManager.GetServiceNamespace(),
+		WebhookServiceName:      e.certManager.GetServiceName(),
+	})
+	if len(drift) > 0 {
+		log.Debug("CRD drifted from the chart", "gvr", gvr.String(), "drift", drift)
+		cr.SetConditions(crdDrifted(drift))
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+	cr.SetConditions(crdInSync())
+
+	if !crdutils.StorageMigrated(crd) && !storageHeld(cr, crd) {
+		log.Debug("Stored compositions not migrated to the storage version", "gvr", gvr.String(), "storedVersions", crd.Status.StoredVersions)
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+
+	plan, err := e.retentionPlan(ctx, cr, crd, gvr.Version)
+	if err != nil {
+		return reconciler.ExternalObservation{}, err
+	}
+	if !plan.Empty() {
+		log.Debug("CRD versions outside the retention policy", "gvr", gvr.String(), "unserve", plan.Unserve, "remove", plan.Remove)
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+
 	// Certificate management is now handled by a separate CertificateReconciler
 	// that runs independently on a periodic schedule.
 
@@ -344,6 +418,7 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		DiscoveryClient:        memory.NewMemCacheClient(e.client.Discovery()),
 		KubeClient:             e.kube,
 		Namespace:              cr.Namespace,
+		Scope:                  crdopts.Scope(cr),
 		GVR:                    gvr,
 		Spec:                   cr.Spec.Chart.DeepCopy(),
 		DeploymentTemplatePath: CDCtemplateDeploymentPath,
@@ -402,12 +477,18 @@ func (e *external) Create(ctx context.Context, mg resource.Managed) error {
 
 	log.Info("Creating CompositionDefinition")
 
-	pkg, dir, err := chart.ChartInfoFromSpec(ctx, e.kube, cr.Spec.Chart)
+	pkgFS, err := e.fetchChart(ctx, cr)
 	if err != nil {
 		return err
 	}
+	pkg, dir := pkgFS.FS(), pkgFS.RootDir()
 
-	gvk, err := chart.ChartGroupVersionKind(pkg, dir)
+	names, err := chart.CRDNames(pkg, dir, cr.Spec.CRD)
+	if err != nil {
+		return err
+	}
+	gvk := names.GVK
+	genOpts, err := crdopts.Generate(pkg, dir, cr, names)
 	if err != nil {
 		return err
 	}
@@ -416,7 +497,7 @@ func (e *external) Create(ctx context.Context, mg resource.Managed) error {
 	if err != nil {
 		return fmt.Errorf("error getting JSON schema: %w", err)
 	}
-	crd, err := crdutils.GenerateCRD(specSchemaBytes, gvk)
+	crd, err := generateCRD(cr, specSchemaBytes, gvk, genOpts)
 	if err != nil {
 		return fmt.Errorf("error generating CRD: %w", err)
 	}
@@ -428,6 +509,7 @@ func (e *external) Create(ctx context.Context, mg resource.Managed) error {
 		CABundle:                e.certManager.GetCABundle(),
 		WebhookServiceNamespace: e.certManager.GetServiceNamespace(),
 		WebhookServiceName:      e.certManager.GetServiceName(),
+		Covered:                 coveredBy(cr),
 	})
 	if err != nil {
 		return fmt.Errorf("error applying or updating CRD: %w", err)
@@ -441,6 +523,7 @@ func (e *external) Create(ctx context.Context, mg resource.Managed) error {
 		DiscoveryClient:        memory.NewMemCacheClient(e.client.Discovery()),
 		KubeClient:             e.kube,
 		Namespace:              cr.Namespace,
+		Scope:                  crdopts.Scope(cr),
 		GVR:                    gvr,
 		Spec:                   cr.Spec.Chart.DeepCopy(),
 		DeploymentTemplatePath: CDCtemplateDeploymentPath,
@@ -477,16 +560,18 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 
 	log.Info("Updating CompositionDefinition")
 
-	pkg, dir, err := chart.ChartInfoFromSpec(ctx, e.kube, cr.Spec.Chart)
+	pkgFS, err := e.fetchChart(ctx, cr)
 	if err != nil {
 		return fmt.Errorf("error getting chart info: %w", err)
 	}
-	pkgFS, err := chartfs.ForSpec(ctx, e.kube, cr.Spec.Chart)
+	pkg, dir := pkgFS.FS(), pkgFS.RootDir()
+
+	names, err := chart.CRDNames(pkg, dir, cr.Spec.CRD)
 	if err != nil {
 		return err
 	}
-
-	gvk, err := chart.ChartGroupVersionKind(pkg, dir)
+	gvk := names.GVK
+	genOpts, err := crdopts.Generate(pkg, dir, cr, names)
 	if err != nil {
 		return err
 	}
@@ -495,7 +580,7 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 	if err != nil {
 		return fmt.Errorf("error getting JSON schema: %w", err)
 	}
-	crd, err := crdutils.GenerateCRD(specSchemaBytes, gvk)
+	crd, err := generateCRD(cr, specSchemaBytes, gvk, genOpts)
 	if err != nil {
 		return fmt.Errorf("error generating CRD: %w", err)
 	}
@@ -503,10 +588,15 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 		return fmt.Errorf("error generating CRD: crd is nil")
 	}
 
+	if err := e.checkSchemaCompatibility(ctx, cr, crd, gvk); err != nil {
+		return err
+	}
+
 	gvr, err := crdclient.ApplyOrUpdateCRD(ctx, e.kube, e.dynamic, crd, crdclient.ApplyOpts{
 		CABundle:                e.certManager.GetCABundle(),
 		WebhookServiceNamespace: e.certManager.GetServiceNamespace(),
 		WebhookServiceName:      e.certManager.GetServiceName(),
+		Covered:                 coveredBy(cr),
 	})
 	if err != nil {
 		return fmt.Errorf("error applying or updating CRD: %w", err)
@@ -520,6 +610,7 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 		DiscoveryClient:        memory.NewMemCacheClient(e.client.Discovery()),
 		KubeClient:             e.kube,
 		Namespace:              cr.Namespace,
+		Scope:                  crdopts.Scope(cr),
 		GVR:                    gvr,
 		Spec:                   cr.Spec.Chart.DeepCopy(),
 		DeploymentTemplatePath: CDCtemplateDeploymentPath,
@@ -555,10 +646,11 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 					JsonSchemaTemplatePath: JSONSchemaTemplateConfigmapPath,
 					ServiceTemplatePath:    ServiceTemplatePath,
 					DynamicClient:          e.dynamic,
-					Spec:                   (*compositiondefinitionsv1alpha1.ChartInfo)(vi.Chart),
+					Spec:                   chartInfoFromProps(vi.Chart),
 					GVR:                    oldGVR,
 					KubeClient:             e.kube,
 					Namespace:              cr.Namespace,
+					Scope:                  crdopts.Scope(cr),
 					SkipCRD:                true,
 				})
 				if err != nil {
@@ -577,13 +669,118 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 		log.Debug("Updated compositions version", "gvr", oldGVR.String())
 	}
 
-	if err := status.RefreshCompositionDefinitionStatus(cr, crd, gvr, gvk, pkgFS.PackageURL()); err != nil {
+	migration, err := crdclient.MigrateStorage(ctx, e.kube, e.dynamic, gvr.GroupResource(), status.StorageMigrationProgress(cr), coveredBy(cr))
+	status.UpdateStorageMigration(cr, migration, err)
+	e.observeStorageMigration(cr, migration)
+	if err != nil {
+		return fmt.Errorf("error migrating stored compositions: %w", err)
+	}
+	log.Debug("Storage migration progress", "storageVersion", migration.StorageVersion, "migrated", migration.Migrated, "total", migration.Total, "done", migration.Done)
+
+	liveCRD, err := crdclient.Get(ctx, e.kube, gvr.GroupResource())
+	if err != nil {
+		return fmt.Errorf("error getting CRD: %w", err)
+	}
+	if liveCRD == nil {
+		return fmt.Errorf("error getting CRD: crd %s not found", gvr.GroupResource().String())
+	}
+
+	plan, err := e.retentionPlan(ctx, cr, liveCRD, gvr.Version)
+	if err != nil {
+		return err
+	}
+	if err := retention.Apply(ctx, e.kube, liveCRD, plan); err != nil {
+		return err
+	}
+
+	if err := status.RefreshCompositionDefinitionStatus(cr, liveCRD, gvr, gvk, pkgFS.PackageURL()); err != nil {
 		return fmt.Errorf("error refreshing CompositionDefinition status: %w", err)
 	}
 
 	return nil
 }
 
+// retentionPlan computes the CRD versions outside the version retention policy of the CompositionDefinition.
+// The version of the chart and the versions of the other CompositionDefinitions of the same kind are pinned.
+func (e *external) retentionPlan(ctx context.Context, cr *compositiondefinitionsv1alpha1.CompositionDefinition, crd *apiextensionsv1.CustomResourceDefinition, version string) (retention.Plan, error) {
+	if cr.Spec.VersionRetention == nil {
+		return retention.Plan{}, nil
+	}
+
+	lst, err := getters.GetCompositionDefinitions(ctx, e.kube, schema.GroupKind{
+		Group: crd.Spec.Group,
+		Kind:  crd.Spec.Names.Kind,
+	})
+	if err != nil {
+		return retention.Plan{}, fmt.Errorf("error getting CompositionDefinitions: %w", err)
+	}
+
+	pinned := []string{version}
+	for i := range lst {
+		if lst[i].UID == cr.UID {
+			continue
+		}
+		pinned = append(pinned, schema.FromAPIVersionAndKind(lst[i].Status.ApiVersion, lst[i].Status.Kind).Version)
+	}
+
+	plan, err := retention.Compute(ctx, e.dynamic, crd, cr.Spec.VersionRetention, pinned)
+	if err != nil {
+		return retention.Plan{}, fmt.Errorf("error computing version retention: %w", err)
+	}
+	return plan, nil
+}
+
+// chartInfoFromProps returns the chart of a version recorded in the status. Verification is not recorded:
+// the chart is only used to undeploy the version.
+func chartInfoFromProps(props *compositiondefinitionsv1alpha1.ChartInfoProps) *compositiondefinitionsv1alpha1.ChartInfo {
+	if props == nil {
+		return nil
+	}
+	return &compositiondefinitionsv1alpha1.ChartInfo{
+		Url:                   props.Url,
+		Version:               props.Version,
+		Repo:                  props.Repo,
+		InsecureSkipVerifyTLS: props.InsecureSkipVerifyTLS,
+		Credentials:           props.Credentials,
+		BearerTokenRef:        props.BearerTokenRef,
+		PullSecretRef:         props.PullSecretRef,
+		TLS:                   props.TLS,
+	}
+}
+
+// generateCRD generates the CRD of the CompositionDefinition and reports whether its CEL validation rules compile.
+func generateCRD(cr *compositiondefinitionsv1alpha1.CompositionDefinition, specSchema []byte, gvk schema.GroupVersionKind, opts crdutils.GenerateOpts) (*apiextensionsv1.CustomResourceDefinition, error) {
+	crd, err := crdutils.GenerateCRD(specSchema, gvk, opts)
+	var rulesErr *celrules.Error
+	if errors.As(err, &rulesErr) {
+		cr.SetConditions(validationRulesInvalid(rulesErr.Errs))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr.SetConditions(validationRulesValid())
+	return crd, nil
+}
+
+// resolveGVR returns the resource of the generated CRD. A configured plural is used as is,
+// otherwise the plural is looked up through the pluralizer. Both report a not found error when the CRD does not exist.
+func (e *external) resolveGVR(ctx context.Context, names chart.Names) (schema.GroupVersionResource, error) {
+	if names.Plural == "" {
+		return e.pluralizer.GVKtoGVR(names.GVK)
+	}
+
+	gvr := names.GVK.GroupVersion().WithResource(names.Plural)
+	crd, err := crdclient.Get(ctx, e.kube, gvr.GroupResource())
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	if crd == nil {
+		return schema.GroupVersionResource{}, apierrors.NewNotFound(gvr.GroupResource(), gvr.Resource)
+	}
+	return gvr, nil
+}
+
 func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
 	cr, ok := mg.(*compositiondefinitionsv1alpha1.CompositionDefinition)
 	if !ok {
@@ -594,19 +791,21 @@ func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
 
 	cr.SetConditions(rtv1.Deleting())
 
-	pkg, dir, err := chart.ChartInfoFromSpec(ctx, e.kube, cr.Spec.Chart)
+	pkgFS, err := e.fetchChart(ctx, cr)
 	if err != nil {
 		return fmt.Errorf("error getting chart info: %w", err)
 	}
+	pkg, dir := pkgFS.FS(), pkgFS.RootDir()
 
-	gvk, err := chart.ChartGroupVersionKind(pkg, dir)
+	names, err := chart.CRDNames(pkg, dir, cr.Spec.CRD)
 	if err != nil {
 		return fmt.Errorf("error getting chart GVK: %w", err)
 	}
+	gvk := names.GVK
 
 	var gvr schema.GroupVersionResource
 	crdExist := true
-	gvr, err = e.pluralizer.GVKtoGVR(gvk)
+	gvr, err = e.resolveGVR(ctx, names)
 	if apierrors.IsNotFound(err) {
 		crdExist = false
 		log.Debug("Plural not found, CRD not found, skipping deletion", "gvk", gvk.String())
@@ -671,6 +870,7 @@ func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
 			KubeClient:             e.kube,
 			GVR:                    gvr,
 			Namespace:              cr.Namespace,
+			Scope:                  crdopts.Scope(cr),
 			SkipCRD:                skipCRD,
 			DynamicClient:          e.dynamic,
 			RBACFolderPath:         CDCrbacConfigFolder,
@@ -113,6 +113,15 @@ func TestMain(m *testing.M) {
 				return ctx, err
 			}
 
+			err = os.MkdirAll(filepath.Join(os.TempDir(), "assets", "validating-webhook-configuration"), os.ModePerm)
+			if err != nil {
+				return ctx, err
+			}
+			err = os.Link(filepath.Join(manifestsPath, "validating-webhook.yaml"), filepath.Join(os.TempDir(), "assets", "validating-webhook-configuration", "validating-webhook.yaml"))
+			if err != nil {
+				return ctx, err
+			}
+
 			err = os.MkdirAll(filepath.Join(os.TempDir(), "assets", "cdc-deployment"), os.ModePerm)
 			if err != nil {
 				return ctx, err
@@ -510,8 +519,8 @@ func TestController(t *testing.T) {
 			}
 
 			// Check CRD version
-			if len(crd.Spec.Versions) != 3 {
-				t.Fatalf("Expected 3 versions, got %d", len(crd.Spec.Versions))
+			if len(crd.Spec.Versions) != 2 {
+				t.Fatalf("Expected 2 versions, got %d", len(crd.Spec.Versions))
 			}
 			if !slices.ContainsFunc(crd.Spec.Versions, func(v apiextensionsv1.CustomResourceDefinitionVersion) bool {
 				return v.Name == newVersionNormalized
@@ -524,9 +533,9 @@ func TestController(t *testing.T) {
 				t.Fatalf("Expected version %s, got %v", oldVersionNormalized, crd.Spec.Versions)
 			}
 			if !slices.ContainsFunc(crd.Spec.Versions, func(v apiextensionsv1.CustomResourceDefinitionVersion) bool {
-				return v.Name == "vacuum"
+				return v.Name == newVersionNormalized && v.Storage
 			}) {
-				t.Fatalf("Expected version vacuum, got %v", crd.Spec.Versions)
+				t.Fatalf("Expected storage version %s, got %v", newVersionNormalized, crd.Spec.Versions)
 			}
 
 		}
@@ -0,0 +1,227 @@
+package compositiondefinitions
+
+import (
+	"fmt"
+	"strings"
+
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TypeSchemaCompatible reports whether the spec schema of the chart is compatible with the previous version.
+	TypeSchemaCompatible rtv1.ConditionType = "SchemaCompatible"
+	// TypeCRDInSync reports whether the generated CRD matches the one produced from the chart.
+	TypeCRDInSync rtv1.ConditionType = "CRDInSync"
+	// TypeValidationRulesValid reports whether the CEL validation rules of the generated CRD compile.
+	TypeValidationRulesValid rtv1.ConditionType = "ValidationRulesValid"
+	// TypeChartVerified reports whether the chart passed the verification configured in spec.chart.verify.
+	TypeChartVerified rtv1.ConditionType = "ChartVerified"
+	// TypeChartContentChanged reports whether the content of the chart changed under the same version,
+	// or does not match the digest pinned in spec.chart.digest.
+	TypeChartContentChanged rtv1.ConditionType = "ChartContentChanged"
+	// TypeChartArchiveValid is set to False when the chart archive is rejected for exceeding the archive limits
+	// or holding unsafe entries. It is removed once a valid archive is read.
+	TypeChartArchiveValid rtv1.ConditionType = "ChartArchiveValid"
+	// TypeConversionRulesValid is set to False when the rules of spec.conversions are not valid.
+	// It is removed once the rules are valid.
+	TypeConversionRulesValid rtv1.ConditionType = "ConversionRulesValid"
+	// TypeStorageMigrationSafe is set to False while the storage is held on the vacuum version, because the latest
+	// version drops fields of the other versions that the conversion rules do not carry. It is removed once the
+	// storage can be migrated.
+	TypeStorageMigrationSafe rtv1.ConditionType = "StorageMigrationSafe"
+	// TypeUpgradeAvailable reports whether a newer chart version matching the range in spec.chart.version is not applied.
+	TypeUpgradeAvailable rtv1.ConditionType = "UpgradeAvailable"
+
+	ReasonSchemaCompatible       rtv1.ConditionReason = "Compatible"
+	ReasonBreakingChanges        rtv1.ConditionReason = "BreakingChanges"
+	ReasonBreakingChangeApproved rtv1.ConditionReason = "BreakingChangesApproved"
+
+	ReasonCRDInSync  rtv1.ConditionReason = "InSync"
+	ReasonCRDDrifted rtv1.ConditionReason = "Drifted"
+
+	ReasonValidationRulesCompiled rtv1.ConditionReason = "Compiled"
+	ReasonInvalidValidationRules  rtv1.ConditionReason = "InvalidRules"
+
+	ReasonChartVerified           rtv1.ConditionReason = "Verified"
+	ReasonChartVerificationFailed rtv1.ConditionReason = "VerificationFailed"
+
+	ReasonChartUnchanged      rtv1.ConditionReason = "Unchanged"
+	ReasonChartContentChanged rtv1.ConditionReason = "ContentChanged"
+	ReasonChartDigestMismatch rtv1.ConditionReason = "DigestMismatch"
+
+	ReasonChartArchiveRejected rtv1.ConditionReason = "Rejected"
+
+	ReasonInvalidConversionRules rtv1.ConditionReason = "InvalidConversionRules"
+
+	ReasonFieldsDropped rtv1.ConditionReason = "FieldsDropped"
+
+	ReasonUpToDate                 rtv1.ConditionReason = "UpToDate"
+	ReasonUpgradeHeldByPolicy      rtv1.ConditionReason = "HeldByPolicy"
+	ReasonOutsideMaintenanceWindow rtv1.ConditionReason = "OutsideMaintenanceWindow"
+)
+
+func schemaCompatible() rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeSchemaCompatible,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSchemaCompatible,
+	}
+}
+
+func schemaBreakingChanges(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeSchemaCompatible,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonBreakingChanges,
+		Message:            msg,
+	}
+}
+
+func schemaBreakingChangesApproved(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeSchemaCompatible,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonBreakingChangeApproved,
+		Message:            msg,
+	}
+}
+
+func crdInSync() rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeCRDInSync,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCRDInSync,
+	}
+}
+
+func crdDrifted(drift []string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeCRDInSync,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCRDDrifted,
+		Message:            fmt.Sprintf("CRD differs from the chart: %s", strings.Join(drift, ", ")),
+	}
+}
+
+func validationRulesValid() rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeValidationRulesValid,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonValidationRulesCompiled,
+	}
+}
+
+func validationRulesInvalid(errs []string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeValidationRulesValid,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInvalidValidationRules,
+		Message:            strings.Join(errs, "; "),
+	}
+}
+
+func chartVerified(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartVerified,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartVerified,
+		Message:            msg,
+	}
+}
+
+func chartVerificationFailed(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartVerified,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartVerificationFailed,
+		Message:            msg,
+	}
+}
+
+func chartUnchanged() rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartContentChanged,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartUnchanged,
+	}
+}
+
+func chartContentChanged(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartContentChanged,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartContentChanged,
+		Message:            msg,
+	}
+}
+
+func chartDigestMismatch(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartContentChanged,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartDigestMismatch,
+		Message:            msg,
+	}
+}
+
+func chartArchiveRejected(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeChartArchiveValid,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartArchiveRejected,
+		Message:            msg,
+	}
+}
+
+func conversionRulesInvalid(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeConversionRulesValid,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInvalidConversionRules,
+		Message:            msg,
+	}
+}
+
+func storageMigrationHeld(msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeStorageMigrationSafe,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonFieldsDropped,
+		Message:            msg,
+	}
+}
+
+func upgradeNotAvailable() rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeUpgradeAvailable,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUpToDate,
+	}
+}
+
+func upgradeAvailable(reason rtv1.ConditionReason, msg string) rtv1.Condition {
+	return rtv1.Condition{
+		Type:               TypeUpgradeAvailable,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            msg,
+	}
+}
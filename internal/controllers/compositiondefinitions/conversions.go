@@ -0,0 +1,70 @@
+package compositiondefinitions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/conversionrules"
+	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// observeConversionRules reports invalid conversion rules in the conditions of the CompositionDefinition. The same
+// rules are rejected the same way until the spec changes, so the error is terminal. A CompositionDefinition being
+// deleted does not serve conversions anymore and is not checked.
+func (e *external) observeConversionRules(cr *compositiondefinitionsv1alpha1.CompositionDefinition, deleted bool) error {
+	if deleted {
+		return nil
+	}
+	if err := conversionrules.Validate(cr.Spec.Conversions); err != nil {
+		msg := fmt.Sprintf("invalid conversion rules: %s", err)
+		cr.SetConditions(conversionRulesInvalid(msg))
+		e.event(cr, corev1.EventTypeWarning, string(ReasonInvalidConversionRules), msg)
+		return reconcile.TerminalError(fmt.Errorf("error validating conversion rules: %w", err))
+	}
+	cr.Status.Conditions = slices.DeleteFunc(cr.Status.Conditions, func(c rtv1.Condition) bool {
+		return c.Type == TypeConversionRulesValid
+	})
+	return nil
+}
+
+// coveredBy returns the function reporting whether the conversion rules of cr carry a field of the objects of a
+// version to another, so that storing them in the other version does not prune it.
+func coveredBy(cr *compositiondefinitionsv1alpha1.CompositionDefinition) func(from, to, path string) bool {
+	rules := cr.Spec.Conversions
+	return func(from, to, path string) bool {
+		return conversionrules.Covers(rules, from, to, path)
+	}
+}
+
+// storageHeld reports whether the storage of crd is held on the vacuum version for fields that the conversion rules
+// of cr do not carry. The storage migration waits for the rules to change, which does not leave cr out of date.
+func storageHeld(cr *compositiondefinitionsv1alpha1.CompositionDefinition, crd *apiextensionsv1.CustomResourceDefinition) bool {
+	return generation.StorageVersion(crd) == generation.VacuumVersion &&
+		len(generation.DroppedFields(crd, generation.LatestVersion(crd), coveredBy(cr))) > 0
+}
+
+// observeStorageMigration reports in the conditions of the CompositionDefinition a storage held on the vacuum
+// version, with an event when the fields it is held for change.
+func (e *external) observeStorageMigration(cr *compositiondefinitionsv1alpha1.CompositionDefinition, res crdclient.MigrationResult) {
+	if len(res.Held) == 0 {
+		cr.Status.Conditions = slices.DeleteFunc(cr.Status.Conditions, func(c rtv1.Condition) bool {
+			return c.Type == TypeStorageMigrationSafe
+		})
+		return
+	}
+
+	msg := fmt.Sprintf("storage is held on the %s version: version %s drops fields that the conversion rules do not carry: %s",
+		generation.VacuumVersion, res.StorageVersion, strings.Join(res.Held, ", "))
+	if c := cr.GetCondition(TypeStorageMigrationSafe); c.Status != metav1.ConditionFalse || c.Message != msg {
+		e.event(cr, corev1.EventTypeWarning, string(ReasonFieldsDropped), msg)
+	}
+	cr.SetConditions(storageMigrationHeld(msg))
+}
@@ -0,0 +1,96 @@
+package compositiondefinitions
+
+import (
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestObserveConversionRules(t *testing.T) {
+	cr := newTestCompositionDefinition()
+	cr.Spec.Conversions = []compositiondefinitionsv1alpha1.ConversionRule{{
+		From: "v1-0-0", To: "v1-1-0",
+		Operations: []compositiondefinitionsv1alpha1.ConversionOperation{
+			{Type: compositiondefinitionsv1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.c"},
+			{Type: compositiondefinitionsv1alpha1.ConversionOperationMove, Path: "spec.b", To: "spec.c"},
+		},
+	}}
+
+	e := &external{}
+	assert.NoError(t, e.observeConversionRules(cr, true), "deleted definitions are not checked")
+
+	err := e.observeConversionRules(cr, false)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, reconcile.TerminalError(nil))
+	cond := cr.GetCondition(TypeConversionRulesValid)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, ReasonInvalidConversionRules, cond.Reason)
+	assert.Contains(t, cond.Message, "spec.c")
+
+	cr.Spec.Conversions[0].Operations = cr.Spec.Conversions[0].Operations[:1]
+	require.NoError(t, e.observeConversionRules(cr, false))
+	assert.Equal(t, metav1.ConditionUnknown, cr.GetCondition(TypeConversionRulesValid).Status)
+}
+
+func TestObserveStorageMigration(t *testing.T) {
+	cr := newTestCompositionDefinition()
+	recorder := events.NewFakeRecorder(10)
+	e := &external{rec: recorder}
+
+	held := crdclient.MigrationResult{StorageVersion: "v1-1-0", Held: []string{"v1-0-0 spec.legacy"}}
+	e.observeStorageMigration(cr, held)
+	cond := cr.GetCondition(TypeStorageMigrationSafe)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, ReasonFieldsDropped, cond.Reason)
+	assert.Contains(t, cond.Message, "v1-0-0 spec.legacy")
+	require.Len(t, recorder.Events, 1)
+
+	// The event is not emitted again while the storage is held for the same fields
+	<-recorder.Events
+	e.observeStorageMigration(cr, held)
+	assert.Empty(t, recorder.Events)
+
+	e.observeStorageMigration(cr, crdclient.MigrationResult{StorageVersion: "v1-1-0"})
+	assert.Equal(t, metav1.ConditionUnknown, cr.GetCondition(TypeStorageMigrationSafe).Status)
+}
+
+func TestStorageHeld(t *testing.T) {
+	schemaOf := func(names ...string) *apiextensionsv1.CustomResourceValidation {
+		spec := apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{}}
+		for _, el := range names {
+			spec.Properties[el] = apiextensionsv1.JSONSchemaProps{Type: "string"}
+		}
+		return &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": spec},
+		}}
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true, Schema: schemaOf("name", "legacy")},
+				{Name: "v1-1-0", Served: true, Schema: schemaOf("name")},
+			},
+		},
+	}
+	generation.HoldStorage(crd)
+
+	cr := newTestCompositionDefinition()
+	assert.True(t, storageHeld(cr, crd))
+
+	cr.Spec.Conversions = []compositiondefinitionsv1alpha1.ConversionRule{{
+		From: "v1-0-0", To: "v1-1-0",
+		Operations: []compositiondefinitionsv1alpha1.ConversionOperation{
+			{Type: compositiondefinitionsv1alpha1.ConversionOperationDrop, Path: "spec.legacy"},
+		},
+	}}
+	assert.False(t, storageHeld(cr, crd), "the dropped field is preserved by the conversion rules")
+}
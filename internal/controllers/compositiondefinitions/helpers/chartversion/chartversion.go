@@ -0,0 +1,159 @@
+package chartversion
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Selection is the chart version selected for a version range.
+type Selection struct {
+	// Version is the version to use.
+	Version *semver.Version
+	// Newer lists the published versions newer than Version, without the prereleases outside the range.
+	Newer []*semver.Version
+	// Held is the newest version matching the range that is not applied, if any.
+	Held *semver.Version
+	// OutsideWindow tells that Held waits for the next maintenance window, rather than being held by the upgrade policy.
+	OutsideWindow bool
+}
+
+// RangeError reports a version range that cannot be resolved whatever the chart source answers: the range is
+// invalid, or no published version of the chart matches it.
+type RangeError struct {
+	msg string
+}
+
+func (e *RangeError) Error() string {
+	return e.msg
+}
+
+// Resolve selects the version of the chart for the version range of nfo, following its upgrade policy and
+// maintenance windows at now. resolved is the version in use, empty before the range is resolved for the first time.
+func Resolve(ctx context.Context, kube client.Client, nfo *compositiondefinitionsv1alpha1.ChartInfo, resolved string, now time.Time) (Selection, error) {
+	constraint, err := semver.NewConstraint(nfo.Version)
+	if err != nil {
+		return Selection{}, &RangeError{msg: fmt.Sprintf("invalid chart version range %q: %s", nfo.Version, err)}
+	}
+	published, err := chart.Versions(ctx, kube, nfo)
+	if err != nil {
+		return Selection{}, fmt.Errorf("failed to list chart versions: %w", err)
+	}
+	var current *semver.Version
+	if resolved != "" {
+		current, _ = semver.NewVersion(resolved)
+	}
+	inWindow, err := InMaintenanceWindow(nfo.MaintenanceWindows, now)
+	if err != nil {
+		return Selection{}, err
+	}
+
+	sel, err := Select(constraint, published, current, nfo.UpgradePolicy, inWindow)
+	if err != nil {
+		return Selection{}, &RangeError{msg: fmt.Sprintf("no published version of chart %s matches %q", nfo.Url, nfo.Version)}
+	}
+	return sel, nil
+}
+
+// Select selects the version to use among the published ones for the range. Without a current version,
+// or when the current version no longer matches the range, the newest matching version is selected.
+// Otherwise the current version is upgraded only to the newest matching version allowed by the policy,
+// and only within a maintenance window.
+func Select(constraint *semver.Constraints, published []*semver.Version, current *semver.Version, policy compositiondefinitionsv1alpha1.UpgradePolicy, inWindow bool) (Selection, error) {
+	var latest *semver.Version
+	for _, v := range published {
+		if constraint.Check(v) && (latest == nil || v.GreaterThan(latest)) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return Selection{}, fmt.Errorf("no published version matches the range")
+	}
+
+	sel := Selection{Version: latest}
+	if current != nil && constraint.Check(current) && !latest.Equal(current) {
+		sel.Version = current
+		for _, v := range published {
+			if constraint.Check(v) && v.GreaterThan(sel.Version) && allowedUpgrade(current, v, policy) {
+				sel.Version = v
+			}
+		}
+		if !sel.Version.Equal(current) && !inWindow {
+			sel.Version, sel.Held, sel.OutsideWindow = current, latest, true
+		}
+		if sel.Held == nil && !sel.Version.Equal(latest) {
+			sel.Held = latest
+		}
+	}
+
+	for _, v := range published {
+		if v.GreaterThan(sel.Version) && (v.Prerelease() == "" || constraint.Check(v)) {
+			sel.Newer = append(sel.Newer, v)
+		}
+	}
+	return sel, nil
+}
+
+// allowedUpgrade reports whether the policy applies the upgrade from current to v automatically.
+func allowedUpgrade(current, v *semver.Version, policy compositiondefinitionsv1alpha1.UpgradePolicy) bool {
+	switch policy {
+	case compositiondefinitionsv1alpha1.UpgradePolicyPatch:
+		return v.Major() == current.Major() && v.Minor() == current.Minor()
+	case compositiondefinitionsv1alpha1.UpgradePolicyMinor:
+		return v.Major() == current.Major()
+	default:
+		return false
+	}
+}
+
+// InMaintenanceWindow reports whether t falls within one of the windows, always true without windows.
+func InMaintenanceWindow(windows []compositiondefinitionsv1alpha1.MaintenanceWindow, t time.Time) (bool, error) {
+	if len(windows) == 0 {
+		return true, nil
+	}
+	for _, w := range windows {
+		loc := time.UTC
+		if w.TimeZone != "" {
+			var err error
+			if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+				return false, fmt.Errorf("invalid maintenance window time zone %q: %w", w.TimeZone, err)
+			}
+		}
+		hour, minute, err := parseClock(w.Start)
+		if err != nil {
+			return false, err
+		}
+
+		// A window may have opened on one of the previous days and still be open.
+		local := t.In(loc)
+		for back := 0; back <= int(w.Duration.Duration/(24*time.Hour))+1; back++ {
+			day := local.AddDate(0, 0, -back)
+			if len(w.Days) > 0 && !slices.Contains(w.Days, compositiondefinitionsv1alpha1.Weekday(day.Weekday().String())) {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+			if !t.Before(start) && t.Before(start.Add(w.Duration.Duration)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func parseClock(s string) (int, int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	hour, herr := strconv.Atoi(hh)
+	minute, merr := strconv.Atoi(mm)
+	if !ok || herr != nil || merr != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid maintenance window start %q, expected HH:MM", s)
+	}
+	return hour, minute, nil
+}
@@ -0,0 +1,204 @@
+package chartversion
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectVersion(t *testing.T) {
+	var published []*semver.Version
+	for _, v := range []string{"1.3.0", "1.4.0", "1.4.1", "1.4.2", "1.5.0", "1.6.0-rc.1", "2.0.0"} {
+		published = append(published, semver.MustParse(v))
+	}
+
+	tests := []struct {
+		name       string
+		constraint string
+		current    string
+		policy     compositiondefinitionsv1alpha1.UpgradePolicy
+		outside    bool
+		version    string
+		held       string
+		newer      []string
+	}{
+		{
+			name:       "First resolution selects the newest matching version",
+			constraint: "~1.4",
+			version:    "1.4.2",
+			newer:      []string{"1.5.0", "2.0.0"},
+		},
+		{
+			name:       "Manual policy keeps the current version",
+			constraint: ">=1.0 <2.0",
+			current:    "1.4.0",
+			version:    "1.4.0",
+			held:       "1.5.0",
+			newer:      []string{"1.4.1", "1.4.2", "1.5.0", "2.0.0"},
+		},
+		{
+			name:       "Patch policy applies patch versions only",
+			constraint: ">=1.0 <2.0",
+			current:    "1.4.0",
+			policy:     compositiondefinitionsv1alpha1.UpgradePolicyPatch,
+			version:    "1.4.2",
+			held:       "1.5.0",
+			newer:      []string{"1.5.0", "2.0.0"},
+		},
+		{
+			name:       "Minor policy applies minor versions",
+			constraint: ">=1.0 <2.0",
+			current:    "1.4.0",
+			policy:     compositiondefinitionsv1alpha1.UpgradePolicyMinor,
+			version:    "1.5.0",
+			newer:      []string{"2.0.0"},
+		},
+		{
+			name:       "Upgrades wait for the maintenance window",
+			constraint: ">=1.0 <2.0",
+			current:    "1.4.0",
+			policy:     compositiondefinitionsv1alpha1.UpgradePolicyMinor,
+			outside:    true,
+			version:    "1.4.0",
+			held:       "1.5.0",
+			newer:      []string{"1.4.1", "1.4.2", "1.5.0", "2.0.0"},
+		},
+		{
+			name:       "A current version outside the range is replaced",
+			constraint: "^2.0",
+			current:    "1.4.0",
+			outside:    true,
+			version:    "2.0.0",
+		},
+		{
+			name:       "Prereleases are selected only when the range asks for them",
+			constraint: ">=1.6.0-0 <2.0",
+			version:    "1.6.0-rc.1",
+			newer:      []string{"2.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraint, err := semver.NewConstraint(tt.constraint)
+			require.NoError(t, err)
+			var current *semver.Version
+			if tt.current != "" {
+				current = semver.MustParse(tt.current)
+			}
+
+			sel, err := Select(constraint, published, current, tt.policy, !tt.outside)
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, sel.Version.Original())
+			if tt.held == "" {
+				assert.Nil(t, sel.Held)
+			} else {
+				require.NotNil(t, sel.Held)
+				assert.Equal(t, tt.held, sel.Held.Original())
+				assert.Equal(t, tt.outside, sel.OutsideWindow)
+			}
+			var newer []string
+			for _, v := range sel.Newer {
+				newer = append(newer, v.Original())
+			}
+			assert.Equal(t, tt.newer, newer)
+		})
+	}
+
+	constraint, err := semver.NewConstraint("^3.0")
+	require.NoError(t, err)
+	_, err = Select(constraint, published, nil, "", true)
+	assert.Error(t, err)
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	nightly := compositiondefinitionsv1alpha1.MaintenanceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	weekend := compositiondefinitionsv1alpha1.MaintenanceWindow{
+		Days:     []compositiondefinitionsv1alpha1.Weekday{"Saturday"},
+		Start:    "09:00",
+		Duration: metav1.Duration{Duration: 36 * time.Hour},
+		TimeZone: "Europe/Rome",
+	}
+
+	tests := []struct {
+		name    string
+		windows []compositiondefinitionsv1alpha1.MaintenanceWindow
+		at      time.Time
+		want    bool
+	}{
+		{name: "No windows", at: time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC), want: true},
+		{name: "Before the window", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{nightly}, at: time.Date(2026, 3, 4, 21, 59, 0, 0, time.UTC)},
+		{name: "Within the window", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{nightly}, at: time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC), want: true},
+		{name: "Past midnight", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{nightly}, at: time.Date(2026, 3, 5, 1, 59, 0, 0, time.UTC), want: true},
+		{name: "After the window", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{nightly}, at: time.Date(2026, 3, 5, 2, 0, 0, 0, time.UTC)},
+		{name: "Saturday in the time zone", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{weekend}, at: time.Date(2026, 3, 7, 8, 30, 0, 0, time.UTC), want: true},
+		{name: "Sunday evening", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{weekend}, at: time.Date(2026, 3, 8, 19, 0, 0, 0, time.UTC), want: true},
+		{name: "Monday", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{weekend}, at: time.Date(2026, 3, 9, 8, 30, 0, 0, time.UTC)},
+		{name: "Any window", windows: []compositiondefinitionsv1alpha1.MaintenanceWindow{weekend, nightly}, at: time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InMaintenanceWindow(tt.windows, tt.at)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := InMaintenanceWindow([]compositiondefinitionsv1alpha1.MaintenanceWindow{{Start: "22:00", TimeZone: "Nowhere/City"}}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	const index = `apiVersion: v1
+entries:
+  fireworksapp:
+  - name: fireworksapp
+    version: 1.3.0
+    urls: [fireworksapp-1.3.0.tgz]
+  - name: fireworksapp
+    version: 1.2.3
+    urls: [fireworksapp-1.2.3.tgz]
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(index))
+	}))
+	t.Cleanup(srv.Close)
+
+	nfo := &compositiondefinitionsv1alpha1.ChartInfo{Url: srv.URL, Repo: "fireworksapp", Version: "^1.2"}
+	ctx := context.Background()
+
+	sel, err := Resolve(ctx, nil, nfo, "", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.0", sel.Version.Original())
+
+	// The manual policy keeps the version in use
+	sel, err = Resolve(ctx, nil, nfo, "1.2.3", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", sel.Version.Original())
+	require.NotNil(t, sel.Held)
+	assert.Equal(t, "1.3.0", sel.Held.Original())
+
+	var rerr *RangeError
+	_, err = Resolve(ctx, nil, &compositiondefinitionsv1alpha1.ChartInfo{Url: srv.URL, Repo: "fireworksapp", Version: "^2.0"}, "", time.Now())
+	require.ErrorAs(t, err, &rerr)
+	assert.ErrorContains(t, err, "no published version")
+
+	_, err = Resolve(ctx, nil, &compositiondefinitionsv1alpha1.ChartInfo{Url: srv.URL, Repo: "fireworksapp", Version: ">= nope"}, "", time.Now())
+	require.ErrorAs(t, err, &rerr)
+
+	_, err = Resolve(ctx, nil, &compositiondefinitionsv1alpha1.ChartInfo{Url: srv.URL, Repo: "missing", Version: "^1.2"}, "", time.Now())
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &rerr)
+}
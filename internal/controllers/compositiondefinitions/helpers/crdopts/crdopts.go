@@ -0,0 +1,58 @@
+package crdopts
+
+import (
+	"fmt"
+	"io/fs"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/celrules"
+	crdutils "github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// Scope returns the scope of the CRD generated for the CompositionDefinition.
+func Scope(cr *compositiondefinitionsv1alpha1.CompositionDefinition) apiextensionsv1.ResourceScope {
+	if cr.Spec.CRD != nil && cr.Spec.CRD.Scope == compositiondefinitionsv1alpha1.CRDScopeCluster {
+		return apiextensionsv1.ClusterScoped
+	}
+	return apiextensionsv1.NamespaceScoped
+}
+
+// Generate returns the options of the CRD generated for the CompositionDefinition,
+// including the printer columns, validation rules and status schema declared by the chart and by the CompositionDefinition.
+func Generate(pkg fs.FS, dir string, cr *compositiondefinitionsv1alpha1.CompositionDefinition, names chart.Names) (crdutils.GenerateOpts, error) {
+	columns, err := chart.CRDPrinterColumns(pkg, dir, cr.Spec.CRD)
+	if err != nil {
+		return crdutils.GenerateOpts{}, err
+	}
+	statusSchema, err := chart.ChartStatusSchema(pkg, dir)
+	if err != nil {
+		return crdutils.GenerateOpts{}, fmt.Errorf("error getting status schema: %w", err)
+	}
+	validations := make([]celrules.Rule, 0, len(cr.Spec.Validations))
+	for _, el := range cr.Spec.Validations {
+		path := el.Path
+		if path == "" {
+			path = "spec"
+		}
+		validations = append(validations, celrules.Rule{
+			Path: path,
+			ValidationRule: apiextensionsv1.ValidationRule{
+				Rule:              el.Rule,
+				Message:           el.Message,
+				MessageExpression: el.MessageExpression,
+				FieldPath:         el.FieldPath,
+			},
+		})
+	}
+	return crdutils.GenerateOpts{
+		Plural:         names.Plural,
+		Scope:          Scope(cr),
+		ShortNames:     names.ShortNames,
+		Categories:     names.Categories,
+		PrinterColumns: columns,
+		Validations:    validations,
+		StatusSchema:   statusSchema,
+	}, nil
+}
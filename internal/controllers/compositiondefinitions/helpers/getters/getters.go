@@ -33,9 +33,15 @@ const (
 var retryWait = retry.Wait
 
 func GetCompositions(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource) (*unstructured.UnstructuredList, error) {
+	return GetCompositionsForVersion(ctx, dyn, gvr, gvr.Version)
+}
+
+// GetCompositionsForVersion lists, through gvr, the compositions labeled with the given composition version.
+// It allows to look up the compositions of a version that is no longer served.
+func GetCompositionsForVersion(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, version string) (*unstructured.UnstructuredList, error) {
 	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
 	// Create a label requirement for the composition version
-	labelreq, err := labels.NewRequirement(deploy.CompositionVersionLabel, selection.Equals, []string{gvr.Version})
+	labelreq, err := labels.NewRequirement(deploy.CompositionVersionLabel, selection.Equals, []string{version})
 	if err != nil {
 		log.Debug("Error creating label requirement", "error", err)
 		return nil, fmt.Errorf("error creating label requirement: %w", err)
@@ -199,7 +205,7 @@ func isNonRetryableCompositionError(err error) bool {
 	return false
 }
 
-func GetCompositionDefinitions(ctx context.Context, cli client.Client, gk schema.GroupKind) ([]compositiondefinitionsv1alpha1.CompositionDefinition, error) {
+func GetCompositionDefinitions(ctx context.Context, cli client.Reader, gk schema.GroupKind) ([]compositiondefinitionsv1alpha1.CompositionDefinition, error) {
 	var cdList compositiondefinitionsv1alpha1.CompositionDefinitionList
 	err := cli.List(ctx, &cdList, &client.ListOptions{Namespace: metav1.NamespaceAll})
 	if err != nil {
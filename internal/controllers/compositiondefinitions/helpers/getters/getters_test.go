@@ -60,6 +60,40 @@ func TestUpdateCompositionsVersion(t *testing.T) {
 	}
 }
 
+func TestUpdateCompositionsVersionClusterScoped(t *testing.T) {
+	scheme := runtime.NewScheme()
+	obj1 := newTestComposition("test-tenant", "", "v0-3-0")
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		{Group: "composition.krateo.io", Version: "v0-3-0", Resource: "fireworksapps"}: "TheCompositionsList",
+	}, obj1)
+
+	gvr := schema.GroupVersionResource{
+		Group:    "composition.krateo.io",
+		Version:  "v0-3-0",
+		Resource: "fireworksapps",
+	}
+
+	ul, err := GetCompositions(context.Background(), dyn, gvr)
+	if err != nil {
+		t.Fatalf("GetCompositions failed: %v", err)
+	}
+	if len(ul.Items) != 1 || ul.Items[0].GetNamespace() != "" {
+		t.Fatalf("expected the cluster-scoped composition, got %v", ul.Items)
+	}
+
+	if err := UpdateCompositionsVersion(context.Background(), dyn, gvr, "v2"); err != nil {
+		t.Fatalf("updateCompositionsVersion failed: %v", err)
+	}
+
+	updatedComp, err := dyn.Resource(gvr).Get(context.Background(), "test-tenant", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get updated composition: %v", err)
+	}
+	if updatedComp.GetLabels()[deploy.CompositionVersionLabel] != "v2" {
+		t.Errorf("expected composition version label 'v2', got '%s'", updatedComp.GetLabels()[deploy.CompositionVersionLabel])
+	}
+}
+
 func TestUpdateCompositionsVersionRetriesTransientListError(t *testing.T) {
 	t.Cleanup(func() {
 		retryWait = retry.Wait
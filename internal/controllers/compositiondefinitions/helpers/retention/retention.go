@@ -0,0 +1,138 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/getters"
+	contexttools "github.com/krateoplatformops/core-provider/internal/tools/context"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Plan lists the versions of a CRD that fall outside the retention policy.
+type Plan struct {
+	// Unserve: versions that are still served and must be unserved
+	Unserve []string
+	// Remove: unserved versions without compositions that can be removed from the CRD
+	Remove []string
+}
+
+// Empty reports whether the plan has nothing to do.
+func (p Plan) Empty() bool {
+	return len(p.Unserve) == 0 && len(p.Remove) == 0
+}
+
+// Compute builds the retention plan of the crd for the given policy.
+//
+// The latest version, the storage version, the versions in status.storedVersions and the
+// pinned versions (the versions of the CompositionDefinitions of the same kind) are always retained.
+// A version outside the policy is unserved first; it is removed once no composition is
+// labeled with it anymore. Compositions are looked up through the latest served version, so
+// unserved versions can still be checked.
+func Compute(ctx context.Context, dyn dynamic.Interface, crd *apiextensionsv1.CustomResourceDefinition, policy *compositiondefinitionsv1alpha1.VersionRetention, pinned []string) (Plan, error) {
+	plan := Plan{}
+	if policy == nil {
+		return plan, nil
+	}
+
+	latest := generation.LatestVersion(crd)
+	if latest == "" {
+		return plan, nil
+	}
+
+	versions := []string{}
+	for _, v := range crd.Spec.Versions {
+		if v.Name != generation.VacuumVersion {
+			versions = append(versions, v.Name)
+		}
+	}
+
+	gvr := schema.GroupVersionResource{
+		Group:    crd.Spec.Group,
+		Version:  latest,
+		Resource: crd.Spec.Names.Plural,
+	}
+	inUse := map[string]bool{}
+	for _, v := range versions {
+		ul, err := getters.GetCompositionsForVersion(ctx, dyn, gvr, v)
+		if err != nil {
+			return plan, fmt.Errorf("error getting compositions of version %s: %w", v, err)
+		}
+		inUse[v] = len(ul.Items) > 0
+	}
+
+	keep := map[string]bool{
+		latest:                         true,
+		generation.StorageVersion(crd): true,
+	}
+	for _, v := range crd.Status.StoredVersions {
+		keep[v] = true
+	}
+	for _, v := range pinned {
+		keep[v] = true
+	}
+
+	switch policy.Policy {
+	case compositiondefinitionsv1alpha1.VersionRetentionKeepLast:
+		for i := max(len(versions)-policy.Keep, 0); i < len(versions); i++ {
+			keep[versions[i]] = true
+		}
+	case compositiondefinitionsv1alpha1.VersionRetentionKeepInUse:
+		for v, ok := range inUse {
+			if ok {
+				keep[v] = true
+			}
+		}
+	default:
+		return plan, fmt.Errorf("unknown version retention policy %q", policy.Policy)
+	}
+
+	for _, v := range crd.Spec.Versions {
+		if v.Name == generation.VacuumVersion || keep[v.Name] {
+			continue
+		}
+		if v.Served {
+			plan.Unserve = append(plan.Unserve, v.Name)
+			continue
+		}
+		if !inUse[v.Name] {
+			plan.Remove = append(plan.Remove, v.Name)
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply applies the plan to the crd and updates it in the cluster.
+func Apply(ctx context.Context, cli client.Client, crd *apiextensionsv1.CustomResourceDefinition, plan Plan) error {
+	if plan.Empty() {
+		return nil
+	}
+	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
+
+	versions := []apiextensionsv1.CustomResourceDefinitionVersion{}
+	for _, v := range crd.Spec.Versions {
+		if slices.Contains(plan.Remove, v.Name) {
+			continue
+		}
+		if slices.Contains(plan.Unserve, v.Name) {
+			v.Served = false
+		}
+		versions = append(versions, v)
+	}
+	crd.Spec.Versions = versions
+
+	if err := cli.Update(ctx, crd); err != nil {
+		return fmt.Errorf("error applying version retention to CRD: %w", err)
+	}
+	log.Debug("Version retention applied", "crd", crd.Name, "unserved", plan.Unserve, "removed", plan.Remove)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package retention
+
+import (
+	"context"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/core-provider/internal/tools/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var latestGVR = schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "fireworksapps"}
+
+func newTestCRD(served ...bool) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps.composition.krateo.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "composition.krateo.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "FireworksApp", Plural: "fireworksapps"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: served[0]},
+				{Name: "v1-1-0", Served: served[1]},
+				{Name: "v1-2-0", Served: true, Storage: true},
+				{Name: generation.VacuumVersion},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1-2-0"}},
+	}
+	return crd
+}
+
+func newTestComposition(name, version string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(latestGVR.GroupVersion().String())
+	u.SetKind("FireworksApp")
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.SetLabels(map[string]string{deploy.CompositionVersionLabel: version})
+	return u
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name         string
+		crd          *apiextensionsv1.CustomResourceDefinition
+		policy       *compositiondefinitionsv1alpha1.VersionRetention
+		pinned       []string
+		compositions []runtime.Object
+		expected     Plan
+	}{
+		{
+			name:     "No policy",
+			crd:      newTestCRD(true, true),
+			expected: Plan{},
+		},
+		{
+			name:     "Keep last unserves older versions",
+			crd:      newTestCRD(true, true),
+			policy:   &compositiondefinitionsv1alpha1.VersionRetention{Policy: compositiondefinitionsv1alpha1.VersionRetentionKeepLast, Keep: 2},
+			expected: Plan{Unserve: []string{"v1-0-0"}},
+		},
+		{
+			name:         "Unserved versions are removed once they have no compositions",
+			crd:          newTestCRD(false, false),
+			policy:       &compositiondefinitionsv1alpha1.VersionRetention{Policy: compositiondefinitionsv1alpha1.VersionRetentionKeepLast, Keep: 1},
+			compositions: []runtime.Object{newTestComposition("in-use", "v1-0-0")},
+			expected:     Plan{Remove: []string{"v1-1-0"}},
+		},
+		{
+			name:         "Keep in use retains versions with compositions",
+			crd:          newTestCRD(true, true),
+			policy:       &compositiondefinitionsv1alpha1.VersionRetention{Policy: compositiondefinitionsv1alpha1.VersionRetentionKeepInUse},
+			compositions: []runtime.Object{newTestComposition("in-use", "v1-0-0")},
+			expected:     Plan{Unserve: []string{"v1-1-0"}},
+		},
+		{
+			name:     "Pinned versions are retained",
+			crd:      newTestCRD(true, true),
+			policy:   &compositiondefinitionsv1alpha1.VersionRetention{Policy: compositiondefinitionsv1alpha1.VersionRetentionKeepInUse},
+			pinned:   []string{"v1-1-0"},
+			expected: Plan{Unserve: []string{"v1-0-0"}},
+		},
+		{
+			name: "Stored versions are retained",
+			crd: func() *apiextensionsv1.CustomResourceDefinition {
+				crd := newTestCRD(false, false)
+				crd.Status.StoredVersions = []string{"v1-0-0", "v1-2-0"}
+				return crd
+			}(),
+			policy:   &compositiondefinitionsv1alpha1.VersionRetention{Policy: compositiondefinitionsv1alpha1.VersionRetentionKeepInUse},
+			expected: Plan{Remove: []string{"v1-1-0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				latestGVR: "FireworksAppList",
+			}, tt.compositions...)
+
+			plan, err := Compute(context.Background(), dyn, tt.crd, tt.policy, tt.pinned)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, plan)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	crd := newTestCRD(true, false)
+	cli := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build()
+
+	current := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(context.Background(), client.ObjectKeyFromObject(crd), current))
+
+	err := Apply(context.Background(), cli, current, Plan{Unserve: []string{"v1-0-0"}, Remove: []string{"v1-1-0"}})
+	require.NoError(t, err)
+
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(context.Background(), client.ObjectKeyFromObject(crd), got))
+
+	names := []string{}
+	for _, v := range got.Spec.Versions {
+		names = append(names, v.Name)
+		if v.Name == "v1-0-0" {
+			assert.False(t, v.Served)
+		}
+	}
+	assert.Equal(t, []string{"v1-0-0", "v1-2-0", generation.VacuumVersion}, names)
+}
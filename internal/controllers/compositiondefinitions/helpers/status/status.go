@@ -1,10 +1,14 @@
 package status
 
 import (
+	"fmt"
+	"slices"
+
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
 )
 
 // updateVersionInfo updates the version information of a CompositionDefinition custom resource
@@ -13,7 +17,8 @@ import (
 // The function iterates through the versions specified in the CustomResourceDefinition and updates
 // the corresponding version information in the CompositionDefinition's status. If a version is not
 // found in the existing status, it is added. If the version matches the GroupVersionResource, additional
-// chart information is populated from the CompositionDefinition's spec.
+// chart information is populated from the CompositionDefinition's spec, with the resolved chart version. Versions that are no longer
+// defined in the CustomResourceDefinition are removed from the status.
 func UpdateVersionInfo(cr *compositiondefinitionsv1alpha1.CompositionDefinition, crd *apiextensionsv1.CustomResourceDefinition, gvr schema.GroupVersionResource) {
 	for _, v := range crd.Spec.Versions {
 		i := -1
@@ -33,10 +38,17 @@ func UpdateVersionInfo(cr *compositiondefinitionsv1alpha1.CompositionDefinition,
 			if gvr.Version == versionDetail.Version {
 				versionDetail.Chart = &compositiondefinitionsv1alpha1.ChartInfoProps{}
 				versionDetail.Chart.Credentials = cr.Spec.Chart.Credentials
+				versionDetail.Chart.BearerTokenRef = cr.Spec.Chart.BearerTokenRef
+				versionDetail.Chart.PullSecretRef = cr.Spec.Chart.PullSecretRef
+				versionDetail.Chart.TLS = cr.Spec.Chart.TLS
 				versionDetail.Chart.InsecureSkipVerifyTLS = cr.Spec.Chart.InsecureSkipVerifyTLS
 				versionDetail.Chart.Repo = cr.Spec.Chart.Repo
 				versionDetail.Chart.Url = cr.Spec.Chart.Url
 				versionDetail.Chart.Version = cr.Spec.Chart.Version
+				if cr.Status.ResolvedVersion != "" {
+					// A version range is recorded as the version it resolved to.
+					versionDetail.Chart.Version = cr.Status.ResolvedVersion
+				}
 			}
 
 			cr.Status.Managed.VersionInfo = append(cr.Status.Managed.VersionInfo, versionDetail)
@@ -45,6 +57,62 @@ func UpdateVersionInfo(cr *compositiondefinitionsv1alpha1.CompositionDefinition,
 		cr.Status.Managed.VersionInfo[i].Served = v.Served
 		cr.Status.Managed.VersionInfo[i].Stored = v.Storage
 	}
+
+	// Drop the versions that have been removed from the CustomResourceDefinition
+	cr.Status.Managed.VersionInfo = slices.DeleteFunc(cr.Status.Managed.VersionInfo, func(vi compositiondefinitionsv1alpha1.VersionDetail) bool {
+		return !slices.ContainsFunc(crd.Spec.Versions, func(v apiextensionsv1.CustomResourceDefinitionVersion) bool {
+			return v.Name == vi.Version
+		})
+	})
+}
+
+// UpdateStorageMigration records the progress of the storage version migration in the
+// CompositionDefinition status. A non nil err marks the migration as failed.
+func UpdateStorageMigration(cr *compositiondefinitionsv1alpha1.CompositionDefinition, res crdclient.MigrationResult, err error) {
+	sm := &compositiondefinitionsv1alpha1.StorageMigration{
+		StorageVersion: res.StorageVersion,
+		State:          compositiondefinitionsv1alpha1.StorageMigrationPending,
+		Migrated:       res.Migrated,
+		Total:          res.Total,
+		Continue:       res.Continue,
+		Failed:         res.Failed,
+		Failures:       res.Failures,
+	}
+	if len(res.Held) > 0 {
+		sm.State = compositiondefinitionsv1alpha1.StorageMigrationHeld
+	}
+	if res.Done {
+		sm.State = compositiondefinitionsv1alpha1.StorageMigrationSucceeded
+	}
+	if res.Failed > 0 && res.Continue == "" {
+		// The pass over the objects is complete, the next one starts from the first object.
+		sm.State = compositiondefinitionsv1alpha1.StorageMigrationFailed
+		sm.Error = fmt.Sprintf("%d compositions could not be rewritten in version %s", res.Failed, res.StorageVersion)
+	}
+	if err != nil {
+		sm.State = compositiondefinitionsv1alpha1.StorageMigrationFailed
+		sm.Error = err.Error()
+	}
+
+	cr.Status.Managed.StorageMigration = sm
+}
+
+// StorageMigrationProgress returns the progress of the storage version migration recorded in the
+// CompositionDefinition status, which the next migration resumes from.
+func StorageMigrationProgress(cr *compositiondefinitionsv1alpha1.CompositionDefinition) crdclient.MigrationResult {
+	sm := cr.Status.Managed.StorageMigration
+	if sm == nil {
+		return crdclient.MigrationResult{}
+	}
+	return crdclient.MigrationResult{
+		StorageVersion: sm.StorageVersion,
+		Migrated:       sm.Migrated,
+		Total:          sm.Total,
+		Continue:       sm.Continue,
+		Failed:         sm.Failed,
+		Failures:       sm.Failures,
+		Done:           sm.State == compositiondefinitionsv1alpha1.StorageMigrationSucceeded,
+	}
 }
 
 func RefreshCompositionDefinitionStatus(
@@ -1,12 +1,15 @@
 package status
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
 )
 
 func TestUpdateVersionInfo(t *testing.T) {
@@ -57,3 +60,132 @@ func TestUpdateVersionInfo(t *testing.T) {
 		t.Fatal("expected chart info to be set")
 	}
 }
+
+func TestUpdateStorageMigration(t *testing.T) {
+	tests := []struct {
+		name     string
+		res      crdclient.MigrationResult
+		err      error
+		expected compositiondefinitionsv1alpha1.StorageMigration
+	}{
+		{
+			name: "Storage version switched",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0"},
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationPending,
+			},
+		},
+		{
+			name: "Migration in progress",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0", Migrated: 100, Total: 100, Continue: "next"},
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationPending,
+				Migrated:       100,
+				Total:          100,
+				Continue:       "next",
+			},
+		},
+		{
+			name: "Storage held on the vacuum version",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0", Held: []string{"v1-0-0 spec.replicas"}},
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationHeld,
+			},
+		},
+		{
+			name: "Migration completed",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0", Migrated: 3, Total: 3, Done: true},
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationSucceeded,
+				Migrated:       3,
+				Total:          3,
+			},
+		},
+		{
+			name: "Compositions not rewritten",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0", Migrated: 2, Total: 3, Failed: 1, Failures: []string{"error migrating examples demo/second: denied"}},
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationFailed,
+				Migrated:       2,
+				Total:          3,
+				Failed:         1,
+				Failures:       []string{"error migrating examples demo/second: denied"},
+				Error:          "1 compositions could not be rewritten in version v1-1-0",
+			},
+		},
+		{
+			name: "Migration failed",
+			res:  crdclient.MigrationResult{StorageVersion: "v1-1-0", Migrated: 1, Total: 3},
+			err:  errors.New("boom"),
+			expected: compositiondefinitionsv1alpha1.StorageMigration{
+				StorageVersion: "v1-1-0",
+				State:          compositiondefinitionsv1alpha1.StorageMigrationFailed,
+				Migrated:       1,
+				Total:          3,
+				Error:          "boom",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &compositiondefinitionsv1alpha1.CompositionDefinition{}
+			UpdateStorageMigration(cr, tt.res, tt.err)
+
+			if cr.Status.Managed.StorageMigration == nil {
+				t.Fatal("expected storage migration to be set")
+			}
+			if !reflect.DeepEqual(*cr.Status.Managed.StorageMigration, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, *cr.Status.Managed.StorageMigration)
+			}
+			// The next migration resumes from the recorded progress, the held fields are computed again
+			progress := tt.res
+			progress.Held = nil
+			if got := StorageMigrationProgress(cr); !reflect.DeepEqual(got, progress) {
+				t.Errorf("expected progress %+v, got %+v", progress, got)
+			}
+		})
+	}
+}
+
+func TestUpdateVersionInfoDropsRemovedVersions(t *testing.T) {
+	cr := &compositiondefinitionsv1alpha1.CompositionDefinition{
+		Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+			Managed: compositiondefinitionsv1alpha1.Managed{
+				VersionInfo: []compositiondefinitionsv1alpha1.VersionDetail{
+					{Version: "v1", Served: true},
+					{Version: "v2", Served: true, Stored: true},
+				},
+			},
+		},
+		Spec: compositiondefinitionsv1alpha1.CompositionDefinitionSpec{
+			Chart: &compositiondefinitionsv1alpha1.ChartInfo{},
+		},
+	}
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v2", Served: false, Storage: false},
+				{Name: "v3", Served: true, Storage: true},
+			},
+		},
+	}
+
+	UpdateVersionInfo(cr, crd, schema.GroupVersionResource{Version: "v3"})
+
+	if len(cr.Status.Managed.VersionInfo) != 2 {
+		t.Fatalf("expected 2 version info, got %d", len(cr.Status.Managed.VersionInfo))
+	}
+	if vi := cr.Status.Managed.VersionInfo[0]; vi.Version != "v2" || vi.Served || vi.Stored {
+		t.Errorf("expected v2 to be unserved and not stored, got %+v", vi)
+	}
+	if vi := cr.Status.Managed.VersionInfo[1]; vi.Version != "v3" || !vi.Served || !vi.Stored {
+		t.Errorf("expected v3 to be served and stored, got %+v", vi)
+	}
+}
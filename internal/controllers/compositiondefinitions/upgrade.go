@@ -0,0 +1,106 @@
+package compositiondefinitions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	contexttools "github.com/krateoplatformops/core-provider/internal/tools/context"
+	crdclient "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/compatibility"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ApproveBreakingChangesAnnotation approves a chart upgrade with breaking schema changes.
+	// Its value must be the approved chart version, so an approval does not carry over to later upgrades.
+	ApproveBreakingChangesAnnotation = "krateo.io/approve-breaking-changes"
+
+	// maxReportedChanges limits the breaking changes listed in conditions and events.
+	maxReportedChanges = 10
+)
+
+// checkSchemaCompatibility compares the spec schema of the version of the CRD the CompositionDefinition
+// was serving with the spec schema generated from the new chart. Breaking changes block the upgrade
+// until the ApproveBreakingChangesAnnotation is set to the new chart version, the one resolved from a version range.
+// A blocked upgrade stays blocked until the chart or the annotation change, so the error is terminal; the SchemaCompatible
+// condition reports it, and the event is emitted only when the condition changes.
+func (e *external) checkSchemaCompatibility(ctx context.Context, cr *compositiondefinitionsv1alpha1.CompositionDefinition, newCRD *apiextensionsv1.CustomResourceDefinition, gvk schema.GroupVersionKind) error {
+	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
+
+	oldGVK := schema.FromAPIVersionAndKind(cr.Status.ApiVersion, cr.Status.Kind)
+	if oldGVK.Version == "" || oldGVK.Version == gvk.Version || oldGVK.GroupKind() != gvk.GroupKind() {
+		return nil
+	}
+
+	current, err := crdclient.Get(ctx, e.kube, schema.GroupResource{Group: newCRD.Spec.Group, Resource: newCRD.Spec.Names.Plural})
+	if err != nil {
+		return fmt.Errorf("error getting CRD: %w", err)
+	}
+	if current == nil {
+		return nil
+	}
+
+	changes := compatibility.Compare(
+		compatibility.SpecSchema(current, oldGVK.Version),
+		compatibility.SpecSchema(newCRD, gvk.Version),
+	)
+	if len(changes) == 0 {
+		cr.SetConditions(schemaCompatible())
+		return nil
+	}
+
+	summary := summarizeChanges(oldGVK.Version, gvk.Version, changes)
+	log.Debug("Breaking schema changes detected", "from", oldGVK.Version, "to", gvk.Version, "changes", len(changes))
+
+	version := cr.Spec.Chart.Version
+	if cr.Status.ResolvedVersion != "" {
+		version = cr.Status.ResolvedVersion
+	}
+	if version != "" && cr.GetAnnotations()[ApproveBreakingChangesAnnotation] == version {
+		e.setSchemaCondition(cr, schemaBreakingChangesApproved(summary), corev1.EventTypeNormal)
+		return nil
+	}
+
+	e.setSchemaCondition(cr, schemaBreakingChanges(summary), corev1.EventTypeWarning)
+
+	return reconcile.TerminalError(fmt.Errorf("chart upgrade to version %s blocked by %d breaking schema changes: set the %s annotation to %q to approve it",
+		version, len(changes), ApproveBreakingChangesAnnotation, version))
+}
+
+// setSchemaCondition sets the SchemaCompatible condition, with an event when its reason or message changes.
+func (e *external) setSchemaCondition(cr *compositiondefinitionsv1alpha1.CompositionDefinition, cond rtv1.Condition, eventtype string) {
+	if c := cr.GetCondition(TypeSchemaCompatible); c.Reason != cond.Reason || c.Message != cond.Message {
+		e.event(cr, eventtype, string(cond.Reason), cond.Message)
+	}
+	cr.SetConditions(cond)
+}
+
+func (e *external) event(cr *compositiondefinitionsv1alpha1.CompositionDefinition, eventtype, reason, note string) {
+	if e.rec == nil {
+		return
+	}
+	e.rec.Eventf(cr, nil, eventtype, reason, "Upgrade", "%s", note)
+}
+
+func summarizeChanges(from, to string, changes []compatibility.Change) string {
+	lines := make([]string, 0, min(len(changes), maxReportedChanges))
+	for i, c := range changes {
+		if i == maxReportedChanges {
+			break
+		}
+		lines = append(lines, c.String())
+	}
+
+	msg := fmt.Sprintf("%d breaking schema changes from %s to %s: %s", len(changes), from, to, strings.Join(lines, "; "))
+	if len(changes) > maxReportedChanges {
+		msg += fmt.Sprintf("; and %d more", len(changes)-maxReportedChanges)
+	}
+	return msg
+}
@@ -0,0 +1,159 @@
+package compositiondefinitions
+
+import (
+	"context"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/events"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newUpgradeTestCRD(specs map[string]apiextensionsv1.JSONSchemaProps) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps.composition.krateo.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "composition.krateo.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "FireworksApp", Plural: "fireworksapps"},
+		},
+	}
+	for version, spec := range specs {
+		crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name: version,
+			Schema: &apiextensionsv1.CustomResourceValidation{
+				OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+					Type:       "object",
+					Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": spec},
+				},
+			},
+		})
+	}
+	return crd
+}
+
+func TestCheckSchemaCompatibility(t *testing.T) {
+	oldSpec := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name":     {Type: "string"},
+			"replicas": {Type: "integer"},
+		},
+	}
+	compatibleSpec := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name":     {Type: "string"},
+			"replicas": {Type: "integer"},
+			"labels":   {Type: "object"},
+		},
+	}
+	breakingSpec := apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"name"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name": {Type: "string"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		newSpec     apiextensionsv1.JSONSchemaProps
+		annotations map[string]string
+		expectErr   bool
+		reason      string
+		status      metav1.ConditionStatus
+	}{
+		{
+			name:    "Compatible upgrade",
+			newSpec: compatibleSpec,
+			reason:  string(ReasonSchemaCompatible),
+			status:  metav1.ConditionTrue,
+		},
+		{
+			name:      "Breaking upgrade is blocked",
+			newSpec:   breakingSpec,
+			expectErr: true,
+			reason:    string(ReasonBreakingChanges),
+			status:    metav1.ConditionFalse,
+		},
+		{
+			name:        "Approval for another version does not apply",
+			newSpec:     breakingSpec,
+			annotations: map[string]string{ApproveBreakingChangesAnnotation: "1.0.0"},
+			expectErr:   true,
+			reason:      string(ReasonBreakingChanges),
+			status:      metav1.ConditionFalse,
+		},
+		{
+			name:        "Approved breaking upgrade",
+			newSpec:     breakingSpec,
+			annotations: map[string]string{ApproveBreakingChangesAnnotation: "1.1.0"},
+			reason:      string(ReasonBreakingChangeApproved),
+			status:      metav1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+			cli := fakeclient.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(newUpgradeTestCRD(map[string]apiextensionsv1.JSONSchemaProps{"v1-0-0": oldSpec})).
+				Build()
+
+			cr := newTestCompositionDefinition()
+			cr.SetAnnotations(tt.annotations)
+			cr.Spec.Chart = &compositiondefinitionsv1alpha1.ChartInfo{Version: "1.1.0"}
+			cr.Status.ApiVersion = "composition.krateo.io/v1-0-0"
+			cr.Status.Kind = "FireworksApp"
+
+			gvk := schema.GroupVersionKind{Group: "composition.krateo.io", Version: "v1-1-0", Kind: "FireworksApp"}
+			newCRD := newUpgradeTestCRD(map[string]apiextensionsv1.JSONSchemaProps{"v1-1-0": tt.newSpec})
+
+			recorder := events.NewFakeRecorder(10)
+			e := &external{kube: cli, rec: recorder}
+			err := e.checkSchemaCompatibility(context.Background(), cr, newCRD, gvk)
+			if tt.expectErr {
+				assert.ErrorContains(t, err, ApproveBreakingChangesAnnotation)
+				assert.ErrorIs(t, err, reconcile.TerminalError(nil))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			cond := cr.GetCondition(TypeSchemaCompatible)
+			assert.Equal(t, tt.reason, string(cond.Reason))
+			assert.Equal(t, tt.status, cond.Status)
+
+			// The event is emitted once, not on every reconcile of the same upgrade
+			if tt.reason != string(ReasonSchemaCompatible) {
+				require.Len(t, recorder.Events, 1)
+				<-recorder.Events
+			}
+			_ = e.checkSchemaCompatibility(context.Background(), cr, newCRD, gvk)
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestCheckSchemaCompatibilitySkipsSameVersion(t *testing.T) {
+	cr := newTestCompositionDefinition()
+	cr.Spec.Chart = &compositiondefinitionsv1alpha1.ChartInfo{Version: "1.0.0"}
+	cr.Status.ApiVersion = "composition.krateo.io/v1-0-0"
+	cr.Status.Kind = "FireworksApp"
+
+	gvk := schema.GroupVersionKind{Group: "composition.krateo.io", Version: "v1-0-0", Kind: "FireworksApp"}
+
+	e := &external{}
+	err := e.checkSchemaCompatibility(context.Background(), cr, newUpgradeTestCRD(nil), gvk)
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.ConditionUnknown, corev1.ConditionStatus(cr.GetCondition(TypeSchemaCompatible).Status))
+}
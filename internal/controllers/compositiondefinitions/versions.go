@@ -0,0 +1,73 @@
+package compositiondefinitions
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/chartversion"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/krateoplatformops/provider-runtime/pkg/meta"
+)
+
+// maxAvailableVersions bounds the newer versions listed in the status.
+const maxAvailableVersions = 10
+
+// resolveChartVersion returns the chart to fetch for the CompositionDefinition. When spec.chart.version is a range,
+// the returned chart has the version selected by the upgrade policy, and the status lists the newer versions.
+// A deleted CompositionDefinition keeps the version in use, without resolving the range again.
+func (e *external) resolveChartVersion(ctx context.Context, cr *compositiondefinitionsv1alpha1.CompositionDefinition) (*compositiondefinitionsv1alpha1.ChartInfo, error) {
+	nfo := cr.Spec.Chart
+	if nfo == nil || !chart.IsVersionRange(nfo.Version) {
+		if nfo != nil && !meta.WasDeleted(cr) {
+			cr.Status.ResolvedVersion, cr.Status.AvailableVersions = nfo.Version, nil
+			cr.Status.Conditions = slices.DeleteFunc(cr.Status.Conditions, func(c rtv1.Condition) bool {
+				return c.Type == TypeUpgradeAvailable
+			})
+		}
+		return nfo, nil
+	}
+
+	if meta.WasDeleted(cr) && cr.Status.ResolvedVersion != "" {
+		nfo = nfo.DeepCopy()
+		nfo.Version = cr.Status.ResolvedVersion
+		return nfo, nil
+	}
+
+	sel, err := chartversion.Resolve(ctx, e.kube, nfo, cr.Status.ResolvedVersion, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	cr.Status.ResolvedVersion = sel.Version.Original()
+	cr.Status.AvailableVersions = nil
+	for _, v := range sel.Newer[max(0, len(sel.Newer)-maxAvailableVersions):] {
+		cr.Status.AvailableVersions = append(cr.Status.AvailableVersions, v.Original())
+	}
+	if sel.Held != nil {
+		reason := ReasonUpgradeHeldByPolicy
+		if sel.OutsideWindow {
+			reason = ReasonOutsideMaintenanceWindow
+		}
+		cr.SetConditions(upgradeAvailable(reason, fmt.Sprintf("version %s matches %q but is not applied, %s", sel.Held.Original(), nfo.Version, heldMessage(reason, nfo.UpgradePolicy))))
+	} else {
+		cr.SetConditions(upgradeNotAvailable())
+	}
+
+	nfo = nfo.DeepCopy()
+	nfo.Version = cr.Status.ResolvedVersion
+	return nfo, nil
+}
+
+func heldMessage(reason rtv1.ConditionReason, policy compositiondefinitionsv1alpha1.UpgradePolicy) string {
+	if reason == ReasonOutsideMaintenanceWindow {
+		return "waiting for the next maintenance window"
+	}
+	if policy == "" {
+		policy = compositiondefinitionsv1alpha1.UpgradePolicyManual
+	}
+	return fmt.Sprintf("the %s upgrade policy does not allow it, update spec.chart.version to apply it", policy)
+}
@@ -1,14 +1,20 @@
 package conversion
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/go-logr/logr"
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/getters"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/conversionrules"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/convertible"
 	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
 	"github.com/krateoplatformops/core-provider/internal/tools/loghandler"
@@ -18,9 +24,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func NewWebhookHandler(scheme *runtime.Scheme, metrics ...*webhooktelemetry.Metrics) http.Handler {
+// NewWebhookHandler returns the conversion webhook handler. The conversion rules declared on the
+// CompositionDefinitions are read through cli; when cli is nil objects are copied verbatim.
+func NewWebhookHandler(cli client.Reader, scheme *runtime.Scheme, metrics ...*webhooktelemetry.Metrics) http.Handler {
 	var recorder *webhooktelemetry.Metrics
 	if len(metrics) > 0 {
 		recorder = metrics[0]
@@ -30,11 +40,12 @@ func NewWebhookHandler(scheme *runtime.Scheme, metrics ...*webhooktelemetry.Metr
 	// See docs/log-ingester-compatibility.md.
 	log := logging.NewLogrLogger(logr.FromSlogHandler(loghandler.NewJSONHandler(slog.LevelError, os.Stderr)))
 
-	return &webhook{scheme: scheme, log: log.WithName("core-provider-conversion-webhook"), metrics: recorder}
+	return &webhook{cli: cli, scheme: scheme, log: log.WithName("core-provider-conversion-webhook"), metrics: recorder}
 }
 
 // webhook implements a CRD conversion webhook HTTP handler.
 type webhook struct {
+	cli     client.Reader
 	scheme  *runtime.Scheme
 	log     logging.Logger
 	metrics *webhooktelemetry.Metrics
@@ -67,7 +78,7 @@ func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := wh.handleConvertRequest(convertReview.Request)
+	resp, err := wh.handleConvertRequest(r.Context(), convertReview.Request)
 	if err != nil {
 		log.Error(err, "failed to convert", "request", convertReview.Request.UID)
 		convertReview.Response = errored(err)
@@ -87,11 +98,17 @@ func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // handles a version conversion request.
-func (wh *webhook) handleConvertRequest(req *apix.ConversionRequest) (*apix.ConversionResponse, error) {
+func (wh *webhook) handleConvertRequest(ctx context.Context, req *apix.ConversionRequest) (*apix.ConversionResponse, error) {
 	if req == nil {
 		return nil, fmt.Errorf("conversion request is nil")
 	}
+	desired, err := schema.ParseGroupVersion(req.DesiredAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing desired api version: %w", err)
+	}
+
 	var objects []runtime.RawExtension
+	rulesByKind := map[schema.GroupKind][]compositiondefinitionsv1alpha1.ConversionRule{}
 
 	for _, obj := range req.Objects {
 		usrc, gvk, err := unstructured.UnstructuredJSONScheme.Decode(obj.Raw, nil, nil)
@@ -104,6 +121,20 @@ func (wh *webhook) handleConvertRequest(req *apix.ConversionRequest) (*apix.Conv
 		dst.Object["metadata"] = src.Object["metadata"]
 		dst.Object["spec"] = src.Object["spec"]
 		dst.Object["status"] = src.Object["status"]
+
+		rules, ok := rulesByKind[gvk.GroupKind()]
+		if !ok {
+			rules, err = wh.conversionRules(ctx, gvk.GroupKind())
+			if err != nil {
+				return nil, err
+			}
+			rulesByKind[gvk.GroupKind()] = rules
+		}
+		err = conversionrules.Convert(dst.Unstructured, gvk.Version, desired.Version, rules)
+		if err != nil {
+			return nil, fmt.Errorf("error converting %s %s: %w", gvk.Kind, unssrc.GetName(), err)
+		}
+
 		objects = append(objects, runtime.RawExtension{Object: dst})
 	}
 	return &apix.ConversionResponse{
@@ -115,6 +146,42 @@ func (wh *webhook) handleConvertRequest(req *apix.ConversionRequest) (*apix.Conv
 	}, nil
 }
 
+// conversionRules collects the conversion rules declared by the CompositionDefinitions of a generated kind.
+// The rules of a CompositionDefinition that fail validation are skipped as a whole: the controller reports them
+// in its ConversionRulesValid condition. Definitions are read in namespace and name order, and a rule between two
+// versions already connected by the rules of a previous definition is ignored, whatever its direction.
+func (wh *webhook) conversionRules(ctx context.Context, gk schema.GroupKind) ([]compositiondefinitionsv1alpha1.ConversionRule, error) {
+	if wh.cli == nil {
+		return nil, nil
+	}
+
+	lst, err := getters.GetCompositionDefinitions(ctx, wh.cli, gk)
+	if err != nil {
+		return nil, fmt.Errorf("error getting conversion rules for %s: %w", gk.String(), err)
+	}
+	slices.SortFunc(lst, func(a, b compositiondefinitionsv1alpha1.CompositionDefinition) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	var rules []compositiondefinitionsv1alpha1.ConversionRule
+	seen := map[[2]string]bool{}
+	for i := range lst {
+		if err := conversionrules.Validate(lst[i].Spec.Conversions); err != nil {
+			wh.log.Debug("Skipping invalid conversion rules", "compositionDefinition", lst[i].Namespace+"/"+lst[i].Name, "error", err)
+			continue
+		}
+		for _, r := range lst[i].Spec.Conversions {
+			pair := [2]string{min(r.From, r.To), max(r.From, r.To)}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
 // helper to construct error response.
 func errored(err error) *apix.ConversionResponse {
 	return &apix.ConversionResponse{
@@ -0,0 +1,139 @@
+package conversion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apix "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func convert(t *testing.T, handler http.Handler, desired string, obj string) map[string]interface{} {
+	t.Helper()
+
+	review := apix.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+		Request: &apix.ConversionRequest{
+			UID:               types.UID("test"),
+			DesiredAPIVersion: desired,
+			Objects:           []runtime.RawExtension{{Raw: []byte(obj)}},
+		},
+	}
+	body, err := json.Marshal(review)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	res := apix.ConversionReview{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.NotNil(t, res.Response)
+	require.Equal(t, metav1.StatusSuccess, res.Response.Result.Status, res.Response.Result.Message)
+	require.Len(t, res.Response.ConvertedObjects, 1)
+
+	out := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(res.Response.ConvertedObjects[0].Raw, &out))
+	return out
+}
+
+func TestConversionWebhook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = compositiondefinitionsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	cli := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&compositiondefinitionsv1alpha1.CompositionDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "demo-system"},
+			Spec: compositiondefinitionsv1alpha1.CompositionDefinitionSpec{
+				Conversions: []compositiondefinitionsv1alpha1.ConversionRule{{
+					From: "v1-0-0", To: "v1-1-0",
+					Operations: []compositiondefinitionsv1alpha1.ConversionOperation{
+						{Type: compositiondefinitionsv1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+					},
+				}},
+			},
+			Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+				ApiVersion: "composition.krateo.io/v1-1-0",
+				Kind:       "Example",
+			},
+		},
+	).Build()
+
+	const src = `{"apiVersion":"composition.krateo.io/v1-0-0","kind":"Example","metadata":{"name":"test"},"spec":{"image":"nginx"}}`
+
+	t.Run("should apply conversion rules", func(t *testing.T) {
+		out := convert(t, NewWebhookHandler(cli, runtime.NewScheme()), "composition.krateo.io/v1-1-0", src)
+
+		assert.Equal(t, "composition.krateo.io/v1-1-0", out["apiVersion"])
+		assert.Equal(t, map[string]interface{}{"container": map[string]interface{}{"image": "nginx"}}, out["spec"])
+	})
+
+	t.Run("should copy verbatim without a client", func(t *testing.T) {
+		out := convert(t, NewWebhookHandler(nil, runtime.NewScheme()), "composition.krateo.io/v1-1-0", src)
+
+		assert.Equal(t, "composition.krateo.io/v1-1-0", out["apiVersion"])
+		assert.Equal(t, map[string]interface{}{"image": "nginx"}, out["spec"])
+	})
+}
+
+func TestConversionRules(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = compositiondefinitionsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	definition := func(namespace, name string, rules ...compositiondefinitionsv1alpha1.ConversionRule) *compositiondefinitionsv1alpha1.CompositionDefinition {
+		return &compositiondefinitionsv1alpha1.CompositionDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       compositiondefinitionsv1alpha1.CompositionDefinitionSpec{Conversions: rules},
+			Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+				ApiVersion: "composition.krateo.io/v1-1-0",
+				Kind:       "Example",
+			},
+		}
+	}
+	move := func(from, to, path, dst string) compositiondefinitionsv1alpha1.ConversionRule {
+		return compositiondefinitionsv1alpha1.ConversionRule{
+			From: from, To: to,
+			Operations: []compositiondefinitionsv1alpha1.ConversionOperation{
+				{Type: compositiondefinitionsv1alpha1.ConversionOperationMove, Path: path, To: dst},
+			},
+		}
+	}
+
+	cli := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(
+		definition("demo-system", "example", move("v1-0-0", "v1-1-0", "spec.image", "spec.container.image")),
+		// The same versions, in both directions, are already connected by the rules of demo-system/example
+		definition("other-system", "duplicate",
+			move("v1-0-0", "v1-1-0", "spec.image", "spec.main.image"),
+			move("v1-1-0", "v1-0-0", "spec.main.image", "spec.image"),
+			move("v1-1-0", "v1-2-0", "spec.container.image", "spec.containers.main.image"),
+		),
+		// A move onto its own source makes the whole set invalid
+		definition("broken-system", "invalid",
+			move("v1-2-0", "v1-3-0", "spec.containers", "spec.containers.main"),
+			move("v1-3-0", "v1-4-0", "spec.name", "spec.title"),
+		),
+	).Build()
+
+	wh := NewWebhookHandler(cli, runtime.NewScheme()).(*webhook)
+	rules, err := wh.conversionRules(context.Background(), schema.GroupKind{Group: "composition.krateo.io", Kind: "Example"})
+	require.NoError(t, err)
+	assert.Equal(t, []compositiondefinitionsv1alpha1.ConversionRule{
+		move("v1-0-0", "v1-1-0", "spec.image", "spec.container.image"),
+		move("v1-1-0", "v1-2-0", "spec.container.image", "spec.containers.main.image"),
+	}, rules)
+
+	const src = `{"apiVersion":"composition.krateo.io/v1-0-0","kind":"Example","metadata":{"name":"test"},"spec":{"image":"nginx"}}`
+	out := convert(t, wh, "composition.krateo.io/v1-2-0", src)
+	assert.Equal(t, map[string]interface{}{"containers": map[string]interface{}{"main": map[string]interface{}{"image": "nginx"}}}, out["spec"])
+}
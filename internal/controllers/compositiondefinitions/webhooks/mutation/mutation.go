@@ -7,19 +7,20 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/crdcache"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/defaults"
 	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
-	crdtools "github.com/krateoplatformops/core-provider/internal/tools/crd"
 	"gomodules.xyz/jsonpatch/v2"
 	v1 "k8s.io/api/admission/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
-func NewWebhookHandler(cli client.Reader, metrics ...*webhooktelemetry.Metrics) *webhook.Admission {
+// NewWebhookHandler returns the handler applying the defaults of the CRD schema to the compositions and labeling
+// them with their version on create. The CRDs and their schemas are read from crds.
+func NewWebhookHandler(crds *crdcache.Cache, metrics ...*webhooktelemetry.Metrics) *webhook.Admission {
 	var recorder *webhooktelemetry.Metrics
 	if len(metrics) > 0 {
 		recorder = metrics[0]
@@ -44,7 +45,7 @@ func NewWebhookHandler(cli client.Reader, metrics ...*webhooktelemetry.Metrics)
 				return webhook.Errored(http.StatusBadRequest, err)
 			}
 			// Get CRD from the request
-			crd, err := crdtools.Get(ctx, cli, schema.GroupResource{
+			crd, err := crds.Get(ctx, schema.GroupResource{
 				Group:    req.Kind.Group,
 				Resource: req.Resource.Resource,
 			})
@@ -61,7 +62,15 @@ func NewWebhookHandler(cli client.Reader, metrics ...*webhooktelemetry.Metrics)
 			if err != nil {
 				return webhook.Errored(http.StatusBadRequest, err)
 			}
-			err = defaults.PopulateDefaultsFromCRD(crd, &modObj)
+			version, err := defaults.Version(unstructuredObj)
+			if err != nil {
+				return webhook.Errored(http.StatusBadRequest, err)
+			}
+			specSchema, err := crds.SpecSchema(crd, version)
+			if err != nil {
+				return webhook.Errored(http.StatusBadRequest, err)
+			}
+			err = defaults.PopulateDefaults(specSchema, &modObj)
 			if err != nil {
 				return webhook.Errored(http.StatusBadRequest, err)
 			}
@@ -6,9 +6,11 @@ import (
 	"testing"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/crdcache"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/admission/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -18,7 +20,8 @@ import (
 
 func TestNewWebhookHandler(t *testing.T) {
 	cli := fake.NewClientBuilder().Build()
-	handler := NewWebhookHandler(cli)
+	// The informer is not started: the CRDs are read from cli
+	handler := NewWebhookHandler(crdcache.New(apiextensionsfake.NewSimpleClientset(), cli, 0))
 
 	t.Run("should return error for invalid JSON", func(t *testing.T) {
 		req := webhook.AdmissionRequest{
@@ -193,6 +196,59 @@ func TestNewWebhookHandler(t *testing.T) {
 		assert.Equal(t, "v1", patch[1].Value)
 	})
 
+	t.Run("should handle cluster-scoped compositions", func(t *testing.T) {
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "tenants.example.com",
+			},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Scope: apiextensionsv1.ClusterScoped,
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+					{
+						Name:    "v1",
+						Served:  true,
+						Storage: true,
+						Schema: &apiextensionsv1.CustomResourceValidation{
+							OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"spec": {Type: "object"},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		cli.Create(context.Background(), crd)
+
+		req := webhook.AdmissionRequest{
+			AdmissionRequest: v1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Group:   "example.com",
+					Version: "v1",
+					Kind:    "Tenant",
+				},
+				Resource: metav1.GroupVersionResource{
+					Group:    "example.com",
+					Version:  "v1",
+					Resource: "tenants",
+				},
+				Name:      "acme",
+				Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.com/v1","kind":"Tenant","metadata":{"name":"acme","labels":{"existing":"label"}},"spec":{}}`)},
+				Operation: v1.Create,
+			},
+		}
+		resp := handler.Handle(context.Background(), req)
+		if resp.Result.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, resp.Result.Code)
+		}
+
+		assert.Len(t, resp.Patches, 1)
+		assert.Equal(t, "/metadata/labels/krateo.io~1composition-version", resp.Patches[0].Path)
+		assert.Equal(t, "v1", resp.Patches[0].Value)
+	})
+
 	t.Run("Update operation should not add labels", func(t *testing.T) {
 		req := webhook.AdmissionRequest{
 			AdmissionRequest: v1.AdmissionRequest{
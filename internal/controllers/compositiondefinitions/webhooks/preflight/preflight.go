@@ -0,0 +1,278 @@
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/chartversion"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/crdopts"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/conversionrules"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/responses"
+	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartfs"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
+	crdtools "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/celrules"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	v1 "k8s.io/api/admission/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// FetchTimeout bounds the resolution and the fetch of the chart. It is below the default timeoutSeconds of the
+	// webhook configurations, so that a slow chart source results in a warning rather than in a failed call.
+	FetchTimeout = 8 * time.Second
+
+	// maxChartVersionLength is the MaxLength of the chart version recorded in status.managed.versionInfo.
+	maxChartVersionLength = 20
+)
+
+// NewWebhookHandler returns the handler running the preflight checks of the CompositionDefinitions on create and on
+// update of their spec: the checks a reconcile would otherwise fail on. The chart is resolved and fetched through the
+// chart cache within FetchTimeout, its values schema is parsed and the CRD is generated from it, then the CRD is
+// checked against the existing CRD. Mistakes are denied, with the field they come from. A chart that cannot be
+// fetched in time, or from a source that cannot be reached, and a version generated by another CompositionDefinition
+// are allowed with a warning.
+// cli reads CRDs and CompositionDefinitions, kube fetches the charts, and charts exceeding the archive limits l are denied.
+func NewWebhookHandler(cli client.Reader, kube client.Client, l tgzfs.Limits, metrics ...*webhooktelemetry.Metrics) *webhook.Admission {
+	var recorder *webhooktelemetry.Metrics
+	if len(metrics) > 0 {
+		recorder = metrics[0]
+	}
+
+	return &webhook.Admission{
+		Handler: admission.HandlerFunc(func(ctx context.Context, req webhook.AdmissionRequest) webhook.AdmissionResponse {
+			started := time.Now()
+			operation := string(req.Operation)
+			if operation == "" {
+				operation = "unknown"
+			}
+			success := false
+			defer func() {
+				if recorder != nil {
+					recorder.RecordRequest(ctx, "preflight", operation, time.Since(started), success)
+				}
+			}()
+
+			if req.Operation != v1.Create && req.Operation != v1.Update {
+				success = true
+				return webhook.Allowed("")
+			}
+
+			cd := &compositiondefinitionsv1alpha1.CompositionDefinition{}
+			if err := json.Unmarshal(req.Object.Raw, cd); err != nil {
+				return webhook.Errored(http.StatusBadRequest, err)
+			}
+			if req.Operation == v1.Update {
+				old := &compositiondefinitionsv1alpha1.CompositionDefinition{}
+				if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+					return webhook.Errored(http.StatusBadRequest, err)
+				}
+				// Updates of the metadata or of the status, and the updates of a definition being deleted, are not
+				// checked: a definition that fails the checks must still be reconciled and deleted.
+				if cd.DeletionTimestamp != nil || equality.Semantic.DeepEqual(old.Spec, cd.Spec) {
+					success = true
+					return webhook.Allowed("")
+				}
+			}
+
+			errs, warnings, err := check(ctx, cli, kube, l, cd)
+			if err != nil {
+				return webhook.Errored(http.StatusInternalServerError, err)
+			}
+			success = true
+			if len(errs) > 0 {
+				return responses.Denied(req, errs).WithWarnings(warnings...)
+			}
+			return webhook.Allowed("").WithWarnings(warnings...)
+		}),
+	}
+}
+
+// check runs the preflight checks of cd. It returns the mistakes found in cd and the warnings about the checks that
+// could not run. The error is returned when the cluster cannot be read.
+func check(ctx context.Context, cli client.Reader, kube client.Client, l tgzfs.Limits, cd *compositiondefinitionsv1alpha1.CompositionDefinition) (field.ErrorList, []string, error) {
+	specPath := field.NewPath("spec")
+
+	var errs field.ErrorList
+	if err := conversionrules.Validate(cd.Spec.Conversions); err != nil {
+		errs = append(errs, invalid(specPath.Child("conversions"), err.Error()))
+	}
+	nfo := cd.Spec.Chart
+	if nfo == nil {
+		return append(errs, field.Required(specPath.Child("chart"), "")), nil, nil
+	}
+	versionPath := specPath.Child("chart", "version")
+	isRange := chart.IsVersionRange(nfo.Version)
+	if !isRange && len(nfo.Version) > maxChartVersionLength {
+		errs = append(errs, field.TooLong(versionPath, nfo.Version, maxChartVersionLength))
+	}
+	if len(errs) > 0 {
+		return errs, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, FetchTimeout)
+	defer cancel()
+
+	nfo = nfo.DeepCopy()
+	if isRange {
+		if _, err := chartversion.InMaintenanceWindow(nfo.MaintenanceWindows, time.Now()); err != nil {
+			return field.ErrorList{invalid(specPath.Child("chart", "maintenanceWindows"), err.Error())}, nil, nil
+		}
+		// The version the reconcile would apply: the upgrade policy and the maintenance windows may keep the one in use
+		sel, err := chartversion.Resolve(ctx, kube, nfo, cd.Status.ResolvedVersion, time.Now())
+		var rerr *chartversion.RangeError
+		switch {
+		case errors.As(err, &rerr):
+			return field.ErrorList{invalid(versionPath, rerr.Error())}, nil, nil
+		case err != nil:
+			return nil, []string{notChecked(nfo, err)}, nil
+		}
+		version := sel.Version.Original()
+		if len(version) > maxChartVersionLength {
+			return field.ErrorList{invalid(versionPath, fmt.Sprintf("resolves to version %s, which must have at most %d bytes", version, maxChartVersionLength))}, nil, nil
+		}
+		nfo.Version = version
+	}
+
+	chartPath := specPath.Child("chart")
+	pkg, err := chart.Fetch(ctx, kube, nfo, chart.WithLimits(l))
+	var mismatch *chart.DigestMismatchError
+	var verr *verify.Error
+	switch {
+	case errors.Is(err, tgzfs.ErrRejected):
+		return field.ErrorList{invalid(chartPath, err.Error())}, nil, nil
+	case errors.As(err, &mismatch):
+		return field.ErrorList{invalid(specPath.Child("chart", "digest"), mismatch.Error())}, nil, nil
+	case errors.As(err, &verr):
+		return field.ErrorList{invalid(specPath.Child("chart", "verify"), verr.Error())}, nil, nil
+	case err != nil:
+		return nil, []string{notChecked(nfo, err)}, nil
+	}
+
+	fsys, err := chartfs.FromReaderWithLimits(bytes.NewReader(pkg.Data), pkg.PackageURL, l)
+	if errors.Is(err, tgzfs.ErrRejected) {
+		return field.ErrorList{invalid(chartPath, err.Error())}, nil, nil
+	}
+	if err != nil {
+		return field.ErrorList{invalid(chartPath, fmt.Sprintf("chart %s is not a valid chart archive: %s", pkg.PackageURL, err))}, nil, nil
+	}
+
+	crd, errs := generate(fsys, cd)
+	if len(errs) > 0 {
+		return errs, nil, nil
+	}
+
+	return collisions(ctx, cli, cd, crd)
+}
+
+// generate generates the CRD of cd from the chart, as the reconciler does.
+func generate(fsys *chartfs.ChartFS, cd *compositiondefinitionsv1alpha1.CompositionDefinition) (*apiextensionsv1.CustomResourceDefinition, field.ErrorList) {
+	specPath := field.NewPath("spec")
+	pkg, dir := fsys.FS(), fsys.RootDir()
+
+	names, err := chart.CRDNames(pkg, dir, cd.Spec.CRD)
+	if err != nil {
+		return nil, field.ErrorList{invalid(specPath.Child("crd"), fmt.Sprintf("the names of the CRD are not valid: %s", err))}
+	}
+	opts, err := crdopts.Generate(pkg, dir, cd, names)
+	if err != nil {
+		return nil, field.ErrorList{invalid(specPath.Child("chart"), err.Error())}
+	}
+	specSchema, err := chart.ChartJsonSchema(pkg, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, field.ErrorList{invalid(specPath.Child("chart"), fmt.Sprintf("chart %s has no values schema (values.schema.json)", fsys.PackageURL()))}
+	}
+	if err != nil {
+		return nil, field.ErrorList{invalid(specPath.Child("chart"), fmt.Sprintf("the values schema of chart %s is not valid: %s", fsys.PackageURL(), err))}
+	}
+
+	crd, err := generation.GenerateCRD(specSchema, names.GVK, opts)
+	var rulesErr *celrules.Error
+	if errors.As(err, &rulesErr) {
+		return nil, field.ErrorList{invalid(specPath.Child("validations"), rulesErr.Error())}
+	}
+	if err != nil {
+		return nil, field.ErrorList{invalid(specPath.Child("chart"), fmt.Sprintf("the CRD cannot be generated from chart %s: %s", fsys.PackageURL(), err))}
+	}
+	return crd, nil
+}
+
+// collisions checks the CRD generated for cd against the CRD of the same name, when it exists. Only the CRDs that
+// core-provider does not manage are denied: a CRD is managed when it carries the generation.ManagedByLabel label, or
+// when a CompositionDefinition generated it before the label existed. Several CompositionDefinitions may generate the
+// same version, which only results in a warning.
+func collisions(ctx context.Context, cli client.Reader, cd *compositiondefinitionsv1alpha1.CompositionDefinition, crd *apiextensionsv1.CustomResourceDefinition) (field.ErrorList, []string, error) {
+	crdPath := field.NewPath("spec", "crd")
+	gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: crd.Spec.Versions[0].Name, Kind: crd.Spec.Names.Kind}
+
+	var list compositiondefinitionsv1alpha1.CompositionDefinitionList
+	if err := cli.List(ctx, &list); err != nil {
+		return nil, nil, fmt.Errorf("error listing CompositionDefinitions: %w", err)
+	}
+	claimed := false
+	var warnings []string
+	for i := range list.Items {
+		el := &list.Items[i]
+		gv, err := schema.ParseGroupVersion(el.Status.ApiVersion)
+		if err != nil || gv.Group != gvk.Group || el.Status.Kind != gvk.Kind {
+			continue
+		}
+		claimed = true
+		if el.Namespace == cd.Namespace && el.Name == cd.Name {
+			continue
+		}
+		if gv.Version == gvk.Version {
+			warnings = append(warnings, fmt.Sprintf("%s is also generated by CompositionDefinition %s/%s: its compositions are shared, and deleted with the last definition generating it", gvk, el.Namespace, el.Name))
+		}
+	}
+
+	live, err := crdtools.Get(ctx, cli, schema.GroupResource{Group: crd.Spec.Group, Resource: crd.Spec.Names.Plural})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting CRD %s: %w", crd.Name, err)
+	}
+	switch {
+	case live == nil:
+		return nil, warnings, nil
+	case live.Spec.Names.Kind != gvk.Kind:
+		return field.ErrorList{invalid(crdPath, fmt.Sprintf("CRD %s exists and serves kind %s, not %s", live.Name, live.Spec.Names.Kind, gvk.Kind))}, warnings, nil
+	case !generation.IsManaged(live) && !claimed:
+		return field.ErrorList{invalid(crdPath, fmt.Sprintf("CRD %s exists and is not managed by core-provider", live.Name))}, warnings, nil
+	case live.Spec.Scope != crd.Spec.Scope:
+		return field.ErrorList{invalid(crdPath.Child("scope"), fmt.Sprintf("CRD %s is %s and cannot become %s: the scope of a CRD is immutable", live.Name, live.Spec.Scope, crd.Spec.Scope))}, warnings, nil
+	}
+	return nil, warnings, nil
+}
+
+// notChecked returns the warning about a chart that could not be fetched.
+func notChecked(nfo *compositiondefinitionsv1alpha1.ChartInfo, err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("the chart was not checked: chart %s could not be fetched in %s", nfo.Url, FetchTimeout)
+	}
+	return fmt.Sprintf("the chart was not checked: chart %s could not be fetched, the CompositionDefinition will not become ready until it is: %s", nfo.Url, err)
+}
+
+// invalid returns the error of the field at path, described by detail.
+func invalid(path *field.Path, detail string) *field.Error {
+	return &field.Error{
+		Type:     field.ErrorTypeInvalid,
+		Field:    path.String(),
+		BadValue: field.OmitValueType{},
+		Detail:   detail,
+	}
+}
@@ -0,0 +1,362 @@
+package preflight
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const valuesSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "default": 1}
+  }
+}`
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	s := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(s))
+	require.NoError(t, apiextensionsv1.AddToScheme(s))
+	require.NoError(t, compositiondefinitionsv1alpha1.SchemeBuilder.AddToScheme(s))
+	return s
+}
+
+// chartArchive returns the archive of the fireworksapp chart at version 1.2.3, with the values schema when it is not empty.
+func chartArchive(t *testing.T, schema string) []byte {
+	t.Helper()
+
+	files := map[string]string{
+		"fireworksapp/Chart.yaml":  "apiVersion: v2\nname: fireworksapp\nversion: 1.2.3\n",
+		"fireworksapp/values.yaml": "replicas: 1\n",
+	}
+	if schema != "" {
+		files["fireworksapp/values.schema.json"] = schema
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func newDefinition(url string) *compositiondefinitionsv1alpha1.CompositionDefinition {
+	return &compositiondefinitionsv1alpha1.CompositionDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp", Namespace: "krateo-system"},
+		Spec: compositiondefinitionsv1alpha1.CompositionDefinitionSpec{
+			Chart: &compositiondefinitionsv1alpha1.ChartInfo{Url: url},
+		},
+	}
+}
+
+func newRequest(t *testing.T, op v1.Operation, cd, old *compositiondefinitionsv1alpha1.CompositionDefinition) webhook.AdmissionRequest {
+	t.Helper()
+
+	req := webhook.AdmissionRequest{
+		AdmissionRequest: v1.AdmissionRequest{
+			Operation: op,
+			Name:      cd.Name,
+			Namespace: cd.Namespace,
+			Kind:      metav1.GroupVersionKind{Group: "core.krateo.io", Version: "v1alpha1", Kind: "CompositionDefinition"},
+			Resource:  metav1.GroupVersionResource{Group: "core.krateo.io", Version: "v1alpha1", Resource: "compositiondefinitions"},
+		},
+	}
+	dat, err := json.Marshal(cd)
+	require.NoError(t, err)
+	req.Object.Raw = dat
+	if old != nil {
+		dat, err := json.Marshal(old)
+		require.NoError(t, err)
+		req.OldObject.Raw = dat
+	}
+	return req
+}
+
+func newCRD(kind string, managed bool) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps.composition.krateo.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "composition.krateo.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "fireworksapps", Kind: kind},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true, Storage: true},
+			},
+		},
+	}
+	if managed {
+		generation.SetManaged(crd)
+	}
+	return crd
+}
+
+func causes(resp webhook.AdmissionResponse) map[string]string {
+	res := map[string]string{}
+	if resp.Result == nil || resp.Result.Details == nil {
+		return res
+	}
+	for _, el := range resp.Result.Details.Causes {
+		res[el.Field] = el.Message
+	}
+	return res
+}
+
+func TestNewWebhookHandler(t *testing.T) {
+	charts := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "charts", Namespace: "krateo-system"},
+		BinaryData: map[string][]byte{
+			"fireworksapp.tgz":           chartArchive(t, valuesSchema),
+			"fireworksapp-noschema.tgz":  chartArchive(t, ""),
+			"fireworksapp-badschema.tgz": chartArchive(t, "{not json"),
+		},
+	}
+	const url = "configmap://krateo-system/charts/fireworksapp.tgz"
+
+	tests := []struct {
+		name     string
+		objs     []client.Object
+		mutate   func(cd *compositiondefinitionsv1alpha1.CompositionDefinition)
+		denied   map[string]string
+		warnings []string
+	}{
+		{
+			name:   "Valid definitions are allowed",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+		},
+		{
+			name: "Missing chart",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Chart = nil
+			},
+			denied: map[string]string{"spec.chart": "Required value"},
+		},
+		{
+			name: "Chart version longer than the status allows",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Chart.Version = "1.2.3-rc.1+build.20240101"
+			},
+			denied: map[string]string{"spec.chart.version": "may not be more than 20"},
+		},
+		{
+			name: "Chart without values schema",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Chart.Url = "configmap://krateo-system/charts/fireworksapp-noschema.tgz"
+			},
+			denied: map[string]string{"spec.chart": "has no values schema"},
+		},
+		{
+			name: "Chart with an invalid values schema",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Chart.Url = "configmap://krateo-system/charts/fireworksapp-badschema.tgz"
+			},
+			denied: map[string]string{"spec.chart": "is not valid"},
+		},
+		{
+			name: "Invalid CRD names",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.CRD = &compositiondefinitionsv1alpha1.CRDInfo{Group: "nodots"}
+			},
+			denied: map[string]string{"spec.crd": "invalid CRD group"},
+		},
+		{
+			name: "Invalid validation rules",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Validations = []compositiondefinitionsv1alpha1.ValidationRule{{Rule: "self.replicas >"}}
+			},
+			denied: map[string]string{"spec.validations": "invalid CEL validation rules"},
+		},
+		{
+			name:   "CRD not managed by core-provider",
+			objs:   []client.Object{newCRD("Fireworksapp", false)},
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+			denied: map[string]string{"spec.crd": "is not managed by core-provider"},
+		},
+		{
+			name:   "CRD serving another kind",
+			objs:   []client.Object{newCRD("Rocket", true)},
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+			denied: map[string]string{"spec.crd": "serves kind Rocket"},
+		},
+		{
+			name:   "CRD managed by core-provider",
+			objs:   []client.Object{newCRD("Fireworksapp", true)},
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+		},
+		{
+			name: "Version generated by another definition is allowed with a warning",
+			objs: []client.Object{
+				newCRD("Fireworksapp", true),
+				&compositiondefinitionsv1alpha1.CompositionDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp", Namespace: "other"},
+					Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+						ApiVersion: "composition.krateo.io/v1-2-3",
+						Kind:       "Fireworksapp",
+					},
+				},
+			},
+			mutate:   func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+			warnings: []string{"is also generated by CompositionDefinition other/fireworksapp"},
+		},
+		{
+			name: "CRD generated by another definition before the managed label",
+			objs: []client.Object{
+				newCRD("Fireworksapp", false),
+				&compositiondefinitionsv1alpha1.CompositionDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp", Namespace: "other"},
+					Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+						ApiVersion: "composition.krateo.io/v1-0-0",
+						Kind:       "Fireworksapp",
+					},
+				},
+			},
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {},
+		},
+		{
+			name: "Charts that cannot be fetched are allowed with a warning",
+			mutate: func(cd *compositiondefinitionsv1alpha1.CompositionDefinition) {
+				cd.Spec.Chart.Url = "configmap://krateo-system/missing/fireworksapp.tgz"
+			},
+			warnings: []string{"could not be fetched"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(append(tt.objs, charts.DeepCopy())...).Build()
+			cd := newDefinition(url)
+			tt.mutate(cd)
+
+			resp := NewWebhookHandler(cli, cli, tgzfs.Limits{}).Handle(context.Background(), newRequest(t, v1.Create, cd, nil))
+			if len(tt.denied) == 0 {
+				assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+			} else {
+				require.False(t, resp.Allowed)
+				got := causes(resp)
+				require.Len(t, got, len(tt.denied), "causes: %v", got)
+				for fieldPath, msg := range tt.denied {
+					assert.Contains(t, got[fieldPath], msg)
+				}
+			}
+			require.Len(t, resp.Warnings, len(tt.warnings))
+			for i, el := range tt.warnings {
+				assert.Contains(t, resp.Warnings[i], el)
+			}
+		})
+	}
+}
+
+func TestNewWebhookHandlerOnUpdate(t *testing.T) {
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).Build()
+	handler := NewWebhookHandler(cli, cli, tgzfs.Limits{})
+
+	old := newDefinition("configmap://krateo-system/missing/fireworksapp.tgz")
+	old.Spec.Chart.Version = "1.2.3-rc.1+build.20240101"
+
+	t.Run("unchanged specs are not checked", func(t *testing.T) {
+		cd := old.DeepCopy()
+		cd.Finalizers = []string{"composition.krateo.io/finalizer"}
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Update, cd, old))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("changed specs are checked", func(t *testing.T) {
+		cd := old.DeepCopy()
+		cd.Spec.Chart.Version = "1.2.4-rc.1+build.20240101"
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Update, cd, old))
+		require.False(t, resp.Allowed)
+		assert.True(t, strings.Contains(resp.Result.Message, "spec.chart.version"), resp.Result.Message)
+	})
+
+	t.Run("deletes are not checked", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Delete, old, nil))
+		assert.True(t, resp.Allowed)
+	})
+}
+
+func TestNewWebhookHandlerResolvesLikeTheReconcile(t *testing.T) {
+	const index = `apiVersion: v1
+entries:
+  fireworksapp:
+  - name: fireworksapp
+    version: 1.3.0
+    urls: [fireworksapp-1.3.0.tgz]
+  - name: fireworksapp
+    version: 1.2.3
+    urls: [fireworksapp-1.2.3.tgz]
+`
+	// Only the version in use has a valid values schema
+	archives := map[string][]byte{
+		"/fireworksapp-1.2.3.tgz": chartArchive(t, valuesSchema),
+		"/fireworksapp-1.3.0.tgz": chartArchive(t, "{not json"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.yaml" {
+			w.Write([]byte(index))
+			return
+		}
+		if dat, ok := archives[r.URL.Path]; ok {
+			w.Write(dat)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).Build()
+	handler := NewWebhookHandler(cli, cli, tgzfs.Limits{})
+
+	cd := newDefinition(srv.URL)
+	cd.Spec.Chart.Repo = "fireworksapp"
+	cd.Spec.Chart.Version = "^1.2"
+
+	t.Run("the upgrade policy keeps the version in use", func(t *testing.T) {
+		cd := cd.DeepCopy()
+		cd.Status.ResolvedVersion = "1.2.3"
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Create, cd, nil))
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+	})
+
+	t.Run("the newest version is checked on the first resolution", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Create, cd, nil))
+		require.False(t, resp.Allowed)
+		assert.Contains(t, causes(resp)["spec.chart"], "is not valid")
+	})
+
+	t.Run("invalid maintenance windows are denied", func(t *testing.T) {
+		cd := cd.DeepCopy()
+		cd.Spec.Chart.MaintenanceWindows = []compositiondefinitionsv1alpha1.MaintenanceWindow{{Start: "22:00", TimeZone: "Nowhere/City"}}
+		resp := handler.Handle(context.Background(), newRequest(t, v1.Create, cd, nil))
+		require.False(t, resp.Allowed)
+		assert.Contains(t, causes(resp)["spec.chart.maintenanceWindows"], "invalid maintenance window time zone")
+	})
+}
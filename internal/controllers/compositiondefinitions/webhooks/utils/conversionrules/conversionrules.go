@@ -0,0 +1,574 @@
+package conversionrules
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+// PreservedFieldsAnnotation stores the fields that a conversion could not represent in the
+// destination version, so that converting back restores them and a round trip does not lose data.
+const PreservedFieldsAnnotation = "krateo.io/conversion-preserved-fields"
+
+// LayoutVersionAnnotation records the version whose field layout an object has while it is
+// held in the vacuum version, which has a permissive schema and no layout of its own.
+const LayoutVersionAnnotation = "krateo.io/conversion-layout-version"
+
+// VacuumVersion is the name of the permissive storage version of the generated CRDs.
+const VacuumVersion = generation.VacuumVersion
+
+const defaultSeparator = ","
+
+// preserved is the content of the PreservedFieldsAnnotation.
+type preserved struct {
+	// Fields: values removed by drop operations, keyed by path
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Defaulted: paths set by default operations
+	Defaulted []string `json:"defaulted,omitempty"`
+	// Overwritten: values replaced by move operations, keyed by the destination path
+	Overwritten map[string]interface{} `json:"overwritten,omitempty"`
+}
+
+// step is a single rule of a conversion plan, applied forward or in reverse.
+type step struct {
+	rule    v1alpha1.ConversionRule
+	reverse bool
+}
+
+// Validate checks that the rules are well formed.
+func Validate(rules []v1alpha1.ConversionRule) error {
+	for i, r := range rules {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("conversion rule %d: from and to versions are required", i)
+		}
+		if r.From == r.To {
+			return fmt.Errorf("conversion rule %d: from and to versions must differ", i)
+		}
+		for j, op := range r.Operations {
+			if err := validateOperation(op); err != nil {
+				return fmt.Errorf("conversion rule %d (%s -> %s), operation %d: %w", i, r.From, r.To, j, err)
+			}
+		}
+		if err := validateMoves(r.Operations); err != nil {
+			return fmt.Errorf("conversion rule %d (%s -> %s), %w", i, r.From, r.To, err)
+		}
+	}
+	return nil
+}
+
+// validateMoves rejects the moves that would overwrite a field the rule itself writes or moves: a destination
+// inside or around its own source, or a destination also written by another operation of the rule. The values
+// of the object are not known here: a value already at the destination of a move is preserved when it is applied.
+func validateMoves(ops []v1alpha1.ConversionOperation) error {
+	for i, op := range ops {
+		if op.Type != v1alpha1.ConversionOperationMove {
+			continue
+		}
+		if overlaps(op.Path, op.To) {
+			return fmt.Errorf("operation %d: move destination %s overlaps its source %s", i, op.To, op.Path)
+		}
+		for j, other := range ops {
+			if j == i {
+				continue
+			}
+			for _, dst := range destinations(other) {
+				if overlaps(op.To, dst) {
+					return fmt.Errorf("operation %d: move destination %s overlaps %s, written by operation %d", i, op.To, dst, j)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// destinations returns the paths an operation overwrites. A default only sets missing fields and overwrites nothing.
+func destinations(op v1alpha1.ConversionOperation) []string {
+	switch op.Type {
+	case v1alpha1.ConversionOperationMove:
+		return []string{op.To}
+	case v1alpha1.ConversionOperationSplit:
+		return op.Paths
+	case v1alpha1.ConversionOperationJoin:
+		return []string{op.Path}
+	default:
+		return nil
+	}
+}
+
+// overlaps reports whether a path is equal to, or nested in, the other.
+func overlaps(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+func validateOperation(op v1alpha1.ConversionOperation) error {
+	paths := []string{op.Path}
+	switch op.Type {
+	case v1alpha1.ConversionOperationMove:
+		if op.To == "" {
+			return fmt.Errorf("move requires a destination path")
+		}
+		paths = append(paths, op.To)
+	case v1alpha1.ConversionOperationDefault:
+		if op.Value == nil {
+			return fmt.Errorf("default requires a value")
+		}
+	case v1alpha1.ConversionOperationDrop:
+	case v1alpha1.ConversionOperationSplit, v1alpha1.ConversionOperationJoin:
+		if len(op.Paths) == 0 {
+			return fmt.Errorf("%s requires at least one path", op.Type)
+		}
+		paths = append(paths, op.Paths...)
+	default:
+		return fmt.Errorf("unknown operation type %q", op.Type)
+	}
+
+	for _, p := range paths {
+		if _, err := splitPath(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Convert migrates the fields of obj from version `from` to version `to` following rules.
+// Rules are chained when no direct rule exists and are applied in reverse when converting
+// towards the From version of a rule. When no chain of rules connects the two versions,
+// obj is left untouched and the versions are assumed to be field-compatible.
+// Objects converted to the VacuumVersion keep their layout, which is recorded in the
+// LayoutVersionAnnotation and used as the source version when they are read back.
+func Convert(obj *unstructured.Unstructured, from, to string, rules []v1alpha1.ConversionRule) error {
+	if obj == nil {
+		return nil
+	}
+
+	annotations := obj.GetAnnotations()
+	if from == VacuumVersion {
+		if v := annotations[LayoutVersionAnnotation]; v != "" {
+			from = v
+		}
+	}
+	if to == VacuumVersion {
+		if from != VacuumVersion {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[LayoutVersionAnnotation] = from
+			obj.SetAnnotations(annotations)
+		}
+		return nil
+	}
+	if _, ok := annotations[LayoutVersionAnnotation]; ok {
+		delete(annotations, LayoutVersionAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+
+	if from == to || len(rules) == 0 {
+		return nil
+	}
+
+	plan := resolvePlan(from, to, rules)
+	if len(plan) == 0 {
+		return nil
+	}
+
+	state, err := readPreserved(obj)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range plan {
+		ops := slices.Clone(s.rule.Operations)
+		if s.reverse {
+			slices.Reverse(ops)
+		}
+		for _, op := range ops {
+			if err := apply(obj.Object, op, s.reverse, state); err != nil {
+				return fmt.Errorf("converting %s -> %s: %w", s.rule.From, s.rule.To, err)
+			}
+		}
+	}
+
+	return writePreserved(obj, state)
+}
+
+// Covers reports whether converting the objects of version from to version to following rules carries the field at
+// path: the field, or one of its parents, is moved, dropped into the PreservedFieldsAnnotation, split or joined by a
+// rule of the chain, so that it is not pruned when the objects are stored in version to.
+func Covers(rules []v1alpha1.ConversionRule, from, to, path string) bool {
+	for _, s := range resolvePlan(from, to, rules) {
+		for _, op := range s.rule.Operations {
+			for _, src := range sources(op, s.reverse) {
+				if path == src || strings.HasPrefix(path, src+".") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// sources returns the paths an operation reads and moves away, applied forward or in reverse.
+func sources(op v1alpha1.ConversionOperation, reverse bool) []string {
+	switch op.Type {
+	case v1alpha1.ConversionOperationMove:
+		if reverse {
+			return []string{op.To}
+		}
+		return []string{op.Path}
+	case v1alpha1.ConversionOperationDrop:
+		if reverse {
+			return nil
+		}
+		return []string{op.Path}
+	case v1alpha1.ConversionOperationSplit:
+		if reverse {
+			return op.Paths
+		}
+		return []string{op.Path}
+	case v1alpha1.ConversionOperationJoin:
+		if reverse {
+			return []string{op.Path}
+		}
+		return op.Paths
+	default:
+		return nil
+	}
+}
+
+// resolvePlan finds the shortest chain of rules that leads from one version to another.
+func resolvePlan(from, to string, rules []v1alpha1.ConversionRule) []step {
+	prev := map[string]step{}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			break
+		}
+
+		for _, r := range rules {
+			next, s := "", step{rule: r}
+			switch cur {
+			case r.From:
+				next = r.To
+			case r.To:
+				next, s.reverse = r.From, true
+			default:
+				continue
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			prev[next] = s
+			queue = append(queue, next)
+		}
+	}
+
+	if !visited[to] {
+		return nil
+	}
+
+	plan := []step{}
+	for cur := to; cur != from; {
+		s := prev[cur]
+		plan = append(plan, s)
+		if s.reverse {
+			cur = s.rule.To
+		} else {
+			cur = s.rule.From
+		}
+	}
+	slices.Reverse(plan)
+
+	return plan
+}
+
+func apply(obj map[string]interface{}, op v1alpha1.ConversionOperation, reverse bool, state *preserved) error {
+	sep := op.Separator
+	if sep == "" {
+		sep = defaultSeparator
+	}
+
+	switch op.Type {
+	case v1alpha1.ConversionOperationMove:
+		if reverse {
+			return unmove(obj, op.To, op.Path, state)
+		}
+		return move(obj, op.Path, op.To, state)
+	case v1alpha1.ConversionOperationDefault:
+		if reverse {
+			return undoDefault(obj, op.Path, state)
+		}
+		return setDefault(obj, op.Path, op.Value.Raw, state)
+	case v1alpha1.ConversionOperationDrop:
+		if reverse {
+			return restore(obj, op.Path, state)
+		}
+		return drop(obj, op.Path, state)
+	case v1alpha1.ConversionOperationSplit:
+		if reverse {
+			return join(obj, op.Paths, op.Path, sep)
+		}
+		return split(obj, op.Path, op.Paths, sep)
+	case v1alpha1.ConversionOperationJoin:
+		if reverse {
+			return split(obj, op.Path, op.Paths, sep)
+		}
+		return join(obj, op.Paths, op.Path, sep)
+	default:
+		return fmt.Errorf("unknown operation type %q", op.Type)
+	}
+}
+
+// move moves the field at src to dst. The moved field takes precedence over a value already at dst, which is
+// preserved and restored by unmove.
+func move(obj map[string]interface{}, src, dst string, state *preserved) error {
+	val, found, err := get(obj, src)
+	if err != nil || !found {
+		return err
+	}
+	old, found, err := get(obj, dst)
+	if err != nil {
+		return err
+	}
+	if found {
+		if state.Overwritten == nil {
+			state.Overwritten = map[string]interface{}{}
+		}
+		state.Overwritten[dst] = old
+	}
+	if err := set(obj, dst, val); err != nil {
+		return err
+	}
+	return remove(obj, src)
+}
+
+// unmove reverts a move: the field at src is moved back to dst, and the value the move overwrote at src is restored.
+func unmove(obj map[string]interface{}, src, dst string, state *preserved) error {
+	val, found, err := get(obj, src)
+	if err != nil {
+		return err
+	}
+	if found {
+		if err := set(obj, dst, val); err != nil {
+			return err
+		}
+		if err := remove(obj, src); err != nil {
+			return err
+		}
+	}
+
+	old, ok := state.Overwritten[src]
+	if !ok {
+		return nil
+	}
+	delete(state.Overwritten, src)
+	return set(obj, src, old)
+}
+
+func setDefault(obj map[string]interface{}, path string, raw []byte, state *preserved) error {
+	_, found, err := get(obj, path)
+	if err != nil || found {
+		return err
+	}
+
+	// utiljson decodes whole numbers as int64, as the apiserver does for unstructured objects
+	var val interface{}
+	if err := utiljson.Unmarshal(raw, &val); err != nil {
+		return fmt.Errorf("failed to unmarshal default value for %s: %w", path, err)
+	}
+	if err := set(obj, path, val); err != nil {
+		return err
+	}
+	if !slices.Contains(state.Defaulted, path) {
+		state.Defaulted = append(state.Defaulted, path)
+	}
+	return nil
+}
+
+func undoDefault(obj map[string]interface{}, path string, state *preserved) error {
+	i := slices.Index(state.Defaulted, path)
+	if i == -1 {
+		return nil
+	}
+	state.Defaulted = slices.Delete(state.Defaulted, i, i+1)
+	return remove(obj, path)
+}
+
+func drop(obj map[string]interface{}, path string, state *preserved) error {
+	val, found, err := get(obj, path)
+	if err != nil || !found {
+		return err
+	}
+	if state.Fields == nil {
+		state.Fields = map[string]interface{}{}
+	}
+	state.Fields[path] = val
+	return remove(obj, path)
+}
+
+func restore(obj map[string]interface{}, path string, state *preserved) error {
+	val, ok := state.Fields[path]
+	if !ok {
+		return nil
+	}
+	delete(state.Fields, path)
+	return set(obj, path, val)
+}
+
+func split(obj map[string]interface{}, src string, dst []string, sep string) error {
+	val, found, err := get(obj, src)
+	if err != nil || !found {
+		return err
+	}
+	s, ok := val.(string)
+	if !ok {
+		return fmt.Errorf("cannot split %s: value is %T, not a string", src, val)
+	}
+
+	parts := strings.SplitN(s, sep, len(dst))
+	for i, p := range parts {
+		if err := set(obj, dst[i], p); err != nil {
+			return err
+		}
+	}
+	return remove(obj, src)
+}
+
+func join(obj map[string]interface{}, src []string, dst string, sep string) error {
+	parts := make([]string, len(src))
+	last := -1
+	for i, p := range src {
+		val, found, err := get(obj, p)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("cannot join %s: value is %T, not a string", p, val)
+		}
+		parts[i] = s
+		last = i
+	}
+	if last == -1 {
+		return nil
+	}
+
+	if err := set(obj, dst, strings.Join(parts[:last+1], sep)); err != nil {
+		return err
+	}
+	for _, p := range src {
+		if err := remove(obj, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func get(obj map[string]interface{}, path string) (interface{}, bool, error) {
+	fields, err := splitPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	// NestedFieldNoCopy errors when an intermediate field is not a map: treat it as not found
+	val, found, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if err != nil {
+		return nil, false, nil
+	}
+	return val, found, nil
+}
+
+func set(obj map[string]interface{}, path string, val interface{}) error {
+	fields, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(obj, runtime.DeepCopyJSONValue(val), fields...); err != nil {
+		return fmt.Errorf("error setting %s: %w", path, err)
+	}
+	return nil
+}
+
+func remove(obj map[string]interface{}, path string) error {
+	fields, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	unstructured.RemoveNestedField(obj, fields...)
+	pruneEmptyParents(obj, fields[:len(fields)-1])
+	return nil
+}
+
+// pruneEmptyParents removes the objects left empty by a removal, so that moving
+// the last field out of an object does not leave an empty object behind.
+func pruneEmptyParents(obj map[string]interface{}, fields []string) {
+	for i := len(fields); i > 1; i-- {
+		val, found, err := unstructured.NestedFieldNoCopy(obj, fields[:i]...)
+		if err != nil || !found {
+			continue
+		}
+		m, ok := val.(map[string]interface{})
+		if !ok || len(m) > 0 {
+			return
+		}
+		unstructured.RemoveNestedField(obj, fields[:i]...)
+	}
+}
+
+func splitPath(path string) ([]string, error) {
+	fields := strings.Split(path, ".")
+	if len(fields) < 2 || (fields[0] != "spec" && fields[0] != "status") {
+		return nil, fmt.Errorf("invalid path %q: must be rooted at spec or status", path)
+	}
+	if slices.Contains(fields, "") {
+		return nil, fmt.Errorf("invalid path %q: empty field name", path)
+	}
+	return fields, nil
+}
+
+func readPreserved(obj *unstructured.Unstructured) (*preserved, error) {
+	state := &preserved{}
+	raw, ok := obj.GetAnnotations()[PreservedFieldsAnnotation]
+	if !ok || raw == "" {
+		return state, nil
+	}
+	if err := utiljson.Unmarshal([]byte(raw), state); err != nil {
+		return nil, fmt.Errorf("error decoding %s annotation: %w", PreservedFieldsAnnotation, err)
+	}
+	return state, nil
+}
+
+func writePreserved(obj *unstructured.Unstructured, state *preserved) error {
+	annotations := obj.GetAnnotations()
+	if len(state.Fields) == 0 && len(state.Defaulted) == 0 && len(state.Overwritten) == 0 {
+		if _, ok := annotations[PreservedFieldsAnnotation]; ok {
+			delete(annotations, PreservedFieldsAnnotation)
+			obj.SetAnnotations(annotations)
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding %s annotation: %w", PreservedFieldsAnnotation, err)
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[PreservedFieldsAnnotation] = string(raw)
+	obj.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,295 @@
+package conversionrules
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newObj(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "composition.krateo.io/v1-0-0",
+			"kind":       "Example",
+			"metadata":   map[string]interface{}{"name": "example"},
+			"spec":       spec,
+		},
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []v1alpha1.ConversionRule
+		from, to string
+		spec     map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "Move field forward",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+				},
+			}},
+			from: "v1-0-0", to: "v1-1-0",
+			spec:     map[string]interface{}{"image": "nginx"},
+			expected: map[string]interface{}{"container": map[string]interface{}{"image": "nginx"}},
+		},
+		{
+			name: "Move field backward prunes empty parents",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+				},
+			}},
+			from: "v1-1-0", to: "v1-0-0",
+			spec:     map[string]interface{}{"container": map[string]interface{}{"image": "nginx"}},
+			expected: map[string]interface{}{"image": "nginx"},
+		},
+		{
+			name: "Split and chain rules",
+			rules: []v1alpha1.ConversionRule{
+				{
+					From: "v1-0-0", To: "v1-1-0",
+					Operations: []v1alpha1.ConversionOperation{
+						{Type: v1alpha1.ConversionOperationSplit, Path: "spec.image", Paths: []string{"spec.repository", "spec.tag"}, Separator: ":"},
+					},
+				},
+				{
+					From: "v1-1-0", To: "v2-0-0",
+					Operations: []v1alpha1.ConversionOperation{
+						{Type: v1alpha1.ConversionOperationDefault, Path: "spec.replicas", Value: &apiextensionsv1.JSON{Raw: []byte("2")}},
+					},
+				},
+			},
+			from: "v1-0-0", to: "v2-0-0",
+			spec:     map[string]interface{}{"image": "nginx:1.27"},
+			expected: map[string]interface{}{"repository": "nginx", "tag": "1.27", "replicas": int64(2)},
+		},
+		{
+			name: "No rule between versions copies verbatim",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationDrop, Path: "spec.legacy"},
+				},
+			}},
+			from: "v3-0-0", to: "v4-0-0",
+			spec:     map[string]interface{}{"legacy": true},
+			expected: map[string]interface{}{"legacy": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newObj(tt.spec)
+			err := Convert(obj, tt.from, tt.to, tt.rules)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, obj.Object["spec"])
+		})
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	rules := []v1alpha1.ConversionRule{{
+		From: "v1-0-0", To: "v1-1-0",
+		Operations: []v1alpha1.ConversionOperation{
+			{Type: v1alpha1.ConversionOperationDrop, Path: "spec.legacy"},
+			{Type: v1alpha1.ConversionOperationDefault, Path: "spec.replicas", Value: &apiextensionsv1.JSON{Raw: []byte("1")}},
+			{Type: v1alpha1.ConversionOperationJoin, Path: "spec.image", Paths: []string{"spec.repository", "spec.tag"}, Separator: ":"},
+		},
+	}}
+
+	original := map[string]interface{}{
+		"legacy":     map[string]interface{}{"enabled": true},
+		"repository": "nginx",
+		"tag":        "1.27",
+	}
+	obj := newObj(original)
+
+	require.NoError(t, Convert(obj, "v1-0-0", "v1-1-0", rules))
+	assert.Equal(t, map[string]interface{}{"image": "nginx:1.27", "replicas": int64(1)}, obj.Object["spec"])
+	assert.Contains(t, obj.GetAnnotations(), PreservedFieldsAnnotation)
+
+	require.NoError(t, Convert(obj, "v1-1-0", "v1-0-0", rules))
+	assert.Equal(t, map[string]interface{}{
+		"legacy":     map[string]interface{}{"enabled": true},
+		"repository": "nginx",
+		"tag":        "1.27",
+	}, obj.Object["spec"])
+	assert.NotContains(t, obj.GetAnnotations(), PreservedFieldsAnnotation)
+}
+
+func TestConvertMoveRoundTripPreservesOverwrittenValue(t *testing.T) {
+	rules := []v1alpha1.ConversionRule{{
+		From: "v1-0-0", To: "v1-1-0",
+		Operations: []v1alpha1.ConversionOperation{
+			{Type: v1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+		},
+	}}
+
+	obj := newObj(map[string]interface{}{
+		"image":     "nginx",
+		"container": map[string]interface{}{"image": "busybox", "port": int64(80)},
+	})
+
+	// The moved field takes precedence, the value it replaces is preserved
+	require.NoError(t, Convert(obj, "v1-0-0", "v1-1-0", rules))
+	assert.Equal(t, map[string]interface{}{"container": map[string]interface{}{"image": "nginx", "port": int64(80)}}, obj.Object["spec"])
+	assert.Contains(t, obj.GetAnnotations(), PreservedFieldsAnnotation)
+
+	require.NoError(t, Convert(obj, "v1-1-0", "v1-0-0", rules))
+	assert.Equal(t, map[string]interface{}{
+		"image":     "nginx",
+		"container": map[string]interface{}{"image": "busybox", "port": int64(80)},
+	}, obj.Object["spec"])
+	assert.NotContains(t, obj.GetAnnotations(), PreservedFieldsAnnotation)
+}
+
+func TestConvertThroughStorageVersion(t *testing.T) {
+	rules := []v1alpha1.ConversionRule{{
+		From: "v1-0-0", To: "v1-1-0",
+		Operations: []v1alpha1.ConversionOperation{
+			{Type: v1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+		},
+	}}
+
+	obj := newObj(map[string]interface{}{"image": "nginx"})
+
+	require.NoError(t, Convert(obj, "v1-0-0", VacuumVersion, rules))
+	assert.Equal(t, map[string]interface{}{"image": "nginx"}, obj.Object["spec"])
+	assert.Equal(t, "v1-0-0", obj.GetAnnotations()[LayoutVersionAnnotation])
+
+	require.NoError(t, Convert(obj, VacuumVersion, "v1-1-0", rules))
+	assert.Equal(t, map[string]interface{}{"container": map[string]interface{}{"image": "nginx"}}, obj.Object["spec"])
+	assert.NotContains(t, obj.GetAnnotations(), LayoutVersionAnnotation)
+}
+
+func TestCovers(t *testing.T) {
+	rules := []v1alpha1.ConversionRule{
+		{
+			From: "v1-0-0", To: "v1-1-0",
+			Operations: []v1alpha1.ConversionOperation{
+				{Type: v1alpha1.ConversionOperationMove, Path: "spec.image", To: "spec.container.image"},
+				{Type: v1alpha1.ConversionOperationDrop, Path: "spec.legacy"},
+			},
+		},
+		{
+			From: "v1-1-0", To: "v1-2-0",
+			Operations: []v1alpha1.ConversionOperation{
+				{Type: v1alpha1.ConversionOperationJoin, Paths: []string{"spec.host", "spec.port"}, Path: "spec.address"},
+			},
+		},
+	}
+
+	assert.True(t, Covers(rules, "v1-0-0", "v1-1-0", "spec.image"))
+	assert.True(t, Covers(rules, "v1-0-0", "v1-1-0", "spec.legacy.flag"), "the fields of a dropped object are preserved")
+	assert.True(t, Covers(rules, "v1-0-0", "v1-2-0", "spec.port"), "rules are chained")
+	assert.True(t, Covers(rules, "v1-1-0", "v1-0-0", "spec.container.image"), "rules are applied in reverse")
+	assert.False(t, Covers(rules, "v1-1-0", "v1-0-0", "spec.legacy"), "a restored field is not carried")
+	assert.False(t, Covers(rules, "v1-0-0", "v1-1-0", "spec.replicas"))
+	assert.False(t, Covers(rules, "v1-0-0", "v2-0-0", "spec.image"), "no chain of rules")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     []v1alpha1.ConversionRule
+		expectErr bool
+	}{
+		{
+			name: "Valid rules",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.b"},
+				},
+			}},
+		},
+		{
+			name:      "Same versions",
+			rules:     []v1alpha1.ConversionRule{{From: "v1-0-0", To: "v1-0-0"}},
+			expectErr: true,
+		},
+		{
+			name: "Path outside spec and status",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationDrop, Path: "metadata.labels"},
+				},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Move into its own source",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.a.b"},
+				},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Moves to the same destination",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.c"},
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.b", To: "spec.c"},
+				},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Move into a joined field",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationJoin, Path: "spec.c", Paths: []string{"spec.x", "spec.y"}},
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.c.d"},
+				},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Move with a default at the destination",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a", To: "spec.b"},
+					{Type: v1alpha1.ConversionOperationDefault, Path: "spec.b", Value: &apiextensionsv1.JSON{Raw: []byte(`1`)}},
+				},
+			}},
+		},
+		{
+			name: "Move without destination",
+			rules: []v1alpha1.ConversionRule{{
+				From: "v1-0-0", To: "v1-1-0",
+				Operations: []v1alpha1.ConversionOperation{
+					{Type: v1alpha1.ConversionOperationMove, Path: "spec.a"},
+				},
+			}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.rules)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package crdcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/defaults"
+	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
+	crdtools "github.com/krateoplatformops/core-provider/internal/tools/crd"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
+	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultResyncPeriod is the period after which the informer delivers again every CRD it holds.
+const DefaultResyncPeriod = 10 * time.Minute
+
+// Cache serves the CRDs generated by core-provider to the webhooks from a shared informer, filtered on the
+// generation.ManagedByLabel label, so that an admission request does not cost an API server round trip.
+// The CRDs the informer does not hold, because it is not synced yet or because they are not labeled yet,
+// are read from the fallback reader. The CRDs returned are shared with the informer and must not be modified.
+type Cache struct {
+	factory  apiextensionsinformers.SharedInformerFactory
+	informer toolscache.SharedIndexInformer
+	lister   apiextensionslisters.CustomResourceDefinitionLister
+	fallback client.Reader
+	metrics  *webhooktelemetry.Metrics
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	schemas map[schemaKey]cachedSchema
+}
+
+// schemaKey identifies a version of a CRD.
+type schemaKey struct {
+	name    string
+	version string
+}
+
+// cachedSchema is the spec schema of a version, along with the resource version of the CRD it was read from.
+type cachedSchema struct {
+	resourceVersion string
+	schema          *apiextensionsv1.JSONSchemaProps
+}
+
+// New returns a cache of the CRDs generated by core-provider. The informer runs once the cache is started,
+// usually by adding it to the manager.
+func New(cs clientset.Interface, fallback client.Reader, resync time.Duration, metrics ...*webhooktelemetry.Metrics) *Cache {
+	var recorder *webhooktelemetry.Metrics
+	if len(metrics) > 0 {
+		recorder = metrics[0]
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{generation.ManagedByLabel: generation.ManagedByValue}).String()
+	factory := apiextensionsinformers.NewSharedInformerFactoryWithOptions(cs, resync,
+		apiextensionsinformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		}))
+	crds := factory.Apiextensions().V1().CustomResourceDefinitions()
+
+	c := &Cache{
+		factory:  factory,
+		informer: crds.Informer(),
+		lister:   crds.Lister(),
+		fallback: fallback,
+		metrics:  recorder,
+		seen:     map[string]time.Time{},
+		schemas:  map[schemaKey]cachedSchema{},
+	}
+	// The informer cannot be running yet, so registering the handler cannot fail
+	_, _ = c.informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    c.touch,
+		UpdateFunc: func(_, obj interface{}) { c.touch(obj) },
+		DeleteFunc: c.forget,
+	})
+	return c
+}
+
+// Start runs the informer until ctx is done.
+func (c *Cache) Start(ctx context.Context) error {
+	c.factory.Start(ctx.Done())
+	<-ctx.Done()
+	c.factory.Shutdown()
+	return nil
+}
+
+// NeedLeaderElection returns false: the webhooks are served by every replica.
+func (c *Cache) NeedLeaderElection() bool {
+	return false
+}
+
+// HasSynced reports whether the informer holds every labeled CRD.
+func (c *Cache) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// Get returns the CRD of the group resource, nil when it does not exist.
+func (c *Cache) Get(ctx context.Context, gr schema.GroupResource) (*apiextensionsv1.CustomResourceDefinition, error) {
+	started := time.Now()
+	if c.informer.HasSynced() {
+		crd, err := c.lister.Get(gr.String())
+		if err == nil {
+			c.metrics.RecordCRDLookup(ctx, "cache", time.Since(started))
+			c.mu.Lock()
+			seen, ok := c.seen[crd.Name]
+			c.mu.Unlock()
+			if ok {
+				c.metrics.RecordCRDCacheAge(ctx, time.Since(seen))
+			}
+			return crd, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	crd, err := crdtools.Get(ctx, c.fallback, gr)
+	c.metrics.RecordCRDLookup(ctx, "apiserver", time.Since(started))
+	return crd, err
+}
+
+// SpecSchema returns the schema of the spec of the version of the CRD, nil when the version does not define a
+// spec. The schema is read once for each resource version of the CRD and must not be modified.
+func (c *Cache) SpecSchema(crd *apiextensionsv1.CustomResourceDefinition, version string) (*apiextensionsv1.JSONSchemaProps, error) {
+	key := schemaKey{name: crd.Name, version: version}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.schemas[key]; ok && el.resourceVersion == crd.ResourceVersion {
+		return el.schema, nil
+	}
+
+	sch, err := defaults.SpecSchema(crd, version)
+	if err != nil {
+		return nil, err
+	}
+	c.schemas[key] = cachedSchema{resourceVersion: crd.ResourceVersion, schema: sch}
+	return sch, nil
+}
+
+// touch records that the informer delivered the CRD.
+func (c *Cache) touch(obj interface{}) {
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[crd.Name] = time.Now()
+}
+
+// forget drops what is recorded about a deleted CRD.
+func (c *Cache) forget(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, crd.Name)
+	for key := range c.schemas {
+		if key.name == crd.Name {
+			delete(c.schemas, key)
+		}
+	}
+}
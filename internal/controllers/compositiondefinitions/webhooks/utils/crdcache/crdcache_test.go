@@ -0,0 +1,124 @@
+package crdcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// countingReader counts the reads that reach the fallback reader.
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (r *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	r.gets++
+	return r.Reader.Get(ctx, key, obj, opts...)
+}
+
+func newCRD(name, resourceVersion string, managed bool, field string) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: resourceVersion},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name: "v1",
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {
+									Type: "object",
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										field: {Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if managed {
+		generation.SetManaged(crd)
+	}
+	return crd
+}
+
+func TestCache(t *testing.T) {
+	managed := newCRD("examples.example.com", "1", true, "a")
+	unlabeled := newCRD("legacies.example.com", "1", false, "a")
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+	fallback := &countingReader{Reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(unlabeled.DeepCopy()).Build()}
+	crds := New(apiextensionsfake.NewSimpleClientset(managed.DeepCopy(), unlabeled.DeepCopy()), fallback, 0)
+	assert.False(t, crds.NeedLeaderElection())
+
+	// Before the informer is synced, the CRDs are read from the fallback reader
+	crd, err := crds.Get(context.Background(), schema.GroupResource{Group: "example.com", Resource: "legacies"})
+	require.NoError(t, err)
+	require.NotNil(t, crd)
+	assert.Equal(t, 1, fallback.gets)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- crds.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+	require.Eventually(t, crds.HasSynced, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("Labeled CRDs are served by the informer", func(t *testing.T) {
+		gets := fallback.gets
+		crd, err := crds.Get(context.Background(), schema.GroupResource{Group: "example.com", Resource: "examples"})
+		require.NoError(t, err)
+		require.NotNil(t, crd)
+		assert.Equal(t, managed.Name, crd.Name)
+		assert.Equal(t, gets, fallback.gets)
+	})
+
+	t.Run("Unlabeled and missing CRDs are read from the fallback reader", func(t *testing.T) {
+		gets := fallback.gets
+		crd, err := crds.Get(context.Background(), schema.GroupResource{Group: "example.com", Resource: "legacies"})
+		require.NoError(t, err)
+		require.NotNil(t, crd)
+		assert.Equal(t, unlabeled.Name, crd.Name)
+
+		crd, err = crds.Get(context.Background(), schema.GroupResource{Group: "example.com", Resource: "missings"})
+		require.NoError(t, err)
+		assert.Nil(t, crd)
+		assert.Equal(t, gets+2, fallback.gets)
+	})
+
+	t.Run("Spec schemas are cached per resource version", func(t *testing.T) {
+		first, err := crds.SpecSchema(managed, "v1")
+		require.NoError(t, err)
+		require.Contains(t, first.Properties, "a")
+
+		again, err := crds.SpecSchema(managed, "v1")
+		require.NoError(t, err)
+		assert.Same(t, first, again)
+
+		updated, err := crds.SpecSchema(newCRD(managed.Name, "2", true, "b"), "v1")
+		require.NoError(t, err)
+		assert.Contains(t, updated.Properties, "b")
+
+		_, err = crds.SpecSchema(managed, "v2")
+		assert.Error(t, err)
+	})
+}
@@ -1,13 +1,13 @@
 package defaults
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
 )
 
 // PopulateDefaultsFromCRD applies default values from the CRD's OpenAPI schema to the custom resource spec.
@@ -21,43 +21,72 @@ func PopulateDefaultsFromCRD(crd *apiextensionsv1.CustomResourceDefinition, cr *
 		return fmt.Errorf("custom resource is nil")
 	}
 
-	// Find the appropriate version schema
-	// First, try to get the schema from the stored version
-	var schema *apiextensionsv1.JSONSchemaProps
-	crVersion := ""
-
 	// Extract version from the custom resource
 	crUnstructured, ok := (*cr).(*unstructured.Unstructured)
 	if !ok {
 		return fmt.Errorf("custom resource must be an *unstructured.Unstructured")
 	}
+	crVersion, err := Version(crUnstructured)
+	if err != nil {
+		return err
+	}
+
+	specSchema, err := SpecSchema(crd, crVersion)
+	if err != nil {
+		return err
+	}
+
+	return PopulateDefaults(specSchema, cr)
+}
 
-	crAPIVersion := crUnstructured.GetAPIVersion()
+// Version returns the version of the apiVersion of the custom resource.
+func Version(cr *unstructured.Unstructured) (string, error) {
+	crAPIVersion := cr.GetAPIVersion()
 	parts := strings.Split(crAPIVersion, "/")
-	if len(parts) == 2 {
-		crVersion = parts[1]
-	} else {
-		return fmt.Errorf("invalid apiVersion format in custom resource: %s", crAPIVersion)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid apiVersion format in custom resource: %s", crAPIVersion)
 	}
+	return parts[1], nil
+}
 
+// SpecSchema returns a copy of the schema of the spec of the version of the CRD, nil when the schema of the version
+// does not define a spec.
+func SpecSchema(crd *apiextensionsv1.CustomResourceDefinition, version string) (*apiextensionsv1.JSONSchemaProps, error) {
 	// Find the schema for the resource version
-	for _, version := range crd.Spec.Versions {
-		if version.Name == crVersion && version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
-			schema = version.Schema.OpenAPIV3Schema
+	var schema *apiextensionsv1.JSONSchemaProps
+	for _, el := range crd.Spec.Versions {
+		if el.Name == version && el.Schema != nil && el.Schema.OpenAPIV3Schema != nil {
+			schema = el.Schema.OpenAPIV3Schema
 			break
 		}
 	}
 
 	if schema == nil {
-		return fmt.Errorf("no schema found for version %s in CRD %s", crVersion, crd.Name)
+		return nil, fmt.Errorf("no schema found for version %s in CRD %s", version, crd.Name)
 	}
 
 	// Now find the spec field in the schema
 	specSchema, found := schema.Properties["spec"]
 	if !found {
 		// No spec field defined in the schema
+		return nil, nil
+	}
+	return specSchema.DeepCopy(), nil
+}
+
+// PopulateDefaults applies the default values of the spec schema to the custom resource spec, as
+// PopulateDefaultsFromCRD does. A nil schema applies no default.
+func PopulateDefaults(specSchema *apiextensionsv1.JSONSchemaProps, cr *runtime.Object) error {
+	if specSchema == nil {
 		return nil
 	}
+	if cr == nil || *cr == nil {
+		return fmt.Errorf("custom resource is nil")
+	}
+	crUnstructured, ok := (*cr).(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("custom resource must be an *unstructured.Unstructured")
+	}
 
 	// Get the current spec from the custom resource
 	spec, found, err := unstructured.NestedFieldCopy(crUnstructured.Object, "spec")
@@ -75,8 +104,9 @@ func PopulateDefaultsFromCRD(crd *apiextensionsv1.CustomResourceDefinition, cr *
 		return fmt.Errorf("spec field is not a map")
 	}
 
-	// Recursively apply defaults
-	err = applyDefaultsToMap(specSchema.Properties, specMap)
+	// Prune the nulls the apiserver drops, then apply defaults recursively
+	pruneNulls(specMap, specSchema)
+	err = applyDefaults(specMap, specSchema)
 	if err != nil {
 		return err
 	}
@@ -90,78 +120,132 @@ func PopulateDefaultsFromCRD(crd *apiextensionsv1.CustomResourceDefinition, cr *
 	return nil
 }
 
-// applyDefaultsToMap recursively applies default values to a map according to the schema
-func applyDefaultsToMap(properties map[string]apiextensionsv1.JSONSchemaProps, targetMap map[string]interface{}) error {
-	for fieldName, fieldSchema := range properties {
-		// Skip if the field is already set
-		if _, exists := targetMap[fieldName]; exists {
-			// If it's an object, recurse into it
-			if fieldSchema.Type == "object" && len(fieldSchema.Properties) > 0 {
-				fieldValue, ok := targetMap[fieldName].(map[string]interface{})
-				if !ok {
-					// Field exists but is not a map, skip recursion
-					continue
-				}
+// applyDefaults recursively applies the default values of the schema to x, as the apiserver structural defaulting does.
+// A default is applied to a field that is missing or null and not nullable, in objects (properties and
+// additionalProperties values) and in the items of arrays, then the defaulted values are walked as well.
+// Missing objects and arrays are not created, and the fields a schema does not describe, such as the ones
+// preserved by x-kubernetes-preserve-unknown-fields, are left alone.
+func applyDefaults(x interface{}, schema *apiextensionsv1.JSONSchemaProps) error {
+	if schema == nil {
+		return nil
+	}
 
-				// Recursively apply defaults to the nested object
-				if err := applyDefaultsToMap(fieldSchema.Properties, fieldValue); err != nil {
-					return err
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for fieldName, fieldSchema := range schema.Properties {
+			if fieldSchema.Default == nil {
+				continue
+			}
+			if value, exists := x[fieldName]; !exists || isNonNullableNull(value, &fieldSchema) {
+				defaultValue, err := defaultOf(&fieldSchema)
+				if err != nil {
+					return fmt.Errorf("failed to unmarshal default value for field %s: %w", fieldName, err)
 				}
+				x[fieldName] = defaultValue
 			}
-			continue
 		}
-
-		// If there's a default value, apply it
-		if fieldSchema.Default != nil {
-			var defaultValue interface{}
-			if err := json.Unmarshal(fieldSchema.Default.Raw, &defaultValue); err != nil {
-				return fmt.Errorf("failed to unmarshal default value for field %s: %w", fieldName, err)
+		for fieldName := range x {
+			if fieldSchema, found := schema.Properties[fieldName]; found {
+				if err := applyDefaults(x[fieldName], &fieldSchema); err != nil {
+					return err
+				}
+				continue
 			}
-
-			// Convert float64 to int64 if needed based on the field type
-			if fieldSchema.Type == "integer" {
-				if floatVal, ok := defaultValue.(float64); ok {
-					// Convert float64 to int64 for integer fields
-					defaultValue = int64(floatVal)
+			valueSchema := additionalPropertiesOf(schema)
+			if valueSchema == nil {
+				continue
+			}
+			if isNonNullableNull(x[fieldName], valueSchema) && valueSchema.Default != nil {
+				defaultValue, err := defaultOf(valueSchema)
+				if err != nil {
+					return fmt.Errorf("failed to unmarshal default value for field %s: %w", fieldName, err)
 				}
+				x[fieldName] = defaultValue
 			}
-
-			targetMap[fieldName] = defaultValue
-		} else if fieldSchema.Type == "object" && len(fieldSchema.Properties) > 0 {
-			// Create nested object and apply defaults recursively
-			nestedMap := map[string]interface{}{}
-			if err := applyDefaultsToMap(fieldSchema.Properties, nestedMap); err != nil {
+			if err := applyDefaults(x[fieldName], valueSchema); err != nil {
 				return err
 			}
-
-			// Only add the nested map if it has any values
-			if len(nestedMap) > 0 {
-				targetMap[fieldName] = nestedMap
-			}
-		} else if fieldSchema.Type == "array" && fieldSchema.Items != nil && fieldSchema.Items.Schema != nil {
-			// Handle array defaults if needed
-			if fieldSchema.MinItems != nil && *fieldSchema.MinItems > 0 && fieldSchema.Items.Schema.Default != nil {
-				var defaultItem interface{}
-				if err := json.Unmarshal(fieldSchema.Items.Schema.Default.Raw, &defaultItem); err != nil {
-					return fmt.Errorf("failed to unmarshal default array item for field %s: %w", fieldName, err)
+		}
+	case []interface{}:
+		itemSchema := itemsOf(schema)
+		if itemSchema == nil {
+			return nil
+		}
+		for i := range x {
+			if isNonNullableNull(x[i], itemSchema) && itemSchema.Default != nil {
+				defaultValue, err := defaultOf(itemSchema)
+				if err != nil {
+					return fmt.Errorf("failed to unmarshal default value for item %d: %w", i, err)
 				}
+				x[i] = defaultValue
+			}
+			if err := applyDefaults(x[i], itemSchema); err != nil {
+				return err
+			}
+		}
+	}
 
-				// Convert float64 to int64 if needed for array items
-				if fieldSchema.Items.Schema.Type == "integer" {
-					if floatVal, ok := defaultItem.(float64); ok {
-						defaultItem = int64(floatVal)
-					}
-				}
+	return nil
+}
 
-				defaultArray := make([]interface{}, *fieldSchema.MinItems)
-				for i := range defaultArray {
-					defaultArray[i] = defaultItem
+// pruneNulls removes the null values of the fields that are neither nullable nor defaulted, as the apiserver does
+// before defaulting. The null values that have a default are defaulted by applyDefaults.
+func pruneNulls(x interface{}, schema *apiextensionsv1.JSONSchemaProps) {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for fieldName, value := range x {
+			var fieldSchema *apiextensionsv1.JSONSchemaProps
+			if schema != nil {
+				if s, found := schema.Properties[fieldName]; found {
+					fieldSchema = &s
+				} else {
+					fieldSchema = additionalPropertiesOf(schema)
 				}
-
-				targetMap[fieldName] = defaultArray
 			}
+			if isNonNullableNull(value, fieldSchema) && fieldSchema.Default == nil {
+				delete(x, fieldName)
+				continue
+			}
+			pruneNulls(value, fieldSchema)
+		}
+	case []interface{}:
+		var itemSchema *apiextensionsv1.JSONSchemaProps
+		if schema != nil {
+			itemSchema = itemsOf(schema)
+		}
+		for i := range x {
+			pruneNulls(x[i], itemSchema)
 		}
 	}
+}
 
-	return nil
+// isNonNullableNull reports whether value is null for a field that is described by a schema and is not nullable.
+func isNonNullableNull(value interface{}, schema *apiextensionsv1.JSONSchemaProps) bool {
+	return value == nil && schema != nil && !schema.Nullable
+}
+
+// additionalPropertiesOf returns the schema of the values of a map, nil when the schema does not describe them.
+func additionalPropertiesOf(schema *apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	if schema.AdditionalProperties == nil {
+		return nil
+	}
+	return schema.AdditionalProperties.Schema
+}
+
+// itemsOf returns the schema of the items of an array, nil when the schema does not describe them.
+func itemsOf(schema *apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	if schema.Items == nil {
+		return nil
+	}
+	return schema.Items.Schema
+}
+
+// defaultOf returns a new copy of the default value of the schema. Numbers are decoded as the apiserver decodes
+// them: integers as int64, other numbers as float64.
+func defaultOf(schema *apiextensionsv1.JSONSchemaProps) (interface{}, error) {
+	var defaultValue interface{}
+	if err := json.Unmarshal(schema.Default.Raw, &defaultValue); err != nil {
+		return nil, err
+	}
+	return defaultValue, nil
 }
@@ -4,9 +4,15 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
 )
 
 func TestPopulateDefaultsFromCRD(t *testing.T) {
@@ -165,3 +171,217 @@ func TestPopulateDefaultsFromCRD(t *testing.T) {
 		})
 	}
 }
+
+// TestPopulateDefaultsFromCRDConformance checks that the defaults applied to the spec are the ones the apiserver
+// applies with its structural defaulting, for the same schema and the same spec.
+func TestPopulateDefaultsFromCRDConformance(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		spec   string
+		want   string
+	}{
+		{
+			name: "Properties",
+			schema: `
+type: object
+properties:
+  replicas: {type: integer, default: 3}
+  ratio: {type: number, default: 0.5}
+  image: {type: string, default: nginx}
+  enabled: {type: boolean, default: true}
+`,
+			spec: `{"image": "redis"}`,
+			want: `{"replicas": 3, "ratio": 0.5, "image": "redis", "enabled": true}`,
+		},
+		{
+			name: "Missing nested objects are not created",
+			schema: `
+type: object
+properties:
+  resources:
+    type: object
+    properties:
+      cpu: {type: string, default: 100m}
+`,
+			spec: `{}`,
+			want: `{}`,
+		},
+		{
+			name: "Defaults within defaulted objects",
+			schema: `
+type: object
+properties:
+  resources:
+    type: object
+    default: {}
+    properties:
+      cpu: {type: string, default: 100m}
+      limits:
+        type: object
+        default: {memory: 1Gi}
+        properties:
+          memory: {type: string}
+          cpu: {type: string, default: "1"}
+`,
+			spec: `{}`,
+			want: `{"resources": {"cpu": "100m", "limits": {"memory": "1Gi", "cpu": "1"}}}`,
+		},
+		{
+			name: "Arrays of objects",
+			schema: `
+type: object
+properties:
+  servers:
+    type: array
+    items:
+      type: object
+      properties:
+        host: {type: string}
+        port: {type: integer, default: 80}
+        tls:
+          type: object
+          default: {}
+          properties:
+            enabled: {type: boolean, default: false}
+`,
+			spec: `{"servers": [{"host": "a"}, {"host": "b", "port": 443, "tls": {"enabled": true}}]}`,
+			want: `{"servers": [{"host": "a", "port": 80, "tls": {"enabled": false}}, {"host": "b", "port": 443, "tls": {"enabled": true}}]}`,
+		},
+		{
+			name: "Nested items",
+			schema: `
+type: object
+properties:
+  matrix:
+    type: array
+    items:
+      type: array
+      items:
+        type: object
+        properties:
+          weight: {type: integer, default: 1}
+`,
+			spec: `{"matrix": [[{}, {"weight": 5}], [], [{}]]}`,
+			want: `{"matrix": [[{"weight": 1}, {"weight": 5}], [], [{"weight": 1}]]}`,
+		},
+		{
+			name: "Null items",
+			schema: `
+type: object
+properties:
+  defaulted:
+    type: array
+    items: {type: string, default: none}
+  nullable:
+    type: array
+    items: {type: string, nullable: true, default: none}
+`,
+			spec: `{"defaulted": ["a", null], "nullable": ["a", null]}`,
+			want: `{"defaulted": ["a", "none"], "nullable": ["a", null]}`,
+		},
+		{
+			name: "Additional properties",
+			schema: `
+type: object
+properties:
+  labels:
+    type: object
+    additionalProperties: {type: string, default: unset}
+  backends:
+    type: object
+    additionalProperties:
+      type: object
+      properties:
+        weight: {type: integer, default: 100}
+        port: {type: integer}
+`,
+			spec: `{"labels": {"app": "demo", "tier": null}, "backends": {"blue": {}, "green": {"weight": 10, "port": 8080}}}`,
+			want: `{"labels": {"app": "demo", "tier": "unset"}, "backends": {"blue": {"weight": 100}, "green": {"weight": 10, "port": 8080}}}`,
+		},
+		{
+			name: "Nullable and non-nullable nulls",
+			schema: `
+type: object
+properties:
+  defaulted: {type: string, default: value}
+  nullableDefaulted: {type: string, nullable: true, default: value}
+  pruned: {type: string}
+  nullable: {type: string, nullable: true}
+  object:
+    type: object
+    properties:
+      field: {type: integer}
+`,
+			spec: `{"defaulted": null, "nullableDefaulted": null, "pruned": null, "nullable": null, "object": null}`,
+			want: `{"defaulted": "value", "nullableDefaulted": null, "nullable": null}`,
+		},
+		{
+			name: "Preserve unknown fields",
+			schema: `
+type: object
+x-kubernetes-preserve-unknown-fields: true
+properties:
+  known: {type: string, default: value}
+  config:
+    type: object
+    x-kubernetes-preserve-unknown-fields: true
+    properties:
+      level: {type: string, default: info}
+`,
+			spec: `{"unknown": {"nested": null, "list": [null]}, "config": {"extra": null}}`,
+			want: `{"known": "value", "unknown": {"nested": null, "list": [null]}, "config": {"extra": null, "level": "info"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var specSchema apiextensionsv1.JSONSchemaProps
+			require.NoError(t, yaml.Unmarshal([]byte(tt.schema), &specSchema))
+
+			var spec map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.spec), &spec))
+			var want map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.want), &want))
+
+			crd := &apiextensionsv1.CustomResourceDefinition{
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+						{
+							Name: "v1",
+							Schema: &apiextensionsv1.CustomResourceValidation{
+								OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+									Type: "object",
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										"spec": specSchema,
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			cr := runtime.Object(&unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "example.com/v1",
+					"kind":       "Example",
+					"spec":       runtime.DeepCopyJSONValue(spec),
+				},
+			})
+			require.NoError(t, PopulateDefaultsFromCRD(crd, &cr))
+			got := cr.(*unstructured.Unstructured).Object["spec"]
+
+			// The apiserver defaulting of the same spec
+			var internal apiextensions.JSONSchemaProps
+			require.NoError(t, apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(&specSchema, &internal, nil))
+			structural, err := structuralschema.NewStructural(&internal)
+			require.NoError(t, err)
+			expected := runtime.DeepCopyJSONValue(spec)
+			structuraldefaulting.PruneNonNullableNullsWithoutDefaults(expected, structural)
+			structuraldefaulting.Default(expected, structural)
+
+			assert.Equal(t, expected, got, "defaults differ from the apiserver ones")
+			assert.Equal(t, want, got)
+		})
+	}
+}
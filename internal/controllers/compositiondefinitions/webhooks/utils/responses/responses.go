@@ -0,0 +1,21 @@
+package responses
+
+import (
+	v1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Denied returns the response denying the request, in the format of the apiserver validation errors.
+func Denied(req webhook.AdmissionRequest, errs field.ErrorList) webhook.AdmissionResponse {
+	gk := schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind}
+	status := apierrors.NewInvalid(gk, req.Name, errs).ErrStatus
+	return webhook.AdmissionResponse{
+		AdmissionResponse: v1.AdmissionResponse{
+			Allowed: false,
+			Result:  &status,
+		},
+	}
+}
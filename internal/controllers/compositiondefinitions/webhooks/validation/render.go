@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	v1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// renderCheck returns the render check of the CompositionDefinition, nil when it is not enabled.
+func renderCheck(cd *compositiondefinitionsv1alpha1.CompositionDefinition) *compositiondefinitionsv1alpha1.RenderCheck {
+	if cd.Spec.Admission == nil || cd.Spec.Admission.Render == nil || !cd.Spec.Admission.Render.Enabled {
+		return nil
+	}
+	return cd.Spec.Admission.Render
+}
+
+// renderSpec renders the chart of cd with spec as values. It returns the reason to deny the composition when the
+// templates fail to render, or a warning when the chart could not be rendered at all: a chart that cannot be fetched
+// or rendered in time does not block the compositions.
+func renderSpec(ctx context.Context, kube client.Client, l tgzfs.Limits, cd *compositiondefinitionsv1alpha1.CompositionDefinition, check *compositiondefinitionsv1alpha1.RenderCheck, req webhook.AdmissionRequest, spec map[string]any) (denial string, warning string) {
+	if cd.Spec.Chart == nil {
+		return "", fmt.Sprintf("the chart was not rendered: CompositionDefinition %s/%s has no chart", cd.Namespace, cd.Name)
+	}
+	nfo := cd.Spec.Chart.DeepCopy()
+	if chart.IsVersionRange(nfo.Version) {
+		if cd.Status.ResolvedVersion == "" {
+			return "", fmt.Sprintf("the chart was not rendered: the version range %s of CompositionDefinition %s/%s is not resolved yet", nfo.Version, cd.Namespace, cd.Name)
+		}
+		nfo.Version = cd.Status.ResolvedVersion
+	}
+
+	timeout := defaultRenderTimeout
+	if check.Timeout != nil && check.Timeout.Duration > 0 {
+		timeout = check.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pkg, err := chart.Fetch(ctx, kube, nfo, chart.WithLimits(l))
+	if err == nil {
+		err = chart.Render(ctx, pkg.Data, chart.RenderOptions{
+			Name:      req.Name,
+			Namespace: req.Namespace,
+			IsUpgrade: req.Operation == v1.Update,
+		}, spec)
+	}
+	var rerr *chart.RenderError
+	switch {
+	case err == nil:
+		return "", ""
+	case errors.As(err, &rerr):
+		return fmt.Sprintf("chart %s failed to render with the spec as values: %s", nfo.Url, rerr.Error()), ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "", fmt.Sprintf("the chart was not rendered: rendering did not complete in %s", timeout)
+	default:
+		return "", fmt.Sprintf("the chart was not rendered: %s", err)
+	}
+}
@@ -0,0 +1,322 @@
+package validation
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/helpers/getters"
+	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions/webhooks/utils/responses"
+	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// SchemaKey is the key of the values schema in the JSON schema ConfigMap of a composition version.
+	SchemaKey = "values.schema.json"
+
+	// defaultRenderTimeout bounds the rendering of the chart when the CompositionDefinition does not set a timeout.
+	defaultRenderTimeout = 5 * time.Second
+)
+
+// printer renders the validation errors.
+var printer = message.NewPrinter(language.English)
+
+// NewWebhookHandler returns the handler validating the spec of the compositions against the values schema of their
+// chart, as stored in the JSON schema ConfigMap deployed next to the CDC. The schema is compiled as a draft-07 schema,
+// so the keywords a CRD structural schema cannot express (oneOf, anyOf, if/then/else, dependencies, patternProperties,
+// formats, ...) are enforced too. Compositions whose definition or schema cannot be found are allowed with a warning.
+// When the CompositionDefinition enables it, the chart is also rendered with the spec as values, fetched through the
+// chart cache within the archive limits l.
+// The updates that leave the spec as it is, and the updates of a composition being deleted, are neither validated nor
+// rendered.
+// The CompositionDefinitions and the ConfigMaps are read from cli, usually the cached client of the manager, so that
+// a request does not cost API server round trips.
+func NewWebhookHandler(cli client.Client, l tgzfs.Limits, metrics ...*webhooktelemetry.Metrics) *webhook.Admission {
+	var recorder *webhooktelemetry.Metrics
+	if len(metrics) > 0 {
+		recorder = metrics[0]
+	}
+	schemas := &schemaCache{entries: map[types.NamespacedName]cachedSchema{}}
+
+	return &webhook.Admission{
+		Handler: admission.HandlerFunc(func(ctx context.Context, req webhook.AdmissionRequest) webhook.AdmissionResponse {
+			started := time.Now()
+			operation := string(req.Operation)
+			if operation == "" {
+				operation = "unknown"
+			}
+			success := false
+			defer func() {
+				if recorder != nil {
+					recorder.RecordRequest(ctx, "validating", operation, time.Since(started), success)
+				}
+			}()
+
+			if req.Operation != v1.Create && req.Operation != v1.Update {
+				success = true
+				return webhook.Allowed("")
+			}
+
+			obj := map[string]any{}
+			if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+				return webhook.Errored(http.StatusBadRequest, err)
+			}
+
+			skip, err := unchanged(req, obj)
+			if err != nil {
+				return webhook.Errored(http.StatusBadRequest, err)
+			}
+			if skip {
+				success = true
+				return webhook.Allowed("")
+			}
+
+			cd, warnings, err := definitionOf(ctx, cli, req)
+			if err != nil {
+				return webhook.Errored(http.StatusInternalServerError, err)
+			}
+			if cd == nil {
+				success = true
+				return webhook.Allowed("").WithWarnings(fmt.Sprintf("no CompositionDefinition found for %s %s/%s, the values schema was not enforced", req.Kind.Kind, req.Kind.Group, req.Kind.Version))
+			}
+
+			spec := map[string]any{}
+			if raw, ok := obj["spec"]; ok {
+				if spec, ok = raw.(map[string]any); !ok {
+					success = true
+					return responses.Denied(req, field.ErrorList{field.Invalid(field.NewPath("spec"), raw, "must be an object")}).WithWarnings(warnings...)
+				}
+			}
+
+			nn := types.NamespacedName{
+				Namespace: cd.Namespace,
+				Name:      fmt.Sprintf("%s-%s-jsonschema-configmap", req.Resource.Resource, req.Kind.Version),
+			}
+			sch, err := schemas.get(ctx, cli, nn)
+			switch {
+			case apierrors.IsNotFound(err):
+				warnings = append(warnings, fmt.Sprintf("values schema ConfigMap %s not found, the values schema was not enforced", nn))
+			case err != nil:
+				return webhook.Errored(http.StatusInternalServerError, err)
+			case sch != nil:
+				errs, err := validateSpec(sch, spec)
+				if err != nil {
+					return webhook.Errored(http.StatusBadRequest, err)
+				}
+				if len(errs) > 0 {
+					success = true
+					return responses.Denied(req, errs).WithWarnings(warnings...)
+				}
+			}
+
+			if check := renderCheck(cd); check != nil {
+				msg, warning := renderSpec(ctx, cli, l, cd, check, req, spec)
+				if msg != "" {
+					success = true
+					return responses.Denied(req, field.ErrorList{&field.Error{
+						Type:     field.ErrorTypeInvalid,
+						Field:    "spec",
+						BadValue: field.OmitValueType{},
+						Detail:   msg,
+					}}).WithWarnings(warnings...)
+				}
+				if warning != "" {
+					warnings = append(warnings, warning)
+				}
+			}
+
+			success = true
+			return webhook.Allowed("").WithWarnings(warnings...)
+		}),
+	}
+}
+
+// unchanged reports whether the request is an update leaving the spec of the composition as it is, or an update of a
+// composition being deleted. Those are not checked: a composition that no longer matches the schema of its chart must
+// still be relabelled, migrated and deleted.
+func unchanged(req webhook.AdmissionRequest, obj map[string]any) (bool, error) {
+	if req.Operation != v1.Update {
+		return false, nil
+	}
+	if ts, ok, _ := unstructured.NestedFieldNoCopy(obj, "metadata", "deletionTimestamp"); ok && ts != nil {
+		return true, nil
+	}
+	if len(req.OldObject.Raw) == 0 {
+		return false, nil
+	}
+	old := map[string]any{}
+	if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+		return false, err
+	}
+	return equality.Semantic.DeepEqual(old["spec"], obj["spec"]), nil
+}
+
+// definitionOf returns the CompositionDefinition generating the group, version and kind of the composition, nil when
+// there is none. Several definitions may generate the same version, in different namespaces: the one in the namespace
+// of the composition is preferred, otherwise the first one by namespace and name is used, with a warning.
+func definitionOf(ctx context.Context, cli client.Client, req webhook.AdmissionRequest) (*compositiondefinitionsv1alpha1.CompositionDefinition, []string, error) {
+	gvk := schema.GroupVersionKind{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind}
+	lst, err := getters.GetCompositionDefinitionsWithVersion(ctx, cli, gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch len(lst) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return &lst[0], nil, nil
+	}
+
+	slices.SortFunc(lst, func(a, b compositiondefinitionsv1alpha1.CompositionDefinition) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+	for i := range lst {
+		if lst[i].Namespace == req.Namespace {
+			return &lst[i], nil, nil
+		}
+	}
+	cd := &lst[0]
+	return cd, []string{fmt.Sprintf("%s %s is generated by %d CompositionDefinitions, none in namespace %s: the values schema of %s/%s was enforced", gvk.Kind, gvk.GroupVersion(), len(lst), req.Namespace, cd.Namespace, cd.Name)}, nil
+}
+
+// cachedSchema is a compiled schema, along with the resource version of the ConfigMap it was read from.
+type cachedSchema struct {
+	resourceVersion string
+	schema          *jsonschema.Schema
+}
+
+// schemaCache holds the compiled schema of each ConfigMap, so that a schema is compiled again only when its
+// ConfigMap changes.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]cachedSchema
+}
+
+// get returns the compiled schema stored in the ConfigMap nn, nil if the ConfigMap holds no schema.
+func (c *schemaCache) get(ctx context.Context, cli client.Reader, nn types.NamespacedName) (*jsonschema.Schema, error) {
+	cm := &corev1.ConfigMap{}
+	if err := cli.Get(ctx, nn, cm); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[nn]; ok && el.resourceVersion == cm.ResourceVersion {
+		return el.schema, nil
+	}
+
+	sch, err := compile(nn.String(), cm.Data[SchemaKey])
+	if err != nil {
+		return nil, fmt.Errorf("error compiling values schema of %s: %w", nn, err)
+	}
+	c.entries[nn] = cachedSchema{resourceVersion: cm.ResourceVersion, schema: sch}
+	return sch, nil
+}
+
+// compile compiles a values schema as a draft-07 schema asserting formats. References are inlined when the schema
+// is stored, so nothing is loaded from outside of it.
+func compile(name, dat string) (*jsonschema.Schema, error) {
+	if len(bytes.TrimSpace([]byte(dat))) == 0 {
+		return nil, nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader([]byte(dat)))
+	if err != nil {
+		return nil, err
+	}
+
+	url := "configmap://" + name + "/" + SchemaKey
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft7)
+	c.AssertFormat()
+	c.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := c.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+	return c.Compile(url)
+}
+
+// validateSpec validates spec against sch, returning an error for each failing keyword, with the path of the field.
+func validateSpec(sch *jsonschema.Schema, spec map[string]any) (field.ErrorList, error) {
+	// Numbers are decoded as json.Number, as the validator expects them.
+	dat, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+
+	err = sch.Validate(doc)
+	if err == nil {
+		return nil, nil
+	}
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return field.ErrorList{field.InternalError(field.NewPath("spec"), err)}, nil
+	}
+
+	var errs field.ErrorList
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			errs = append(errs, &field.Error{
+				Type:     field.ErrorTypeInvalid,
+				Field:    fieldPath(spec, e.InstanceLocation).String(),
+				BadValue: field.OmitValueType{},
+				Detail:   e.ErrorKind.LocalizedString(printer),
+			})
+			return
+		}
+		for _, el := range e.Causes {
+			walk(el)
+		}
+	}
+	walk(verr)
+	return errs, nil
+}
+
+// fieldPath returns the path of the field of spec at the JSON pointer tokens, indexing arrays.
+func fieldPath(spec map[string]any, tokens []string) *field.Path {
+	res := field.NewPath("spec")
+	var node any = spec
+	for _, el := range tokens {
+		switch v := node.(type) {
+		case []any:
+			i, err := strconv.Atoi(el)
+			if err != nil || i < 0 || i >= len(v) {
+				return res.Child(el)
+			}
+			res, node = res.Index(i), v[i]
+		case map[string]any:
+			res, node = res.Child(el), v[el]
+		default:
+			res, node = res.Child(el), nil
+		}
+	}
+	return res
+}
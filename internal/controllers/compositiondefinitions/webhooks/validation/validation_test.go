@@ -0,0 +1,362 @@
+package validation
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	compositiondefinitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const valuesSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "email": {"type": "string", "format": "email"},
+    "storage": {
+      "oneOf": [
+        {"type": "object", "required": ["size"], "properties": {"size": {"type": "string"}}, "additionalProperties": false},
+        {"type": "object", "required": ["claimName"], "properties": {"claimName": {"type": "string"}}, "additionalProperties": false}
+      ]
+    },
+    "ingress": {
+      "type": "object",
+      "properties": {"enabled": {"type": "boolean"}, "host": {"type": "string"}},
+      "if": {"properties": {"enabled": {"const": true}}, "required": ["enabled"]},
+      "then": {"required": ["host"]}
+    },
+    "servers": {
+      "type": "array",
+      "items": {"type": "object", "properties": {"port": {"type": "integer", "maximum": 65535}}}
+    },
+    "labels": {"type": "object", "patternProperties": {"^[a-z]+$": {"type": "string"}}, "additionalProperties": false},
+    "tls": {"type": "object", "dependencies": {"cert": ["key"]}}
+  }
+}`
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	s := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(s))
+	require.NoError(t, compositiondefinitionsv1alpha1.SchemeBuilder.AddToScheme(s))
+	return s
+}
+
+func newRequest(op v1.Operation, obj string) webhook.AdmissionRequest {
+	return webhook.AdmissionRequest{
+		AdmissionRequest: v1.AdmissionRequest{
+			Operation: op,
+			Name:      "demo",
+			Namespace: "demo-system",
+			Kind:      metav1.GroupVersionKind{Group: "composition.krateo.io", Version: "v1-2-3", Kind: "FireworksApp"},
+			Resource:  metav1.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-3", Resource: "fireworksapps"},
+			Object:    runtime.RawExtension{Raw: []byte(obj)},
+		},
+	}
+}
+
+func newObjects() []client.Object {
+	return []client.Object{
+		&compositiondefinitionsv1alpha1.CompositionDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp", Namespace: "krateo-system"},
+			Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+				ApiVersion: "composition.krateo.io/v1-2-3",
+				Kind:       "FireworksApp",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps-v1-2-3-jsonschema-configmap", Namespace: "krateo-system"},
+			Data:       map[string]string{SchemaKey: valuesSchema},
+		},
+	}
+}
+
+func TestNewWebhookHandler(t *testing.T) {
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(newObjects()...).WithStatusSubresource(&compositiondefinitionsv1alpha1.CompositionDefinition{}).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	t.Run("valid spec is allowed", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {
+			"replicas": 2,
+			"email": "ops@example.com",
+			"storage": {"size": "1Gi"},
+			"ingress": {"enabled": true, "host": "demo.example.com"},
+			"servers": [{"port": 80}],
+			"labels": {"team": "ops"},
+			"tls": {"cert": "c", "key": "k"}
+		}}`))
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("violations are denied with the paths of the fields", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Update, `{"spec": {
+			"replicas": 0,
+			"email": "not-an-email",
+			"storage": {"size": "1Gi", "claimName": "data"},
+			"ingress": {"enabled": true},
+			"servers": [{"port": 80}, {"port": 70000}],
+			"labels": {"Team": "ops"},
+			"tls": {"cert": "c"}
+		}}`))
+		require.False(t, resp.Allowed)
+		require.NotNil(t, resp.Result)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), resp.Result.Code)
+		assert.Equal(t, metav1.StatusReasonInvalid, resp.Result.Reason)
+
+		fields := map[string]bool{}
+		for _, el := range resp.Result.Details.Causes {
+			fields[el.Field] = true
+		}
+		for _, el := range []string{"spec.replicas", "spec.email", "spec.storage", "spec.ingress", "spec.servers[1].port", "spec.labels", "spec.tls"} {
+			assert.True(t, fields[el], "expected a cause for %s, got %v", el, resp.Result.Details.Causes)
+		}
+		assert.False(t, fields["spec.servers[0].port"])
+		assert.Contains(t, resp.Result.Message, `FireworksApp.composition.krateo.io "demo" is invalid`)
+	})
+
+	t.Run("spec must be an object", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": "replicas"}`))
+		require.False(t, resp.Allowed)
+		assert.Equal(t, "spec", resp.Result.Details.Causes[0].Field)
+	})
+
+	t.Run("deletions are not validated", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Delete, ``))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("invalid JSON is rejected", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Create, `invalid-json`))
+		assert.Equal(t, int32(http.StatusBadRequest), resp.Result.Code)
+	})
+}
+
+func TestNewWebhookHandlerWithoutSchema(t *testing.T) {
+	objs := newObjects()
+
+	t.Run("missing CompositionDefinition", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs[1]).Build()
+		resp := NewWebhookHandler(cli, tgzfs.Limits{}).Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+		assert.True(t, resp.Allowed)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "no CompositionDefinition found")
+	})
+
+	t.Run("missing ConfigMap", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs[0]).Build()
+		resp := NewWebhookHandler(cli, tgzfs.Limits{}).Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+		assert.True(t, resp.Allowed)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "values schema ConfigMap krateo-system/fireworksapps-v1-2-3-jsonschema-configmap not found")
+	})
+}
+
+func TestDefinitionOfTheCompositionVersion(t *testing.T) {
+	objs := newObjects()
+	objs = append(objs,
+		&compositiondefinitionsv1alpha1.CompositionDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "archived-fireworksapp", Namespace: "archive-system"},
+			Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+				ApiVersion: "composition.krateo.io/v1-0-0",
+				Kind:       "FireworksApp",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps-v1-0-0-jsonschema-configmap", Namespace: "archive-system"},
+			Data:       map[string]string{SchemaKey: `{"type": "object", "properties": {"replicas": {"type": "integer"}}}`},
+		},
+	)
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs...).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+	require.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Message, "spec.replicas")
+
+	req := newRequest(v1.Create, `{"spec": {"replicas": 0}}`)
+	req.Kind.Version, req.Resource.Version = "v1-0-0", "v1-0-0"
+	resp = handler.Handle(context.Background(), req)
+	assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+	assert.Empty(t, resp.Warnings)
+}
+
+func TestDefinitionInTheNamespaceOfTheComposition(t *testing.T) {
+	objs := append(newObjects(),
+		&compositiondefinitionsv1alpha1.CompositionDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp", Namespace: "demo-system"},
+			Status: compositiondefinitionsv1alpha1.CompositionDefinitionStatus{
+				ApiVersion: "composition.krateo.io/v1-2-3",
+				Kind:       "FireworksApp",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "fireworksapps-v1-2-3-jsonschema-configmap", Namespace: "demo-system"},
+			Data:       map[string]string{SchemaKey: `{"type": "object", "properties": {"replicas": {"type": "integer"}}}`},
+		},
+	)
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs...).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	t.Run("the definition in the namespace of the composition is preferred", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("otherwise the first definition is used with a warning", func(t *testing.T) {
+		req := newRequest(v1.Create, `{"spec": {"replicas": 0}}`)
+		req.Namespace = "other-system"
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "is generated by 2 CompositionDefinitions, none in namespace other-system: the values schema of demo-system/fireworksapp was enforced")
+	})
+}
+
+func TestUnchangedSpecsAreNotValidated(t *testing.T) {
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(newObjects()...).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	t.Run("removing a finalizer from an invalid composition is allowed", func(t *testing.T) {
+		req := newRequest(v1.Update, `{"metadata": {"name": "demo"}, "spec": {"replicas": 0}}`)
+		req.OldObject.Raw = []byte(`{"metadata": {"name": "demo", "finalizers": ["composition.krateo.io/finalizer"]}, "spec": {"replicas": 0}}`)
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("updates of a composition being deleted are allowed", func(t *testing.T) {
+		req := newRequest(v1.Update, `{"metadata": {"name": "demo", "deletionTimestamp": "2026-01-01T00:00:00Z"}, "spec": {"replicas": -1}}`)
+		req.OldObject.Raw = []byte(`{"metadata": {"name": "demo"}, "spec": {"replicas": 0}}`)
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+	})
+
+	t.Run("updates of the spec are validated", func(t *testing.T) {
+		req := newRequest(v1.Update, `{"metadata": {"name": "demo"}, "spec": {"replicas": 0}}`)
+		req.OldObject.Raw = []byte(`{"metadata": {"name": "demo"}, "spec": {"replicas": 1}}`)
+		resp := handler.Handle(context.Background(), req)
+		require.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "spec.replicas")
+	})
+}
+
+func TestSchemaCacheRecompilesChangedSchemas(t *testing.T) {
+	objs := newObjects()
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs...).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+	require.False(t, resp.Allowed)
+
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, cli.Get(context.Background(), client.ObjectKeyFromObject(objs[1]), cm))
+	cm.Data[SchemaKey] = `{"type": "object", "properties": {"replicas": {"type": "integer"}}}`
+	require.NoError(t, cli.Update(context.Background(), cm))
+
+	resp = handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 0}}`))
+	assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+}
+
+// chartArchive returns a chart archive whose ConfigMap template requires the host value.
+func chartArchive(t *testing.T) []byte {
+	t.Helper()
+
+	files := map[string]string{
+		"fireworksapp/Chart.yaml":        "apiVersion: v2\nname: fireworksapp\nversion: 1.2.3\n",
+		"fireworksapp/templates/cm.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\ndata:\n  host: {{ required \"host is required\" .Values.host }}\n",
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestRenderCheck(t *testing.T) {
+	objs := newObjects()
+	cd := objs[0].(*compositiondefinitionsv1alpha1.CompositionDefinition)
+	cd.Spec.Chart = &compositiondefinitionsv1alpha1.ChartInfo{Url: "configmap://krateo-system/fireworksapp-chart/chart.tgz"}
+	cd.Spec.Admission = &compositiondefinitionsv1alpha1.AdmissionChecks{
+		Render: &compositiondefinitionsv1alpha1.RenderCheck{Enabled: true, Timeout: &metav1.Duration{Duration: 10 * time.Second}},
+	}
+	objs = append(objs, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "fireworksapp-chart", Namespace: "krateo-system"},
+		BinaryData: map[string][]byte{"chart.tgz": chartArchive(t)},
+	})
+	cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs...).Build()
+	handler := NewWebhookHandler(cli, tgzfs.Limits{})
+
+	t.Run("rendered compositions are allowed", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Create, `{"spec": {"host": "demo.example.com"}}`))
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("render failures are denied with the template error", func(t *testing.T) {
+		resp := handler.Handle(context.Background(), newRequest(v1.Update, `{"spec": {"replicas": 1}}`))
+		require.False(t, resp.Allowed)
+		require.Len(t, resp.Result.Details.Causes, 1)
+		assert.Equal(t, "spec", resp.Result.Details.Causes[0].Field)
+		assert.Contains(t, resp.Result.Message, "host is required")
+	})
+
+	t.Run("updates leaving the spec unchanged are not rendered", func(t *testing.T) {
+		req := newRequest(v1.Update, `{"metadata": {"name": "demo"}, "spec": {"replicas": 1}}`)
+		req.OldObject.Raw = []byte(`{"metadata": {"name": "demo", "finalizers": ["composition.krateo.io/finalizer"]}, "spec": {"replicas": 1}}`)
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("updates of a composition being deleted are not rendered", func(t *testing.T) {
+		req := newRequest(v1.Update, `{"metadata": {"name": "demo", "deletionTimestamp": "2026-01-01T00:00:00Z"}, "spec": {"replicas": 2}}`)
+		req.OldObject.Raw = []byte(`{"metadata": {"name": "demo"}, "spec": {"replicas": 1}}`)
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed, "unexpected denial: %v", resp.Result)
+	})
+
+	t.Run("other versions are not rendered", func(t *testing.T) {
+		req := newRequest(v1.Create, `{"spec": {"replicas": 1}}`)
+		req.Kind.Version, req.Resource.Version = "v1-0-0", "v1-0-0"
+		resp := handler.Handle(context.Background(), req)
+		assert.True(t, resp.Allowed)
+		assert.Contains(t, strings.Join(resp.Warnings, "\n"), "no CompositionDefinition found for FireworksApp composition.krateo.io/v1-0-0")
+	})
+
+	t.Run("charts that cannot be fetched do not block compositions", func(t *testing.T) {
+		cd := cd.DeepCopy()
+		cd.ResourceVersion = ""
+		cd.Spec.Chart.Url = "configmap://krateo-system/missing/chart.tgz"
+		cli := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs[1], cd).Build()
+		resp := NewWebhookHandler(cli, tgzfs.Limits{}).Handle(context.Background(), newRequest(v1.Create, `{"spec": {"replicas": 1}}`))
+		assert.True(t, resp.Allowed)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "the chart was not rendered")
+	})
+}
@@ -0,0 +1,58 @@
+package charts
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/krateoplatformops/core-provider"
+
+// Metrics captures low-cardinality chart cache telemetry for core-provider.
+type Metrics struct {
+	lookupTotal   metric.Int64Counter
+	evictionTotal metric.Int64Counter
+}
+
+// NewMetrics creates the chart cache metric instruments.
+func NewMetrics() (*Metrics, error) {
+	return newMetrics(otel.Meter(meterName))
+}
+
+func newMetrics(meter metric.Meter) (*Metrics, error) {
+	var err error
+	m := &Metrics{}
+
+	if m.lookupTotal, err = meter.Int64Counter("core_provider.chart_cache.lookup.total"); err != nil {
+		return nil, err
+	}
+	if m.evictionTotal, err = meter.Int64Counter("core_provider.chart_cache.eviction.total"); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// RecordLookup captures a single chart cache lookup, with the tier that served the chart
+// (memory, disk or remote) and its outcome (hit, miss, revalidated, refreshed or error).
+func (m *Metrics) RecordLookup(ctx context.Context, tier string, outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.lookupTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("tier", tier),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// RecordEviction captures a chart evicted from a cache tier.
+func (m *Metrics) RecordEviction(ctx context.Context, tier string) {
+	if m == nil {
+		return
+	}
+
+	m.evictionTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("tier", tier)))
+}
@@ -0,0 +1,59 @@
+package charts
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	metricdata "go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestNewMetricsRecordsChartCacheData(t *testing.T) {
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	ctx := context.Background()
+	t.Cleanup(func() {
+		if err := provider.Shutdown(ctx); err != nil {
+			t.Fatalf("provider.Shutdown() returned error: %v", err)
+		}
+	})
+
+	metrics, err := newMetrics(provider.Meter("github.com/krateoplatformops/core-provider/test"))
+	if err != nil {
+		t.Fatalf("newMetrics() returned error: %v", err)
+	}
+
+	metrics.RecordLookup(ctx, "memory", "hit")
+	metrics.RecordLookup(ctx, "remote", "miss")
+	metrics.RecordEviction(ctx, "disk")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("reader.Collect() returned error: %v", err)
+	}
+
+	if !hasMetric(rm, "core_provider.chart_cache.lookup.total") {
+		t.Fatal("expected chart cache lookup metric to be collected")
+	}
+	if !hasMetric(rm, "core_provider.chart_cache.eviction.total") {
+		t.Fatal("expected chart cache eviction metric to be collected")
+	}
+}
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var metrics *Metrics
+	metrics.RecordLookup(context.Background(), "memory", "hit")
+	metrics.RecordEviction(context.Background(), "memory")
+}
+
+func hasMetric(rm metricdata.ResourceMetrics, name string) bool {
+	for _, scope := range rm.ScopeMetrics {
+		for _, metric := range scope.Metrics {
+			if metric.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -13,8 +13,11 @@ const meterName = "github.com/krateoplatformops/core-provider"
 
 // Metrics captures low-cardinality webhook telemetry for core-provider.
 type Metrics struct {
-	requestDuration metric.Float64Histogram
-	requestTotal    metric.Int64Counter
+	requestDuration   metric.Float64Histogram
+	requestTotal      metric.Int64Counter
+	crdLookupDuration metric.Float64Histogram
+	crdLookupTotal    metric.Int64Counter
+	crdCacheAge       metric.Float64Histogram
 }
 
 // NewMetrics creates the webhook metric instruments.
@@ -32,6 +35,15 @@ func newMetrics(meter metric.Meter) (*Metrics, error) {
 	if m.requestTotal, err = meter.Int64Counter("core_provider.webhook.request.total"); err != nil {
 		return nil, err
 	}
+	if m.crdLookupDuration, err = meter.Float64Histogram("core_provider.webhook.crd_lookup.duration_seconds"); err != nil {
+		return nil, err
+	}
+	if m.crdLookupTotal, err = meter.Int64Counter("core_provider.webhook.crd_lookup.total"); err != nil {
+		return nil, err
+	}
+	if m.crdCacheAge, err = meter.Float64Histogram("core_provider.webhook.crd_cache.age_seconds"); err != nil {
+		return nil, err
+	}
 
 	return m, nil
 }
@@ -55,3 +67,25 @@ func (m *Metrics) RecordRequest(ctx context.Context, webhook string, operation s
 	m.requestDuration.Record(ctx, d.Seconds(), metric.WithAttributes(labels...))
 	m.requestTotal.Add(ctx, 1, metric.WithAttributes(append(labels, attribute.String("outcome", outcome))...))
 }
+
+// RecordCRDLookup captures a CRD lookup of the webhooks and its latency. The source is "cache" when the CRD was
+// served by the informer and "apiserver" when it was read from the API server.
+func (m *Metrics) RecordCRDLookup(ctx context.Context, source string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	labels := metric.WithAttributes(attribute.String("source", source))
+	m.crdLookupDuration.Record(ctx, d.Seconds(), labels)
+	m.crdLookupTotal.Add(ctx, 1, labels)
+}
+
+// RecordCRDCacheAge captures the freshness of a CRD served by the informer: the time since the informer last
+// delivered it.
+func (m *Metrics) RecordCRDCacheAge(ctx context.Context, age time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.crdCacheAge.Record(ctx, age.Seconds())
+}
@@ -26,6 +26,8 @@ func TestNewMetricsRecordsWebhookData(t *testing.T) {
 
 	metrics.RecordRequest(ctx, "mutating", "create", 125*time.Millisecond, true)
 	metrics.RecordRequest(ctx, "conversion", "convert", 250*time.Millisecond, false)
+	metrics.RecordCRDLookup(ctx, "cache", time.Millisecond)
+	metrics.RecordCRDCacheAge(ctx, 30*time.Second)
 
 	var rm metricdata.ResourceMetrics
 	if err := reader.Collect(ctx, &rm); err != nil {
@@ -38,6 +40,15 @@ func TestNewMetricsRecordsWebhookData(t *testing.T) {
 	if !hasMetric(rm, "core_provider.webhook.request.total") {
 		t.Fatal("expected webhook request total metric to be collected")
 	}
+	if !hasMetric(rm, "core_provider.webhook.crd_lookup.duration_seconds") {
+		t.Fatal("expected CRD lookup duration metric to be collected")
+	}
+	if !hasMetric(rm, "core_provider.webhook.crd_lookup.total") {
+		t.Fatal("expected CRD lookup total metric to be collected")
+	}
+	if !hasMetric(rm, "core_provider.webhook.crd_cache.age_seconds") {
+		t.Fatal("expected CRD cache age metric to be collected")
+	}
 }
 
 func hasMetric(rm metricdata.ResourceMetrics, name string) bool {
@@ -9,20 +9,27 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gobuffalo/flect"
 	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/mirrors"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/valuesschema"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
 	contexttools "github.com/krateoplatformops/core-provider/internal/tools/context"
-	"github.com/krateoplatformops/core-provider/internal/tools/resolvers"
 	"github.com/krateoplatformops/core-provider/internal/tools/retry"
 	"github.com/krateoplatformops/core-provider/internal/tools/strutil"
 	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
 	"github.com/krateoplatformops/plumbing/helm/getter"
 	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
 )
@@ -30,42 +37,259 @@ import (
 const (
 	defaultGroup = "composition.krateo.io"
 
+	// GroupAnnotation, KindAnnotation, PluralAnnotation and VersionStrategyAnnotation
+	// are the Chart.yaml annotations that override the names of the generated CRD.
+	GroupAnnotation           = "krateo.io/crd-group"
+	KindAnnotation            = "krateo.io/crd-kind"
+	PluralAnnotation          = "krateo.io/crd-plural"
+	VersionStrategyAnnotation = "krateo.io/crd-version-strategy"
+
+	// ShortNamesAnnotation and CategoriesAnnotation are the Chart.yaml annotations that declare
+	// comma separated short names and categories of the generated CRD.
+	ShortNamesAnnotation = "krateo.io/crd-short-names"
+	CategoriesAnnotation = "krateo.io/crd-categories"
+	// PrinterColumnsAnnotation is the Chart.yaml annotation that declares a YAML list of printer columns of the generated CRD.
+	PrinterColumnsAnnotation = "krateo.io/crd-printer-columns"
+	// StatusSchemaAnnotation is the Chart.yaml annotation that declares the status schema contributed by the chart,
+	// as JSON or YAML, when the chart has no status.schema.json.
+	StatusSchemaAnnotation = "krateo.io/status-schema"
+
 	chartRetryAttempts     = 5
 	chartRetryInitialDelay = 250 * time.Millisecond
 	chartRetryMaximumDelay = 2 * time.Second
 )
 
-var chartGetter = getter.Get
+var (
+	kindRegexp     = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	jsonPathRegexp = regexp.MustCompile(`^\.(spec|status)([.\[].*)?$`)
+)
+
+// getterFunc downloads a chart, returning the archive and the URL it was downloaded from.
+type getterFunc func(ctx context.Context, uri string, opts ...getter.Option) (io.Reader, string, error)
+
+var chartGetter getterFunc = getter.Get
 var chartRetryWait = retry.Wait
 
-func ChartInfoFromSpec(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) (pkg fs.FS, rootDir string, err error) {
+// chartCache is shared by every chart download, it is nil when caching is disabled.
+var chartCache *chartcache.Cache
+
+// SetCache sets the cache shared by ChartInfoFromSpec and Fetch. A nil cache disables caching.
+func SetCache(c *chartcache.Cache) {
+	chartCache = c
+}
+
+// chartMirrors holds the mirror rules applied to every chart source, it is nil when no mirrors are configured.
+var chartMirrors *mirrors.Source
+
+// SetMirrors sets the mirror rules applied by Fetch and Versions. A nil source disables mirrors.
+func SetMirrors(s *mirrors.Source) {
+	chartMirrors = s
+}
+
+// fromMirrors calls get with nfo.Url rewritten to each URL the chart can be downloaded from, in order,
+// and returns the first result with the mirror that served it. Digest mismatches and verification failures
+// are returned as they are, without trying the next mirror, as is the error of a chart with a single source.
+func fromMirrors[T any](ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo, get func(context.Context, client.Client, *v1alpha1.ChartInfo) (T, error)) (T, string, error) {
 	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
 
+	var zero T
+	cfg, err := chartMirrors.Load(ctx, kube)
+	if err != nil {
+		return zero, "", err
+	}
+	candidates := cfg.Candidates(nfo.Url)
+	if len(candidates) == 1 && candidates[0].Mirror == "" {
+		res, err := get(ctx, kube, nfo)
+		return res, "", err
+	}
+
+	var errs []error
+	for _, el := range candidates {
+		src := nfo
+		if el.URL != nfo.Url {
+			src = nfo.DeepCopy()
+			src.Url = el.URL
+		}
+		res, err := get(ctx, kube, src)
+		if err == nil {
+			return res, el.Mirror, nil
+		}
+		var mismatch *DigestMismatchError
+		var verr *verify.Error
+		if errors.As(err, &mismatch) || errors.As(err, &verr) || errors.Is(err, context.Canceled) {
+			return zero, "", err
+		}
+		log.Debug("Chart source failed, trying the next one", "uri", el.URL, "error", err)
+		errs = append(errs, err)
+	}
+	return zero, "", fmt.Errorf("no mirror of %s could serve the chart: %w", nfo.Url, errors.Join(errs...))
+}
+
+// FetchOption tunes Fetch.
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	limits tgzfs.Limits
+}
+
+// WithLimits sets the limits of the downloaded archive: a download larger than l.MaxCompressedSize, and a chart
+// checked out from Git exceeding l.MaxFileSize, l.MaxSize or l.MaxFiles, fail with a *tgzfs.LimitError before
+// the whole archive is held in memory. Zero limits are replaced by their defaults, as tgzfs does.
+func WithLimits(l tgzfs.Limits) FetchOption {
+	return func(o *fetchOptions) {
+		o.limits = l
+	}
+}
+
+// Package is a downloaded chart archive.
+type Package struct {
+	Data []byte
+	// PackageURL is the URL the archive was downloaded from.
+	PackageURL string
+	// Digest is the sha256 digest of the archive, as sha256:<hex>.
+	Digest string
+	// Verification is the result of the verification of the chart, nil when nfo.Verify is not set.
+	Verification *verify.Result
+	// Mirror is the mirror that served the chart, empty when it was served by its source.
+	Mirror string
+}
+
+// ChartInfoFromSpec downloads the chart described by nfo with Fetch, and reads the archive within the limits
+// set with WithLimits, tgzfs.DefaultLimits otherwise.
+func ChartInfoFromSpec(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo, opts ...FetchOption) (pkg fs.FS, rootDir string, err error) {
+	o := fetchOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	res, err := Fetch(ctx, kube, nfo, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return chartFromBytes(res.Data, o.limits)
+}
+
+// Fetch downloads the chart archive described by nfo through the chart cache, from the mirrors configured
+// for its URL (see SetMirrors) or else from its source. Besides OCI, Helm repo and tgz URLs, the source can be a key of
+// a ConfigMap or of a Secret holding the archive (configmap://<namespace>/<name>/<key>, secret://<namespace>/<name>/<key>)
+// or a path in a Git repository (git+<http|https|file>://<repository>[//<path>][?ref=<ref>]), which is packaged
+// as helm package does.
+// Charts downloaded over HTTP are revalidated with conditional requests once their cache entry expires,
+// the other ones are downloaded again and compared by digest.
+// When nfo.Digest is set, the chart is returned only if its content matches, otherwise a *DigestMismatchError is returned.
+// When nfo.Verify is set, the chart is returned only if it passes verification, otherwise a *verify.Error is returned.
+// The archive is bounded by the limits set with WithLimits, tgzfs.DefaultLimits otherwise.
+func Fetch(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo, opts ...FetchOption) (*Package, error) {
 	if nfo == nil {
-		return nil, "", fmt.Errorf("chart infos cannot be nil")
+		return nil, fmt.Errorf("chart infos cannot be nil")
+	}
+	o := fetchOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.limits = o.limits.WithDefaults()
+
+	pkg, mirror, err := fromMirrors(ctx, kube, nfo, func(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) (*Package, error) {
+		return fetch(ctx, kube, nfo, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+	pkg.Mirror = mirror
+	return pkg, nil
+}
+
+// fetch downloads the chart archive described by nfo from nfo.Url.
+func fetch(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo, o fetchOptions) (*Package, error) {
+	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
+
+	cred, err := chartCredentials(ctx, kube, nfo)
+	if err != nil {
+		return nil, err
 	}
 	opts := []getter.Option{
 		getter.WithRepo(nfo.Repo),
 		getter.WithVersion(nfo.Version),
 		getter.WithInsecureSkipVerifyTLS(nfo.InsecureSkipVerifyTLS),
+		getter.WithTimeout(cred.timeout),
+	}
+	if cred.username != "" && cred.password != "" {
+		opts = append(opts, getter.WithCredentials(cred.username, cred.password))
 	}
-	if nfo.Credentials != nil {
-		secret, err := resolvers.GetSecret(ctx, kube, nfo.Credentials.PasswordRef)
+	key := chartcache.Key{URL: nfo.Url, Version: nfo.Version, Repo: nfo.Repo, Auth: cred.digest()}
+	cache := chartCache
+	get := chartGetter
+	switch {
+	case isObjectSource(nfo.Url):
+		// Archives in ConfigMaps and Secrets are read from the informer cache, they are not worth caching again.
+		cache, get = nil, objectGetter(kube)
+	case isGitSource(nfo.Url):
+		get = cred.gitGetter(o.limits)
+	case cred.customTransport():
+		get = cred.get
+	}
+
+	fetcher := func(ctx context.Context, stale *chartcache.Entry) (*chartcache.Response, error) {
+		if stale != nil && canRevalidate(nfo, stale.PackageURL) {
+			res, err := revalidate(ctx, stale, nfo.Url, cred)
+			if err == nil {
+				return res, nil
+			}
+			log.Debug("Conditional chart revalidation failed, downloading the chart again", "uri", stale.PackageURL, "error", err)
+		}
+
+		bData, url, err := chartBytesFromSpecWithRetry(ctx, get, nfo.Url, opts, o.limits.MaxCompressedSize, log)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to get secret: %w", err)
+			return nil, err
 		}
-		opts = append(opts, getter.WithCredentials(nfo.Credentials.Username, secret))
+		return &chartcache.Response{Data: bData, PackageURL: url}, nil
 	}
-	bData, err := chartBytesFromSpecWithRetry(ctx, nfo.Url, opts, log)
+	start := time.Now()
+	entry, data, err := cache.Get(ctx, key, fetcher)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+
+	pkg := &Package{Data: data, PackageURL: entry.PackageURL, Digest: entry.Digest}
+	if nfo.Digest != "" {
+		err := checkDigest(ctx, nfo, pkg, cred)
+		var mismatch *DigestMismatchError
+		if errors.As(err, &mismatch) && entry.FetchedAt.Before(start) {
+			// The cached archive may predate the pinned digest: check a fresh download before failing.
+			log.Debug("Cached chart does not match the pinned digest, downloading the chart again", "uri", nfo.Url, "error", err)
+			cache.Invalidate(key)
+			entry, data, err = cache.Get(ctx, key, fetcher)
+			if err != nil {
+				return nil, err
+			}
+			pkg = &Package{Data: data, PackageURL: entry.PackageURL, Digest: entry.Digest}
+			err = checkDigest(ctx, nfo, pkg, cred)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nfo.Verify != nil {
+		pkg.Verification, err = verifyChart(ctx, kube, nfo, pkg, cred)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return ChartInfoFromBytes(ctx, bData)
+	return pkg, nil
+}
+
+// download is a chart archive and the URL it was downloaded from.
+type download struct {
+	data []byte
+	url  string
 }
 
-func chartBytesFromSpecWithRetry(ctx context.Context, uri string, opts []getter.Option, log logging.Logger) ([]byte, error) {
-	bData, err := retry.Do[[]byte](ctx, retry.Config[[]byte]{
+// chartBytesFromSpecWithRetry downloads the chart archive, retrying transient failures. An archive larger than
+// maxSize fails with a *tgzfs.LimitError as soon as maxSize bytes are read, a negative maxSize disables the limit.
+func chartBytesFromSpecWithRetry(ctx context.Context, get getterFunc, uri string, opts []getter.Option, maxSize int64, log logging.Logger) ([]byte, string, error) {
+	res, err := retry.Do[download](ctx, retry.Config[download]{
 		Attempts:     chartRetryAttempts,
 		InitialDelay: chartRetryInitialDelay,
 		MaximumDelay: chartRetryMaximumDelay,
@@ -74,27 +298,33 @@ func chartBytesFromSpecWithRetry(ctx context.Context, uri string, opts []getter.
 		OnRetry: func(attempt int, nextDelay time.Duration, err error) {
 			log.Warn("Retrying chart fetch", "uri", uri, "attempt", attempt, "next_delay", nextDelay, "error", err)
 		},
-	}, func(context.Context) ([]byte, error) {
-		dat, _, err := chartGetter(ctx, uri, opts...)
+	}, func(context.Context) (download, error) {
+		dat, url, err := get(ctx, uri, opts...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get chart: %w", err)
+			return download{}, fmt.Errorf("failed to get chart: %w", err)
 		}
 		if dat == nil {
-			return nil, fmt.Errorf("failed to get chart: empty response reader")
+			return download{}, fmt.Errorf("failed to get chart: empty response reader")
 		}
 
+		if maxSize >= 0 {
+			dat = io.LimitReader(dat, maxSize+1)
+		}
 		bData, err := io.ReadAll(dat)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read chart: %w", err)
+			return download{}, fmt.Errorf("failed to read chart: %w", err)
+		}
+		if maxSize >= 0 && int64(len(bData)) > maxSize {
+			return download{}, &tgzfs.LimitError{Limit: "MaxCompressedSize", Max: maxSize}
 		}
 
-		return bData, nil
+		return download{data: bData, url: url}, nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chart after %d attempts: %w", chartRetryAttempts, err)
+		return nil, "", fmt.Errorf("failed to get chart after %d attempts: %w", chartRetryAttempts, err)
 	}
 
-	return bData, nil
+	return res.data, res.url, nil
 }
 
 func isRetryableChartError(err error) bool {
@@ -123,6 +353,9 @@ func isRetryableChartError(err error) bool {
 }
 
 func isNonRetryableChartError(err error) bool {
+	if errors.Is(err, errNoChart) || errors.Is(err, tgzfs.ErrRejected) {
+		return true
+	}
 	if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) || apierrors.IsNotFound(err) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
 		return true
 	}
@@ -136,8 +369,9 @@ func isNonRetryableChartError(err error) bool {
 	return false
 }
 
-func ChartInfoFromBytes(ctx context.Context, bin []byte) (pkg fs.FS, rootDir string, err error) {
-	pkg, err = tgzfs.New(bytes.NewBuffer(bin))
+// chartFromBytes reads the chart archive bin within the limits l.
+func chartFromBytes(bin []byte, l tgzfs.Limits) (pkg fs.FS, rootDir string, err error) {
+	pkg, err = tgzfs.NewWithLimits(bytes.NewBuffer(bin), l)
 	if err != nil {
 		return nil, "", err
 	}
@@ -156,36 +390,295 @@ func ChartInfoFromBytes(ctx context.Context, bin []byte) (pkg fs.FS, rootDir str
 	return pkg, rootDir, nil
 }
 
-func ChartGroupVersionKind(tgzFS fs.FS, rootDir string) (schema.GroupVersionKind, error) {
+// Names are the names of the CRD generated from a chart.
+type Names struct {
+	GVK schema.GroupVersionKind
+	// Plural is empty when it is not configured, and is inferred from the kind.
+	Plural string
+	// ShortNames and Categories are declared by the chart and by the CompositionDefinition.
+	// The default categories of the generated CRD are not included.
+	ShortNames []string
+	Categories []string
+}
+
+// chartMetadata is the part of the Chart.yaml used to generate the CRD.
+type chartMetadata struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Annotations map[string]string `json:"annotations"`
+	// Dependencies are used to merge the values schemas of the subcharts.
+	Dependencies []dependency `json:"dependencies"`
+}
+
+func readChartMetadata(tgzFS fs.FS, rootDir string) (chartMetadata, error) {
+	res := chartMetadata{}
+
 	fin, err := tgzFS.Open(rootDir + "/Chart.yaml")
 	if err != nil {
-		return schema.GroupVersionKind{}, err
+		return res, err
 	}
 	defer fin.Close()
 
 	din, err := io.ReadAll(fin)
 	if err != nil {
-		return schema.GroupVersionKind{}, err
+		return res, err
+	}
+
+	err = yaml.Unmarshal(din, &res)
+	return res, err
+}
+
+// CRDNames resolves the names of the CRD generated from the chart.
+// Each name is taken from nfo, then from the krateo.io/crd-* annotations of the Chart.yaml,
+// then defaults to the composition.krateo.io group, a kind derived from the chart name and the ChartVersion strategy.
+// Short names and categories of the chart and of nfo are merged.
+func CRDNames(tgzFS fs.FS, rootDir string, nfo *v1alpha1.CRDInfo) (Names, error) {
+	res, err := readChartMetadata(tgzFS, rootDir)
+	if err != nil {
+		return Names{}, err
 	}
 
-	res := map[string]any{}
-	if err := yaml.Unmarshal(din, &res); err != nil {
+	if nfo == nil {
+		nfo = &v1alpha1.CRDInfo{}
+	}
+	override := func(spec, annotation, def string) string {
+		if spec != "" {
+			return spec
+		}
+		if v := res.Annotations[annotation]; v != "" {
+			return v
+		}
+		return def
+	}
+
+	version, err := crdVersion(res.Version, v1alpha1.VersionStrategy(override(string(nfo.VersionStrategy), VersionStrategyAnnotation, string(v1alpha1.VersionStrategyChartVersion))))
+	if err != nil {
+		return Names{}, err
+	}
+
+	names := Names{
+		GVK: schema.GroupVersionKind{
+			Group:   override(nfo.Group, GroupAnnotation, defaultGroup),
+			Version: version,
+			Kind:    override(nfo.Kind, KindAnnotation, flect.Pascalize(strutil.ToGolangName(res.Name))),
+		},
+		Plural:     override(nfo.Plural, PluralAnnotation, ""),
+		ShortNames: mergeLists(splitList(res.Annotations[ShortNamesAnnotation]), nfo.ShortNames),
+		Categories: mergeLists(splitList(res.Annotations[CategoriesAnnotation]), nfo.Categories),
+	}
+	if err := validateNames(names); err != nil {
+		return Names{}, err
+	}
+
+	return names, nil
+}
+
+func ChartGroupVersionKind(tgzFS fs.FS, rootDir string, nfo *v1alpha1.CRDInfo) (schema.GroupVersionKind, error) {
+	names, err := CRDNames(tgzFS, rootDir, nfo)
+	if err != nil {
 		return schema.GroupVersionKind{}, err
 	}
+	return names.GVK, nil
+}
+
+// crdVersion derives the version of the CRD from the chart version according to the strategy.
+func crdVersion(chartVersion string, strategy v1alpha1.VersionStrategy) (string, error) {
+	if chartVersion == "" {
+		return "", fmt.Errorf("chart version cannot be empty")
+	}
+
+	switch strategy {
+	case v1alpha1.VersionStrategyChartVersion:
+		return fmt.Sprintf("v%s", strings.ReplaceAll(chartVersion, ".", "-")), nil
+	case v1alpha1.VersionStrategyMajor, v1alpha1.VersionStrategyMajorMinor:
+		parts := strings.SplitN(strings.TrimPrefix(chartVersion, "v"), ".", 3)
+		if len(parts) < 2 || !isNumber(parts[0]) || !isNumber(parts[1]) {
+			return "", fmt.Errorf("chart version %q is not a semantic version, required by the %s version strategy", chartVersion, strategy)
+		}
+		if strategy == v1alpha1.VersionStrategyMajor {
+			return fmt.Sprintf("v%s", parts[0]), nil
+		}
+		return fmt.Sprintf("v%s-%s", parts[0], parts[1]), nil
+	default:
+		return "", fmt.Errorf("unknown version strategy %q", strategy)
+	}
+}
 
-	return schema.GroupVersionKind{
-		Group:   defaultGroup,
-		Version: fmt.Sprintf("v%s", strings.ReplaceAll(res["version"].(string), ".", "-")),
-		Kind:    flect.Pascalize(strutil.ToGolangName(res["name"].(string))),
-	}, nil
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
 
-func ChartJsonSchema(tgzFS fs.FS, rootDir string) ([]byte, error) {
-	fin, err := tgzFS.Open(rootDir + "/values.schema.json")
+func validateNames(names Names) error {
+	if errs := validation.IsDNS1123Subdomain(names.GVK.Group); len(errs) > 0 || !strings.Contains(names.GVK.Group, ".") {
+		return fmt.Errorf("invalid CRD group %q: must be a lowercase domain name with at least one dot", names.GVK.Group)
+	}
+	if errs := validation.IsDNS1035Label(names.GVK.Version); len(errs) > 0 {
+		return fmt.Errorf("invalid CRD version %q: %s", names.GVK.Version, strings.Join(errs, ", "))
+	}
+	if !kindRegexp.MatchString(names.GVK.Kind) {
+		return fmt.Errorf("invalid CRD kind %q: must start with an uppercase letter and contain only letters and digits", names.GVK.Kind)
+	}
+	if names.Plural != "" {
+		if errs := validation.IsDNS1035Label(names.Plural); len(errs) > 0 {
+			return fmt.Errorf("invalid CRD plural %q: %s", names.Plural, strings.Join(errs, ", "))
+		}
+	}
+	for _, el := range names.ShortNames {
+		if errs := validation.IsDNS1035Label(el); len(errs) > 0 {
+			return fmt.Errorf("invalid CRD short name %q: %s", el, strings.Join(errs, ", "))
+		}
+	}
+	for _, el := range names.Categories {
+		if errs := validation.IsDNS1035Label(el); len(errs) > 0 {
+			return fmt.Errorf("invalid CRD category %q: %s", el, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated annotation value, dropping empty items.
+func splitList(s string) []string {
+	res := []string{}
+	for _, el := range strings.Split(s, ",") {
+		if el = strings.TrimSpace(el); el != "" {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+// mergeLists returns the items of the lists in order, without duplicates, or nil when there are none.
+func mergeLists(lists ...[]string) []string {
+	var res []string
+	for _, list := range lists {
+		for _, el := range list {
+			if !slices.Contains(res, el) {
+				res = append(res, el)
+			}
+		}
+	}
+	return res
+}
+
+// CRDPrinterColumns returns the printer columns of the CRD generated from the chart:
+// the columns of the krateo.io/crd-printer-columns annotation of the Chart.yaml followed by the columns of nfo.
+// A column of nfo replaces a chart column with the same name.
+func CRDPrinterColumns(tgzFS fs.FS, rootDir string, nfo *v1alpha1.CRDInfo) ([]apiextensionsv1.CustomResourceColumnDefinition, error) {
+	res, err := readChartMetadata(tgzFS, rootDir)
 	if err != nil {
 		return nil, err
 	}
-	defer fin.Close()
 
-	return io.ReadAll(fin)
+	columns := []v1alpha1.PrinterColumn{}
+	if v := res.Annotations[PrinterColumnsAnnotation]; v != "" {
+		if err := yaml.Unmarshal([]byte(v), &columns); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", PrinterColumnsAnnotation, err)
+		}
+	}
+	if nfo != nil {
+		columns = append(columns, nfo.PrinterColumns...)
+	}
+
+	all := []apiextensionsv1.CustomResourceColumnDefinition{}
+	for _, col := range columns {
+		if err := validatePrinterColumn(col); err != nil {
+			return nil, err
+		}
+		def := apiextensionsv1.CustomResourceColumnDefinition{
+			Name:        col.Name,
+			Type:        string(col.Type),
+			Format:      col.Format,
+			Description: col.Description,
+			Priority:    col.Priority,
+			JSONPath:    col.JSONPath,
+		}
+		idx := slices.IndexFunc(all, func(el apiextensionsv1.CustomResourceColumnDefinition) bool {
+			return el.Name == col.Name
+		})
+		if idx == -1 {
+			all = append(all, def)
+			continue
+		}
+		all[idx] = def
+	}
+
+	return all, nil
+}
+
+// validatePrinterColumn checks the printer columns declared by the chart, which are not validated by the apiserver
+// as the ones of the CompositionDefinition.
+func validatePrinterColumn(col v1alpha1.PrinterColumn) error {
+	if col.Name == "" {
+		return fmt.Errorf("invalid printer column: name cannot be empty")
+	}
+	switch col.Type {
+	case "string", "integer", "number", "boolean", "date":
+	default:
+		return fmt.Errorf("invalid printer column %q: unsupported type %q", col.Name, col.Type)
+	}
+	if !jsonPathRegexp.MatchString(col.JSONPath) {
+		return fmt.Errorf("invalid printer column %q: jsonPath %q must point into .spec or .status", col.Name, col.JSONPath)
+	}
+	if col.Priority < 0 {
+		return fmt.Errorf("invalid printer column %q: priority cannot be negative", col.Name)
+	}
+	return nil
+}
+
+// ChartStatusSchema returns the status schema contributed by the chart as a single JSON document, or nil if the chart
+// does not declare one. The schema is read from status.schema.json or status.schema.yaml, resolving local references
+// as ChartJsonSchema does, then from the krateo.io/status-schema annotation of the Chart.yaml.
+func ChartStatusSchema(tgzFS fs.FS, rootDir string) ([]byte, error) {
+	for _, el := range []string{"status.schema.json", "status.schema.yaml", "status.schema.yml"} {
+		if _, err := fs.Stat(tgzFS, rootDir+"/"+el); err == nil {
+			return valuesschema.Load(tgzFS, rootDir+"/"+el)
+		}
+	}
+
+	res, err := readChartMetadata(tgzFS, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	v := res.Annotations[StatusSchemaAnnotation]
+	if v == "" {
+		return nil, nil
+	}
+	dat, err := yaml.YAMLToJSON([]byte(v))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", StatusSchemaAnnotation, err)
+	}
+	return dat, nil
+}
+
+// ChartJsonSchema returns the values schema of the chart as a single JSON document, with the local
+// references to other files of the chart and to definitions inlined. The schema is read from
+// values.schema.json or, when it does not exist, from values.schema.yaml.
+// The schemas of the dependencies declared in the Chart.yaml and vendored in charts/, as dirs or archives,
+// are nested under their alias or name, with a boolean field for each path of their condition and the
+// schemas of the values they import. What the chart declares takes precedence over its subcharts.
+func ChartJsonSchema(tgzFS fs.FS, rootDir string) ([]byte, error) {
+	return chartJsonSchema(tgzFS, rootDir, 0)
+}
+
+// valuesSchema returns the values schema of the chart, without the ones of its subcharts.
+func valuesSchema(tgzFS fs.FS, rootDir string) ([]byte, error) {
+	name := rootDir + "/values.schema.json"
+	if _, err := fs.Stat(tgzFS, name); errors.Is(err, fs.ErrNotExist) {
+		for _, el := range []string{"values.schema.yaml", "values.schema.yml"} {
+			if _, err := fs.Stat(tgzFS, rootDir+"/"+el); err == nil {
+				name = rootDir + "/" + el
+				break
+			}
+		}
+	}
+
+	return valuesschema.Load(tgzFS, name)
 }
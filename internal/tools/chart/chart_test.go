@@ -140,7 +140,7 @@ func TestCRDGenFromOCI(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	gvk, err := ChartGroupVersionKind(pkg, dir)
+	gvk, err := ChartGroupVersionKind(pkg, dir, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
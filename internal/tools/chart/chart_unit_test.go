@@ -5,15 +5,35 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/mirrors"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
 	"github.com/krateoplatformops/plumbing/helm/getter"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"golang.org/x/crypto/openpgp"           //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/clearsign" //nolint:staticcheck
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestChartInfoFromSpecRetriesTransientFailures(t *testing.T) {
@@ -138,6 +158,373 @@ func TestChartInfoFromSpecFailsFastOnDenylistedError(t *testing.T) {
 	}
 }
 
+// countingReader is an endless archive counting the bytes read from it.
+type countingReader struct {
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestFetchBoundsDownloads(t *testing.T) {
+	origGetter := chartGetter
+	origWait := chartRetryWait
+	t.Cleanup(func() {
+		chartGetter = origGetter
+		chartRetryWait = origWait
+	})
+	chartRetryWait = func(context.Context, time.Duration) error { return nil }
+
+	attempts := 0
+	dat := &countingReader{}
+	chartGetter = func(context.Context, string, ...getter.Option) (io.Reader, string, error) {
+		attempts++
+		return dat, "oci://example.invalid/endless:1.0.0", nil
+	}
+
+	_, err := Fetch(context.Background(), nil, &v1alpha1.ChartInfo{Url: "oci://example.invalid/endless", Version: "1.0.0"},
+		WithLimits(tgzfs.Limits{MaxCompressedSize: 1 << 10}))
+	var lerr *tgzfs.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != "MaxCompressedSize" {
+		t.Fatalf("expected a MaxCompressedSize limit error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+	if dat.read > 1<<11 {
+		t.Fatalf("expected the download to stop after the limit, read %d bytes", dat.read)
+	}
+}
+
+func TestFetchSharesCachedCharts(t *testing.T) {
+	origGetter := chartGetter
+	t.Cleanup(func() {
+		chartGetter = origGetter
+		SetCache(nil)
+	})
+
+	cache, err := chartcache.New(chartcache.Options{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	SetCache(cache)
+
+	chartBytes := mustChartArchive(t, "demo-chart")
+	attempts := 0
+	chartGetter = func(context.Context, string, ...getter.Option) (io.Reader, string, error) {
+		attempts++
+		return bytes.NewReader(chartBytes), "oci://example.invalid/chart:1.2.3", nil
+	}
+
+	nfo := &v1alpha1.ChartInfo{Url: "oci://example.invalid/chart", Version: "1.2.3"}
+	if _, _, err := ChartInfoFromSpec(context.Background(), nil, nfo); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	pkg, err := Fetch(context.Background(), nil, nfo)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 download, got %d", attempts)
+	}
+	if pkg.PackageURL != "oci://example.invalid/chart:1.2.3" {
+		t.Fatalf("expected package URL oci://example.invalid/chart:1.2.3, got %q", pkg.PackageURL)
+	}
+	if pkg.Digest != chartcache.Digest(chartBytes) {
+		t.Fatalf("expected digest %s, got %s", chartcache.Digest(chartBytes), pkg.Digest)
+	}
+
+	if _, err := Fetch(context.Background(), nil, &v1alpha1.ChartInfo{Url: nfo.Url, Version: "1.2.4"}); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected another version to be downloaded, got %d downloads", attempts)
+	}
+}
+
+func TestFetchRevalidatesHTTPArchives(t *testing.T) {
+	origGetter := chartGetter
+	t.Cleanup(func() {
+		chartGetter = origGetter
+		SetCache(nil)
+	})
+
+	cache, err := chartcache.New(chartcache.Options{})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	SetCache(cache)
+
+	chartBytes := mustChartArchive(t, "demo-chart")
+	requests, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(chartBytes)
+	}))
+	t.Cleanup(srv.Close)
+
+	downloads := 0
+	chartGetter = func(_ context.Context, uri string, _ ...getter.Option) (io.Reader, string, error) {
+		downloads++
+		return bytes.NewReader(chartBytes), uri, nil
+	}
+
+	// A zero TTL revalidates the cached chart on every fetch: the first revalidation records the ETag,
+	// the next ones are answered with 304 Not Modified.
+	nfo := &v1alpha1.ChartInfo{Url: srv.URL + "/demo-chart-1.2.3.tgz"}
+	for i := 0; i < 3; i++ {
+		pkg, err := Fetch(context.Background(), nil, nfo)
+		if err != nil {
+			t.Fatalf("expected success, got error: %v", err)
+		}
+		if !bytes.Equal(pkg.Data, chartBytes) {
+			t.Fatalf("unexpected chart content on fetch %d", i)
+		}
+	}
+	if downloads != 1 {
+		t.Fatalf("expected 1 download through the getter, got %d", downloads)
+	}
+	if requests != 2 || notModified != 1 {
+		t.Fatalf("expected 2 revalidations with 1 not modified, got %d and %d", requests, notModified)
+	}
+}
+
+func TestFetchVerifiesProvenance(t *testing.T) {
+	origGetter := chartGetter
+	t.Cleanup(func() { chartGetter = origGetter })
+
+	chartBytes := mustChartArchive(t, "demo-chart")
+	signer, err := openpgp.NewEntity("Chart Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	keyring := &bytes.Buffer{}
+	if err := signer.Serialize(keyring); err != nil {
+		t.Fatalf("failed to serialize keyring: %v", err)
+	}
+	sign := func(archive []byte) []byte {
+		out := &bytes.Buffer{}
+		w, err := clearsign.Encode(out, signer.PrivateKey, nil)
+		if err != nil {
+			t.Fatalf("failed to sign provenance file: %v", err)
+		}
+		fmt.Fprintf(w, "name: demo-chart\nversion: 1.2.3\n\n...\nfiles:\n  demo-chart-1.2.3.tgz: sha256:%x\n", sha256.Sum256(archive))
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to sign provenance file: %v", err)
+		}
+		return out.Bytes()
+	}
+
+	provs := map[string][]byte{
+		"/signed/demo-chart-1.2.3.tgz.prov":   sign(chartBytes),
+		"/tampered/demo-chart-1.2.3.tgz.prov": sign([]byte("another archive")),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prov, ok := provs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(prov)
+	}))
+	t.Cleanup(srv.Close)
+
+	// Verified archives are remembered by digest, so the charts expected to fail have their own content.
+	otherBytes := mustChartArchive(t, "other-chart")
+	chartGetter = func(_ context.Context, uri string, _ ...getter.Option) (io.Reader, string, error) {
+		if strings.Contains(uri, "/signed/") {
+			return bytes.NewReader(chartBytes), uri, nil
+		}
+		return bytes.NewReader(otherBytes), uri, nil
+	}
+	kube := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keyring", Namespace: "default"},
+		Data:       map[string][]byte{"pubring.gpg": keyring.Bytes()},
+	}).Build()
+	verification := &v1alpha1.ChartVerification{
+		Provenance: &v1alpha1.ProvenanceVerification{
+			KeyringRef: rtv1.SecretKeySelector{
+				Reference: rtv1.Reference{Name: "keyring", Namespace: "default"},
+				Key:       "pubring.gpg",
+			},
+		},
+	}
+
+	pkg, err := Fetch(context.Background(), kube, &v1alpha1.ChartInfo{Url: srv.URL + "/signed/demo-chart-1.2.3.tgz", Verify: verification})
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if pkg.Verification == nil || pkg.Verification.Signer != "Chart Signer <signer@example.com>" {
+		t.Fatalf("unexpected verification result: %+v", pkg.Verification)
+	}
+
+	for _, dir := range []string{"tampered", "unsigned"} {
+		_, err := Fetch(context.Background(), kube, &v1alpha1.ChartInfo{Url: srv.URL + "/" + dir + "/demo-chart-1.2.3.tgz", Verify: verification})
+		var verr *verify.Error
+		if !errors.As(err, &verr) {
+			t.Fatalf("expected a verification error for the %s chart, got: %v", dir, err)
+		}
+	}
+}
+
+func TestMemoLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	memo := newMemoLRU[*verify.Result](2)
+	a, b, c := &verify.Result{Signer: "a"}, &verify.Result{Signer: "b"}, &verify.Result{Signer: "c"}
+
+	memo.put("a", a)
+	memo.put("b", b)
+	if _, ok := memo.get("a"); !ok {
+		t.Fatalf("expected a to be remembered")
+	}
+	memo.put("c", c)
+
+	if _, ok := memo.get("b"); ok {
+		t.Fatalf("expected b, the least recently used result, to be evicted")
+	}
+	for key, want := range map[string]*verify.Result{"a": a, "c": c} {
+		if got, ok := memo.get(key); !ok || got != want {
+			t.Fatalf("expected %s to be remembered, got %v", key, got)
+		}
+	}
+}
+
+func TestFetchEnforcesPinnedDigest(t *testing.T) {
+	origGetter := chartGetter
+	t.Cleanup(func() {
+		chartGetter = origGetter
+		SetCache(nil)
+	})
+
+	cache, err := chartcache.New(chartcache.Options{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	SetCache(cache)
+
+	published := mustChartArchive(t, "demo-chart")
+	downloads := 0
+	chartGetter = func(_ context.Context, uri string, _ ...getter.Option) (io.Reader, string, error) {
+		downloads++
+		return bytes.NewReader(published), uri, nil
+	}
+	nfo := &v1alpha1.ChartInfo{Url: "https://example.com/charts/demo-chart-1.2.3.tgz"}
+	if _, err := Fetch(context.Background(), nil, nfo); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	// The chart is republished under the same version and pinned to its new content:
+	// the cached archive does not match, so it is replaced by a fresh download.
+	published = mustChartArchive(t, "other-chart")
+	nfo.Digest = chartcache.Digest(published)
+	pkg, err := Fetch(context.Background(), nil, nfo)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if pkg.Digest != nfo.Digest {
+		t.Fatalf("expected digest %s, got %s", nfo.Digest, pkg.Digest)
+	}
+	if downloads != 2 {
+		t.Fatalf("expected 2 downloads, got %d", downloads)
+	}
+
+	nfo.Digest = chartcache.Digest([]byte("another archive"))
+	_, err = Fetch(context.Background(), nil, nfo)
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a digest mismatch, got: %v", err)
+	}
+	if mismatch.Actual != pkg.Digest {
+		t.Fatalf("expected actual digest %s, got %s", pkg.Digest, mismatch.Actual)
+	}
+}
+
+func TestFetchFallsBackToMirrors(t *testing.T) {
+	origGetter, origWait := chartGetter, chartRetryWait
+	t.Cleanup(func() {
+		chartGetter, chartRetryWait = origGetter, origWait
+		SetMirrors(nil)
+	})
+	chartRetryWait = func(context.Context, time.Duration) error { return nil }
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "chart-mirrors", Namespace: "krateo-system"},
+		Data: map[string]string{mirrors.DefaultKey: `
+rules:
+- prefix: https://charts.example.com
+  mirrors: [https://mirror-a.example.com, https://mirror-b.example.com]
+  fallbackToSource: true
+`},
+	}
+	kube := fake.NewClientBuilder().WithObjects(cm).Build()
+	SetMirrors(&mirrors.Source{ConfigMap: types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}})
+
+	archive := mustChartArchive(t, "demo-chart")
+	var tried []string
+	available := map[string]bool{"https://mirror-b.example.com/demo-chart-1.2.3.tgz": true}
+	chartGetter = func(_ context.Context, uri string, _ ...getter.Option) (io.Reader, string, error) {
+		tried = append(tried, uri)
+		if !available[uri] {
+			return nil, "", fmt.Errorf("failed to fetch %s : 503 Service Unavailable", uri)
+		}
+		return bytes.NewReader(archive), uri, nil
+	}
+
+	nfo := &v1alpha1.ChartInfo{Url: "https://charts.example.com/demo-chart-1.2.3.tgz"}
+	pkg, err := Fetch(context.Background(), kube, nfo)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if pkg.Mirror != "https://mirror-b.example.com" {
+		t.Fatalf("expected the chart to be served by mirror-b, got %q", pkg.Mirror)
+	}
+	if pkg.PackageURL != "https://mirror-b.example.com/demo-chart-1.2.3.tgz" {
+		t.Fatalf("unexpected package URL %s", pkg.PackageURL)
+	}
+	if nfo.Url != "https://charts.example.com/demo-chart-1.2.3.tgz" {
+		t.Fatalf("expected the chart infos to be left untouched, got URL %s", nfo.Url)
+	}
+	if tried[0] != "https://mirror-a.example.com/demo-chart-1.2.3.tgz" {
+		t.Fatalf("expected mirror-a to be tried first, got %v", tried)
+	}
+
+	// The mirrors are down, the source serves the chart.
+	available = map[string]bool{nfo.Url: true}
+	pkg, err = Fetch(context.Background(), kube, nfo)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if pkg.Mirror != "" {
+		t.Fatalf("expected the chart to be served by its source, got %q", pkg.Mirror)
+	}
+
+	// A mirror serving another content is not a reason to try the next one.
+	available = map[string]bool{"https://mirror-a.example.com/demo-chart-1.2.3.tgz": true, nfo.Url: true}
+	nfo.Digest = chartcache.Digest([]byte("another archive"))
+	tried = nil
+	_, err = Fetch(context.Background(), kube, nfo)
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a digest mismatch, got: %v", err)
+	}
+	if len(tried) != 1 {
+		t.Fatalf("expected a single download, got %v", tried)
+	}
+
+	nfo.Digest = ""
+	available = nil
+	if _, err = Fetch(context.Background(), kube, nfo); err == nil || !strings.Contains(err.Error(), "no mirror of "+nfo.Url) {
+		t.Fatalf("expected all the mirrors to fail, got: %v", err)
+	}
+}
+
 func TestIsRetryableChartError(t *testing.T) {
 	tests := []struct {
 		name string
@@ -192,3 +579,333 @@ func mustChartArchive(t *testing.T, rootDir string) []byte {
 
 	return buf.Bytes()
 }
+
+func TestCRDNames(t *testing.T) {
+	chartYAML := func(annotations string) fstest.MapFS {
+		return fstest.MapFS{
+			"demo-chart/Chart.yaml": &fstest.MapFile{Data: []byte("apiVersion: v2\nname: demo-chart\nversion: 1.2.3\n" + annotations)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pkg     fstest.MapFS
+		nfo     *v1alpha1.CRDInfo
+		want    Names
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			pkg:  chartYAML(""),
+			want: Names{GVK: schema.GroupVersionKind{Group: "composition.krateo.io", Version: "v1-2-3", Kind: "DemoChart"}},
+		},
+		{
+			name: "chart annotations",
+			pkg: chartYAML("annotations:\n  krateo.io/crd-group: apps.example.org\n  krateo.io/crd-kind: Demo\n" +
+				"  krateo.io/crd-plural: demoes\n  krateo.io/crd-version-strategy: Major\n"),
+			want: Names{GVK: schema.GroupVersionKind{Group: "apps.example.org", Version: "v1", Kind: "Demo"}, Plural: "demoes"},
+		},
+		{
+			name: "spec overrides chart annotations",
+			pkg:  chartYAML("annotations:\n  krateo.io/crd-group: apps.example.org\n  krateo.io/crd-kind: Demo\n"),
+			nfo:  &v1alpha1.CRDInfo{Group: "team.example.org", VersionStrategy: v1alpha1.VersionStrategyMajorMinor},
+			want: Names{GVK: schema.GroupVersionKind{Group: "team.example.org", Version: "v1-2", Kind: "Demo"}},
+		},
+		{
+			name: "short names and categories are merged",
+			pkg:  chartYAML("annotations:\n  krateo.io/crd-short-names: dc\n  krateo.io/crd-categories: 'demos, apps'\n"),
+			nfo:  &v1alpha1.CRDInfo{ShortNames: []string{"demo", "dc"}, Categories: []string{"team"}},
+			want: Names{
+				GVK:        schema.GroupVersionKind{Group: "composition.krateo.io", Version: "v1-2-3", Kind: "DemoChart"},
+				ShortNames: []string{"dc", "demo"},
+				Categories: []string{"demos", "apps", "team"},
+			},
+		},
+		{
+			name:    "invalid short name",
+			pkg:     chartYAML("annotations:\n  krateo.io/crd-short-names: DC\n"),
+			wantErr: true,
+		},
+		{
+			name:    "group without a dot",
+			pkg:     chartYAML(""),
+			nfo:     &v1alpha1.CRDInfo{Group: "example"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid plural",
+			pkg:     chartYAML("annotations:\n  krateo.io/crd-plural: Demos\n"),
+			wantErr: true,
+		},
+		{
+			name:    "unknown version strategy",
+			pkg:     chartYAML("annotations:\n  krateo.io/crd-version-strategy: Latest\n"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CRDNames(tt.pkg, "demo-chart", tt.nfo)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got names %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected success, got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCRDPrinterColumns(t *testing.T) {
+	chartYAML := func(annotations string) fstest.MapFS {
+		return fstest.MapFS{
+			"demo-chart/Chart.yaml": &fstest.MapFile{Data: []byte("apiVersion: v2\nname: demo-chart\nversion: 1.2.3\n" + annotations)},
+		}
+	}
+	chartColumns := "annotations:\n  krateo.io/crd-printer-columns: |\n" +
+		"    - name: REPLICAS\n      type: integer\n      jsonPath: .spec.replicas\n" +
+		"    - name: URL\n      type: string\n      jsonPath: .status.url\n      priority: 1\n"
+
+	tests := []struct {
+		name    string
+		pkg     fstest.MapFS
+		nfo     *v1alpha1.CRDInfo
+		want    []apiextensionsv1.CustomResourceColumnDefinition
+		wantErr bool
+	}{
+		{
+			name: "no columns",
+			pkg:  chartYAML(""),
+			want: []apiextensionsv1.CustomResourceColumnDefinition{},
+		},
+		{
+			name: "chart columns",
+			pkg:  chartYAML(chartColumns),
+			want: []apiextensionsv1.CustomResourceColumnDefinition{
+				{Name: "REPLICAS", Type: "integer", JSONPath: ".spec.replicas"},
+				{Name: "URL", Type: "string", JSONPath: ".status.url", Priority: 1},
+			},
+		},
+		{
+			name: "spec columns replace chart columns",
+			pkg:  chartYAML(chartColumns),
+			nfo: &v1alpha1.CRDInfo{PrinterColumns: []v1alpha1.PrinterColumn{
+				{Name: "URL", Type: "string", JSONPath: ".status.endpoint"},
+				{Name: "TIER", Type: "string", JSONPath: `.spec.tiers[0].name`, Description: "The first tier"},
+			}},
+			want: []apiextensionsv1.CustomResourceColumnDefinition{
+				{Name: "REPLICAS", Type: "integer", JSONPath: ".spec.replicas"},
+				{Name: "URL", Type: "string", JSONPath: ".status.endpoint"},
+				{Name: "TIER", Type: "string", JSONPath: ".spec.tiers[0].name", Description: "The first tier"},
+			},
+		},
+		{
+			name:    "malformed annotation",
+			pkg:     chartYAML("annotations:\n  krateo.io/crd-printer-columns: 'name: URL'\n"),
+			wantErr: true,
+		},
+		{
+			name:    "json path outside spec and status",
+			pkg:     chartYAML("annotations:\n  krateo.io/crd-printer-columns: '[{name: NAME, type: string, jsonPath: .metadata.name}]'\n"),
+			wantErr: true,
+		},
+		{
+			name: "unsupported type",
+			pkg:  chartYAML(""),
+			nfo: &v1alpha1.CRDInfo{PrinterColumns: []v1alpha1.PrinterColumn{
+				{Name: "TAGS", Type: "array", JSONPath: ".spec.tags"},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CRDPrinterColumns(tt.pkg, "demo-chart", tt.nfo)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got columns %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected success, got error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestChartJsonSchema(t *testing.T) {
+	pkg := fstest.MapFS{
+		"json-chart/values.schema.json": &fstest.MapFile{Data: []byte(`{"type": "object", "properties": {"port": {"$ref": "schemas/port.json"}}}`)},
+		"json-chart/schemas/port.json":  &fstest.MapFile{Data: []byte(`{"type": "integer"}`)},
+		"yaml-chart/values.schema.yaml": &fstest.MapFile{Data: []byte("type: object\nproperties:\n  port:\n    type: integer\n")},
+		"no-schema-chart/values.yaml":   &fstest.MapFile{Data: []byte("port: 80\n")},
+	}
+
+	for _, dir := range []string{"json-chart", "yaml-chart"} {
+		got, err := ChartJsonSchema(pkg, dir)
+		if err != nil {
+			t.Fatalf("%s: expected success, got error: %v", dir, err)
+		}
+		if want := `{"properties":{"port":{"type":"integer"}},"type":"object"}`; string(got) != want {
+			t.Fatalf("%s: expected %s, got %s", dir, want, got)
+		}
+	}
+
+	if _, err := ChartJsonSchema(pkg, "no-schema-chart"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestChartJsonSchemaWithSubcharts(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"common/Chart.yaml":         "apiVersion: v2\nname: common\nversion: 0.1.0\n",
+		"common/values.schema.json": `{"type": "object", "properties": {"exports": {"type": "object", "properties": {"defaults": {"type": "object", "properties": {"timezone": {"type": "string"}}}}}}}`,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+
+	pkg := fstest.MapFS{
+		"umbrella/Chart.yaml": &fstest.MapFile{Data: []byte(`apiVersion: v2
+name: umbrella
+version: 1.0.0
+dependencies:
+  - name: postgresql
+    alias: db
+    condition: db.enabled,global.db.enabled
+    import-values:
+      - child: auth
+        parent: dbAuth
+  - name: common
+    import-values:
+      - defaults
+  - name: redis
+    condition: redis.enabled
+`)},
+		"umbrella/values.schema.json":                   &fstest.MapFile{Data: []byte(`{"type": "object", "properties": {"db": {"properties": {"port": {"type": "string"}}}}}`)},
+		"umbrella/charts/postgresql/Chart.yaml":         &fstest.MapFile{Data: []byte("apiVersion: v2\nname: postgresql\nversion: 12.0.0\n")},
+		"umbrella/charts/postgresql/values.schema.json": &fstest.MapFile{Data: []byte(`{"type": "object", "required": ["port"], "properties": {"port": {"type": "integer"}, "auth": {"type": "object", "properties": {"username": {"type": "string"}}}}}`)},
+		"umbrella/charts/common-0.1.0.tgz":              &fstest.MapFile{Data: buf.Bytes()},
+	}
+
+	got, err := ChartJsonSchema(pkg, "umbrella")
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	want := `{"properties":{` +
+		`"common":{"properties":{"exports":{"properties":{"defaults":{"properties":{"timezone":{"type":"string"}},"type":"object"}},"type":"object"}},"type":"object"},` +
+		`"db":{"properties":{"auth":{"properties":{"username":{"type":"string"}},"type":"object"},"enabled":{"type":"boolean"},"port":{"type":"string"}},"required":["port"],"type":"object"},` +
+		`"dbAuth":{"properties":{"username":{"type":"string"}},"type":"object"},` +
+		`"global":{"properties":{"db":{"properties":{"enabled":{"type":"boolean"}},"type":"object"}},"type":"object"},` +
+		`"timezone":{"type":"string"}},"type":"object"}`
+	if string(got) != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	// Without subcharts, the schema of the chart is returned as it is.
+	delete(pkg, "umbrella/charts/postgresql/values.schema.json")
+	delete(pkg, "umbrella/charts/common-0.1.0.tgz")
+	got, err = ChartJsonSchema(pkg, "umbrella")
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if want := `{"properties":{"db":{"properties":{"port":{"type":"string"}}}},"type":"object"}`; string(got) != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestChartStatusSchema(t *testing.T) {
+	chartYAML := func(annotations string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("apiVersion: v2\nname: demo-chart\nversion: 1.2.3\n" + annotations)}
+	}
+	pkg := fstest.MapFS{
+		"file-chart/Chart.yaml":           chartYAML("annotations:\n  krateo.io/status-schema: '{\"type\": \"object\"}'\n"),
+		"file-chart/status.schema.json":   &fstest.MapFile{Data: []byte(`{"properties": {"endpoint": {"$ref": "#/definitions/url"}}, "definitions": {"url": {"type": "string"}}}`)},
+		"annotation-chart/Chart.yaml":     chartYAML("annotations:\n  krateo.io/status-schema: |\n    properties:\n      endpoint:\n        type: string\n"),
+		"no-status-chart/Chart.yaml":      chartYAML(""),
+		"invalid-status-chart/Chart.yaml": chartYAML("annotations:\n  krateo.io/status-schema: '{'\n"),
+	}
+
+	tests := []struct {
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{dir: "file-chart", want: `{"properties":{"endpoint":{"type":"string"}}}`},
+		{dir: "annotation-chart", want: `{"properties":{"endpoint":{"type":"string"}}}`},
+		{dir: "no-status-chart"},
+		{dir: "invalid-status-chart", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ChartStatusSchema(pkg, tt.dir)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error, got %s", tt.dir, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected success, got error: %v", tt.dir, err)
+		}
+		if string(got) != tt.want {
+			t.Fatalf("%s: expected %q, got %q", tt.dir, tt.want, got)
+		}
+	}
+}
+
+func TestCRDVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		strategy v1alpha1.VersionStrategy
+		want     string
+		wantErr  bool
+	}{
+		{version: "1.2.3", strategy: v1alpha1.VersionStrategyChartVersion, want: "v1-2-3"},
+		{version: "1.2.3-rc.1", strategy: v1alpha1.VersionStrategyMajor, want: "v1"},
+		{version: "v2.10.0", strategy: v1alpha1.VersionStrategyMajorMinor, want: "v2-10"},
+		{version: "latest", strategy: v1alpha1.VersionStrategyMajor, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := crdVersion(tt.version, tt.strategy)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("%s/%s: expected error, got %q", tt.version, tt.strategy, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s/%s: expected success, got error: %v", tt.version, tt.strategy, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s/%s: expected %q, got %q", tt.version, tt.strategy, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+// Package chartcache caches the chart archives downloaded by the operator, so that the fetches
+// of the same chart made by Observe, Create, Update and Delete, and by other CompositionDefinitions,
+// share a single download.
+//
+// Archives are content-addressed: they are stored by the sha256 digest of their content, and an index
+// maps the source of a chart (URL, version, repo and credentials) to the digest it resolved to.
+// The archives live in an in-memory LRU and, optionally, in a directory on disk that survives restarts.
+// Entries older than the TTL are revalidated against their source before they are served again.
+package chartcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	charttelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/charts"
+	"golang.org/x/sync/singleflight"
+)
+
+// Tiers of the cache, as reported by the metrics.
+const (
+	TierMemory = "memory"
+	TierDisk   = "disk"
+	TierRemote = "remote"
+)
+
+// Outcomes of a lookup, as reported by the metrics.
+const (
+	// OutcomeHit is a fresh entry served from the cache.
+	OutcomeHit = "hit"
+	// OutcomeMiss is a chart that was not cached and has been downloaded.
+	OutcomeMiss = "miss"
+	// OutcomeRevalidated is a stale entry whose source did not change.
+	OutcomeRevalidated = "revalidated"
+	// OutcomeRefreshed is a stale entry whose source changed and has been downloaded again.
+	OutcomeRefreshed = "refreshed"
+	// OutcomeError is a chart that could not be downloaded.
+	OutcomeError = "error"
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Key identifies the source of a chart.
+type Key struct {
+	URL     string `json:"url"`
+	Version string `json:"version,omitempty"`
+	Repo    string `json:"repo,omitempty"`
+	// Auth is a digest of the credentials used to download the chart, so that a chart downloaded
+	// with credentials is only served to the fetches made with the same credentials.
+	Auth string `json:"auth,omitempty"`
+}
+
+func (k Key) id() string {
+	dat, _ := json.Marshal(k)
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:])
+}
+
+// Validators are the HTTP validators of a downloaded archive, used to revalidate it conditionally.
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// Entry describes a cached archive.
+type Entry struct {
+	Key Key `json:"key"`
+	// Digest is the sha256 digest of the archive, as sha256:<hex>.
+	Digest string `json:"digest"`
+	// PackageURL is the URL the archive was downloaded from.
+	PackageURL string     `json:"packageURL,omitempty"`
+	Validators Validators `json:"validators"`
+	Size       int64      `json:"size"`
+	FetchedAt  time.Time  `json:"fetchedAt"`
+}
+
+// Response is the result of a Fetcher.
+type Response struct {
+	Data       []byte
+	PackageURL string
+	Validators Validators
+	// NotModified reports that the stale entry passed to the Fetcher is still current. Data is ignored.
+	NotModified bool
+}
+
+// Fetcher downloads a chart archive. When stale is not nil, the chart is cached but expired,
+// and the Fetcher may revalidate it with its validators and return a Response with NotModified set.
+type Fetcher func(ctx context.Context, stale *Entry) (*Response, error)
+
+// Options configures a Cache.
+type Options struct {
+	// TTL is how long an entry is served without being revalidated. A zero TTL revalidates on every lookup.
+	TTL time.Duration
+	// MaxEntries and MaxBytes limit the archives held in memory. Zero means no limit.
+	MaxEntries int
+	MaxBytes   int64
+	// Dir enables the disk tier when it is not empty.
+	Dir string
+	// MaxDiskBytes limits the archives stored in Dir. Zero means no limit.
+	MaxDiskBytes int64
+	Metrics      *charttelemetry.Metrics
+}
+
+// Cache is a chart archive cache. It is safe for concurrent use, and concurrent lookups
+// of the same key share a single download. A nil *Cache downloads every chart.
+type Cache struct {
+	opts  Options
+	now   func() time.Time
+	group singleflight.Group
+
+	mu    sync.Mutex
+	index map[Key]Entry
+	lru   *list.List
+	blobs map[string]*list.Element
+	size  int64
+}
+
+type blob struct {
+	digest string
+	data   []byte
+}
+
+// New creates a Cache, creating the directories of the disk tier when it is enabled.
+func New(opts Options) (*Cache, error) {
+	if opts.Dir != "" {
+		for _, dir := range []string{"blobs", "index"} {
+			if err := os.MkdirAll(filepath.Join(opts.Dir, dir), 0o700); err != nil {
+				return nil, fmt.Errorf("error creating chart cache directory: %w", err)
+			}
+		}
+	}
+
+	return &Cache{
+		opts:  opts,
+		now:   time.Now,
+		index: map[Key]Entry{},
+		lru:   list.New(),
+		blobs: map[string]*list.Element{},
+	}, nil
+}
+
+// Digest returns the sha256 digest of data, as sha256:<hex>.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the archive of the chart identified by key, calling fetch when it is not cached or is expired.
+// The returned data is shared between callers and must not be modified.
+func (c *Cache) Get(ctx context.Context, key Key, fetch Fetcher) (Entry, []byte, error) {
+	if c == nil {
+		resp, err := fetch(ctx, nil)
+		if err != nil {
+			return Entry{}, nil, err
+		}
+		return newEntry(key, resp, time.Now()), resp.Data, nil
+	}
+
+	type result struct {
+		entry Entry
+		data  []byte
+	}
+	res, err, _ := c.group.Do(key.id(), func() (any, error) {
+		entry, data, err := c.get(ctx, key, fetch)
+		return result{entry: entry, data: data}, err
+	})
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	r := res.(result)
+	return r.entry, r.data, nil
+}
+
+func (c *Cache) get(ctx context.Context, key Key, fetch Fetcher) (Entry, []byte, error) {
+	entry, data, tier, ok := c.lookup(ctx, key)
+	if ok && c.now().Sub(entry.FetchedAt) < c.opts.TTL {
+		c.opts.Metrics.RecordLookup(ctx, tier, OutcomeHit)
+		return entry, data, nil
+	}
+
+	var stale *Entry
+	if ok {
+		stale = &entry
+	}
+	resp, err := fetch(ctx, stale)
+	if err != nil {
+		c.opts.Metrics.RecordLookup(ctx, TierRemote, OutcomeError)
+		return Entry{}, nil, err
+	}
+
+	if resp.NotModified {
+		if stale == nil {
+			c.opts.Metrics.RecordLookup(ctx, TierRemote, OutcomeError)
+			return Entry{}, nil, fmt.Errorf("chart %s is not cached and cannot be revalidated", key.URL)
+		}
+		entry.FetchedAt = c.now()
+		if resp.Validators != (Validators{}) {
+			entry.Validators = resp.Validators
+		}
+		c.store(ctx, entry, data)
+		c.opts.Metrics.RecordLookup(ctx, tier, OutcomeRevalidated)
+		return entry, data, nil
+	}
+
+	fresh := newEntry(key, resp, c.now())
+	outcome := OutcomeMiss
+	if stale != nil {
+		outcome = OutcomeRefreshed
+		if fresh.Digest == stale.Digest {
+			outcome = OutcomeRevalidated
+		}
+	}
+	c.store(ctx, fresh, resp.Data)
+	c.opts.Metrics.RecordLookup(ctx, TierRemote, outcome)
+	return fresh, resp.Data, nil
+}
+
+// TTL returns how long an entry is served before it is revalidated, zero for a nil cache.
+func (c *Cache) TTL() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.opts.TTL
+}
+
+// Invalidate drops the entry of key, so the next Get downloads the chart again.
+// The archive stays cached for the other keys that share it.
+func (c *Cache) Invalidate(key Key) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.index, key)
+	c.mu.Unlock()
+	if c.opts.Dir != "" {
+		os.Remove(c.indexPath(key))
+	}
+}
+
+func newEntry(key Key, resp *Response, now time.Time) Entry {
+	return Entry{
+		Key:        key,
+		Digest:     Digest(resp.Data),
+		PackageURL: resp.PackageURL,
+		Validators: resp.Validators,
+		Size:       int64(len(resp.Data)),
+		FetchedAt:  now,
+	}
+}
+
+// lookup returns the entry of key and its archive, from memory or else from disk.
+func (c *Cache) lookup(ctx context.Context, key Key) (Entry, []byte, string, bool) {
+	c.mu.Lock()
+	entry, ok := c.index[key]
+	if ok {
+		if el, found := c.blobs[entry.Digest]; found {
+			c.lru.MoveToFront(el)
+			data := el.Value.(*blob).data
+			c.mu.Unlock()
+			return entry, data, TierMemory, true
+		}
+	}
+	c.mu.Unlock()
+
+	if c.opts.Dir == "" {
+		return Entry{}, nil, "", false
+	}
+	entry, ok = c.readIndex(key)
+	if !ok {
+		return Entry{}, nil, "", false
+	}
+	data, err := c.readBlob(entry.Digest)
+	if err != nil {
+		os.Remove(c.indexPath(key))
+		return Entry{}, nil, "", false
+	}
+
+	c.mu.Lock()
+	c.add(ctx, entry, data)
+	c.mu.Unlock()
+	return entry, data, TierDisk, true
+}
+
+// store saves the entry and its archive in memory and on disk.
+// The disk tier is best effort: an archive that cannot be written to disk is still cached in memory.
+func (c *Cache) store(ctx context.Context, entry Entry, data []byte) {
+	if c.opts.Dir != "" {
+		if err := c.writeBlob(entry.Digest, data); err == nil {
+			if err := c.writeIndex(entry); err == nil {
+				c.pruneDisk(ctx, entry.Digest)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.add(ctx, entry, data)
+	c.mu.Unlock()
+}
+
+// add caches the archive in memory and evicts the least recently used ones over the limits.
+// It must be called with c.mu held.
+func (c *Cache) add(ctx context.Context, entry Entry, data []byte) {
+	if c.opts.MaxBytes > 0 && int64(len(data)) > c.opts.MaxBytes {
+		delete(c.index, entry.Key)
+		return
+	}
+
+	c.index[entry.Key] = entry
+	if el, ok := c.blobs[entry.Digest]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.blobs[entry.Digest] = c.lru.PushFront(&blob{digest: entry.Digest, data: data})
+	c.size += int64(len(data))
+
+	for (c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) || (c.opts.MaxBytes > 0 && c.size > c.opts.MaxBytes) {
+		b := c.lru.Remove(c.lru.Back()).(*blob)
+		delete(c.blobs, b.digest)
+		c.size -= int64(len(b.data))
+		for k, e := range c.index {
+			if e.Digest == b.digest {
+				delete(c.index, k)
+			}
+		}
+		c.opts.Metrics.RecordEviction(ctx, TierMemory)
+	}
+}
+
+func (c *Cache) indexPath(key Key) string {
+	return filepath.Join(c.opts.Dir, "index", key.id()+".json")
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.opts.Dir, "blobs", strings.TrimPrefix(digest, "sha256:")+".tgz")
+}
+
+func (c *Cache) readIndex(key Key) (Entry, bool) {
+	dat, err := os.ReadFile(c.indexPath(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	entry := Entry{}
+	if err := json.Unmarshal(dat, &entry); err != nil || entry.Key != key || !digestRegexp.MatchString(entry.Digest) {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// readBlob reads the archive with the digest from disk and checks its content against the digest.
+func (c *Cache) readBlob(digest string) ([]byte, error) {
+	name := c.blobPath(digest)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if Digest(data) != digest {
+		os.Remove(name)
+		return nil, fmt.Errorf("chart archive %s is corrupted", digest)
+	}
+	now := c.now()
+	os.Chtimes(name, now, now)
+	return data, nil
+}
+
+func (c *Cache) writeIndex(entry Entry) error {
+	dat, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFile(c.indexPath(entry.Key), dat)
+}
+
+func (c *Cache) writeBlob(digest string, data []byte) error {
+	name := c.blobPath(digest)
+	if _, err := os.Stat(name); err != nil {
+		if err := writeFile(name, data); err != nil {
+			return err
+		}
+	}
+	now := c.now()
+	return os.Chtimes(name, now, now)
+}
+
+// pruneDisk removes the least recently used archives until the disk tier fits MaxDiskBytes.
+// The archive with the keep digest is never removed.
+func (c *Cache) pruneDisk(ctx context.Context, keep string) {
+	if c.opts.MaxDiskBytes <= 0 {
+		return
+	}
+
+	dir := filepath.Join(c.opts.Dir, "blobs")
+	all, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	infos := make([]os.FileInfo, 0, len(all))
+	total := int64(0)
+	for _, el := range all {
+		nfo, err := el.Info()
+		if err != nil || !nfo.Mode().IsRegular() || strings.HasPrefix(nfo.Name(), ".") {
+			continue
+		}
+		infos = append(infos, nfo)
+		total += nfo.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, nfo := range infos {
+		if total <= c.opts.MaxDiskBytes {
+			return
+		}
+		if "sha256:"+strings.TrimSuffix(nfo.Name(), ".tgz") == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, nfo.Name())); err == nil {
+			total -= nfo.Size()
+			c.opts.Metrics.RecordEviction(ctx, TierDisk)
+		}
+	}
+}
+
+// writeFile writes data to a temporary file and renames it to name, so readers never see a partial file.
+func writeFile(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package chartcache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves an archive and counts the downloads and revalidations made through its fetcher.
+type fakeSource struct {
+	mu          sync.Mutex
+	data        []byte
+	etag        string
+	downloads   int
+	revalidated int
+}
+
+func (s *fakeSource) fetch(_ context.Context, stale *Entry) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stale != nil && stale.Validators.ETag != "" && stale.Validators.ETag == s.etag {
+		s.revalidated++
+		return &Response{NotModified: true}, nil
+	}
+	s.downloads++
+	return &Response{Data: s.data, PackageURL: "https://example.com/demo-0.1.0.tgz", Validators: Validators{ETag: s.etag}}, nil
+}
+
+func newTestCache(t *testing.T, opts Options) (*Cache, *time.Time) {
+	t.Helper()
+	c, err := New(opts)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	key := Key{URL: "https://example.com/demo-0.1.0.tgz"}
+
+	t.Run("fresh entries are served from memory", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Minute})
+		src := &fakeSource{data: []byte("chart"), etag: `"v1"`}
+
+		for range 3 {
+			entry, data, err := c.Get(ctx, key, src.fetch)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("chart"), data)
+			assert.Equal(t, Digest([]byte("chart")), entry.Digest)
+			assert.Equal(t, "https://example.com/demo-0.1.0.tgz", entry.PackageURL)
+		}
+		assert.Equal(t, 1, src.downloads)
+	})
+
+	t.Run("expired entries are revalidated", func(t *testing.T) {
+		c, now := newTestCache(t, Options{TTL: time.Minute})
+		src := &fakeSource{data: []byte("chart"), etag: `"v1"`}
+
+		_, _, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+
+		*now = now.Add(2 * time.Minute)
+		entry, data, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart"), data)
+		assert.Equal(t, *now, entry.FetchedAt)
+		assert.Equal(t, 1, src.downloads)
+		assert.Equal(t, 1, src.revalidated)
+
+		src.data, src.etag = []byte("chart v2"), `"v2"`
+		*now = now.Add(2 * time.Minute)
+		entry, data, err = c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart v2"), data)
+		assert.Equal(t, Digest([]byte("chart v2")), entry.Digest)
+		assert.Equal(t, 2, src.downloads)
+	})
+
+	t.Run("keys with different credentials do not share entries", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Minute})
+		src := &fakeSource{data: []byte("chart")}
+
+		_, _, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		_, _, err = c.Get(ctx, Key{URL: key.URL, Auth: Digest([]byte("user:pass"))}, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, 2, src.downloads)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Minute})
+		calls := 0
+		fetch := func(context.Context, *Entry) (*Response, error) {
+			calls++
+			return nil, errors.New("boom")
+		}
+
+		_, _, err := c.Get(ctx, key, fetch)
+		assert.EqualError(t, err, "boom")
+		_, _, err = c.Get(ctx, key, fetch)
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("concurrent lookups share a download", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Minute})
+		release := make(chan struct{})
+		src := &fakeSource{data: []byte("chart")}
+		fetch := func(ctx context.Context, stale *Entry) (*Response, error) {
+			<-release
+			return src.fetch(ctx, stale)
+		}
+
+		var wg sync.WaitGroup
+		for range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, data, err := c.Get(ctx, key, fetch)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("chart"), data)
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, 1, src.downloads)
+	})
+
+	t.Run("invalidated entries are downloaded again", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Hour, Dir: t.TempDir()})
+		src := &fakeSource{data: []byte("chart"), etag: `"v1"`}
+
+		_, _, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		c.Invalidate(key)
+		_, _, err = c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, 2, src.downloads)
+		assert.Equal(t, 0, src.revalidated)
+	})
+
+	t.Run("nil cache downloads every chart", func(t *testing.T) {
+		var c *Cache
+		src := &fakeSource{data: []byte("chart")}
+
+		for range 2 {
+			entry, _, err := c.Get(ctx, key, src.fetch)
+			require.NoError(t, err)
+			assert.Equal(t, Digest([]byte("chart")), entry.Digest)
+		}
+		assert.Equal(t, 2, src.downloads)
+	})
+}
+
+func TestMemoryLimits(t *testing.T) {
+	ctx := context.Background()
+	keys := []Key{{URL: "oci://example.com/a"}, {URL: "oci://example.com/b"}, {URL: "oci://example.com/c"}}
+
+	t.Run("max entries", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Hour, MaxEntries: 2})
+		for _, key := range keys {
+			_, _, err := c.Get(ctx, key, (&fakeSource{data: []byte(key.URL)}).fetch)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, c.lru.Len())
+		assert.NotContains(t, c.index, keys[0])
+		assert.Contains(t, c.index, keys[2])
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Hour, MaxBytes: 40})
+		for _, key := range keys {
+			_, _, err := c.Get(ctx, key, (&fakeSource{data: []byte(key.URL)}).fetch)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, c.lru.Len())
+		assert.LessOrEqual(t, c.size, int64(40))
+
+		_, _, err := c.Get(ctx, Key{URL: "oci://example.com/large"}, (&fakeSource{data: make([]byte, 41)}).fetch)
+		require.NoError(t, err)
+		assert.Equal(t, 2, c.lru.Len())
+	})
+
+	t.Run("archives with the same content are stored once", func(t *testing.T) {
+		c, _ := newTestCache(t, Options{TTL: time.Hour})
+		for _, key := range keys {
+			_, _, err := c.Get(ctx, key, (&fakeSource{data: []byte("chart")}).fetch)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 1, c.lru.Len())
+		assert.Len(t, c.index, 3)
+	})
+}
+
+func TestDiskTier(t *testing.T) {
+	ctx := context.Background()
+	key := Key{URL: "oci://example.com/demo", Version: "0.1.0"}
+
+	t.Run("archives survive a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		src := &fakeSource{data: []byte("chart")}
+
+		c, _ := newTestCache(t, Options{TTL: time.Hour, Dir: dir})
+		_, _, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+
+		restarted, _ := newTestCache(t, Options{TTL: time.Hour, Dir: dir})
+		entry, data, err := restarted.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart"), data)
+		assert.Equal(t, "https://example.com/demo-0.1.0.tgz", entry.PackageURL)
+		assert.Equal(t, 1, src.downloads)
+	})
+
+	t.Run("corrupted archives are downloaded again", func(t *testing.T) {
+		dir := t.TempDir()
+		src := &fakeSource{data: []byte("chart")}
+
+		c, _ := newTestCache(t, Options{TTL: time.Hour, Dir: dir})
+		entry, _, err := c.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(c.blobPath(entry.Digest), []byte("tampered"), 0o600))
+
+		restarted, _ := newTestCache(t, Options{TTL: time.Hour, Dir: dir})
+		_, data, err := restarted.Get(ctx, key, src.fetch)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart"), data)
+		assert.Equal(t, 2, src.downloads)
+	})
+
+	t.Run("max disk bytes", func(t *testing.T) {
+		dir := t.TempDir()
+		c, now := newTestCache(t, Options{TTL: time.Hour, Dir: dir, MaxDiskBytes: 10})
+
+		for _, el := range []string{"first", "second", "third"} {
+			*now = now.Add(time.Second)
+			_, _, err := c.Get(ctx, Key{URL: "oci://example.com/" + el}, (&fakeSource{data: []byte(el)}).fetch)
+			require.NoError(t, err)
+		}
+
+		all, err := os.ReadDir(filepath.Join(dir, "blobs"))
+		require.NoError(t, err)
+		require.Len(t, all, 1)
+		assert.Equal(t, c.blobPath(Digest([]byte("third"))), filepath.Join(dir, "blobs", all[0].Name()))
+	})
+}
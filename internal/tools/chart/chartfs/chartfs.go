@@ -1,20 +1,25 @@
 package chartfs
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/fs"
 
 	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
-	"github.com/krateoplatformops/core-provider/internal/tools/resolvers"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
 	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
-	"github.com/krateoplatformops/plumbing/helm/getter"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func FromReader(in io.Reader, pkgurl string) (*ChartFS, error) {
-	pkg, err := tgzfs.New(in)
+	return FromReaderWithLimits(in, pkgurl, tgzfs.DefaultLimits)
+}
+
+// FromReaderWithLimits reads the chart archive in as FromReader does, rejecting it when it exceeds the limits l.
+func FromReaderWithLimits(in io.Reader, pkgurl string, l tgzfs.Limits) (*ChartFS, error) {
+	pkg, err := tgzfs.NewWithLimits(in, l)
 	if err != nil {
 		return nil, err
 	}
@@ -42,31 +47,14 @@ func FromReader(in io.Reader, pkgurl string) (*ChartFS, error) {
 	}, nil
 }
 
+// ForSpec downloads the chart described by nfo through the chart cache shared with chart.ChartInfoFromSpec.
 func ForSpec(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) (*ChartFS, error) {
-	if nfo == nil {
-		return nil, fmt.Errorf("chart infos cannot be nil")
-	}
-
-	opts := []getter.Option{
-		getter.WithRepo(nfo.Repo),
-		getter.WithVersion(nfo.Version),
-		getter.WithInsecureSkipVerifyTLS(nfo.InsecureSkipVerifyTLS),
-	}
-	if nfo.Credentials != nil {
-		secret, err := resolvers.GetSecret(ctx, kube, nfo.Credentials.PasswordRef)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get secret: %w", err)
-		}
-		opts = append(opts, getter.WithCredentials(nfo.Credentials.Username, secret))
-	}
-	dat, url, err := getter.Get(ctx, nfo.Url,
-		opts...,
-	)
+	pkg, err := chart.Fetch(ctx, kube, nfo)
 	if err != nil {
 		return nil, err
 	}
 
-	return FromReader(dat, url)
+	return FromReader(bytes.NewReader(pkg.Data), pkg.PackageURL)
 }
 
 var _ fs.FS = (*ChartFS)(nil)
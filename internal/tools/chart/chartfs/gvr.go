@@ -1,37 +1,13 @@
 package chartfs
 
 import (
-	"fmt"
-	"io"
-	"strings"
-
-	"github.com/gobuffalo/flect"
-
-	"github.com/krateoplatformops/core-provider/internal/tools/strutil"
-	"gopkg.in/yaml.v2"
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-func GroupVersionKind(fs *ChartFS) (schema.GroupVersionKind, error) {
-	fin, err := fs.Open(fs.RootDir() + "/Chart.yaml")
-	if err != nil {
-		return schema.GroupVersionKind{}, err
-	}
-	defer fin.Close()
-
-	din, err := io.ReadAll(fin)
-	if err != nil {
-		return schema.GroupVersionKind{}, err
-	}
-
-	res := map[string]any{}
-	if err := yaml.Unmarshal(din, &res); err != nil {
-		return schema.GroupVersionKind{}, err
-	}
-
-	return schema.GroupVersionKind{
-		Group:   "composition.krateo.io",
-		Version: fmt.Sprintf("v%s", strings.ReplaceAll(res["version"].(string), ".", "-")),
-		Kind:    flect.Pascalize(strutil.ToGolangName(res["name"].(string))),
-	}, nil
+// GroupVersionKind returns the GroupVersionKind of the CRD generated from the chart,
+// resolved the same way as chart.CRDNames.
+func GroupVersionKind(fs *ChartFS, nfo *v1alpha1.CRDInfo) (schema.GroupVersionKind, error) {
+	return chart.ChartGroupVersionKind(fs, fs.RootDir(), nfo)
 }
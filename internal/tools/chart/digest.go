@@ -0,0 +1,66 @@
+package chart
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
+)
+
+// maxPinnedManifests bounds the OCI manifest digests kept in memory.
+const maxPinnedManifests = 256
+
+// pinnedManifests remembers the manifest digest resolved for an OCI chart archive, by reference and archive digest,
+// so that a chart pinned by manifest and served from the cache does not resolve its manifest on every reconcile.
+var pinnedManifests = newMemoLRU[string](maxPinnedManifests)
+
+// DigestMismatchError is returned when the content of the downloaded chart does not match the digest pinned in the spec.
+type DigestMismatchError struct {
+	// Expected is the pinned digest.
+	Expected string
+	// Actual is the digest of the downloaded archive.
+	Actual string
+	// Manifest is the digest of the manifest holding the archive, set for OCI charts.
+	Manifest string
+}
+
+func (e *DigestMismatchError) Error() string {
+	if e.Manifest != "" {
+		return fmt.Sprintf("chart digest mismatch: expected %s, got archive %s in manifest %s", e.Expected, e.Actual, e.Manifest)
+	}
+	return fmt.Sprintf("chart digest mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// checkDigest enforces the digest pinned in nfo.Digest: it must be the digest of the downloaded archive or,
+// for OCI charts, the digest of the manifest holding it. It returns a *DigestMismatchError when the content does not match.
+func checkDigest(ctx context.Context, nfo *v1alpha1.ChartInfo, pkg *Package, cred credentials) error {
+	if pkg.Digest == nfo.Digest {
+		return nil
+	}
+	if !strings.HasPrefix(pkg.PackageURL, "oci://") {
+		return &DigestMismatchError{Expected: nfo.Digest, Actual: pkg.Digest}
+	}
+
+	ref := strings.TrimPrefix(pkg.PackageURL, "oci://")
+	memo := ref + "@" + pkg.Digest
+	manifest, ok := pinnedManifests.get(memo)
+	if !ok {
+		var holds bool
+		var err error
+		manifest, holds, err = verify.Manifest(ctx, cred.registry(ref), pkg.Digest)
+		if err != nil {
+			return err
+		}
+		if !holds {
+			return &DigestMismatchError{Expected: nfo.Digest, Actual: pkg.Digest, Manifest: manifest}
+		}
+
+		pinnedManifests.put(memo, manifest)
+	}
+	if manifest != nfo.Digest {
+		return &DigestMismatchError{Expected: nfo.Digest, Actual: pkg.Digest, Manifest: manifest}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	"sigs.k8s.io/yaml"
+)
+
+// gitScheme prefixes the URLs of the charts stored in a Git repository, as
+// git+<http|https|file>://<repository>[//<path>][?ref=<branch|tag|commit>].
+const gitScheme = "git+"
+
+// isGitSource reports whether uri is a chart stored in a Git repository.
+func isGitSource(uri string) bool {
+	return strings.HasPrefix(uri, gitScheme)
+}
+
+// gitSource is the path of a chart in a Git repository, at a ref.
+type gitSource struct {
+	repo string
+	path string
+	// ref is a branch, a tag or a commit, HEAD when empty.
+	ref string
+}
+
+// parseGitSource parses a git+<http|https|file>://<repository>[//<path>][?ref=<ref>] URL.
+func parseGitSource(uri string) (gitSource, error) {
+	rest, _ := strings.CutPrefix(uri, gitScheme)
+	rest, query, _ := strings.Cut(rest, "?")
+	scheme, rest, ok := strings.Cut(rest, "://")
+	if !ok || (scheme != "http" && scheme != "https" && scheme != "file") {
+		return gitSource{}, fmt.Errorf("invalid chart url %s, expected git+<http|https|file>://<repository>[//<path>][?ref=<ref>]", uri)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return gitSource{}, fmt.Errorf("invalid chart url %s: %w", uri, err)
+	}
+	repo, dir, _ := strings.Cut(rest, "//")
+	dir = path.Clean("/" + dir)[1:]
+	if repo == "" || strings.HasPrefix(q.Get("ref"), "-") {
+		return gitSource{}, fmt.Errorf("invalid chart url %s", uri)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	return gitSource{repo: scheme + "://" + repo, path: dir, ref: q.Get("ref")}, nil
+}
+
+// url returns the URL of the chart at commit.
+func (s gitSource) url(commit string) string {
+	uri := gitScheme + s.repo
+	if s.path != "." {
+		uri += "//" + s.path
+	}
+	return uri + "?ref=" + commit
+}
+
+// gitGetter returns the getter of the charts stored in Git repositories, packaged within the limits l.
+func (c credentials) gitGetter(l tgzfs.Limits) getterFunc {
+	return func(ctx context.Context, uri string, opts ...getter.Option) (io.Reader, string, error) {
+		return c.getGit(ctx, uri, l, opts...)
+	}
+}
+
+// getGit checks out the chart at uri with the git command and packages it as helm package does,
+// so that the archive of a commit is always the same. The URL of the returned archive pins the commit.
+// Credentials are sent as an Authorization header, and the options of the transport are set as git configuration.
+// A checkout exceeding the limits l fails with a *tgzfs.LimitError.
+func (c credentials) getGit(ctx context.Context, uri string, l tgzfs.Limits, opts ...getter.Option) (io.Reader, string, error) {
+	o := getter.GetOptions{URI: uri, Timeout: c.timeout}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, "", err
+		}
+	}
+	if o.Username != "" && o.Password != "" {
+		c.username, c.password = o.Username, o.Password
+	}
+	c.insecureSkipVerifyTLS = c.insecureSkipVerifyTLS || o.InsecureSkipVerifyTLS
+
+	src, err := parseGitSource(o.URI)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", errNoChart, err)
+	}
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	dir, err := os.MkdirTemp("", "chart-git-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create checkout dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env, err := c.gitEnv(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	worktree := filepath.Join(dir, "worktree")
+	ref := src.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := git(ctx, env, "", "init", "-q", worktree); err != nil {
+		return nil, "", err
+	}
+	if _, err := git(ctx, env, worktree, "fetch", "-q", "--depth=1", "--no-tags", "--", src.repo, ref); err != nil {
+		return nil, "", fmt.Errorf("failed to fetch ref %s of %s: %w", ref, src.repo, err)
+	}
+	if _, err := git(ctx, env, worktree, "checkout", "-q", "FETCH_HEAD"); err != nil {
+		return nil, "", err
+	}
+	commit, err := git(ctx, env, worktree, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+
+	dat, err := packageDir(filepath.Join(worktree, filepath.FromSlash(src.path)), l)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to package %s at %s: %w", src.path, ref, err)
+	}
+	return bytes.NewReader(dat), src.url(commit), nil
+}
+
+// gitEnv returns the environment of the git commands, isolated from the configuration of the system and of the user.
+// The CA bundle and the client certificate are written to dir.
+func (c credentials) gitEnv(dir string) ([]string, error) {
+	config := [][2]string{}
+	switch {
+	case c.token != "":
+		config = append(config, [2]string{"http.extraHeader", "Authorization: Bearer " + c.token})
+	case c.username != "" && c.password != "":
+		auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+		config = append(config, [2]string{"http.extraHeader", "Authorization: Basic " + auth})
+	}
+	if c.insecureSkipVerifyTLS {
+		config = append(config, [2]string{"http.sslVerify", "false"})
+	}
+	if c.proxyURL != nil {
+		config = append(config, [2]string{"http.proxy", c.proxyURL.String()})
+	}
+	if c.caBundle != nil {
+		name := filepath.Join(dir, "ca.crt")
+		if err := os.WriteFile(name, c.caBundle, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write CA bundle: %w", err)
+		}
+		config = append(config, [2]string{"http.sslCAInfo", name})
+	}
+	if c.clientCert != nil {
+		key, err := x509.MarshalPKCS8PrivateKey(c.clientCert.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode client certificate key: %w", err)
+		}
+		certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+		if err := os.WriteFile(certFile, c.clientCertPEM, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write client certificate: %w", err)
+		}
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write client certificate key: %w", err)
+		}
+		config = append(config, [2]string{"http.sslCert", certFile}, [2]string{"http.sslKey", keyFile})
+	}
+
+	// Settings are passed in the environment rather than as arguments, so that credentials do not show in process lists.
+	env := append(os.Environ(),
+		"HOME="+dir,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(config)),
+	)
+	for i, el := range config {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, el[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, el[1]))
+	}
+	return env, nil
+}
+
+// git runs a git command in dir and returns its trimmed output. A missing repository or ref is reported as errNoChart.
+func git(ctx context.Context, env []string, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir, cmd.Env = dir, env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "couldn't find remote ref") || strings.Contains(msg, "not found") || strings.Contains(msg, "does not appear to be a git repository") {
+			return "", fmt.Errorf("%w: git %s: %s", errNoChart, args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// packageDir archives the chart in dir under a root dir named after the chart, skipping the .git dirs.
+// Entries are written in lexical order with fixed times and modes, so that the same files give the same archive.
+// The files are checked against the MaxFiles, MaxFileSize and MaxSize limits of l before they are read, and the
+// first one exceeding a limit fails with a *tgzfs.LimitError, as it would when the archive is read.
+func packageDir(dir string, l tgzfs.Limits) ([]byte, error) {
+	l = l.WithDefaults()
+	meta, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: no Chart.yaml", errNoChart)
+		}
+		return nil, err
+	}
+	var chartMeta struct {
+		Name string `json:"name"`
+	}
+	if err := yaml.Unmarshal(meta, &chartMeta); err != nil {
+		return nil, fmt.Errorf("invalid Chart.yaml: %w", err)
+	}
+	root := chartMeta.Name
+	if root == "" || strings.ContainsAny(root, `/\`) || root == "." || root == ".." {
+		return nil, fmt.Errorf("invalid chart name %q in Chart.yaml", root)
+	}
+
+	var files int
+	var size int64
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		entry := path.Join(root, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		if l.MaxFiles >= 0 && files > l.MaxFiles {
+			return &tgzfs.LimitError{Limit: "MaxFiles", Max: int64(l.MaxFiles)}
+		}
+		if l.MaxFileSize >= 0 && info.Size() > l.MaxFileSize {
+			return &tgzfs.LimitError{Limit: "MaxFileSize", Max: l.MaxFileSize, Name: entry}
+		}
+		size += info.Size()
+		if l.MaxSize >= 0 && size > l.MaxSize {
+			return &tgzfs.LimitError{Limit: "MaxSize", Max: l.MaxSize}
+		}
+		dat, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:     entry,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(dat)),
+			ModTime:  time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(dat)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
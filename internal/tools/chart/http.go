@@ -0,0 +1,299 @@
+package chart
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/registry"
+	"github.com/krateoplatformops/core-provider/internal/tools/resolvers"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const httpTimeout = 60 * time.Second
+
+// credentials are the options of a chart download that apply to the other requests made for the chart:
+// its authentication and the transport used to reach its source.
+type credentials struct {
+	username string
+	password string
+	// token is sent as a bearer token, refreshToken is exchanged for access tokens by OCI registries.
+	token                 string
+	refreshToken          string
+	insecureSkipVerifyTLS bool
+	// caBundle holds the PEM encoded certificate authorities trusted in addition to the system ones.
+	caBundle []byte
+	// clientCert is the client certificate, and clientCertPEM its PEM encoded certificate chain.
+	clientCert    *tls.Certificate
+	clientCertPEM []byte
+	proxyURL      *url.URL
+	timeout       time.Duration
+}
+
+// chartCredentials resolves the credentials of the chart described by nfo.
+func chartCredentials(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) (credentials, error) {
+	cred := credentials{insecureSkipVerifyTLS: nfo.InsecureSkipVerifyTLS, timeout: httpTimeout}
+	if nfo.Credentials != nil {
+		secret, err := resolvers.GetSecret(ctx, kube, nfo.Credentials.PasswordRef)
+		if err != nil {
+			return credentials{}, fmt.Errorf("failed to get secret: %w", err)
+		}
+		cred.username, cred.password = nfo.Credentials.Username, secret
+	}
+	if nfo.BearerTokenRef != nil {
+		token, err := resolvers.GetSecret(ctx, kube, *nfo.BearerTokenRef)
+		if err != nil {
+			return credentials{}, fmt.Errorf("failed to get bearer token secret: %w", err)
+		}
+		if token == "" {
+			return credentials{}, fmt.Errorf("key %s of bearer token secret %s/%s is empty", nfo.BearerTokenRef.Key, nfo.BearerTokenRef.Namespace, nfo.BearerTokenRef.Name)
+		}
+		cred.token = strings.TrimSpace(token)
+	}
+	if nfo.PullSecretRef != nil {
+		data, err := resolvers.GetSecretData(ctx, kube, *nfo.PullSecretRef)
+		if err != nil {
+			return credentials{}, fmt.Errorf("failed to get pull secret: %w", err)
+		}
+		auth, err := pullSecretAuth(data, nfo.Url)
+		if err != nil {
+			return credentials{}, fmt.Errorf("invalid pull secret %s/%s: %w", nfo.PullSecretRef.Namespace, nfo.PullSecretRef.Name, err)
+		}
+		cred.username, cred.password = auth.Username, auth.Password
+		cred.token, cred.refreshToken = auth.RegistryToken, auth.IdentityToken
+	}
+	if nfo.TLS != nil {
+		if err := cred.resolveTLS(ctx, kube, nfo.TLS); err != nil {
+			return credentials{}, err
+		}
+	}
+	if nfo.ProxyURL != "" {
+		u, err := url.Parse(nfo.ProxyURL)
+		if err != nil {
+			return credentials{}, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		cred.proxyURL = u
+	}
+	if nfo.Timeout != nil && nfo.Timeout.Duration > 0 {
+		cred.timeout = nfo.Timeout.Duration
+	}
+	return cred, nil
+}
+
+// resolveTLS reads the client certificate and the CA bundle of the chart source.
+func (c *credentials) resolveTLS(ctx context.Context, kube client.Client, nfo *v1alpha1.SourceTLS) error {
+	if ref := nfo.ClientCertificateRef; ref != nil {
+		data, err := resolvers.GetSecretData(ctx, kube, *ref)
+		if err != nil {
+			return fmt.Errorf("failed to get client certificate secret: %w", err)
+		}
+		cert, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return fmt.Errorf("invalid client certificate in secret %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+		c.clientCert, c.clientCertPEM = &cert, data[corev1.TLSCertKey]
+	}
+
+	ref := nfo.CABundleRef
+	if ref == nil {
+		return nil
+	}
+	var bundle, from string
+	var err error
+	switch {
+	case ref.SecretKeyRef != nil:
+		from = fmt.Sprintf("key %s of secret %s/%s", ref.SecretKeyRef.Key, ref.SecretKeyRef.Namespace, ref.SecretKeyRef.Name)
+		bundle, err = resolvers.GetSecret(ctx, kube, *ref.SecretKeyRef)
+	case ref.ConfigMapKeyRef != nil:
+		from = fmt.Sprintf("key %s of configmap %s/%s", ref.ConfigMapKeyRef.Key, ref.ConfigMapKeyRef.Namespace, ref.ConfigMapKeyRef.Name)
+		bundle, err = resolvers.GetConfigMapKey(ctx, kube, *ref.ConfigMapKeyRef)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CA bundle: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(bundle)) {
+		return fmt.Errorf("no PEM encoded certificate found in the %s", from)
+	}
+	c.caBundle = []byte(bundle)
+	return nil
+}
+
+// digest identifies the credentials in cache keys without holding them.
+func (c credentials) digest() string {
+	if c.username == "" && c.password == "" && c.token == "" && c.refreshToken == "" && c.clientCert == nil {
+		return ""
+	}
+	id := c.username + ":" + c.password
+	if c.token != "" || c.refreshToken != "" || c.clientCert != nil {
+		id = strings.Join([]string{id, c.token, c.refreshToken, string(c.clientCertPEM)}, "\n")
+	}
+	return chartcache.Digest([]byte(id))
+}
+
+// customTransport reports whether the chart source needs options the getter does not support,
+// so that the chart is downloaded with get instead.
+func (c credentials) customTransport() bool {
+	return c.token != "" || c.refreshToken != "" || c.caBundle != nil || c.clientCert != nil || c.proxyURL != nil
+}
+
+// authorize sets the bearer token or the basic auth credentials on req when it targets the host of chartURL.
+func (c credentials) authorize(req *http.Request, chartURL string) {
+	if !sameHost(req.URL.String(), chartURL) {
+		return
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "" && c.password != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// transport returns the transport used to reach the chart source.
+func (c credentials) transport() *http.Transport {
+	transport := &http.Transport{
+		DisableCompression: true,
+		Proxy:              http.ProxyFromEnvironment,
+	}
+	if c.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(c.proxyURL)
+	}
+	if c.insecureSkipVerifyTLS || c.caBundle != nil || c.clientCert != nil {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: c.insecureSkipVerifyTLS,
+		}
+	}
+	if c.caBundle != nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(c.caBundle)
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if c.clientCert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*c.clientCert}
+	}
+	return transport
+}
+
+// client returns an HTTP client configured like the one of the getter, which drops the credentials on cross-host redirects.
+func (c credentials) client() *http.Client {
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = httpTimeout
+	}
+	return &http.Client{
+		Transport: c.transport(),
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > 0 && req.URL.Host != via[0].URL.Host {
+				req.Header.Del("Authorization")
+			}
+			return nil
+		},
+	}
+}
+
+// registry returns the options used to connect to the OCI repository of the reference.
+func (c credentials) registry(ref string) registry.Options {
+	opts := registry.Options{
+		Reference:             ref,
+		Username:              c.username,
+		Password:              c.password,
+		Token:                 c.token,
+		RefreshToken:          c.refreshToken,
+		InsecureSkipVerifyTLS: c.insecureSkipVerifyTLS,
+		Timeout:               c.timeout,
+	}
+	if c.customTransport() {
+		opts.Transport = c.transport()
+	}
+	return opts
+}
+
+// isHTTPArchive reports whether uri is a chart archive served over HTTP, which can be revalidated conditionally.
+func isHTTPArchive(uri string) bool {
+	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+		return false
+	}
+	return strings.HasSuffix(uri, ".tgz") || strings.HasSuffix(uri, ".tar.gz")
+}
+
+// canRevalidate reports whether the archive downloaded from packageURL for nfo can be revalidated conditionally.
+// An archive resolved from a repository index without a version is the latest one, so the index is read again instead.
+func canRevalidate(nfo *v1alpha1.ChartInfo, packageURL string) bool {
+	if !isHTTPArchive(packageURL) {
+		return false
+	}
+	return isHTTPArchive(nfo.Url) || nfo.Version != ""
+}
+
+// revalidate asks the server of a cached archive whether it changed, with the ETag and Last-Modified
+// validators of the cache entry. When the entry has no validators yet, the archive is downloaded again
+// and its validators are recorded. Credentials are only sent when the archive is served by the host of
+// chartURL, as the getter does for the archives listed in a repository index.
+func revalidate(ctx context.Context, stale *chartcache.Entry, chartURL string, cred credentials) (*chartcache.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stale.PackageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request for uri %s: %w", stale.PackageURL, err)
+	}
+	if stale.Validators.ETag != "" {
+		req.Header.Set("If-None-Match", stale.Validators.ETag)
+	}
+	if stale.Validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", stale.Validators.LastModified)
+	}
+	cred.authorize(req, chartURL)
+
+	resp, err := cred.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revalidate %s: %w", stale.PackageURL, err)
+	}
+	defer resp.Body.Close()
+
+	res := &chartcache.Response{
+		PackageURL: stale.PackageURL,
+		Validators: chartcache.Validators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		res.NotModified = true
+		return res, nil
+	case http.StatusOK:
+		res.Data, err = io.ReadAll(io.LimitReader(resp.Body, getter.MaxResponseSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stale.PackageURL, err)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("failed to revalidate %s: %s", stale.PackageURL, resp.Status)
+	}
+}
+
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host == ub.Host
+}
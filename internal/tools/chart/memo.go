@@ -0,0 +1,53 @@
+package chart
+
+import (
+	"container/list"
+	"sync"
+)
+
+// memoLRU is an LRU of the values remembered by key: past its size, the least recently used value is evicted,
+// so the values in use are not computed again.
+type memoLRU[V any] struct {
+	mu     sync.Mutex
+	size   int
+	lru    *list.List
+	values map[string]*list.Element
+}
+
+type memoEntry[V any] struct {
+	key string
+	val V
+}
+
+func newMemoLRU[V any](size int) *memoLRU[V] {
+	return &memoLRU[V]{size: size, lru: list.New(), values: map[string]*list.Element{}}
+}
+
+// get returns the value remembered for key.
+func (m *memoLRU[V]) get(key string) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.values[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*memoEntry[V]).val, true
+}
+
+// put remembers the value of key and evicts the least recently used values over the size.
+func (m *memoLRU[V]) put(key string, val V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.values[key]; ok {
+		el.Value.(*memoEntry[V]).val = val
+		m.lru.MoveToFront(el)
+		return
+	}
+	m.values[key] = m.lru.PushFront(&memoEntry[V]{key: key, val: val})
+	for m.lru.Len() > m.size {
+		e := m.lru.Remove(m.lru.Back()).(*memoEntry[V])
+		delete(m.values, e.key)
+	}
+}
@@ -0,0 +1,180 @@
+// Package mirrors rewrites chart URLs to the mirrors that serve them, as configured for the whole provider.
+//
+// Rules are read from a ConfigMap key holding YAML such as:
+//
+//	rules:
+//	- registry: ghcr.io
+//	  mirrors: [registry.internal/ghcr, registry-dr.internal/ghcr]
+//	- prefix: https://charts.krateo.io
+//	  mirrors: [https://charts.internal/krateo]
+//	  fallbackToSource: true
+//
+// A registry rule matches the oci:// charts of a registry host, a prefix rule matches the chart URLs starting
+// with the prefix at a path boundary. The most specific matching rule applies: its mirrors replace the matched
+// part of the URL and are tried in order, followed by the source itself when fallbackToSource is set.
+package mirrors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultKey is the key of the ConfigMap holding the rules when no key is configured.
+const DefaultKey = "mirrors.yaml"
+
+// Rule maps chart sources to their mirrors. Exactly one of Prefix and Registry must be set.
+type Rule struct {
+	// Prefix matches the chart URLs starting with it, e.g. https://charts.krateo.io or oci://ghcr.io/krateoplatformops.
+	Prefix string `json:"prefix,omitempty"`
+	// Registry matches the oci:// charts of a registry host, e.g. ghcr.io.
+	Registry string `json:"registry,omitempty"`
+	// Mirrors replace the matched part of the URL, in order of preference. The mirrors of a registry rule are
+	// registry hosts with an optional path, with or without the oci:// scheme.
+	Mirrors []string `json:"mirrors"`
+	// FallbackToSource tries the source of the chart after the mirrors.
+	FallbackToSource bool `json:"fallbackToSource,omitempty"`
+}
+
+// Config holds the mirror rules.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Candidate is a URL a chart can be downloaded from.
+type Candidate struct {
+	URL string
+	// Mirror is the mirror serving URL, empty when URL is the source of the chart.
+	Mirror string
+}
+
+// Parse parses and validates the YAML rules.
+func Parse(dat []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(dat, cfg); err != nil {
+		return nil, fmt.Errorf("invalid mirror rules: %w", err)
+	}
+	for i, r := range cfg.Rules {
+		switch {
+		case (r.Prefix == "") == (r.Registry == ""):
+			return nil, fmt.Errorf("invalid mirror rule %d: exactly one of prefix and registry must be set", i)
+		case strings.Contains(r.Registry, "/"):
+			return nil, fmt.Errorf("invalid mirror rule %d: registry %q must be a host", i, r.Registry)
+		case r.Prefix != "" && !strings.Contains(r.Prefix, "://"):
+			return nil, fmt.Errorf("invalid mirror rule %d: prefix %q must be a URL", i, r.Prefix)
+		case len(r.Mirrors) == 0:
+			return nil, fmt.Errorf("invalid mirror rule %d: no mirrors", i)
+		}
+		for _, m := range r.Mirrors {
+			if m == "" || (r.Prefix != "" && !strings.Contains(m, "://")) {
+				return nil, fmt.Errorf("invalid mirror rule %d: mirror %q must be a URL", i, m)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Candidates returns the URLs the chart at url is downloaded from, in order. The chart is only downloaded
+// from its source when no rule matches it or when the matching rule falls back to it.
+func (c *Config) Candidates(url string) []Candidate {
+	source := []Candidate{{URL: url}}
+	if c == nil {
+		return source
+	}
+
+	var rule *Rule
+	var rest string
+	matched := -1
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		var prefix string
+		switch {
+		case r.Registry != "":
+			prefix = "oci://" + strings.ToLower(r.Registry)
+			if !strings.HasPrefix(strings.ToLower(url), prefix) {
+				continue
+			}
+		default:
+			prefix = strings.TrimSuffix(r.Prefix, "/")
+			if !strings.HasPrefix(url, prefix) {
+				continue
+			}
+		}
+		tail := url[len(prefix):]
+		if tail != "" && !strings.HasPrefix(tail, "/") {
+			continue
+		}
+		if len(prefix) > matched {
+			rule, rest, matched = r, tail, len(prefix)
+		}
+	}
+	if rule == nil {
+		return source
+	}
+
+	res := make([]Candidate, 0, len(rule.Mirrors)+1)
+	for _, m := range rule.Mirrors {
+		m = strings.TrimSuffix(m, "/")
+		if rule.Registry != "" && !strings.HasPrefix(m, "oci://") {
+			m = "oci://" + m
+		}
+		res = append(res, Candidate{URL: m + rest, Mirror: m})
+	}
+	if rule.FallbackToSource {
+		res = append(res, source...)
+	}
+	return res
+}
+
+// Source reads the rules from a ConfigMap key, parsing them again only when the ConfigMap changes.
+// A nil *Source has no rules.
+type Source struct {
+	ConfigMap types.NamespacedName
+	// Key is the key of the ConfigMap holding the rules, DefaultKey when empty.
+	Key string
+
+	mu              sync.Mutex
+	resourceVersion string
+	config          *Config
+}
+
+// Load returns the current rules. A missing ConfigMap or key has no rules.
+func (s *Source) Load(ctx context.Context, kube client.Client) (*Config, error) {
+	if s == nil {
+		return nil, nil
+	}
+	cm := &corev1.ConfigMap{}
+	if err := kube.Get(ctx, s.ConfigMap, cm); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get mirror rules configmap %s: %w", s.ConfigMap, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resourceVersion != "" && s.resourceVersion == cm.ResourceVersion {
+		return s.config, nil
+	}
+	key := s.Key
+	if key == "" {
+		key = DefaultKey
+	}
+	dat, ok := cm.Data[key]
+	if !ok {
+		s.resourceVersion, s.config = cm.ResourceVersion, nil
+		return nil, nil
+	}
+	cfg, err := Parse([]byte(dat))
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s: %w", s.ConfigMap, err)
+	}
+	s.resourceVersion, s.config = cm.ResourceVersion, cfg
+	return cfg, nil
+}
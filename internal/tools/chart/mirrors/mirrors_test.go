@@ -0,0 +1,132 @@
+package mirrors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const rules = `
+rules:
+- registry: ghcr.io
+  mirrors: [registry.internal/ghcr, oci://registry-dr.internal/ghcr/]
+- prefix: oci://ghcr.io/krateoplatformops
+  mirrors: [oci://registry.internal/krateo]
+- prefix: https://charts.krateo.io/
+  mirrors: [https://charts.internal/krateo]
+  fallbackToSource: true
+`
+
+func TestCandidates(t *testing.T) {
+	cfg, err := Parse([]byte(rules))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		url  string
+		want []Candidate
+	}{
+		{
+			name: "registry rule",
+			url:  "oci://ghcr.io/acme/charts/demo",
+			want: []Candidate{
+				{URL: "oci://registry.internal/ghcr/acme/charts/demo", Mirror: "oci://registry.internal/ghcr"},
+				{URL: "oci://registry-dr.internal/ghcr/acme/charts/demo", Mirror: "oci://registry-dr.internal/ghcr"},
+			},
+		},
+		{
+			name: "the most specific rule applies",
+			url:  "oci://ghcr.io/krateoplatformops/fireworks-app",
+			want: []Candidate{{URL: "oci://registry.internal/krateo/fireworks-app", Mirror: "oci://registry.internal/krateo"}},
+		},
+		{
+			name: "prefix rule with fallback to the source",
+			url:  "https://charts.krateo.io/fireworks-app-1.0.0.tgz",
+			want: []Candidate{
+				{URL: "https://charts.internal/krateo/fireworks-app-1.0.0.tgz", Mirror: "https://charts.internal/krateo"},
+				{URL: "https://charts.krateo.io/fireworks-app-1.0.0.tgz"},
+			},
+		},
+		{
+			name: "prefixes match at path boundaries",
+			url:  "https://charts.krateo.io.evil.com/demo.tgz",
+			want: []Candidate{{URL: "https://charts.krateo.io.evil.com/demo.tgz"}},
+		},
+		{
+			name: "registry hosts match exactly",
+			url:  "oci://ghcr.io.example.com/charts/demo",
+			want: []Candidate{{URL: "oci://ghcr.io.example.com/charts/demo"}},
+		},
+		{
+			name: "no matching rule",
+			url:  "oci://quay.io/charts/demo",
+			want: []Candidate{{URL: "oci://quay.io/charts/demo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cfg.Candidates(tt.url))
+		})
+	}
+
+	var none *Config
+	assert.Equal(t, []Candidate{{URL: "oci://ghcr.io/charts/demo"}}, none.Candidates("oci://ghcr.io/charts/demo"))
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"prefix and registry":     "rules:\n- prefix: https://a.example.com\n  registry: a.example.com\n  mirrors: [https://b.example.com]\n",
+		"registry with a path":    "rules:\n- registry: a.example.com/charts\n  mirrors: [b.example.com]\n",
+		"prefix without a scheme": "rules:\n- prefix: a.example.com\n  mirrors: [https://b.example.com]\n",
+		"no mirrors":              "rules:\n- registry: a.example.com\n",
+		"mirror without a scheme": "rules:\n- prefix: https://a.example.com\n  mirrors: [b.example.com]\n",
+		"unknown field":           "rules:\n- registry: a.example.com\n  mirrors: [b.example.com]\n  fallback: true\n",
+	}
+	for name, dat := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(dat))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSourceLoad(t *testing.T) {
+	ctx := context.Background()
+	nn := types.NamespacedName{Namespace: "krateo-system", Name: "chart-mirrors"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+		Data:       map[string]string{DefaultKey: rules},
+	}
+	kube := fake.NewClientBuilder().WithObjects(cm).Build()
+
+	var none *Source
+	cfg, err := none.Load(ctx, kube)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	src := &Source{ConfigMap: nn}
+	cfg, err = src.Load(ctx, kube)
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 3)
+
+	cached, err := src.Load(ctx, kube)
+	require.NoError(t, err)
+	assert.Same(t, cfg, cached)
+
+	require.NoError(t, kube.Get(ctx, nn, cm))
+	cm.Data[DefaultKey] = "rules: [{registry: ghcr.io, mirrors: [registry.internal/ghcr]}]"
+	require.NoError(t, kube.Update(ctx, cm))
+	cfg, err = src.Load(ctx, kube)
+	require.NoError(t, err)
+	assert.Len(t, cfg.Rules, 1)
+
+	cfg, err = (&Source{ConfigMap: types.NamespacedName{Namespace: "krateo-system", Name: "missing"}}).Load(ctx, kube)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+}
@@ -0,0 +1,71 @@
+package chart
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// dockerConfig is the content of a kubernetes.io/dockerconfigjson secret.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+// dockerAuth holds the credentials of a registry in a docker config.
+type dockerAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Auth is the base64 encoding of username:password.
+	Auth string `json:"auth,omitempty"`
+	// IdentityToken is a refresh token, RegistryToken a bearer token sent to the registry.
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// pullSecretAuth returns the credentials of the dockerconfigjson secret data for the host of chartURL.
+func pullSecretAuth(data map[string][]byte, chartURL string) (dockerAuth, error) {
+	dat, ok := data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return dockerAuth{}, fmt.Errorf("key %s not found", corev1.DockerConfigJsonKey)
+	}
+	cfg := dockerConfig{}
+	if err := json.Unmarshal(dat, &cfg); err != nil {
+		return dockerAuth{}, fmt.Errorf("failed to parse %s: %w", corev1.DockerConfigJsonKey, err)
+	}
+
+	host := registryHost(chartURL)
+	for k, auth := range cfg.Auths {
+		if registryHost(k) != host {
+			continue
+		}
+		if auth.Auth != "" && auth.Username == "" && auth.Password == "" {
+			dec, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return dockerAuth{}, fmt.Errorf("invalid auth of %s: %w", k, err)
+			}
+			auth.Username, auth.Password, ok = strings.Cut(string(dec), ":")
+			if !ok {
+				return dockerAuth{}, fmt.Errorf("invalid auth of %s: expected username:password", k)
+			}
+		}
+		return auth, nil
+	}
+	return dockerAuth{}, fmt.Errorf("no credentials found for %s", host)
+}
+
+// registryHost returns the host of a chart URL or of a docker config entry, which can be a bare host,
+// a host with a path or a URL.
+func registryHost(s string) string {
+	s = strings.TrimPrefix(s, "oci://")
+	if strings.Contains(s, "://") {
+		if u, err := url.Parse(s); err == nil {
+			return strings.ToLower(u.Host)
+		}
+	}
+	host, _, _ := strings.Cut(s, "/")
+	return strings.ToLower(host)
+}
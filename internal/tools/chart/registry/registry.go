@@ -0,0 +1,86 @@
+// Package registry connects to the OCI registries serving charts.
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const timeout = 60 * time.Second
+
+// Options locates an OCI repository and holds the options used to connect to it.
+type Options struct {
+	// Reference is the reference of the repository, as registry/repository with an optional tag.
+	Reference string
+	Username  string
+	Password  string
+	// Token is a bearer token sent to the registry as is, RefreshToken is exchanged for
+	// access tokens with the authorization service of the registry.
+	Token                 string
+	RefreshToken          string
+	InsecureSkipVerifyTLS bool
+	// Transport replaces the default transport, along with its InsecureSkipVerifyTLS option, when it is set.
+	Transport http.RoundTripper
+	// Timeout of each request, defaults to 60s.
+	Timeout time.Duration
+}
+
+// Repository returns a client of the repository of the reference.
+// Registries on the loopback interface are reached over plain HTTP, as the chart getter does.
+func Repository(opts Options) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(opts.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %s: %w", opts.Reference, err)
+	}
+	host := strings.ToLower(repo.Reference.Registry)
+	repo.PlainHTTP = strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") || strings.HasPrefix(host, "[::1]")
+
+	transport := opts.Transport
+	if transport == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if opts.InsecureSkipVerifyTLS {
+			t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		transport = t
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = timeout
+	}
+	cli := &auth.Client{
+		Client: &http.Client{Transport: transport, Timeout: opts.Timeout},
+		Cache:  auth.NewCache(),
+	}
+	cred := auth.Credential{AccessToken: opts.Token, RefreshToken: opts.RefreshToken}
+	if opts.Username != "" && opts.Password != "" {
+		cred.Username, cred.Password = opts.Username, opts.Password
+	}
+	if cred != auth.EmptyCredential {
+		cli.Credential = auth.StaticCredential(repo.Reference.Registry, cred)
+	}
+	repo.Client = cli
+	return repo, nil
+}
+
+// Tags lists the tags of the repository of the reference.
+func Tags(ctx context.Context, opts Options) ([]string, error) {
+	repo, err := Repository(opts)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	err = repo.Tags(ctx, "", func(page []string) error {
+		tags = append(tags, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", repo.Reference.Registry+"/"+repo.Reference.Repository, err)
+	}
+	return tags, nil
+}
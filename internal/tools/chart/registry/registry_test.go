@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+		case "/v2/charts/demo/tags/list":
+			json.NewEncoder(w).Encode(map[string]any{"name": "charts/demo", "tags": []string{"0.1.0", "0.2.0", "latest"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tags, err := Tags(context.Background(), Options{Reference: host + "/charts/demo"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.1.0", "0.2.0", "latest"}, tags)
+
+	_, err = Tags(context.Background(), Options{Reference: host + "/charts/missing"})
+	assert.Error(t, err)
+
+	_, err = Tags(context.Background(), Options{Reference: "not a reference"})
+	assert.Error(t, err)
+}
+
+func TestRepositorySendsBearerToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.example.com/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "charts/demo", "tags": []string{"0.1.0"}})
+	}))
+	t.Cleanup(srv.Close)
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/charts/demo"
+
+	tags, err := Tags(context.Background(), Options{Reference: ref, Token: "s3cr3t"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.1.0"}, tags)
+
+	_, err = Tags(context.Background(), Options{Reference: ref, Token: "wrong"})
+	assert.Error(t, err)
+}
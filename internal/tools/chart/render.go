@@ -0,0 +1,84 @@
+package chart
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// RenderOptions describes the release a chart is rendered for.
+type RenderOptions struct {
+	Name      string
+	Namespace string
+	IsUpgrade bool
+}
+
+// RenderError is returned when the templates of a chart fail to render with the given values, as opposed to
+// failing to load the chart.
+type RenderError struct {
+	Err error
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// Render renders the templates of the chart archive dat with values, as helm install or helm upgrade does without
+// a cluster: dependencies are enabled and their values imported, lookup returns nothing and the values schema is not
+// validated. Rendering cannot be interrupted, so it is abandoned when ctx is done and ctx.Err() is returned.
+func Render(ctx context.Context, dat []byte, opts RenderOptions, values map[string]any) error {
+	chrt, err := loader.LoadArchive(bytes.NewReader(dat))
+	if err != nil {
+		return fmt.Errorf("error loading chart: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- render(chrt, opts, values)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func render(chrt *chart.Chart, opts RenderOptions, values map[string]any) (err error) {
+	// Templates run arbitrary chart code: a panic is reported as a failed render.
+	defer func() {
+		if r := recover(); r != nil {
+			err = &RenderError{Err: fmt.Errorf("panic rendering chart: %v", r)}
+		}
+	}()
+
+	if values == nil {
+		values = map[string]any{}
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, values); err != nil {
+		return &RenderError{Err: err}
+	}
+	vals, err := chartutil.ToRenderValuesWithSchemaValidation(chrt, values, chartutil.ReleaseOptions{
+		Name:      opts.Name,
+		Namespace: opts.Namespace,
+		Revision:  1,
+		IsInstall: !opts.IsUpgrade,
+		IsUpgrade: opts.IsUpgrade,
+	}, chartutil.DefaultCapabilities, true)
+	if err != nil {
+		return &RenderError{Err: err}
+	}
+	if _, err := engine.Render(chrt, vals); err != nil {
+		return &RenderError{Err: err}
+	}
+	return nil
+}
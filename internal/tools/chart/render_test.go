@@ -0,0 +1,95 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mustTemplatedChart returns a chart archive holding the templates, named after their file.
+func mustTemplatedChart(t *testing.T, templates map[string]string) []byte {
+	t.Helper()
+
+	files := map[string]string{
+		"demo/Chart.yaml":  "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"demo/values.yaml": "replicas: 1\n",
+	}
+	for name, content := range templates {
+		files["demo/templates/"+name] = content
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRender(t *testing.T) {
+	dat := mustTemplatedChart(t, map[string]string{
+		"cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+  namespace: {{ .Release.Namespace }}
+data:
+  host: {{ required "host is required" .Values.host }}
+  replicas: {{ .Values.replicas | quote }}
+{{- if gt (int .Values.replicas) 5 }}
+{{ fail "at most 5 replicas are supported" }}
+{{- end }}
+`,
+	})
+	opts := RenderOptions{Name: "demo", Namespace: "demo-system"}
+
+	if err := Render(context.Background(), dat, opts, map[string]any{"host": "example.com"}); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	tests := map[string]struct {
+		values map[string]any
+		want   string
+	}{
+		"required value": {values: map[string]any{}, want: "host is required"},
+		"fail call":      {values: map[string]any{"host": "example.com", "replicas": float64(6)}, want: "at most 5 replicas are supported"},
+	}
+	for name, tt := range tests {
+		err := Render(context.Background(), dat, opts, tt.values)
+		var rerr *RenderError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("%s: expected a render error, got: %v", name, err)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%s: expected %q in the error, got: %v", name, tt.want, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Render(ctx, dat, opts, map[string]any{"host": "example.com"}); err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected success or a canceled context, got: %v", err)
+	}
+
+	err := Render(context.Background(), []byte("not an archive"), opts, nil)
+	var rerr *RenderError
+	if err == nil || errors.As(err, &rerr) {
+		t.Fatalf("expected a load error, got: %v", err)
+	}
+}
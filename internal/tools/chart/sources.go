@@ -0,0 +1,82 @@
+package chart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// configMapScheme and secretScheme prefix the URLs of the chart archives stored in a key of a ConfigMap
+	// (in its binaryData) or of a Secret, as configmap://<namespace>/<name>/<key>.
+	configMapScheme = "configmap://"
+	secretScheme    = "secret://"
+)
+
+// errNoChart is returned when the source of a chart exists but does not hold it, which retrying does not fix.
+var errNoChart = errors.New("chart not found")
+
+// isObjectSource reports whether uri is a chart archive stored in a ConfigMap or a Secret.
+func isObjectSource(uri string) bool {
+	return strings.HasPrefix(uri, configMapScheme) || strings.HasPrefix(uri, secretScheme)
+}
+
+// objectRef is the key of a ConfigMap or of a Secret holding a chart archive.
+type objectRef struct {
+	secret bool
+	types.NamespacedName
+	key string
+}
+
+// parseObjectSource parses a configmap://<namespace>/<name>/<key> or secret://<namespace>/<name>/<key> URL.
+func parseObjectSource(uri string) (objectRef, error) {
+	ref := objectRef{}
+	rest, ok := strings.CutPrefix(uri, configMapScheme)
+	if !ok {
+		rest, ok = strings.CutPrefix(uri, secretScheme)
+		ref.secret = true
+	}
+	parts := strings.Split(rest, "/")
+	if !ok || len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return objectRef{}, fmt.Errorf("invalid chart url %s, expected configmap://<namespace>/<name>/<key> or secret://<namespace>/<name>/<key>", uri)
+	}
+	ref.Namespace, ref.Name, ref.key = parts[0], parts[1], parts[2]
+	return ref, nil
+}
+
+// objectGetter returns a getter reading the chart archives stored in ConfigMaps and Secrets.
+func objectGetter(kube client.Client) getterFunc {
+	return func(ctx context.Context, uri string, _ ...getter.Option) (io.Reader, string, error) {
+		ref, err := parseObjectSource(uri)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %w", errNoChart, err)
+		}
+
+		var dat []byte
+		if ref.secret {
+			secret := &corev1.Secret{}
+			if err := kube.Get(ctx, ref.NamespacedName, secret); err != nil {
+				return nil, "", fmt.Errorf("failed to get secret %s: %w", ref.NamespacedName, err)
+			}
+			dat = secret.Data[ref.key]
+		} else {
+			cm := &corev1.ConfigMap{}
+			if err := kube.Get(ctx, ref.NamespacedName, cm); err != nil {
+				return nil, "", fmt.Errorf("failed to get configmap %s: %w", ref.NamespacedName, err)
+			}
+			dat = cm.BinaryData[ref.key]
+		}
+		if len(dat) == 0 {
+			return nil, "", fmt.Errorf("%w: no chart archive in key %s of %s", errNoChart, ref.key, uri)
+		}
+		return bytes.NewReader(dat), uri, nil
+	}
+}
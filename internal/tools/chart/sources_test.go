@@ -0,0 +1,243 @@
+package chart
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// assertDemoChart checks that the chart of nfo is read as the demo-chart archive is.
+func assertDemoChart(t *testing.T, pkg fs.FS, rootDir string, files ...string) {
+	t.Helper()
+
+	if rootDir != "demo-chart" {
+		t.Fatalf("expected root dir demo-chart, got %s", rootDir)
+	}
+	for _, el := range append([]string{"Chart.yaml"}, files...) {
+		if _, err := fs.ReadFile(pkg, rootDir+"/"+el); err != nil {
+			t.Fatalf("expected %s in the chart: %v", el, err)
+		}
+	}
+}
+
+func TestFetchFromConfigMapsAndSecrets(t *testing.T) {
+	archive := mustChartArchive(t, "demo-chart")
+	kube := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo-chart", Namespace: "charts"},
+			BinaryData: map[string][]byte{"demo-chart-1.2.3.tgz": archive},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo-chart", Namespace: "charts"},
+			Data:       map[string][]byte{"chart.tgz": archive},
+		},
+	).Build()
+
+	for _, uri := range []string{"configmap://charts/demo-chart/demo-chart-1.2.3.tgz", "secret://charts/demo-chart/chart.tgz"} {
+		pkg, rootDir, err := ChartInfoFromSpec(context.Background(), kube, &v1alpha1.ChartInfo{Url: uri})
+		if err != nil {
+			t.Fatalf("expected success for %s, got error: %v", uri, err)
+		}
+		assertDemoChart(t, pkg, rootDir)
+	}
+
+	for _, uri := range []string{"configmap://charts/demo-chart/missing.tgz", "configmap://charts/demo-chart", "secret://charts/missing/chart.tgz"} {
+		_, err := Fetch(context.Background(), kube, &v1alpha1.ChartInfo{Url: uri})
+		if err == nil || isRetryableChartError(err) {
+			t.Fatalf("expected a non retryable error for %s, got: %v", uri, err)
+		}
+	}
+}
+
+// mustGitRepo creates a bare repository holding the demo chart under charts/demo, tagged v1.2.3.
+func mustGitRepo(t *testing.T, root string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	run := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	work := t.TempDir()
+	files := map[string]string{
+		"charts/demo/Chart.yaml":         "apiVersion: v2\nname: demo-chart\nversion: 1.2.3\n",
+		"charts/demo/values.yaml":        "replicas: 1\n",
+		"charts/demo/templates/cm.yaml":  "apiVersion: v1\nkind: ConfigMap\n",
+		"charts/demo/values.schema.json": "{}\n",
+		"charts/other/Chart.yaml":        "apiVersion: v2\nname: other\nversion: 0.1.0\n",
+		"README.md":                      "charts\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(work, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	run(work, "init", "-q", "-b", "main")
+	run(work, "add", ".")
+	run(work, "commit", "-q", "-m", "demo chart")
+	run(work, "tag", "v1.2.3")
+
+	bare := filepath.Join(root, "charts.git")
+	run(root, "clone", "-q", "--bare", work, bare)
+	return bare
+}
+
+func TestFetchFromGit(t *testing.T) {
+	origWait := chartRetryWait
+	t.Cleanup(func() { chartRetryWait = origWait })
+	chartRetryWait = func(context.Context, time.Duration) error { return nil }
+
+	root := t.TempDir()
+	bare := mustGitRepo(t, root)
+
+	t.Run("local bare repository", func(t *testing.T) {
+		nfo := &v1alpha1.ChartInfo{Url: "git+file://" + filepath.ToSlash(bare) + "//charts/demo?ref=v1.2.3"}
+		pkg, err := Fetch(context.Background(), nil, nfo)
+		if err != nil {
+			t.Fatalf("expected success, got error: %v", err)
+		}
+		fsys, rootDir, err := chartFromBytes(pkg.Data, tgzfs.DefaultLimits)
+		if err != nil {
+			t.Fatalf("expected a valid archive, got error: %v", err)
+		}
+		assertDemoChart(t, fsys, rootDir, "values.yaml", "values.schema.json", "templates/cm.yaml")
+		if !strings.HasPrefix(pkg.PackageURL, "git+file://"+filepath.ToSlash(bare)+"//charts/demo?ref=") || strings.HasSuffix(pkg.PackageURL, "v1.2.3") {
+			t.Fatalf("expected the package URL to pin the commit, got %s", pkg.PackageURL)
+		}
+
+		// The same commit is packaged in the same archive.
+		again, err := Fetch(context.Background(), nil, &v1alpha1.ChartInfo{Url: pkg.PackageURL})
+		if err != nil {
+			t.Fatalf("expected success, got error: %v", err)
+		}
+		if again.Digest != pkg.Digest {
+			t.Fatalf("expected digest %s, got %s", pkg.Digest, again.Digest)
+		}
+	})
+
+	t.Run("HTTP git server with basic auth", func(t *testing.T) {
+		gitPath, _ := exec.LookPath("git")
+		backend := &cgi.Handler{
+			Path: gitPath,
+			Args: []string{"http-backend"},
+			Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "reader" || pass != "s3cr3t" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			backend.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+
+		kube := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "charts"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		}).Build()
+		nfo := &v1alpha1.ChartInfo{
+			Url: "git+" + srv.URL + "/charts.git//charts/demo",
+			Credentials: &v1alpha1.Credentials{
+				Username:    "reader",
+				PasswordRef: rtv1.SecretKeySelector{Reference: rtv1.Reference{Name: "git", Namespace: "charts"}, Key: "password"},
+			},
+		}
+		pkg, rootDir, err := ChartInfoFromSpec(context.Background(), kube, nfo)
+		if err != nil {
+			t.Fatalf("expected success, got error: %v", err)
+		}
+		assertDemoChart(t, pkg, rootDir, "values.yaml")
+	})
+
+	t.Run("checkouts exceeding the archive limits are rejected", func(t *testing.T) {
+		nfo := &v1alpha1.ChartInfo{Url: "git+file://" + filepath.ToSlash(bare) + "//charts/demo?ref=v1.2.3"}
+		for _, tc := range []struct {
+			limits tgzfs.Limits
+			limit  string
+		}{
+			{limits: tgzfs.Limits{MaxFiles: 1}, limit: "MaxFiles"},
+			{limits: tgzfs.Limits{MaxFileSize: 8}, limit: "MaxFileSize"},
+			{limits: tgzfs.Limits{MaxSize: 16}, limit: "MaxSize"},
+		} {
+			_, err := Fetch(context.Background(), nil, nfo, WithLimits(tc.limits))
+			var lerr *tgzfs.LimitError
+			if !errors.As(err, &lerr) || lerr.Limit != tc.limit {
+				t.Fatalf("expected a %s limit error, got: %v", tc.limit, err)
+			}
+			_, _, err = ChartInfoFromSpec(context.Background(), nil, nfo, WithLimits(tc.limits))
+			if !errors.As(err, &lerr) || lerr.Limit != tc.limit {
+				t.Fatalf("expected a %s limit error reading the chart, got: %v", tc.limit, err)
+			}
+		}
+	})
+
+	t.Run("missing refs and paths are not retried", func(t *testing.T) {
+		for _, uri := range []string{
+			"git+file://" + filepath.ToSlash(bare) + "//charts/demo?ref=v9.9.9",
+			"git+file://" + filepath.ToSlash(bare) + "//charts/missing",
+			"git+file://" + filepath.ToSlash(root) + "/missing.git",
+			"git+ssh://example.com/charts.git",
+		} {
+			_, err := Fetch(context.Background(), nil, &v1alpha1.ChartInfo{Url: uri})
+			if !errors.Is(err, errNoChart) {
+				t.Fatalf("expected a missing chart for %s, got: %v", uri, err)
+			}
+		}
+	})
+}
+
+func TestParseGitSource(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want gitSource
+	}{
+		{uri: "git+https://example.com/org/charts.git//charts/demo?ref=v1.2.3", want: gitSource{repo: "https://example.com/org/charts.git", path: "charts/demo", ref: "v1.2.3"}},
+		{uri: "git+https://example.com/org/charts.git", want: gitSource{repo: "https://example.com/org/charts.git", path: "."}},
+		{uri: "git+file:///srv/git/charts.git//demo/", want: gitSource{repo: "file:///srv/git/charts.git", path: "demo"}},
+		{uri: "git+file:///srv/git/charts.git//../../etc", want: gitSource{repo: "file:///srv/git/charts.git", path: "etc"}},
+	}
+	for _, tt := range tests {
+		got, err := parseGitSource(tt.uri)
+		if err != nil {
+			t.Fatalf("expected %s to parse, got error: %v", tt.uri, err)
+		}
+		if got != tt.want {
+			t.Fatalf("expected %+v for %s, got %+v", tt.want, tt.uri, got)
+		}
+	}
+
+	for _, uri := range []string{"git+ssh://example.com/charts.git", "git+https://", "git+https://example.com/charts.git?ref=--upload-pack=sh"} {
+		if _, err := parseGitSource(uri); err == nil {
+			t.Fatalf("expected %s to be rejected", uri)
+		}
+	}
+}
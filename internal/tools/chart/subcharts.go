@@ -0,0 +1,278 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
+)
+
+// maxSubchartDepth bounds the nesting of the subcharts whose schemas are merged.
+const maxSubchartDepth = 8
+
+// dependency is an entry of the dependencies of the Chart.yaml.
+type dependency struct {
+	Name      string `json:"name"`
+	Alias     string `json:"alias,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	// ImportValues holds strings, imported from the exports of the subchart, and child/parent maps.
+	ImportValues []any `json:"import-values,omitempty"`
+}
+
+// key is the values key of the subchart in the values of its parent.
+func (d dependency) key() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Name
+}
+
+// subchart is the root dir of a chart found in the charts/ dir of its parent, as a dir or as an archive.
+type subchart struct {
+	fsys    fs.FS
+	rootDir string
+}
+
+// chartJsonSchema returns the values schema of the chart with the schemas of its subcharts nested under their
+// values keys. The schema is returned as it is when there are no subchart schemas to merge.
+func chartJsonSchema(tgzFS fs.FS, rootDir string, depth int) ([]byte, error) {
+	own, err := valuesSchema(tgzFS, rootDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	deps, subs, serr := subchartSchemas(tgzFS, rootDir, depth)
+	if serr != nil {
+		return nil, serr
+	}
+	if len(subs) == 0 {
+		return own, err
+	}
+
+	schema := map[string]any{"type": "object"}
+	if err == nil {
+		m, ok := decodeSchema(own).(map[string]any)
+		if !ok {
+			return own, nil
+		}
+		schema = m
+	}
+	for i, dep := range deps {
+		if subs[i] == nil {
+			continue
+		}
+		nestSubchartSchema(schema, dep, subs[i])
+	}
+	return json.Marshal(schema)
+}
+
+// subchartSchemas returns the dependencies of the chart and the values schemas of the ones found in charts/,
+// nil for the dependencies without a schema or not vendored in the chart.
+func subchartSchemas(tgzFS fs.FS, rootDir string, depth int) ([]dependency, [][]byte, error) {
+	meta, err := readChartMetadata(tgzFS, rootDir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(meta.Dependencies) == 0) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if depth >= maxSubchartDepth {
+		return nil, nil, fmt.Errorf("subcharts of %s are nested deeper than %d levels", rootDir, maxSubchartDepth)
+	}
+	charts, err := subcharts(tgzFS, rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found bool
+	schemas := make([][]byte, len(meta.Dependencies))
+	for i, dep := range meta.Dependencies {
+		sub, ok := charts[dep.Name]
+		if !ok {
+			continue
+		}
+		dat, err := chartJsonSchema(sub.fsys, sub.rootDir, depth+1)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting values schema of dependency %s: %w", dep.Name, err)
+		}
+		schemas[i], found = dat, true
+	}
+	if !found {
+		return nil, nil, nil
+	}
+	return meta.Dependencies, schemas, nil
+}
+
+// subcharts returns the charts found in the charts/ dir of the chart, by name. Archives are read within the limits
+// the chart was read with.
+func subcharts(tgzFS fs.FS, rootDir string) (map[string]subchart, error) {
+	dir := rootDir + "/charts"
+	all, err := fs.ReadDir(tgzFS, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]subchart{}
+	for _, el := range all {
+		sub := subchart{fsys: tgzFS, rootDir: dir + "/" + el.Name()}
+		switch {
+		case el.IsDir():
+		case strings.HasSuffix(el.Name(), ".tgz"):
+			dat, err := fs.ReadFile(tgzFS, sub.rootDir)
+			if err != nil {
+				return nil, err
+			}
+			sub.fsys, sub.rootDir, err = chartFromBytes(dat, tgzfs.LimitsOf(tgzFS))
+			if err != nil {
+				return nil, fmt.Errorf("error reading subchart %s: %w", el.Name(), err)
+			}
+		default:
+			continue
+		}
+		meta, err := readChartMetadata(sub.fsys, sub.rootDir)
+		if err != nil {
+			continue
+		}
+		if _, ok := res[meta.Name]; !ok {
+			res[meta.Name] = sub
+		}
+	}
+	return res, nil
+}
+
+// nestSubchartSchema nests the schema of the subchart of dep under its values key, along with the boolean fields of
+// its condition and the values it imports. The keywords already declared by the parent schema take precedence.
+func nestSubchartSchema(schema map[string]any, dep dependency, sub []byte) {
+	if m, ok := decodeSchema(sub).(map[string]any); ok {
+		mergeSchema(schemaAt(schema, dep.key()), m)
+	}
+
+	for _, el := range strings.Split(dep.Condition, ",") {
+		if el = strings.TrimSpace(el); el != "" {
+			mergeSchema(schemaAt(schema, el), map[string]any{"type": "boolean"})
+		}
+	}
+
+	for _, el := range dep.ImportValues {
+		var child, parent string
+		switch v := el.(type) {
+		case string:
+			child = "exports." + v
+		case map[string]any:
+			child, _ = v["child"].(string)
+			parent, _ = v["parent"].(string)
+		}
+		m, ok := decodeSchema(sub).(map[string]any)
+		if !ok || child == "" {
+			continue
+		}
+		if imported := lookupSchema(m, child); imported != nil {
+			mergeSchema(schemaAt(schema, parent), imported)
+		}
+	}
+}
+
+// schemaAt returns the schema of the field at the dot separated path, adding the missing properties as objects.
+// The empty path is the schema itself.
+func schemaAt(schema map[string]any, fieldPath string) map[string]any {
+	node := schema
+	for _, el := range strings.Split(fieldPath, ".") {
+		if el == "" {
+			continue
+		}
+		props, ok := node["properties"].(map[string]any)
+		if !ok {
+			props = map[string]any{}
+			node["properties"] = props
+			if _, ok := node["type"]; !ok {
+				node["type"] = "object"
+			}
+		}
+		next, ok := props[el].(map[string]any)
+		if !ok {
+			next = map[string]any{"type": "object"}
+			props[el] = next
+		}
+		node = next
+	}
+	return node
+}
+
+// lookupSchema returns the schema of the field at the dot separated path, nil when it is not declared.
+func lookupSchema(schema map[string]any, fieldPath string) map[string]any {
+	node := schema
+	for _, el := range strings.Split(fieldPath, ".") {
+		props, ok := node["properties"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		if node, ok = props[el].(map[string]any); !ok {
+			return nil
+		}
+	}
+	return node
+}
+
+// mergeSchema adds to dst the keywords of src it does not declare, merging their properties field by field.
+// A type added by schemaAt is replaced by the one of src.
+func mergeSchema(dst, src map[string]any) {
+	for k, v := range src {
+		if k == "properties" {
+			props, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+			into, ok := dst[k].(map[string]any)
+			if !ok {
+				into = map[string]any{}
+				dst[k] = into
+			}
+			for prop, el := range props {
+				s, ok := el.(map[string]any)
+				existing, found := into[prop].(map[string]any)
+				switch {
+				case !found || !ok:
+					if _, declared := into[prop]; !declared {
+						into[prop] = el
+					}
+				default:
+					mergeSchema(existing, s)
+				}
+			}
+			continue
+		}
+		if _, ok := dst[k]; !ok || (k == "type" && isPlaceholder(dst)) {
+			dst[k] = v
+		}
+	}
+}
+
+// isPlaceholder reports whether schema only holds what schemaAt adds to reach a field.
+func isPlaceholder(schema map[string]any) bool {
+	for k, v := range schema {
+		if k != "type" && k != "properties" || (k == "type" && v != "object") {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeSchema decodes a schema produced by valuesschema, keeping its numbers as they are.
+func decodeSchema(dat []byte) any {
+	var res any
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil
+	}
+	return res
+}
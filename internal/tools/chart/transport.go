@@ -0,0 +1,196 @@
+package chart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/registry"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	"github.com/krateoplatformops/plumbing/helm/getter/repo"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+// get downloads a chart like the getter does, through the transport of the credentials. It is used for the chart
+// sources that need bearer tokens, client certificates, CA bundles or proxies, which the getter does not support.
+// The options are applied as the getter applies them, and override the credentials they set.
+func (c credentials) get(ctx context.Context, uri string, opts ...getter.Option) (io.Reader, string, error) {
+	o := getter.GetOptions{URI: uri, Timeout: c.timeout}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, "", err
+		}
+	}
+	if o.Username != "" && o.Password != "" {
+		c.username, c.password = o.Username, o.Password
+	}
+	c.insecureSkipVerifyTLS = c.insecureSkipVerifyTLS || o.InsecureSkipVerifyTLS
+	c.timeout = o.Timeout
+
+	var dat []byte
+	var packageURL string
+	var err error
+	switch {
+	case strings.HasPrefix(o.URI, "oci://"):
+		dat, packageURL, err = c.getOCI(ctx, o)
+	case isHTTPArchive(o.URI):
+		dat, err = c.fetch(ctx, o.URI, o.URI)
+		packageURL = o.URI
+	case strings.HasPrefix(o.URI, "http://") || strings.HasPrefix(o.URI, "https://"):
+		dat, packageURL, err = c.getFromRepo(ctx, o)
+	default:
+		return nil, "", fmt.Errorf("%w: uri '%s'", getter.ErrNoHandler, o.URI)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get %s: %w", o.URI, err)
+	}
+	return bytes.NewReader(dat), packageURL, nil
+}
+
+// fetch downloads uri, sending the credentials when it is served by the host of chartURL.
+func (c credentials) fetch(ctx context.Context, uri, chartURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request for uri %s: %w", uri, err)
+	}
+	c.authorize(req, chartURL)
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s : %s", uri, resp.Status)
+	}
+
+	dat, err := io.ReadAll(io.LimitReader(resp.Body, getter.MaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	return dat, nil
+}
+
+// getFromRepo downloads the chart o.Repo at o.Version listed in the index of the Helm repo o.URI.
+func (c credentials) getFromRepo(ctx context.Context, o getter.GetOptions) ([]byte, string, error) {
+	uri := strings.TrimSuffix(o.URI, "/") + "/index.yaml"
+	dat, err := c.fetch(ctx, uri, o.URI)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch index.yaml from repo: %w", err)
+	}
+	idx, err := repo.Load(bytes.NewReader(dat), o.URI, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load index.yaml from repo: %w", err)
+	}
+	res, err := idx.Get(o.Repo, o.Version)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get chart %s@%s from index: %w", o.Repo, o.Version, err)
+	}
+	if len(res.URLs) == 0 {
+		return nil, "", fmt.Errorf("no package url found in index @ %s/%s", res.Name, res.Version)
+	}
+
+	packageURL := res.URLs[0]
+	if u, err := url.Parse(packageURL); err != nil {
+		return nil, "", fmt.Errorf("invalid chart url: %w", err)
+	} else if !u.IsAbs() {
+		packageURL, err = repo.URLJoin(o.URI, packageURL)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to join chart URL: %w", err)
+		}
+	}
+
+	dat, err = c.fetch(ctx, packageURL, o.URI)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch chart from url %s: %w", packageURL, err)
+	}
+	return dat, packageURL, nil
+}
+
+// getOCI downloads the chart layer of the OCI chart o.URI, in the repository o.Repo when it is set,
+// at the tag o.Version or else at its highest stable semver tag.
+func (c credentials) getOCI(ctx context.Context, o getter.GetOptions) ([]byte, string, error) {
+	ref := strings.TrimPrefix(o.URI, "oci://")
+	if o.Repo != "" {
+		ref = ref + "/" + o.Repo
+	}
+	if o.Version != "" && !strings.Contains(ref, "@") && !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		ref = ref + ":" + o.Version
+	}
+
+	repository, err := registry.Repository(c.registry(ref))
+	if err != nil {
+		return nil, "", err
+	}
+	if tag := repository.Reference.Reference; tag == "" || tag == "latest" {
+		tags, err := registry.Tags(ctx, c.registry(ref))
+		if err != nil {
+			return nil, "", err
+		}
+		latest := latestStableVersion(tags)
+		if latest == "" {
+			return nil, "", fmt.Errorf("no stable semver tags found for %s", ref)
+		}
+		ref = strings.TrimSuffix(ref, ":"+tag) + ":" + latest
+		repository.Reference.Reference = latest
+	}
+
+	desc, err := repository.Resolve(ctx, repository.Reference.Reference)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve reference %s: %w", ref, err)
+	}
+	dat, err := content.FetchAll(ctx, repository, desc)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(dat, &manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	idx := slices.IndexFunc(manifest.Layers, func(el ocispec.Descriptor) bool {
+		return el.MediaType == getter.ChartLayerMediaType || el.MediaType == getter.LegacyLayerMediaType
+	})
+	if idx == -1 && len(manifest.Layers) == 1 {
+		idx = 0
+	}
+	if idx == -1 {
+		return nil, "", fmt.Errorf("chart layer not found in manifest")
+	}
+	layer := manifest.Layers[idx]
+	if layer.Size > getter.MaxResponseSize {
+		return nil, "", fmt.Errorf("chart layer %s is larger than %d bytes", layer.Digest, getter.MaxResponseSize)
+	}
+	dat, err = content.FetchAll(ctx, repository, layer)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch layer %s: %w", layer.Digest, err)
+	}
+	return dat, "oci://" + ref, nil
+}
+
+// latestStableVersion returns the highest semver tag without a prerelease, as the getter does, or "" if there is none.
+func latestStableVersion(tags []string) string {
+	var latest *semver.Version
+	for _, el := range tags {
+		v, err := semver.NewVersion(el)
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.Original()
+}
@@ -0,0 +1,320 @@
+package chart
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// mustClientCertificate returns a self-signed client certificate and its PEM encoded certificate and key.
+func mustClientCertificate(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "core-provider"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestFetchOverMutualTLSWithBearerToken(t *testing.T) {
+	origWait := chartRetryWait
+	t.Cleanup(func() { chartRetryWait = origWait })
+	chartRetryWait = func(context.Context, time.Duration) error { return nil }
+
+	chartBytes := mustChartArchive(t, "demo-chart")
+	clientCert, certPEM, keyPEM := mustClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/repo/index.yaml":
+			w.Write([]byte("apiVersion: v1\nentries:\n  demo-chart:\n  - name: demo-chart\n    version: 1.2.3\n    urls: [demo-chart-1.2.3.tgz]\n"))
+		case "/repo/demo-chart-1.2.3.tgz", "/charts/demo-chart-1.2.3.tgz":
+			w.Write(chartBytes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	kube := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("s3cr3t\n")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "client-cert", Namespace: "default"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "default"},
+			Data:       map[string]string{"ca.crt": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))},
+		},
+	).Build()
+	source := func(url, repo, version string) *v1alpha1.ChartInfo {
+		return &v1alpha1.ChartInfo{
+			Url:            url,
+			Repo:           repo,
+			Version:        version,
+			BearerTokenRef: &rtv1.SecretKeySelector{Reference: rtv1.Reference{Name: "token", Namespace: "default"}, Key: "token"},
+			TLS: &v1alpha1.SourceTLS{
+				ClientCertificateRef: &rtv1.Reference{Name: "client-cert", Namespace: "default"},
+				CABundleRef: &v1alpha1.CABundleRef{
+					ConfigMapKeyRef: &rtv1.ConfigMapKeySelector{Reference: rtv1.Reference{Name: "ca", Namespace: "default"}, Key: "ca.crt"},
+				},
+			},
+			Timeout: &metav1.Duration{Duration: 5 * time.Second},
+		}
+	}
+
+	pkg, err := Fetch(context.Background(), kube, source(srv.URL+"/charts/demo-chart-1.2.3.tgz", "", ""))
+	if err != nil {
+		t.Fatalf("expected success for a tgz chart, got error: %v", err)
+	}
+	if pkg.Digest != chartcache.Digest(chartBytes) {
+		t.Fatalf("unexpected chart digest %s", pkg.Digest)
+	}
+
+	pkg, err = Fetch(context.Background(), kube, source(srv.URL+"/repo", "demo-chart", "1.2.3"))
+	if err != nil {
+		t.Fatalf("expected success for a Helm repo chart, got error: %v", err)
+	}
+	if want := srv.URL + "/repo/demo-chart-1.2.3.tgz"; pkg.PackageURL != want {
+		t.Fatalf("expected package url %s, got %s", want, pkg.PackageURL)
+	}
+
+	nfo := source(srv.URL+"/charts/demo-chart-1.2.3.tgz", "", "")
+	nfo.TLS.ClientCertificateRef = nil
+	if _, err := Fetch(context.Background(), kube, nfo); err == nil {
+		t.Fatalf("expected an error without the client certificate")
+	}
+
+	nfo = source(srv.URL+"/charts/demo-chart-1.2.3.tgz", "", "")
+	nfo.TLS.CABundleRef = nil
+	if _, err := Fetch(context.Background(), kube, nfo); err == nil {
+		t.Fatalf("expected an error without the CA bundle")
+	}
+}
+
+func TestFetchOCIChartWithPullSecret(t *testing.T) {
+	origWait := chartRetryWait
+	t.Cleanup(func() { chartRetryWait = origWait })
+	chartRetryWait = func(context.Context, time.Duration) error { return nil }
+
+	chartBytes := mustChartArchive(t, "demo-chart")
+	config := []byte("{}")
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeEmptyJSON, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers:    []ocispec.Descriptor{{MediaType: getter.ChartLayerMediaType, Digest: digest.FromBytes(chartBytes), Size: int64(len(chartBytes))}},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+	blobs := map[string][]byte{
+		chartcache.Digest(chartBytes): chartBytes,
+		chartcache.Digest(config):     config,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.example.com/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/v2/charts/demo-chart/")
+		var dat []byte
+		switch {
+		case r.URL.Path == "/v2/":
+			return
+		case path == "tags/list":
+			json.NewEncoder(w).Encode(map[string]any{"name": "charts/demo-chart", "tags": []string{"1.2.2", "1.2.3", "1.3.0-rc.1"}})
+			return
+		case path == "manifests/1.2.3" || path == "manifests/"+chartcache.Digest(manifest):
+			dat = manifest
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		case strings.HasPrefix(path, "blobs/"):
+			dat = blobs[strings.TrimPrefix(path, "blobs/")]
+		}
+		if dat == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", chartcache.Digest(dat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(dat)))
+		if r.Method != http.MethodHead {
+			w.Write(dat)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	dockerConfig, _ := json.Marshal(map[string]any{"auths": map[string]any{
+		"https://" + host + "/v1/": map[string]string{"registrytoken": "registry-token"},
+	}})
+	kube := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull", Namespace: "default"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+	}).Build()
+
+	for _, version := range []string{"1.2.3", ""} {
+		pkg, err := Fetch(context.Background(), kube, &v1alpha1.ChartInfo{
+			Url:           "oci://" + host + "/charts/demo-chart",
+			Version:       version,
+			PullSecretRef: &rtv1.Reference{Name: "pull", Namespace: "default"},
+		})
+		if err != nil {
+			t.Fatalf("expected success for version %q, got error: %v", version, err)
+		}
+		if want := "oci://" + host + "/charts/demo-chart:1.2.3"; pkg.PackageURL != want {
+			t.Fatalf("expected package url %s, got %s", want, pkg.PackageURL)
+		}
+		if pkg.Digest != chartcache.Digest(chartBytes) {
+			t.Fatalf("unexpected chart digest %s", pkg.Digest)
+		}
+	}
+}
+
+func TestPullSecretAuth(t *testing.T) {
+	config := func(auths map[string]dockerAuth) map[string][]byte {
+		dat, _ := json.Marshal(dockerConfig{Auths: auths})
+		return map[string][]byte{corev1.DockerConfigJsonKey: dat}
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte("user:pa:ss"))
+
+	tests := []struct {
+		name     string
+		data     map[string][]byte
+		chartURL string
+		want     dockerAuth
+		wantErr  bool
+	}{
+		{
+			name:     "auth of the OCI registry",
+			data:     config(map[string]dockerAuth{"registry.example.com": {Auth: basic}, "other.example.com": {Auth: "bm9wZTpub3Bl"}}),
+			chartURL: "oci://registry.example.com/charts/demo",
+			want:     dockerAuth{Username: "user", Password: "pa:ss", Auth: basic},
+		},
+		{
+			name:     "entry with scheme and path",
+			data:     config(map[string]dockerAuth{"https://Charts.example.com/v1/": {Username: "user", Password: "pass"}}),
+			chartURL: "https://charts.example.com/stable",
+			want:     dockerAuth{Username: "user", Password: "pass"},
+		},
+		{
+			name:     "tokens",
+			data:     config(map[string]dockerAuth{"registry.example.com:5000": {IdentityToken: "refresh", RegistryToken: "access"}}),
+			chartURL: "oci://registry.example.com:5000/charts/demo",
+			want:     dockerAuth{IdentityToken: "refresh", RegistryToken: "access"},
+		},
+		{
+			name:     "no entry for the host",
+			data:     config(map[string]dockerAuth{"registry.example.com": {Auth: basic}}),
+			chartURL: "oci://registry.example.com:5000/charts/demo",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid auth",
+			data:     config(map[string]dockerAuth{"registry.example.com": {Auth: base64.StdEncoding.EncodeToString([]byte("user"))}}),
+			chartURL: "oci://registry.example.com/charts/demo",
+			wantErr:  true,
+		},
+		{
+			name:     "not a dockerconfigjson secret",
+			data:     map[string][]byte{"password": []byte("pass")},
+			chartURL: "oci://registry.example.com/charts/demo",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pullSecretAuth(tt.data, tt.chartURL)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected success, got error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCredentialsDigest(t *testing.T) {
+	basic := credentials{username: "user", password: "pass"}
+	if got, want := basic.digest(), chartcache.Digest([]byte("user:pass")); got != want {
+		t.Fatalf("expected the digest of basic credentials to be %s, got %s", want, got)
+	}
+	if got := (credentials{}).digest(); got != "" {
+		t.Fatalf("expected no digest without credentials, got %s", got)
+	}
+	token := credentials{token: "s3cr3t"}
+	if token.digest() == "" || token.digest() == (credentials{token: "other"}).digest() {
+		t.Fatalf("expected the digest to identify the bearer token")
+	}
+	if basic.customTransport() || !token.customTransport() {
+		t.Fatalf("expected only the bearer token to need the custom transport")
+	}
+}
@@ -0,0 +1,234 @@
+// Package valuesschema loads the values schema of a chart that is split
+// across several files into a single, self-contained JSON schema.
+package valuesschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// MaxNodes bounds the schema nodes of the loaded schema once its references are inlined. Inlining copies the
+// referenced schema at every reference, so a chain of schemas each referencing the next one twice doubles the
+// size of the schema at each step: such a schema is rejected instead of being expanded into the CRD.
+const MaxNodes = 10000
+
+// Load reads the schema stored at name in fsys and returns it as JSON, with every local $ref inlined.
+// References may point into the same file or into another file of fsys, relative to the referencing file,
+// and may be followed by a JSON pointer (e.g. schemas/common.json#/definitions/port). Files ending in
+// .yaml or .yml are parsed as YAML. The definitions and $defs sections are dropped once inlined.
+// A reference to a schema that is being resolved is recursive and is replaced by an object that preserves
+// unknown fields, since CRD schemas cannot be recursive. A schema expanding to more than MaxNodes nodes is rejected.
+func Load(fsys fs.FS, name string) ([]byte, error) {
+	l := &loader{fsys: fsys, root: path.Dir(name), docs: map[string]any{}}
+
+	doc, err := l.document(name)
+	if err != nil {
+		return nil, err
+	}
+	res, err := l.schema(name, doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
+
+type loader struct {
+	fsys fs.FS
+	// root is the directory of the loaded schema, references cannot point outside of it
+	root string
+	// docs are the parsed files, by path
+	docs map[string]any
+	// stack holds the references being resolved, as path#pointer
+	stack []string
+	// nodes counts the schema nodes produced so far
+	nodes int
+}
+
+func (l *loader) document(name string) (any, error) {
+	if doc, ok := l.docs[name]; ok {
+		return doc, nil
+	}
+
+	dat, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if ext := path.Ext(name); ext == ".yaml" || ext == ".yml" {
+		dat, err = yaml.YAMLToJSON(dat)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing schema %s: %w", name, err)
+		}
+	}
+
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing schema %s: %w", name, err)
+	}
+	l.docs[name] = doc
+	return doc, nil
+}
+
+// schema resolves the references of the schema node found in the file name.
+// Only the keywords holding subschemas are walked, so values of enum, default or examples are kept as they are.
+func (l *loader) schema(name string, node any) (any, error) {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return node, nil
+	}
+	if l.nodes++; l.nodes > MaxNodes {
+		return nil, fmt.Errorf("%s: the schema has more than %d nodes once its references are inlined", name, MaxNodes)
+	}
+	if ref, ok := m["$ref"].(string); ok {
+		return l.ref(name, ref, m)
+	}
+
+	res := make(map[string]any, len(m))
+	for k, v := range m {
+		switch k {
+		case "definitions", "$defs":
+			continue
+		case "properties", "patternProperties", "dependencies":
+			props, ok := v.(map[string]any)
+			if !ok {
+				res[k] = v
+				continue
+			}
+			all := make(map[string]any, len(props))
+			for prop, el := range props {
+				s, err := l.schema(name, el)
+				if err != nil {
+					return nil, err
+				}
+				all[prop] = s
+			}
+			res[k] = all
+		case "items", "additionalItems", "additionalProperties", "allOf", "anyOf", "oneOf",
+			"not", "contains", "propertyNames", "if", "then", "else":
+			list, ok := v.([]any)
+			if !ok {
+				s, err := l.schema(name, v)
+				if err != nil {
+					return nil, err
+				}
+				res[k] = s
+				continue
+			}
+			all := make([]any, 0, len(list))
+			for _, el := range list {
+				s, err := l.schema(name, el)
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, s)
+			}
+			res[k] = all
+		default:
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// ref inlines the schema referenced by node. The other keywords of node are kept and
+// take precedence over the ones of the referenced schema.
+func (l *loader) ref(name, ref string, node map[string]any) (any, error) {
+	file, pointer, _ := strings.Cut(ref, "#")
+	if strings.Contains(file, "://") {
+		return nil, fmt.Errorf("%s: remote reference %q is not supported", name, ref)
+	}
+	target := name
+	if file != "" {
+		target = path.Join(path.Dir(name), file)
+		if l.root != "." && target != l.root && !strings.HasPrefix(target, l.root+"/") || !fs.ValidPath(target) {
+			return nil, fmt.Errorf("%s: reference %q points outside of the chart", name, ref)
+		}
+	}
+
+	siblings := make(map[string]any, len(node))
+	for k, v := range node {
+		if k != "$ref" {
+			siblings[k] = v
+		}
+	}
+	res, err := l.schema(name, siblings)
+	if err != nil {
+		return nil, err
+	}
+	merged := res.(map[string]any)
+
+	key := target + "#" + pointer
+	if slices.Contains(l.stack, key) {
+		merged["type"] = "object"
+		merged["x-kubernetes-preserve-unknown-fields"] = true
+		return merged, nil
+	}
+
+	doc, err := l.document(target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error resolving reference %q: %w", name, ref, err)
+	}
+	el, err := lookup(doc, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error resolving reference %q: %w", name, ref, err)
+	}
+
+	l.stack = append(l.stack, key)
+	resolved, err := l.schema(target, el)
+	l.stack = l.stack[:len(l.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := resolved.(map[string]any)
+	if !ok {
+		return resolved, nil
+	}
+	for k, v := range s {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// lookup returns the element of doc at the JSON pointer.
+func lookup(doc any, pointer string) (any, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("unsupported JSON pointer %q", pointer)
+	}
+
+	el := doc
+	for _, tok := range strings.Split(pointer[1:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		switch v := el.(type) {
+		case map[string]any:
+			next, ok := v[tok]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", pointer)
+			}
+			el = next
+		case []any:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%q not found", pointer)
+			}
+			el = v[i]
+		default:
+			return nil, fmt.Errorf("%q not found", pointer)
+		}
+	}
+	return el, nil
+}
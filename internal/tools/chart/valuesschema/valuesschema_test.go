@@ -0,0 +1,151 @@
+package valuesschema
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+		err      string
+	}{
+		{
+			name: "Schema without references",
+			files: map[string]string{
+				"chart/values.schema.json": `{"type": "object", "properties": {"replicas": {"type": "integer", "default": 1}}}`,
+			},
+			expected: `{"type": "object", "properties": {"replicas": {"type": "integer", "default": 1}}}`,
+		},
+		{
+			name: "Local definitions and $defs are inlined",
+			files: map[string]string{
+				"chart/values.schema.json": `{
+					"type": "object",
+					"definitions": {"port": {"type": "integer", "minimum": 1}},
+					"$defs": {"name": {"type": "string"}},
+					"properties": {
+						"port": {"$ref": "#/definitions/port", "description": "The service port"},
+						"names": {"type": "array", "items": {"$ref": "#/$defs/name"}},
+						"definitions": {"type": "boolean"}
+					}
+				}`,
+			},
+			expected: `{
+				"type": "object",
+				"properties": {
+					"port": {"type": "integer", "minimum": 1, "description": "The service port"},
+					"names": {"type": "array", "items": {"type": "string"}},
+					"definitions": {"type": "boolean"}
+				}
+			}`,
+		},
+		{
+			name: "References to other files are relative to the referencing file",
+			files: map[string]string{
+				"chart/values.schema.json": `{"type": "object", "properties": {"service": {"$ref": "schemas/service.json"}}}`,
+				"chart/schemas/service.json": `{
+					"type": "object",
+					"properties": {"ports": {"type": "array", "items": {"$ref": "common.json#/definitions/port"}}}
+				}`,
+				"chart/schemas/common.json": `{"definitions": {"port": {"type": "integer", "maximum": 65535}}}`,
+			},
+			expected: `{
+				"type": "object",
+				"properties": {"service": {"type": "object", "properties": {"ports": {"type": "array", "items": {"type": "integer", "maximum": 65535}}}}}
+			}`,
+		},
+		{
+			name: "YAML schemas",
+			files: map[string]string{
+				"chart/values.schema.json": `{"type": "object", "properties": {"tier": {"$ref": "schemas/tier.yaml"}}}`,
+				"chart/schemas/tier.yaml":  "type: string\nenum: [small, large]\n",
+			},
+			expected: `{"type": "object", "properties": {"tier": {"type": "string", "enum": ["small", "large"]}}}`,
+		},
+		{
+			name: "Recursive references preserve unknown fields",
+			files: map[string]string{
+				"chart/values.schema.json": `{
+					"type": "object",
+					"definitions": {"node": {"type": "object", "properties": {"name": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#/definitions/node"}}}}},
+					"properties": {"tree": {"$ref": "#/definitions/node"}}
+				}`,
+			},
+			expected: `{
+				"type": "object",
+				"properties": {"tree": {"type": "object", "properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}}
+				}}}
+			}`,
+		},
+		{
+			name: "Remote references are rejected",
+			files: map[string]string{
+				"chart/values.schema.json": `{"properties": {"a": {"$ref": "https://example.com/schema.json"}}}`,
+			},
+			err: `chart/values.schema.json: remote reference "https://example.com/schema.json" is not supported`,
+		},
+		{
+			name: "References outside of the chart are rejected",
+			files: map[string]string{
+				"chart/values.schema.json": `{"properties": {"a": {"$ref": "../other/values.schema.json"}}}`,
+				"other/values.schema.json": `{"type": "string"}`,
+			},
+			err: `chart/values.schema.json: reference "../other/values.schema.json" points outside of the chart`,
+		},
+		{
+			name: "Missing definitions are reported",
+			files: map[string]string{
+				"chart/values.schema.json": `{"properties": {"a": {"$ref": "#/definitions/missing"}}}`,
+			},
+			err: `chart/values.schema.json: error resolving reference "#/definitions/missing": "/definitions/missing" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, content := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+
+			got, err := Load(fsys, "chart/values.schema.json")
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(got))
+		})
+	}
+}
+
+// diamond returns a schema whose definitions form a chain of n definitions, each referencing the next one twice.
+func diamond(n int) string {
+	defs := make([]string, 0, n+1)
+	for i := 0; i < n; i++ {
+		defs = append(defs, fmt.Sprintf(`"d%d": {"type": "object", "properties": {"a": {"$ref": "#/definitions/d%d"}, "b": {"$ref": "#/definitions/d%d"}}}`, i, i+1, i+1))
+	}
+	defs = append(defs, fmt.Sprintf(`"d%d": {"type": "string"}`, n))
+	return fmt.Sprintf(`{"definitions": {%s}, "properties": {"root": {"$ref": "#/definitions/d0"}}}`, strings.Join(defs, ", "))
+}
+
+func TestLoadBoundsInlinedReferences(t *testing.T) {
+	fsys := fstest.MapFS{"chart/values.schema.json": &fstest.MapFile{Data: []byte(diamond(3))}}
+	got, err := Load(fsys, "chart/values.schema.json")
+	require.NoError(t, err)
+	assert.Equal(t, 8, strings.Count(string(got), `"type":"string"`))
+
+	fsys = fstest.MapFS{"chart/values.schema.json": &fstest.MapFile{Data: []byte(diamond(64))}}
+	_, err = Load(fsys, "chart/values.schema.json")
+	assert.ErrorContains(t, err, fmt.Sprintf("more than %d nodes", MaxNodes))
+}
@@ -0,0 +1,100 @@
+package chart
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/verify"
+	"github.com/krateoplatformops/core-provider/internal/tools/resolvers"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxVerifiedCharts bounds the verification results kept in memory.
+const maxVerifiedCharts = 256
+
+// verifiedCharts remembers the charts that passed verification, by archive digest, method and key,
+// so that a chart served from the cache is not verified again on every reconcile.
+var verifiedCharts = newMemoLRU[*verify.Result](maxVerifiedCharts)
+
+// verifyChart checks the authenticity of the downloaded chart with the method selected in nfo.Verify.
+// It returns a *verify.Error when the chart fails verification.
+func verifyChart(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo, pkg *Package, cred credentials) (*verify.Result, error) {
+	method, ref := verify.MethodProvenance, rtv1.SecretKeySelector{}
+	switch {
+	case nfo.Verify.Cosign != nil:
+		method, ref = verify.MethodCosign, nfo.Verify.Cosign.PublicKeyRef
+	case nfo.Verify.Provenance != nil:
+		ref = nfo.Verify.Provenance.KeyringRef
+	default:
+		return nil, fmt.Errorf("no chart verification method is set")
+	}
+	key, err := resolvers.GetSecret(ctx, kube, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verification key secret: %w", err)
+	}
+	if key == "" {
+		return nil, &verify.Error{Method: method, Reason: fmt.Sprintf("key %s of secret %s/%s is empty", ref.Key, ref.Namespace, ref.Name)}
+	}
+
+	memo := strings.Join([]string{pkg.Digest, method, chartcache.Digest([]byte(key))}, "/")
+	res, ok := verifiedCharts.get(memo)
+	if ok {
+		return res, nil
+	}
+
+	switch method {
+	case verify.MethodCosign:
+		if !strings.HasPrefix(pkg.PackageURL, "oci://") {
+			return nil, &verify.Error{Method: method, Reason: "cosign signatures can only be verified for OCI charts"}
+		}
+		res, err = verify.Cosign(ctx, cred.registry(strings.TrimPrefix(pkg.PackageURL, "oci://")), pkg.Digest, []byte(key))
+	default:
+		if !isHTTPArchive(pkg.PackageURL) {
+			return nil, &verify.Error{Method: method, Reason: "provenance files can only be verified for charts served over HTTP"}
+		}
+		var prov []byte
+		prov, err = provenanceFile(ctx, pkg.PackageURL, nfo.Url, cred)
+		if err != nil {
+			return nil, err
+		}
+		res, err = verify.Provenance(pkg.Data, prov, []byte(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedCharts.put(memo, res)
+	return res, nil
+}
+
+// provenanceFile downloads the provenance file published next to the chart archive, as Helm does.
+func provenanceFile(ctx context.Context, packageURL, chartURL string, cred credentials) ([]byte, error) {
+	uri := packageURL + ".prov"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request for uri %s: %w", uri, err)
+	}
+	cred.authorize(req, chartURL)
+
+	resp, err := cred.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provenance file %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(io.LimitReader(resp.Body, getter.MaxResponseSize))
+	case http.StatusNotFound:
+		return nil, &verify.Error{Method: verify.MethodProvenance, Reason: fmt.Sprintf("no provenance file found at %s", uri)}
+	default:
+		return nil, fmt.Errorf("failed to get provenance file %s: %s", uri, resp.Status)
+	}
+}
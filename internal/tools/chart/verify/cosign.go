@@ -0,0 +1,193 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/registry"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+const (
+	// cosignPayloadMediaType is the media type of the layers of a cosign signature manifest.
+	cosignPayloadMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// cosignSignatureAnnotation holds the base64 encoded signature of the payload of a layer.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	chartLayerMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	legacyLayerMediaType = "application/tar+gzip"
+)
+
+// Registry locates an OCI chart and holds the options used to read its signatures.
+// Its Reference is the reference of the chart manifest, as registry/repository:tag.
+type Registry = registry.Options
+
+// simpleSigning is the payload signed by cosign.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// Cosign verifies the cosign signature of an OCI chart: the chart manifest must hold the archive with
+// the digest, and a signature stored at the sha256-<digest>.sig tag of the repository must sign the
+// manifest digest with the PEM encoded public key. Transparency logs are not checked.
+func Cosign(ctx context.Context, reg Registry, archiveDigest string, publicKey []byte) (*Result, error) {
+	pub, fingerprint, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, failed(MethodCosign, "invalid public key: %v", err)
+	}
+
+	repo, err := newRepository(reg)
+	if err != nil {
+		return nil, failed(MethodCosign, "%v", err)
+	}
+	desc, holds, err := resolveManifest(ctx, repo, archiveDigest)
+	if err != nil {
+		return nil, err
+	}
+	if !holds {
+		return nil, failed(MethodCosign, "the manifest %s does not hold the chart archive %s", desc.Digest, archiveDigest)
+	}
+
+	sigTag := strings.Replace(desc.Digest.String(), ":", "-", 1) + ".sig"
+	sigDesc, err := repo.Resolve(ctx, sigTag)
+	if errors.Is(err, errdef.ErrNotFound) {
+		return nil, failed(MethodCosign, "no signature found for %s", desc.Digest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve signature %s: %w", sigTag, err)
+	}
+	sigManifest := ocispec.Manifest{}
+	if err := fetchJSON(ctx, repo, sigDesc, &sigManifest); err != nil {
+		return nil, fmt.Errorf("failed to fetch signature manifest %s: %w", sigTag, err)
+	}
+
+	for _, layer := range sigManifest.Layers {
+		if layer.MediaType != cosignPayloadMediaType {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		payload, err := content.FetchAll(ctx, repo, layer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch signature payload %s: %w", layer.Digest, err)
+		}
+		if !verifySignature(pub, payload, sig) {
+			continue
+		}
+		signed := simpleSigning{}
+		if err := json.Unmarshal(payload, &signed); err != nil || signed.Critical.Image.DockerManifestDigest != desc.Digest.String() {
+			continue
+		}
+
+		return &Result{
+			Method:         MethodCosign,
+			Signer:         fingerprint,
+			KeyFingerprint: fingerprint,
+		}, nil
+	}
+
+	return nil, failed(MethodCosign, "no signature of %s is valid for the public key %s", desc.Digest, fingerprint)
+}
+
+// Manifest resolves the manifest of an OCI chart and returns its digest,
+// reporting whether its chart layer is the archive with the digest.
+func Manifest(ctx context.Context, reg Registry, archiveDigest string) (string, bool, error) {
+	repo, err := newRepository(reg)
+	if err != nil {
+		return "", false, err
+	}
+	desc, holds, err := resolveManifest(ctx, repo, archiveDigest)
+	if err != nil {
+		return "", false, err
+	}
+	return desc.Digest.String(), holds, nil
+}
+
+func resolveManifest(ctx context.Context, repo *remote.Repository, archiveDigest string) (ocispec.Descriptor, bool, error) {
+	desc, err := repo.Resolve(ctx, repo.Reference.Reference)
+	if err != nil {
+		return ocispec.Descriptor{}, false, fmt.Errorf("failed to resolve %s: %w", repo.Reference, err)
+	}
+	manifest := ocispec.Manifest{}
+	if err := fetchJSON(ctx, repo, desc, &manifest); err != nil {
+		return ocispec.Descriptor{}, false, fmt.Errorf("failed to fetch manifest of %s: %w", repo.Reference, err)
+	}
+	return desc, holdsArchive(manifest, archiveDigest), nil
+}
+
+func newRepository(reg Registry) (*remote.Repository, error) {
+	return registry.Repository(reg)
+}
+
+func fetchJSON(ctx context.Context, repo *remote.Repository, desc ocispec.Descriptor, v any) error {
+	dat, err := content.FetchAll(ctx, repo, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(dat, v)
+}
+
+// holdsArchive reports whether the chart layer of the manifest is the archive with the digest.
+func holdsArchive(manifest ocispec.Manifest, archiveDigest string) bool {
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == chartLayerMediaType || layer.MediaType == legacyLayerMediaType {
+			return layer.Digest.String() == archiveDigest
+		}
+	}
+	return len(manifest.Layers) == 1 && manifest.Layers[0].Digest.String() == archiveDigest
+}
+
+// parsePublicKey parses a PEM encoded public key and returns it with its fingerprint,
+// the sha256 digest of its DER encoding.
+func parsePublicKey(dat []byte) (crypto.PublicKey, string, error) {
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, "", fmt.Errorf("no PEM block found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return pub, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// verifySignature verifies the signature of the payload the way cosign does for each key type.
+func verifySignature(pub crypto.PublicKey, payload, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	}
+	return false
+}
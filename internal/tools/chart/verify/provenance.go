@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	// Helm signs and verifies provenance files with these packages, deprecated but kept for compatibility.
+	"golang.org/x/crypto/openpgp"           //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/clearsign" //nolint:staticcheck
+	"sigs.k8s.io/yaml"
+)
+
+// provenanceFiles is the part of a provenance file listing the digests of the chart archives.
+type provenanceFiles struct {
+	Files map[string]string `json:"files"`
+}
+
+// Provenance verifies a Helm provenance file: prov must be clearsigned by a key of the keyring,
+// armored or binary, and must list the sha256 digest of the archive.
+func Provenance(archive, prov, keyring []byte) (*Result, error) {
+	ring, err := readKeyRing(keyring)
+	if err != nil {
+		return nil, failed(MethodProvenance, "invalid keyring: %v", err)
+	}
+
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return nil, failed(MethodProvenance, "the provenance file is not clearsigned")
+	}
+	signer, err := openpgp.CheckDetachedSignature(ring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, failed(MethodProvenance, "invalid signature: %v", err)
+	}
+
+	parts := bytes.Split(block.Plaintext, []byte("\n...\n"))
+	if len(parts) < 2 {
+		return nil, failed(MethodProvenance, "the provenance file does not list the chart files")
+	}
+	files := provenanceFiles{}
+	if err := yaml.Unmarshal(parts[1], &files); err != nil {
+		return nil, failed(MethodProvenance, "invalid list of chart files: %v", err)
+	}
+
+	sum := sha256.Sum256(archive)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	found := false
+	for _, el := range files.Files {
+		if el == digest {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, failed(MethodProvenance, "the chart digest %s is not listed in the provenance file", digest)
+	}
+
+	return &Result{
+		Method:         MethodProvenance,
+		Signer:         identity(signer),
+		KeyFingerprint: fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint),
+	}, nil
+}
+
+func readKeyRing(keyring []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(keyring), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(keyring))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(keyring))
+}
+
+// identity returns the primary user ID of the entity, or the first one in lexical order.
+func identity(e *openpgp.Entity) string {
+	names := make([]string, 0, len(e.Identities))
+	for name, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
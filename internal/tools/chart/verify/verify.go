@@ -0,0 +1,35 @@
+// Package verify checks the authenticity of chart archives: Helm provenance files signed
+// with a PGP key, and cosign signatures of OCI charts made with a public key.
+package verify
+
+import "fmt"
+
+// Verification methods.
+const (
+	MethodProvenance = "provenance"
+	MethodCosign     = "cosign"
+)
+
+// Result is the outcome of a successful verification.
+type Result struct {
+	Method string
+	// Signer is the user ID of the PGP key that signed a provenance file,
+	// or the fingerprint of the public key that verified a cosign signature.
+	Signer         string
+	KeyFingerprint string
+}
+
+// Error reports a chart that fails verification. Unlike a failure to download a signature,
+// it is not transient: the chart, its signature or the trusted keys have to change.
+type Error struct {
+	Method string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("chart %s verification failed: %s", e.Method, e.Reason)
+}
+
+func failed(method, format string, args ...any) *Error {
+	return &Error{Method: method, Reason: fmt.Sprintf(format, args...)}
+}
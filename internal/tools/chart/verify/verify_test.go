@@ -0,0 +1,238 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"           //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/clearsign" //nolint:staticcheck
+)
+
+func newSigner(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Chart Signer", "", "signer@example.com", nil)
+	require.NoError(t, err)
+
+	keyring := &bytes.Buffer{}
+	require.NoError(t, entity.Serialize(keyring))
+	return entity, keyring.Bytes()
+}
+
+func signProvenance(t *testing.T, entity *openpgp.Entity, archive []byte) []byte {
+	t.Helper()
+	sum := sha256.Sum256(archive)
+	plaintext := fmt.Sprintf("apiVersion: v2\nname: demo\nversion: 0.1.0\n\n...\nfiles:\n  demo-0.1.0.tgz: sha256:%x\n", sum)
+
+	out := &bytes.Buffer{}
+	w, err := clearsign.Encode(out, entity.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(plaintext))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return out.Bytes()
+}
+
+func TestProvenance(t *testing.T) {
+	archive := []byte("chart archive")
+	signer, keyring := newSigner(t)
+	_, otherKeyring := newSigner(t)
+	prov := signProvenance(t, signer, archive)
+
+	t.Run("valid provenance file", func(t *testing.T) {
+		res, err := Provenance(archive, prov, keyring)
+		require.NoError(t, err)
+		assert.Equal(t, MethodProvenance, res.Method)
+		assert.Equal(t, "Chart Signer <signer@example.com>", res.Signer)
+		assert.Equal(t, fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint), res.KeyFingerprint)
+	})
+
+	tests := []struct {
+		name    string
+		archive []byte
+		prov    []byte
+		keyring []byte
+		reason  string
+	}{
+		{name: "tampered archive", archive: []byte("tampered"), prov: prov, keyring: keyring, reason: "the chart digest sha256:"},
+		{name: "unknown signer", archive: archive, prov: prov, keyring: otherKeyring, reason: "invalid signature"},
+		{name: "unsigned provenance file", archive: archive, prov: []byte("files: {}\n"), keyring: keyring, reason: "the provenance file is not clearsigned"},
+		{name: "invalid keyring", archive: archive, prov: prov, keyring: []byte("not a keyring"), reason: "invalid keyring"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Provenance(tt.archive, tt.prov, tt.keyring)
+			var verr *Error
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, MethodProvenance, verr.Method)
+			assert.True(t, strings.HasPrefix(verr.Reason, tt.reason), verr.Reason)
+		})
+	}
+}
+
+// fakeRegistry serves manifests and blobs of a single repository over the OCI distribution API.
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func (r *fakeRegistry) push(dat []byte) ocispec.Descriptor {
+	d := digest.FromBytes(dat)
+	r.blobs[d.String()] = dat
+	return ocispec.Descriptor{Digest: d, Size: int64(len(dat))}
+}
+
+func (r *fakeRegistry) pushManifest(t *testing.T, tag string, layers ...ocispec.Descriptor) digest.Digest {
+	t.Helper()
+	config := r.push([]byte("{}"))
+	config.MediaType = ocispec.MediaTypeEmptyJSON
+	dat, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    layers,
+	})
+	require.NoError(t, err)
+	d := digest.FromBytes(dat)
+	r.manifests[d.String()] = dat
+	r.manifests[tag] = dat
+	return d
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/charts/demo/")
+	var dat []byte
+	var ok bool
+	switch {
+	case req.URL.Path == "/v2/":
+		return
+	case strings.HasPrefix(path, "manifests/"):
+		dat, ok = r.manifests[strings.TrimPrefix(path, "manifests/")]
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+	case strings.HasPrefix(path, "blobs/"):
+		dat, ok = r.blobs[strings.TrimPrefix(path, "blobs/")]
+	}
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(dat).String())
+	w.Header().Set("Content-Length", fmt.Sprint(len(dat)))
+	if req.Method != http.MethodHead {
+		w.Write(dat)
+	}
+}
+
+func TestCosign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherDer, err := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	require.NoError(t, err)
+	otherPublicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDer})
+
+	archive := []byte("chart archive")
+	newRegistry := func(t *testing.T, signed bool) (Registry, string) {
+		reg := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+		layer := reg.push(archive)
+		layer.MediaType = chartLayerMediaType
+		manifest := reg.pushManifest(t, "0.1.0", layer)
+
+		if signed {
+			payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"charts/demo"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, manifest))
+			sum := sha256.Sum256(payload)
+			sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+			require.NoError(t, err)
+			sigLayer := reg.push(payload)
+			sigLayer.MediaType = cosignPayloadMediaType
+			sigLayer.Annotations = map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+			reg.pushManifest(t, strings.Replace(manifest.String(), ":", "-", 1)+".sig", sigLayer)
+		}
+
+		srv := httptest.NewServer(reg)
+		t.Cleanup(srv.Close)
+		return Registry{Reference: strings.TrimPrefix(srv.URL, "http://") + "/charts/demo:0.1.0"}, digest.FromBytes(archive).String()
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		reg, archiveDigest := newRegistry(t, true)
+		res, err := Cosign(context.Background(), reg, archiveDigest, publicKey)
+		require.NoError(t, err)
+		sum := sha256.Sum256(der)
+		assert.Equal(t, &Result{
+			Method:         MethodCosign,
+			Signer:         fmt.Sprintf("sha256:%x", sum),
+			KeyFingerprint: fmt.Sprintf("sha256:%x", sum),
+		}, res)
+	})
+
+	tests := []struct {
+		name      string
+		signed    bool
+		publicKey []byte
+		archive   string
+		reason    string
+	}{
+		{name: "unsigned chart", publicKey: publicKey, reason: "no signature found for sha256:"},
+		{name: "signed with another key", signed: true, publicKey: otherPublicKey, reason: "no signature of sha256:"},
+		{name: "archive not in the manifest", signed: true, publicKey: publicKey, archive: digest.FromString("other").String(), reason: "the manifest sha256:"},
+		{name: "invalid public key", signed: true, publicKey: []byte("not a key"), reason: "invalid public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, archiveDigest := newRegistry(t, tt.signed)
+			if tt.archive != "" {
+				archiveDigest = tt.archive
+			}
+			_, err := Cosign(context.Background(), reg, archiveDigest, tt.publicKey)
+			var verr *Error
+			require.ErrorAs(t, err, &verr)
+			assert.True(t, strings.HasPrefix(verr.Reason, tt.reason), verr.Reason)
+		})
+	}
+}
+
+func TestManifest(t *testing.T) {
+	reg := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	layer := reg.push([]byte("chart archive"))
+	layer.MediaType = chartLayerMediaType
+	manifest := reg.pushManifest(t, "0.1.0", layer)
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	ref := Registry{Reference: strings.TrimPrefix(srv.URL, "http://") + "/charts/demo:0.1.0"}
+
+	got, holds, err := Manifest(context.Background(), ref, layer.Digest.String())
+	require.NoError(t, err)
+	assert.Equal(t, manifest.String(), got)
+	assert.True(t, holds)
+
+	got, holds, err = Manifest(context.Background(), ref, digest.FromString("other").String())
+	require.NoError(t, err)
+	assert.Equal(t, manifest.String(), got)
+	assert.False(t, holds)
+
+	_, _, err = Manifest(context.Background(), Registry{Reference: ref.Reference + "-missing"}, layer.Digest.String())
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package chart
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/registry"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	"github.com/krateoplatformops/plumbing/helm/getter/repo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxVersionLists bounds the version lists kept in memory.
+const maxVersionLists = 256
+
+// versionLists remembers the versions published for a chart for the TTL of the chart cache,
+// so that a version range is not resolved against the registry on every reconcile.
+var versionLists = struct {
+	sync.Mutex
+	lists map[string]versionList
+}{lists: map[string]versionList{}}
+
+type versionList struct {
+	versions  []*semver.Version
+	fetchedAt time.Time
+}
+
+// IsVersionRange reports whether version is a semver range, such as ~1.4 or >=2.0 <3.0, rather than an exact version.
+func IsVersionRange(version string) bool {
+	if version == "" {
+		return false
+	}
+	if strings.ContainsAny(version, "~^<>=!*|, ") {
+		return true
+	}
+	_, err := semver.NewVersion(version)
+	return err != nil
+}
+
+// Versions lists the versions published for the chart described by nfo, in ascending order: the versions of the chart
+// in the index of its Helm repo, or the semver tags of its OCI repository. Tags that are not semver are skipped.
+// Versions are listed from the mirrors configured for the chart URL, as Fetch does.
+func Versions(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) ([]*semver.Version, error) {
+	if nfo == nil {
+		return nil, fmt.Errorf("chart infos cannot be nil")
+	}
+	versions, _, err := fromMirrors(ctx, kube, nfo, listVersions)
+	return versions, err
+}
+
+func listVersions(ctx context.Context, kube client.Client, nfo *v1alpha1.ChartInfo) ([]*semver.Version, error) {
+	cred, err := chartCredentials(ctx, kube, nfo)
+	if err != nil {
+		return nil, err
+	}
+
+	memo := strings.Join([]string{nfo.Url, nfo.Repo, cred.digest()}, "|")
+	ttl := chartCache.TTL()
+	versionLists.Lock()
+	list, ok := versionLists.lists[memo]
+	versionLists.Unlock()
+	if ok && time.Since(list.fetchedAt) < ttl {
+		return list.versions, nil
+	}
+
+	var raw []string
+	switch {
+	case strings.HasPrefix(nfo.Url, "oci://"):
+		ref := strings.TrimPrefix(nfo.Url, "oci://")
+		if nfo.Repo != "" {
+			ref = ref + "/" + nfo.Repo
+		}
+		raw, err = registry.Tags(ctx, cred.registry(ref))
+	case isHTTPArchive(nfo.Url) || isObjectSource(nfo.Url) || isGitSource(nfo.Url) || nfo.Repo == "":
+		return nil, fmt.Errorf("versions can only be listed for OCI charts and Helm repo charts, not for %s", nfo.Url)
+	default:
+		raw, err = repoVersions(ctx, nfo, cred)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*semver.Version, 0, len(raw))
+	for _, el := range raw {
+		if v, err := semver.NewVersion(el); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	slices.SortFunc(versions, func(a, b *semver.Version) int { return a.Compare(b) })
+
+	if ttl > 0 {
+		versionLists.Lock()
+		if len(versionLists.lists) >= maxVersionLists {
+			clear(versionLists.lists)
+		}
+		versionLists.lists[memo] = versionList{versions: versions, fetchedAt: time.Now()}
+		versionLists.Unlock()
+	}
+	return versions, nil
+}
+
+// repoVersions lists the versions of the chart in the index of its Helm repo.
+func repoVersions(ctx context.Context, nfo *v1alpha1.ChartInfo, cred credentials) ([]string, error) {
+	uri := strings.TrimSuffix(nfo.Url, "/") + "/index.yaml"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request for uri %s: %w", uri, err)
+	}
+	cred.authorize(req, nfo.Url)
+
+	resp, err := cred.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo index %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get repo index %s: %s", uri, resp.Status)
+	}
+
+	idx, err := repo.Load(io.LimitReader(resp.Body, getter.MaxResponseSize), uri, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repo index %s: %w", uri, err)
+	}
+	entries, ok := idx.Entries[nfo.Repo]
+	if !ok {
+		return nil, fmt.Errorf("chart %s not found in repo index %s", nfo.Repo, uri)
+	}
+	versions := make([]string, 0, len(entries))
+	for _, el := range entries {
+		if el != nil {
+			versions = append(versions, el.Version)
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,78 @@
+package chart
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+)
+
+func TestIsVersionRange(t *testing.T) {
+	tests := map[string]bool{
+		"":              false,
+		"1.2.3":         false,
+		"v1.2.3":        false,
+		"1.4":           false,
+		"~1.4":          true,
+		"^2":            true,
+		">=2.0 <3.0":    true,
+		"1.x":           true,
+		"1.2 || 1.3":    true,
+		"1.0.0-alpha.1": false,
+	}
+	for version, want := range tests {
+		if got := IsVersionRange(version); got != want {
+			t.Fatalf("IsVersionRange(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestVersionsFromRepoIndex(t *testing.T) {
+	const index = `apiVersion: v1
+entries:
+  demo:
+  - name: demo
+    version: 1.4.0
+    urls: [demo-1.4.0.tgz]
+  - name: demo
+    version: 1.10.0
+    urls: [demo-1.10.0.tgz]
+  - name: demo
+    version: 1.9.1
+    urls: [demo-1.9.1.tgz]
+  other:
+  - name: other
+    version: 9.9.9
+    urls: [other-9.9.9.tgz]
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(index))
+	}))
+	t.Cleanup(srv.Close)
+
+	versions, err := Versions(context.Background(), nil, &v1alpha1.ChartInfo{Url: srv.URL, Repo: "demo"})
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.Original())
+	}
+	if want := []string{"1.4.0", "1.9.1", "1.10.0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected versions %v, got %v", want, got)
+	}
+
+	if _, err := Versions(context.Background(), nil, &v1alpha1.ChartInfo{Url: srv.URL, Repo: "missing"}); err == nil {
+		t.Fatalf("expected an error for a chart missing from the index")
+	}
+	if _, err := Versions(context.Background(), nil, &v1alpha1.ChartInfo{Url: srv.URL + "/demo-1.4.0.tgz"}); err == nil {
+		t.Fatalf("expected an error for a tgz chart")
+	}
+}
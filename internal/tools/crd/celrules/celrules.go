@@ -0,0 +1,204 @@
+// Package celrules carries CEL validation rules into the spec schema of
+// generated CRDs and compiles them the way the apiserver does.
+package celrules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel/model"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// Extension is the values schema keyword that declares the rules of a field.
+const Extension = "x-kubernetes-validations"
+
+// Rule is a CEL validation rule set on the field of the spec schema at Path.
+type Rule struct {
+	// Path is the dot separated path of the field, rooted at spec.
+	// A * segment selects the items of an array or the values of a map.
+	Path string
+	apiextensionsv1.ValidationRule
+}
+
+// Error lists the rules that cannot be set on the spec schema or do not compile.
+type Error struct {
+	Errs []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid CEL validation rules: %s", strings.Join(e.Errs, "; "))
+}
+
+// FromValuesSchema returns the rules declared with the x-kubernetes-validations extension
+// in the values schema of a chart, which the CRD generator does not carry over.
+func FromValuesSchema(specSchema []byte) ([]Rule, error) {
+	var root map[string]any
+	if err := json.Unmarshal(specSchema, &root); err != nil {
+		return nil, fmt.Errorf("error parsing values schema: %w", err)
+	}
+
+	rules := []Rule{}
+	if err := collect("spec", root, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func collect(path string, node map[string]any, rules *[]Rule) error {
+	if raw, ok := node[Extension]; ok {
+		dat, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		list := []apiextensionsv1.ValidationRule{}
+		if err := json.Unmarshal(dat, &list); err != nil {
+			return fmt.Errorf("invalid %s of %s: %w", Extension, path, err)
+		}
+		for _, el := range list {
+			*rules = append(*rules, Rule{Path: path, ValidationRule: el})
+		}
+	}
+
+	if props, ok := node["properties"].(map[string]any); ok {
+		for name, prop := range props {
+			if child, ok := prop.(map[string]any); ok {
+				if err := collect(path+"."+name, child, rules); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if child, ok := node[key].(map[string]any); ok {
+			if err := collect(path+".*", child, rules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Inject appends the rules to the spec schema of every version of the crd.
+// It returns an *Error when the path of a rule does not match a field of the schema.
+func Inject(crd *apiextensionsv1.CustomResourceDefinition, rules []Rule) error {
+	errs := []string{}
+	for i := range crd.Spec.Versions {
+		v := &crd.Spec.Versions[i]
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		for _, rule := range rules {
+			if !add(v.Schema.OpenAPIV3Schema, rule.Path, rule.ValidationRule) {
+				errs = append(errs, fmt.Sprintf("%s: no such field in version %s", rule.Path, v.Name))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &Error{Errs: errs}
+	}
+	return nil
+}
+
+// add appends the rule to the schema of the field at path. It returns false if the schema does not define the field.
+// Properties are stored by value, so each one is written back once the rule is added.
+func add(node *apiextensionsv1.JSONSchemaProps, path string, rule apiextensionsv1.ValidationRule) bool {
+	if path == "" {
+		node.XValidations = append(node.XValidations, rule)
+		return true
+	}
+	name, rest, _ := strings.Cut(path, ".")
+	if name == "*" {
+		switch {
+		case node.Items != nil && node.Items.Schema != nil:
+			return add(node.Items.Schema, rest, rule)
+		case node.AdditionalProperties != nil && node.AdditionalProperties.Schema != nil:
+			return add(node.AdditionalProperties.Schema, rest, rule)
+		}
+		return false
+	}
+
+	prop, ok := node.Properties[name]
+	if !ok || !add(&prop, rest, rule) {
+		return false
+	}
+	node.Properties[name] = prop
+	return true
+}
+
+// Compile compiles the rules of the spec schema of every version of the crd.
+// It returns an *Error listing the rules that do not compile, with the path of their field.
+func Compile(crd *apiextensionsv1.CustomResourceDefinition) error {
+	envSet := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion())
+
+	errs := []string{}
+	for _, v := range crd.Spec.Versions {
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		spec, ok := v.Schema.OpenAPIV3Schema.Properties["spec"]
+		if !ok {
+			continue
+		}
+
+		internal := &apiextensions.JSONSchemaProps{}
+		if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(&spec, internal, nil); err != nil {
+			return fmt.Errorf("error converting spec schema of version %s: %w", v.Name, err)
+		}
+		structural, err := structuralschema.NewStructural(internal)
+		if err != nil {
+			return fmt.Errorf("spec schema of version %s is not structural: %w", v.Name, err)
+		}
+		compile(fmt.Sprintf("%s: spec", v.Name), structural, envSet, &errs)
+	}
+
+	if len(errs) > 0 {
+		return &Error{Errs: errs}
+	}
+	return nil
+}
+
+func compile(path string, s *structuralschema.Structural, envSet *environment.EnvSet, errs *[]string) {
+	if s == nil {
+		return
+	}
+
+	if len(s.XValidations) > 0 {
+		results, err := cel.Compile(s, model.SchemaDeclType(s, s.XEmbeddedResource), celconfig.PerCallLimit, envSet, cel.NewExpressionsEnvLoader())
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %s", path, err))
+		}
+		for i, res := range results {
+			if strings.TrimSpace(s.XValidations[i].Rule) == "" {
+				*errs = append(*errs, fmt.Sprintf("%s: rule cannot be empty", path))
+			}
+			if res.Error != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: rule %q: %s", path, s.XValidations[i].Rule, res.Error.Detail))
+			}
+			if res.MessageExpressionError != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: messageExpression %q: %s", path, s.XValidations[i].MessageExpression, res.MessageExpressionError.Detail))
+			}
+		}
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop := s.Properties[name]
+		compile(path+"."+name, &prop, envSet, errs)
+	}
+	compile(path+".*", s.Items, envSet, errs)
+	if s.AdditionalProperties != nil {
+		compile(path+".*", s.AdditionalProperties.Structural, envSet, errs)
+	}
+}
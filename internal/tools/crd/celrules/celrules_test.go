@@ -0,0 +1,142 @@
+package celrules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func newTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"minReplicas": {Type: "integer"},
+									"maxReplicas": {Type: "integer"},
+									"ports": {Type: "array", Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+										Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+											"port": {Type: "integer"},
+										}},
+									}},
+								},
+							},
+						},
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestFromValuesSchema(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"x-kubernetes-validations": [{"rule": "self.minReplicas <= self.maxReplicas", "message": "minReplicas must not exceed maxReplicas"}],
+		"properties": {
+			"minReplicas": {"type": "integer"},
+			"ports": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"port": {"type": "integer", "x-kubernetes-validations": [{"rule": "self > 0"}]}
+					}
+				}
+			}
+		}
+	}`
+
+	rules, err := FromValuesSchema([]byte(schema))
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Path: "spec", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self.minReplicas <= self.maxReplicas", Message: "minReplicas must not exceed maxReplicas"}},
+		{Path: "spec.ports.*.port", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self > 0"}},
+	}, rules)
+
+	_, err = FromValuesSchema([]byte(`{"type": "object", "x-kubernetes-validations": "self > 0"}`))
+	assert.Error(t, err)
+}
+
+func TestInject(t *testing.T) {
+	crd := newTestCRD()
+	err := Inject(crd, []Rule{
+		{Path: "spec", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self.minReplicas <= self.maxReplicas"}},
+		{Path: "spec.ports.*.port", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self > 0"}},
+	})
+	require.NoError(t, err)
+
+	spec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+	assert.Equal(t, apiextensionsv1.ValidationRules{{Rule: "self.minReplicas <= self.maxReplicas"}}, spec.XValidations)
+	assert.Equal(t, apiextensionsv1.ValidationRules{{Rule: "self > 0"}}, spec.Properties["ports"].Items.Schema.Properties["port"].XValidations)
+
+	err = Inject(newTestCRD(), []Rule{{Path: "spec.replicas", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self > 0"}}})
+	var rulesErr *Error
+	require.ErrorAs(t, err, &rulesErr)
+	assert.Equal(t, []string{"spec.replicas: no such field in version v1-0-0"}, rulesErr.Errs)
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		// expected are the prefixes of the reported errors
+		expected []string
+	}{
+		{
+			name: "Valid rules",
+			rules: []Rule{
+				{Path: "spec", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self.minReplicas <= self.maxReplicas", MessageExpression: "'min ' + string(self.minReplicas)"}},
+				{Path: "spec.ports", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self.all(p, p.port > 0)"}},
+			},
+		},
+		{
+			name: "Unknown field",
+			rules: []Rule{
+				{Path: "spec", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self.replicas > 0"}},
+			},
+			expected: []string{"v1-0-0: spec: rule \"self.replicas > 0\": compilation failed: ERROR: <input>:1:5: undefined field 'replicas'"},
+		},
+		{
+			name: "Type mismatch in a nested field",
+			rules: []Rule{
+				{Path: "spec.ports.*.port", ValidationRule: apiextensionsv1.ValidationRule{Rule: "self == 'http'"}},
+			},
+			expected: []string{"v1-0-0: spec.ports.*.port: rule \"self == 'http'\": compilation failed: ERROR: <input>:1:6: found no matching overload for '_==_'"},
+		},
+		{
+			name: "Invalid message expression",
+			rules: []Rule{
+				{Path: "spec", ValidationRule: apiextensionsv1.ValidationRule{Rule: "true", MessageExpression: "self.minReplicas"}},
+			},
+			expected: []string{"v1-0-0: spec: messageExpression \"self.minReplicas\": messageExpression must evaluate to a string"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := newTestCRD()
+			require.NoError(t, Inject(crd, tt.rules))
+
+			err := Compile(crd)
+			if len(tt.expected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var rulesErr *Error
+			require.ErrorAs(t, err, &rulesErr)
+			require.Len(t, rulesErr.Errs, len(tt.expected))
+			for i, prefix := range tt.expected {
+				assert.True(t, strings.HasPrefix(rulesErr.Errs[i], prefix), rulesErr.Errs[i])
+			}
+		})
+	}
+}
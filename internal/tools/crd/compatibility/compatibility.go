@@ -0,0 +1,167 @@
+// Package compatibility detects breaking changes between two versions of the
+// spec schema of a generated CRD.
+package compatibility
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// ChangeType is the kind of a breaking change.
+type ChangeType string
+
+const (
+	// FieldRemoved: a field of the old schema is no longer defined.
+	FieldRemoved ChangeType = "FieldRemoved"
+	// RequiredAdded: a field became required.
+	RequiredAdded ChangeType = "RequiredAdded"
+	// TypeNarrowed: the type of a field changed to a type that does not accept all the old values.
+	TypeNarrowed ChangeType = "TypeNarrowed"
+	// EnumTightened: an enum dropped some values, or a field became an enum.
+	EnumTightened ChangeType = "EnumTightened"
+)
+
+// Change is a breaking change found at Path.
+type Change struct {
+	Path    string
+	Type    ChangeType
+	Message string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Path, c.Message)
+}
+
+// SpecSchema returns the spec schema of the given version of the crd, or nil if the version is not defined.
+func SpecSchema(crd *apiextensionsv1.CustomResourceDefinition, version string) *apiextensionsv1.JSONSchemaProps {
+	for _, v := range crd.Spec.Versions {
+		if v.Name != version {
+			continue
+		}
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			return nil
+		}
+		spec, ok := v.Schema.OpenAPIV3Schema.Properties["spec"]
+		if !ok {
+			return nil
+		}
+		return &spec
+	}
+	return nil
+}
+
+// Compare returns the breaking changes of the new spec schema with respect to the old one, sorted by path.
+// A nil schema on either side yields no changes.
+func Compare(old, new *apiextensionsv1.JSONSchemaProps) []Change {
+	changes := []Change{}
+	compare("spec", old, new, &changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func compare(path string, old, new *apiextensionsv1.JSONSchemaProps, changes *[]Change) {
+	if old == nil || new == nil {
+		return
+	}
+
+	if narrowed(old.Type, new.Type) {
+		*changes = append(*changes, Change{
+			Path:    path,
+			Type:    TypeNarrowed,
+			Message: fmt.Sprintf("type changed from %s to %s", old.Type, new.Type),
+		})
+		// Nested fields of a field of a different type are not comparable
+		return
+	}
+	if preserves(old) && !preserves(new) {
+		*changes = append(*changes, Change{
+			Path:    path,
+			Type:    TypeNarrowed,
+			Message: "unknown fields are no longer preserved",
+		})
+	}
+
+	if removed := removedEnumValues(old.Enum, new.Enum); len(new.Enum) > 0 && (len(old.Enum) == 0 || len(removed) > 0) {
+		msg := "values restricted to an enum"
+		if len(old.Enum) > 0 {
+			msg = fmt.Sprintf("enum values removed: %s", strings.Join(removed, ", "))
+		}
+		*changes = append(*changes, Change{
+			Path:    path,
+			Type:    EnumTightened,
+			Message: msg,
+		})
+	}
+
+	for _, name := range new.Required {
+		if !slices.Contains(old.Required, name) {
+			*changes = append(*changes, Change{
+				Path:    path + "." + name,
+				Type:    RequiredAdded,
+				Message: "field is now required",
+			})
+		}
+	}
+
+	for name, oldProp := range old.Properties {
+		newProp, ok := new.Properties[name]
+		if !ok {
+			if preserves(new) {
+				continue
+			}
+			*changes = append(*changes, Change{
+				Path:    path + "." + name,
+				Type:    FieldRemoved,
+				Message: "field removed",
+			})
+			continue
+		}
+		compare(path+"."+name, &oldProp, &newProp, changes)
+	}
+
+	if old.Items != nil && new.Items != nil {
+		compare(path+"[*]", old.Items.Schema, new.Items.Schema, changes)
+	}
+
+	if old.AdditionalProperties != nil && new.AdditionalProperties != nil {
+		compare(path+".*", old.AdditionalProperties.Schema, new.AdditionalProperties.Schema, changes)
+	}
+}
+
+// narrowed reports whether a field of type old may hold values rejected by type new.
+// Widening an integer to a number is allowed.
+func narrowed(old, new string) bool {
+	if old == "" || old == new {
+		return false
+	}
+	if old == "integer" && new == "number" {
+		return false
+	}
+	return true
+}
+
+func preserves(s *apiextensionsv1.JSONSchemaProps) bool {
+	return s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields
+}
+
+func removedEnumValues(old, new []apiextensionsv1.JSON) []string {
+	values := make([]string, 0, len(new))
+	for _, v := range new {
+		values = append(values, string(v.Raw))
+	}
+
+	removed := []string{}
+	for _, v := range old {
+		if !slices.Contains(values, string(v.Raw)) {
+			removed = append(removed, string(v.Raw))
+		}
+	}
+	return removed
+}
@@ -0,0 +1,115 @@
+package compatibility
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func enum(values ...string) []apiextensionsv1.JSON {
+	res := []apiextensionsv1.JSON{}
+	for _, v := range values {
+		res = append(res, apiextensionsv1.JSON{Raw: []byte(`"` + v + `"`)})
+	}
+	return res
+}
+
+func TestCompare(t *testing.T) {
+	base := func() *apiextensionsv1.JSONSchemaProps {
+		return &apiextensionsv1.JSONSchemaProps{
+			Type:     "object",
+			Required: []string{"name"},
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"name":     {Type: "string"},
+				"replicas": {Type: "integer"},
+				"tier":     {Type: "string", Enum: enum("small", "medium", "large")},
+				"ports": {Type: "array", Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+					Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"port": {Type: "integer"},
+					}},
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(s *apiextensionsv1.JSONSchemaProps)
+		expected []Change
+	}{
+		{
+			name:     "Identical schemas",
+			mutate:   func(s *apiextensionsv1.JSONSchemaProps) {},
+			expected: []Change{},
+		},
+		{
+			name: "Compatible additions",
+			mutate: func(s *apiextensionsv1.JSONSchemaProps) {
+				s.Properties["labels"] = apiextensionsv1.JSONSchemaProps{Type: "object"}
+				s.Properties["replicas"] = apiextensionsv1.JSONSchemaProps{Type: "number"}
+				s.Properties["tier"] = apiextensionsv1.JSONSchemaProps{Type: "string", Enum: enum("small", "medium", "large", "xlarge")}
+			},
+			expected: []Change{},
+		},
+		{
+			name: "Removed field",
+			mutate: func(s *apiextensionsv1.JSONSchemaProps) {
+				delete(s.Properties, "replicas")
+			},
+			expected: []Change{{Path: "spec.replicas", Type: FieldRemoved, Message: "field removed"}},
+		},
+		{
+			name: "New required field",
+			mutate: func(s *apiextensionsv1.JSONSchemaProps) {
+				s.Required = append(s.Required, "replicas")
+			},
+			expected: []Change{{Path: "spec.replicas", Type: RequiredAdded, Message: "field is now required"}},
+		},
+		{
+			name: "Narrowed nested type",
+			mutate: func(s *apiextensionsv1.JSONSchemaProps) {
+				s.Properties["ports"].Items.Schema.Properties["port"] = apiextensionsv1.JSONSchemaProps{Type: "string"}
+			},
+			expected: []Change{{Path: "spec.ports[*].port", Type: TypeNarrowed, Message: "type changed from integer to string"}},
+		},
+		{
+			name: "Tightened enums",
+			mutate: func(s *apiextensionsv1.JSONSchemaProps) {
+				s.Properties["tier"] = apiextensionsv1.JSONSchemaProps{Type: "string", Enum: enum("small", "large")}
+				s.Properties["name"] = apiextensionsv1.JSONSchemaProps{Type: "string", Enum: enum("a", "b")}
+			},
+			expected: []Change{
+				{Path: "spec.name", Type: EnumTightened, Message: "values restricted to an enum"},
+				{Path: "spec.tier", Type: EnumTightened, Message: `enum values removed: "medium"`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := base()
+			tt.mutate(updated)
+			assert.Equal(t, tt.expected, Compare(base(), updated))
+		})
+	}
+}
+
+func TestSpecSchema(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"spec": {Type: "object"},
+					}},
+				}},
+				{Name: "vacuum"},
+			},
+		},
+	}
+
+	assert.Equal(t, &apiextensionsv1.JSONSchemaProps{Type: "object"}, SpecSchema(crd, "v1-0-0"))
+	assert.Nil(t, SpecSchema(crd, "vacuum"))
+	assert.Nil(t, SpecSchema(crd, "v2-0-0"))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -134,6 +135,10 @@ type ApplyOpts struct {
 	CABundle                []byte
 	WebhookServiceNamespace string
 	WebhookServiceName      string
+	// Covered reports whether the conversion rules carry the field at path of the objects of version from to
+	// version to. When an appended version drops fields of the other versions that are not covered, the storage is
+	// held on the vacuum version so that they are not pruned. A nil Covered covers nothing.
+	Covered func(from, to, path string) bool
 }
 
 // UpdateVersion updates the given CRD to set the given version spec. If the version
@@ -181,6 +186,10 @@ func ApplyOrUpdateCRD(ctx context.Context,
 	}
 	log.Debug("Updating CRD", "gvr", gvr.String())
 
+	if crd.Spec.Scope != newcrd.Spec.Scope {
+		return gvr, fmt.Errorf("CRD %s is %s and cannot become %s: the scope of a CRD is immutable", crd.Name, crd.Spec.Scope, newcrd.Spec.Scope)
+	}
+
 	statusEqual, err := generation.StatusEqual(crd, newcrd)
 	if err != nil {
 		return gvr, fmt.Errorf("error comparing CRD status: %w", err)
@@ -192,6 +201,7 @@ func ApplyOrUpdateCRD(ctx context.Context,
 		if err != nil {
 			return gvr, fmt.Errorf("error updating CRD version: %w", err)
 		}
+		generation.SetManaged(crd)
 		err = kube.Apply(ctx, cli, crd, kube.ApplyOptions{})
 		if err != nil {
 			return gvr, fmt.Errorf("error applying CRD status update: %w", err)
@@ -212,7 +222,33 @@ func ApplyOrUpdateCRD(ctx context.Context,
 		Kind:    newcrd.Spec.Names.Kind,
 		Version: gvr.Version,
 	}) {
-		log.Debug("CRD version exists and is equal, skipping update", "crd", crd.Name, "version", gvr.Version)
+		drift := Drift(crd, newcrd, opts)
+		if len(drift) == 0 {
+			log.Debug("CRD version exists and is equal, skipping update", "crd", crd.Name, "version", gvr.Version)
+			return gvr, nil
+		}
+
+		log.Debug("CRD drifted from the chart, restoring it", "crd", crd.Name, "version", gvr.Version, "drift", drift)
+		generation.RestoreSpec(crd, newcrd)
+		if len(crd.Spec.Versions) > 1 {
+			if err := validateApplyOpts(opts); err != nil {
+				return gvr, err
+			}
+			injectConversionConfToCRD(crd, opts)
+		}
+		err = kube.Apply(ctx, cli, crd, kube.ApplyOptions{})
+		if err != nil {
+			return gvr, fmt.Errorf("error restoring CRD: %w", err)
+		}
+
+		err = watcher.NewWatcher(
+			dyn,
+			apiextensionsv1.SchemeGroupVersion.WithResource("customresourcedefinitions"),
+			1*time.Minute,
+			IsReady).WatchResource(ctx, "", crd.Name)
+		if err != nil {
+			return gvr, fmt.Errorf("error waiting for CRD to be established: %w", err)
+		}
 		return gvr, nil
 	}
 
@@ -220,19 +256,19 @@ func ApplyOrUpdateCRD(ctx context.Context,
 	if err != nil {
 		return gvr, fmt.Errorf("error appending version to CRD: %w", err)
 	}
-
-	if opts.CABundle == nil {
-		return gvr, fmt.Errorf("CA bundle is nil")
-	}
-	if opts.WebhookServiceName == "" {
-		return gvr, fmt.Errorf("webhook service name is empty")
+	if dropped := generation.DroppedFields(crd, gvr.Version, opts.Covered); len(dropped) > 0 {
+		log.Debug("New version drops fields of the other versions, holding storage on the vacuum version", "crd", crd.Name, "version", gvr.Version, "fields", dropped)
+		generation.HoldStorage(crd)
 	}
-	if opts.WebhookServiceNamespace == "" {
-		return gvr, fmt.Errorf("webhook service namespace is empty")
+	// Short names and categories may change with the chart
+	crd.Spec.Names = *newcrd.Spec.Names.DeepCopy()
+	generation.SetManaged(crd)
+
+	if err := validateApplyOpts(opts); err != nil {
+		return gvr, err
 	}
 	injectConversionConfToCRD(crd, opts)
 
-	generation.SetServedStorage(crd, gvr.Version, true, false)
 	err = kube.Apply(ctx, cli, crd, kube.ApplyOptions{})
 	if err != nil {
 		return gvr, fmt.Errorf("error setting properties on CRD: %w", err)
@@ -250,6 +286,68 @@ func ApplyOrUpdateCRD(ctx context.Context,
 	return gvr, nil
 }
 
+func validateApplyOpts(opts ApplyOpts) error {
+	if opts.CABundle == nil {
+		return fmt.Errorf("CA bundle is nil")
+	}
+	if opts.WebhookServiceName == "" {
+		return fmt.Errorf("webhook service name is empty")
+	}
+	if opts.WebhookServiceNamespace == "" {
+		return fmt.Errorf("webhook service namespace is empty")
+	}
+	return nil
+}
+
+// Drift lists the parts of the live CRD that differ from the CRD generated from the chart:
+// names, scope, schema, printer columns and subresources of the generated version and, when the
+// CRD serves more than one version, the conversion webhook configuration. The CA bundle is
+// owned by the certificate manager and is not compared.
+func Drift(live, generated *apiextensionsv1.CustomResourceDefinition, opts ApplyOpts) []string {
+	drift := generation.SpecDrift(live, generated)
+
+	if len(live.Spec.Versions) > 1 {
+		expected := &apiextensionsv1.CustomResourceDefinition{}
+		injectConversionConfToCRD(expected, opts)
+		if !conversionEqual(live.Spec.Conversion, expected.Spec.Conversion) {
+			drift = append(drift, "spec.conversion")
+		}
+	}
+
+	return drift
+}
+
+func conversionEqual(live, expected *apiextensionsv1.CustomResourceConversion) bool {
+	if live == nil || live.Strategy != expected.Strategy || live.Webhook == nil || live.Webhook.ClientConfig == nil {
+		return false
+	}
+	if !slices.Equal(live.Webhook.ConversionReviewVersions, expected.Webhook.ConversionReviewVersions) {
+		return false
+	}
+
+	ls, es := live.Webhook.ClientConfig.Service, expected.Webhook.ClientConfig.Service
+	if ls == nil {
+		return false
+	}
+	// The apiserver defaults the service port to 443
+	port := func(p *int32) int32 {
+		if p == nil {
+			return 443
+		}
+		return *p
+	}
+	path := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	return ls.Namespace == es.Namespace &&
+		ls.Name == es.Name &&
+		port(ls.Port) == port(es.Port) &&
+		path(ls.Path) == path(es.Path)
+}
+
 func injectConversionConfToCRD(crd *apiextensionsv1.CustomResourceDefinition, opts ApplyOpts) {
 	whport := int32(9443)
 	whpath := "/convert"
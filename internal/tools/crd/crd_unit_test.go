@@ -0,0 +1,95 @@
+package crd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newDriftCRD(versions ...string) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "foos.example.test"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.test",
+			Scope: apiextensionsv1.NamespaceScoped,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"},
+		},
+	}
+	for _, v := range versions {
+		crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: v, Served: true})
+	}
+	return crd
+}
+
+func TestDrift(t *testing.T) {
+	opts := ApplyOpts{
+		CABundle:                []byte("ca"),
+		WebhookServiceNamespace: "krateo-system",
+		WebhookServiceName:      "core-provider-webhook-service",
+	}
+
+	tests := []struct {
+		name     string
+		live     func() *apiextensionsv1.CustomResourceDefinition
+		expected []string
+	}{
+		{
+			name: "Single version does not need conversion",
+			live: func() *apiextensionsv1.CustomResourceDefinition {
+				return newDriftCRD("v1")
+			},
+			expected: []string{},
+		},
+		{
+			name: "Conversion in place, CA bundle and default port ignored",
+			live: func() *apiextensionsv1.CustomResourceDefinition {
+				crd := newDriftCRD("v1", "v2")
+				injectConversionConfToCRD(crd, opts)
+				crd.Spec.Conversion.Webhook.ClientConfig.CABundle = []byte("rotated")
+				return crd
+			},
+			expected: []string{},
+		},
+		{
+			name: "Missing conversion",
+			live: func() *apiextensionsv1.CustomResourceDefinition {
+				return newDriftCRD("v1", "v2")
+			},
+			expected: []string{"spec.conversion"},
+		},
+		{
+			name: "Conversion pointing to another service",
+			live: func() *apiextensionsv1.CustomResourceDefinition {
+				crd := newDriftCRD("v1", "v2")
+				injectConversionConfToCRD(crd, opts)
+				crd.Spec.Conversion.Webhook.ClientConfig.Service.Name = "other"
+				return crd
+			},
+			expected: []string{"spec.conversion"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Drift(tt.live(), newDriftCRD("v1"), opts))
+		})
+	}
+}
+
+func TestApplyOrUpdateCRDRejectsScopeChange(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+	cli := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(newDriftCRD("v1")).Build()
+
+	newcrd := newDriftCRD("v2")
+	newcrd.Spec.Scope = apiextensionsv1.ClusterScoped
+
+	_, err := ApplyOrUpdateCRD(context.Background(), cli, nil, newcrd, ApplyOpts{})
+	assert.ErrorContains(t, err, "the scope of a CRD is immutable")
+}
@@ -1,7 +1,12 @@
 package generation
 
 import (
+	stdjson "encoding/json"
 	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 
 	_ "embed"
 
@@ -9,12 +14,28 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/celrules"
 	hasher "github.com/krateoplatformops/core-provider/internal/tools/hash"
 	"github.com/krateoplatformops/plumbing/crdgen"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// VacuumVersion is the name of the permissive, never served version that
+// held storage in the CRDs generated by previous releases. HoldStorage moves
+// the storage back to it while the latest version drops fields.
+const VacuumVersion = "vacuum"
+
+// StatusOutputsField is the status property holding the status schema contributed by the chart.
+const StatusOutputsField = "outputs"
+
+// ManagedByLabel marks the CRDs generated by core-provider, with ManagedByValue as value,
+// so that they can be watched without watching every CRD of the cluster.
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "core-provider"
+)
+
 //go:embed statics/status.schema.json
 var statusJsonSchema []byte
 
@@ -45,72 +66,188 @@ func SetServedStorage(crd *apiextensionsv1.CustomResourceDefinition, version str
 	}
 }
 
-// AppendVersion appends the version of the toadd CRD to the crd CRD and sets the Storage and Served fields in the last version of the crd CRD.
+// AppendVersion appends the versions of the toadd CRD that the crd CRD does not define yet. Every version is served,
+// and the last appended one becomes the storage version: objects stored in older versions are moved to it by a
+// storage migration. The vacuum version is kept, neither served nor stored anymore, until no object is stored in it;
+// HoldStorage moves the storage back to it when the appended version drops fields of the others.
 func AppendVersion(crd apiextensionsv1.CustomResourceDefinition, toadd apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
 	for _, el2 := range toadd.Spec.Versions {
 		exist := false
-		vacuum := false
 		for _, el1 := range crd.Spec.Versions {
 			if el1.Name == el2.Name {
 				exist = true
 				break
 			}
 		}
-		for _, el1 := range crd.Spec.Versions {
-			if el1.Name == "vacuum" {
-				vacuum = true
-				break
-			}
+		if exist {
+			continue
 		}
 
-		if !exist {
-			crd.Spec.Versions = append(crd.Spec.Versions, el2)
-			if !vacuum {
-				crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
-					Name:    "vacuum",
-					Served:  false,
-					Storage: true,
-					Schema: &apiextensionsv1.CustomResourceValidation{
-						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
-							Type:        "object",
-							Description: "This is a vacuum version to storage different versions",
-							Properties: map[string]apiextensionsv1.JSONSchemaProps{
-								"apiVersion": {
-									Type:        "string",
-									Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
-								},
-								"kind": {
-									Type: "string",
-								},
-								"metadata": {
-									Type: "object",
-								},
-								"spec": {
-									Type:                   "object",
-									XPreserveUnknownFields: &[]bool{true}[0],
-								},
-								"status": {
-									Type:                   "object",
-									XPreserveUnknownFields: &[]bool{true}[0],
-								},
-							},
-						},
-					},
-				})
-			}
-			for i := range crd.Spec.Versions {
-				// if different from vacuum served: false and storage: true
-				if crd.Spec.Versions[i].Name != "vacuum" {
-					crd.Spec.Versions[i].Served = true
-					crd.Spec.Versions[i].Storage = false
-				}
-			}
+		crd.Spec.Versions = append(crd.Spec.Versions, el2)
+		for i := range crd.Spec.Versions {
+			crd.Spec.Versions[i].Served = crd.Spec.Versions[i].Name != VacuumVersion
+			crd.Spec.Versions[i].Storage = crd.Spec.Versions[i].Name == el2.Name
 		}
 	}
 
 	return &crd, nil
 }
 
+// vacuumVersion returns the vacuum version, whose schema preserves every field of spec and status.
+func vacuumVersion() apiextensionsv1.CustomResourceDefinitionVersion {
+	preserve := true
+	return apiextensionsv1.CustomResourceDefinitionVersion{
+		Name: VacuumVersion,
+		Schema: &apiextensionsv1.CustomResourceValidation{
+			OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+				Type:        "object",
+				Description: "This is a vacuum version to storage different versions",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"apiVersion": {Type: "string"},
+					"kind":       {Type: "string"},
+					"metadata":   {Type: "object"},
+					"spec":       {Type: "object", XPreserveUnknownFields: &preserve},
+					"status":     {Type: "object", XPreserveUnknownFields: &preserve},
+				},
+			},
+		},
+	}
+}
+
+// HoldStorage makes the vacuum version the storage version of the crd, adding it when the crd does not define it,
+// so that the objects are stored with every field of the version they are written in.
+func HoldStorage(crd *apiextensionsv1.CustomResourceDefinition) {
+	if !slices.ContainsFunc(crd.Spec.Versions, func(v apiextensionsv1.CustomResourceDefinitionVersion) bool {
+		return v.Name == VacuumVersion
+	}) {
+		crd.Spec.Versions = append(crd.Spec.Versions, vacuumVersion())
+	}
+	SetStorageVersion(crd, VacuumVersion)
+}
+
+// DroppedFields returns the fields of the spec that the other versions of the crd declare and version does not, as
+// "<version> <path>". The objects of the other versions lose those fields once stored in version, except the fields
+// covered reports as carried to version by the conversion rules, which are left out. A nil covered covers nothing.
+func DroppedFields(crd *apiextensionsv1.CustomResourceDefinition, version string, covered func(from, to, path string) bool) []string {
+	target := specSchema(crd, version)
+	if target == nil {
+		return nil
+	}
+
+	var res []string
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version || v.Name == VacuumVersion {
+			continue
+		}
+		src := specSchema(crd, v.Name)
+		if src == nil {
+			continue
+		}
+		for _, path := range droppedFields(src, target, "spec", nil) {
+			if covered == nil || !covered(v.Name, version, path) {
+				res = append(res, v.Name+" "+path)
+			}
+		}
+	}
+	return res
+}
+
+// specSchema returns the schema of the spec of version, nil when the crd does not define it.
+func specSchema(crd *apiextensionsv1.CustomResourceDefinition, version string) *apiextensionsv1.JSONSchemaProps {
+	for _, v := range crd.Spec.Versions {
+		if v.Name != version || v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		if spec, ok := v.Schema.OpenAPIV3Schema.Properties["spec"]; ok {
+			return &spec
+		}
+	}
+	return nil
+}
+
+// droppedFields appends to res the paths of the properties of src that dst does not declare. The properties of
+// objects preserving unknown fields, or holding additional properties, are kept and never dropped.
+func droppedFields(src, dst *apiextensionsv1.JSONSchemaProps, path string, res []string) []string {
+	if (dst.XPreserveUnknownFields != nil && *dst.XPreserveUnknownFields) ||
+		(dst.AdditionalProperties != nil && (dst.AdditionalProperties.Allows || dst.AdditionalProperties.Schema != nil)) {
+		return res
+	}
+
+	names := make([]string, 0, len(src.Properties))
+	for name := range src.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child, target := src.Properties[name], dst.Properties[name]
+		if _, ok := dst.Properties[name]; !ok {
+			res = append(res, path+"."+name)
+			continue
+		}
+		res = droppedFields(&child, &target, path+"."+name, res)
+	}
+	if src.Items != nil && src.Items.Schema != nil && dst.Items != nil && dst.Items.Schema != nil {
+		res = droppedFields(src.Items.Schema, dst.Items.Schema, path+"[]", res)
+	}
+	return res
+}
+
+// StorageVersion returns the name of the version of the crd that is persisted in etcd.
+func StorageVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// SetStorageVersion marks version as the only storage version of the crd.
+// It is a no-op if the crd does not define version.
+func SetStorageVersion(crd *apiextensionsv1.CustomResourceDefinition, version string) {
+	found := false
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	for i := range crd.Spec.Versions {
+		crd.Spec.Versions[i].Storage = crd.Spec.Versions[i].Name == version
+	}
+}
+
+// LatestVersion returns the most recently appended served version of the crd.
+// This is the version stored objects are migrated to.
+func LatestVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for i := len(crd.Spec.Versions) - 1; i >= 0; i-- {
+		v := crd.Spec.Versions[i]
+		if v.Name != VacuumVersion && v.Served {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// StorageMigrated reports whether the latest version of the crd is its storage version
+// and the only version objects are persisted in.
+func StorageMigrated(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	latest := LatestVersion(crd)
+	if latest == "" {
+		return true
+	}
+	if StorageVersion(crd) != latest {
+		return false
+	}
+	return len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == latest
+}
+
+// UpdateStatus sets the static part of the status schema of version on all the versions of the crd.
+// The outputs contributed by the chart belong to each version and are kept, except for the version itself that takes the new ones.
 func UpdateStatus(crd *apiextensionsv1.CustomResourceDefinition, version apiextensionsv1.CustomResourceDefinitionVersion) error {
 	if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
 		return fmt.Errorf("CRD %s version %s schema is nil", crd.Name, version.Name)
@@ -119,12 +256,86 @@ func UpdateStatus(crd *apiextensionsv1.CustomResourceDefinition, version apiexte
 
 	// Update the status schema for all versions
 	for i := range crd.Spec.Versions {
-		if crd.Spec.Versions[i].Schema != nil && crd.Spec.Versions[i].Schema.OpenAPIV3Schema != nil {
-			crd.Spec.Versions[i].Schema.OpenAPIV3Schema.Properties["status"] = newStatus
+		v := &crd.Spec.Versions[i]
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		status := *staticStatus(newStatus).DeepCopy()
+		outputs, ok := v.Schema.OpenAPIV3Schema.Properties["status"].Properties[StatusOutputsField]
+		if v.Name == version.Name {
+			outputs, ok = newStatus.Properties[StatusOutputsField]
+		}
+		if ok {
+			if status.Properties == nil {
+				status.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+			}
+			status.Properties[StatusOutputsField] = *outputs.DeepCopy()
 		}
+		v.Schema.OpenAPIV3Schema.Properties["status"] = status
 	}
 	return nil
 }
+
+// staticStatus returns the status schema without the outputs contributed by the chart.
+func staticStatus(status apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	if _, ok := status.Properties[StatusOutputsField]; !ok {
+		return &status
+	}
+	props := make(map[string]apiextensionsv1.JSONSchemaProps, len(status.Properties))
+	for k, v := range status.Properties {
+		if k != StatusOutputsField {
+			props[k] = v
+		}
+	}
+	status.Properties = props
+	return &status
+}
+
+// MergeStatusSchema returns the status schema of generated CRDs: the static status schema with,
+// when chartSchema is set, the object schema contributed by the chart under the outputs property.
+// Properties of the chart schema named like the fixed status fields are reported as clashes,
+// since a chart declaring them expects to override fields owned by the operator.
+func MergeStatusSchema(chartSchema []byte) ([]byte, error) {
+	if len(chartSchema) == 0 {
+		return statusJsonSchema, nil
+	}
+
+	outputs := map[string]any{}
+	if err := stdjson.Unmarshal(chartSchema, &outputs); err != nil {
+		return nil, fmt.Errorf("error parsing chart status schema: %w", err)
+	}
+	props, ok := outputs["properties"].(map[string]any)
+	if !ok || (outputs["type"] != nil && outputs["type"] != "object") {
+		return nil, fmt.Errorf("chart status schema must be an object schema with properties")
+	}
+
+	static := map[string]any{}
+	if err := stdjson.Unmarshal(statusJsonSchema, &static); err != nil {
+		return nil, fmt.Errorf("error parsing static status schema: %w", err)
+	}
+	fixed := static["properties"].(map[string]any)
+
+	clashes := []string{}
+	for name := range props {
+		if _, ok := fixed[name]; ok || name == "conditions" || name == StatusOutputsField {
+			clashes = append(clashes, name)
+		}
+	}
+	if len(clashes) > 0 {
+		sort.Strings(clashes)
+		return nil, fmt.Errorf("chart status schema declares fields owned by the operator: %s", strings.Join(clashes, ", "))
+	}
+
+	delete(outputs, "$schema")
+	delete(outputs, "$id")
+	outputs["type"] = "object"
+	if _, ok := outputs["description"]; !ok {
+		outputs["description"] = "Outputs declared by the chart"
+	}
+	fixed[StatusOutputsField] = outputs
+
+	return stdjson.Marshal(static)
+}
 func Unmarshal(dat []byte) (*apiextensionsv1.CustomResourceDefinition, error) {
 	s := json.NewYAMLSerializer(json.DefaultMetaFactory,
 		clientsetscheme.Scheme,
@@ -135,8 +346,31 @@ func Unmarshal(dat []byte) (*apiextensionsv1.CustomResourceDefinition, error) {
 	return res, err
 }
 
-func GenerateCRD(specSchema []byte, gvk schema.GroupVersionKind) (*apiextensionsv1.CustomResourceDefinition, error) {
-	bcrd, err := generateCRD(specSchema, gvk, false)
+// GenerateOpts customizes the generated CRD.
+type GenerateOpts struct {
+	// Plural overrides the plural name inferred from the kind.
+	Plural string
+	// Scope overrides the namespaced scope.
+	Scope apiextensionsv1.ResourceScope
+	// ShortNames are the short names of the CRD.
+	ShortNames []string
+	// Categories are added to the default categories.
+	Categories []string
+	// PrinterColumns are merged into the printer columns of every version:
+	// a column replaces the default column with the same name, new columns are inserted before AGE.
+	PrinterColumns []apiextensionsv1.CustomResourceColumnDefinition
+	// Validations are CEL rules added to the spec schema, after the ones of the values schema.
+	Validations []celrules.Rule
+	// StatusSchema is the status schema contributed by the chart, merged under status.outputs.
+	StatusSchema []byte
+}
+
+func GenerateCRD(specSchema []byte, gvk schema.GroupVersionKind, opts GenerateOpts) (*apiextensionsv1.CustomResourceDefinition, error) {
+	statusSchema, err := MergeStatusSchema(opts.StatusSchema)
+	if err != nil {
+		return nil, err
+	}
+	bcrd, err := generateCRD(specSchema, statusSchema, gvk, false)
 	if err != nil {
 		return nil, fmt.Errorf("error generating CRD: %w", err)
 	}
@@ -144,9 +378,71 @@ func GenerateCRD(specSchema []byte, gvk schema.GroupVersionKind) (*apiextensions
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling generated CRD: %w", err)
 	}
+	applyOpts(crd, opts)
+
+	// The x-kubernetes-validations extension of the values schema is dropped by crdgen
+	rules, err := celrules.FromValuesSchema(specSchema)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, opts.Validations...)
+	if len(rules) == 0 {
+		return crd, nil
+	}
+	if err := celrules.Inject(crd, rules); err != nil {
+		return nil, err
+	}
+	if err := celrules.Compile(crd); err != nil {
+		return nil, err
+	}
 	return crd, nil
 }
 
+// applyOpts sets the options that crdgen does not support on the generated CRD.
+func applyOpts(crd *apiextensionsv1.CustomResourceDefinition, opts GenerateOpts) {
+	SetManaged(crd)
+	if opts.Plural != "" {
+		crd.Spec.Names.Plural = opts.Plural
+		crd.Name = fmt.Sprintf("%s.%s", opts.Plural, crd.Spec.Group)
+	}
+	if opts.Scope != "" {
+		crd.Spec.Scope = opts.Scope
+	}
+	if len(opts.ShortNames) > 0 {
+		crd.Spec.Names.ShortNames = append([]string{}, opts.ShortNames...)
+	}
+	for _, el := range opts.Categories {
+		if !slices.Contains(crd.Spec.Names.Categories, el) {
+			crd.Spec.Names.Categories = append(crd.Spec.Names.Categories, el)
+		}
+	}
+	for i := range crd.Spec.Versions {
+		crd.Spec.Versions[i].AdditionalPrinterColumns = mergePrinterColumns(crd.Spec.Versions[i].AdditionalPrinterColumns, opts.PrinterColumns)
+	}
+}
+
+// mergePrinterColumns replaces the columns with the same name of the extra ones
+// and inserts the others before the AGE column, which kubectl conventionally shows last.
+func mergePrinterColumns(columns, extra []apiextensionsv1.CustomResourceColumnDefinition) []apiextensionsv1.CustomResourceColumnDefinition {
+	for _, col := range extra {
+		idx := slices.IndexFunc(columns, func(el apiextensionsv1.CustomResourceColumnDefinition) bool {
+			return el.Name == col.Name
+		})
+		if idx != -1 {
+			columns[idx] = col
+			continue
+		}
+		idx = slices.IndexFunc(columns, func(el apiextensionsv1.CustomResourceColumnDefinition) bool {
+			return el.Name == "AGE"
+		})
+		if idx == -1 {
+			idx = len(columns)
+		}
+		columns = slices.Insert(columns, idx, col)
+	}
+	return columns
+}
+
 func StatusEqual(crd1, crd2 *apiextensionsv1.CustomResourceDefinition) (bool, error) {
 	crdHasher := hasher.NewFNVObjectHash()
 	i1 := 0
@@ -165,7 +461,7 @@ func StatusEqual(crd1, crd2 *apiextensionsv1.CustomResourceDefinition) (bool, er
 	if i1 == -1 {
 		return false, fmt.Errorf("CRD %s has no version with status property", crd1.Name)
 	}
-	err := crdHasher.SumHash(crd1.Spec.Versions[i1].Schema.OpenAPIV3Schema.Properties["status"])
+	err := crdHasher.SumHash(staticStatus(crd1.Spec.Versions[i1].Schema.OpenAPIV3Schema.Properties["status"]))
 	if err != nil {
 		return false, fmt.Errorf("error hashing CRD status: %w", err)
 	}
@@ -175,7 +471,7 @@ func StatusEqual(crd1, crd2 *apiextensionsv1.CustomResourceDefinition) (bool, er
 	if i2 == -1 {
 		return false, fmt.Errorf("CRD %s has no version with status property", crd2.Name)
 	}
-	err = genCRDHasher.SumHash(crd2.Spec.Versions[i2].Schema.OpenAPIV3Schema.Properties["status"])
+	err = genCRDHasher.SumHash(staticStatus(crd2.Spec.Versions[i2].Schema.OpenAPIV3Schema.Properties["status"]))
 	if err != nil {
 		return false, fmt.Errorf("error hashing generated CRD status: %w", err)
 	}
@@ -183,6 +479,142 @@ func StatusEqual(crd1, crd2 *apiextensionsv1.CustomResourceDefinition) (bool, er
 	return crdHasher.GetHash() == genCRDHasher.GetHash(), nil
 }
 
+// SetManaged labels the crd as generated by core-provider.
+func SetManaged(crd *apiextensionsv1.CustomResourceDefinition) {
+	if crd.Labels == nil {
+		crd.Labels = map[string]string{}
+	}
+	crd.Labels[ManagedByLabel] = ManagedByValue
+}
+
+// IsManaged reports whether the crd is labeled as generated by core-provider.
+func IsManaged(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	return crd.Labels[ManagedByLabel] == ManagedByValue
+}
+
+// SpecDrift lists the parts of the live crd that differ from the crd generated from the chart.
+// Only the versions defined in generated are compared: the other versions of the live crd
+// belong to other charts. Served and storage flags are owned by the version handling and are ignored.
+func SpecDrift(live, generated *apiextensionsv1.CustomResourceDefinition) []string {
+	drift := []string{}
+
+	if IsManaged(generated) && !IsManaged(live) {
+		drift = append(drift, fmt.Sprintf("metadata.labels[%s]", ManagedByLabel))
+	}
+	if !jsonEqual(defaultedNames(live.Spec.Names), defaultedNames(generated.Spec.Names)) {
+		drift = append(drift, "spec.names")
+	}
+	if live.Spec.Scope != generated.Spec.Scope {
+		drift = append(drift, "spec.scope")
+	}
+
+	for _, gv := range generated.Spec.Versions {
+		i := versionIndex(live, gv.Name)
+		if i == -1 {
+			drift = append(drift, fmt.Sprintf("spec.versions[%s]", gv.Name))
+			continue
+		}
+		lv := live.Spec.Versions[i]
+		if !jsonEqual(lv.Schema, gv.Schema) {
+			drift = append(drift, fmt.Sprintf("spec.versions[%s].schema", gv.Name))
+		}
+		if !jsonEqual(lv.AdditionalPrinterColumns, gv.AdditionalPrinterColumns) {
+			drift = append(drift, fmt.Sprintf("spec.versions[%s].additionalPrinterColumns", gv.Name))
+		}
+		if !jsonEqual(lv.Subresources, gv.Subresources) {
+			drift = append(drift, fmt.Sprintf("spec.versions[%s].subresources", gv.Name))
+		}
+	}
+
+	return drift
+}
+
+// RestoreSpec overwrites the names, the scope and the versions defined in generated on the live crd,
+// keeping the served and storage flags of the live versions, and restores the managed label.
+func RestoreSpec(live, generated *apiextensionsv1.CustomResourceDefinition) {
+	if IsManaged(generated) {
+		SetManaged(live)
+	}
+	live.Spec.Names = *generated.Spec.Names.DeepCopy()
+	live.Spec.Scope = generated.Spec.Scope
+
+	for _, gv := range generated.Spec.Versions {
+		i := versionIndex(live, gv.Name)
+		if i == -1 {
+			continue
+		}
+		lv := &live.Spec.Versions[i]
+		lv.Schema = gv.Schema.DeepCopy()
+		lv.AdditionalPrinterColumns = nil
+		for _, c := range gv.AdditionalPrinterColumns {
+			lv.AdditionalPrinterColumns = append(lv.AdditionalPrinterColumns, *c.DeepCopy())
+		}
+		lv.Subresources = gv.Subresources.DeepCopy()
+	}
+}
+
+// defaultedNames applies the defaults the apiserver sets on the names of a crd.
+func defaultedNames(names apiextensionsv1.CustomResourceDefinitionNames) apiextensionsv1.CustomResourceDefinitionNames {
+	if names.Singular == "" {
+		names.Singular = strings.ToLower(names.Kind)
+	}
+	if names.ListKind == "" {
+		names.ListKind = names.Kind + "List"
+	}
+	return names
+}
+
+func versionIndex(crd *apiextensionsv1.CustomResourceDefinition, version string) int {
+	for i, v := range crd.Spec.Versions {
+		if v.Name == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonEqual compares the JSON representation of a and b, so that formatting differences
+// of raw JSON values (defaults, enums, examples) and the order of required fields do not count as changes.
+func jsonEqual(a, b interface{}) bool {
+	var ua, ub interface{}
+	ba, err := stdjson.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := stdjson.Marshal(b)
+	if err != nil {
+		return false
+	}
+	if err := stdjson.Unmarshal(ba, &ua); err != nil {
+		return false
+	}
+	if err := stdjson.Unmarshal(bb, &ub); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(sortRequired(ua), sortRequired(ub))
+}
+
+// sortRequired sorts the required lists of a decoded JSON schema, the generator does not guarantee their order.
+func sortRequired(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, el := range t {
+			if req, ok := el.([]interface{}); ok && k == "required" {
+				sort.SliceStable(req, func(i, j int) bool {
+					return fmt.Sprint(req[i]) < fmt.Sprint(req[j])
+				})
+				continue
+			}
+			t[k] = sortRequired(el)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = sortRequired(t[i])
+		}
+	}
+	return v
+}
+
 func GVKExists(crd *apiextensionsv1.CustomResourceDefinition, gvk schema.GroupVersionKind) bool {
 	// Check if the CRD has the given GVK
 	if crd.Spec.Group != gvk.Group {
@@ -200,8 +632,8 @@ func GVKExists(crd *apiextensionsv1.CustomResourceDefinition, gvk schema.GroupVe
 	return false
 }
 
-func GetGVRFromGeneratedCRD(specSchema []byte, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
-	bcrd, err := generateCRD(specSchema, gvk, true)
+func GetGVRFromGeneratedCRD(specSchema []byte, gvk schema.GroupVersionKind, opts GenerateOpts) (schema.GroupVersionResource, error) {
+	bcrd, err := generateCRD(specSchema, nil, gvk, true)
 	if err != nil {
 		return schema.GroupVersionResource{}, fmt.Errorf("error generating CRD for GVR fallback: %w", err)
 	}
@@ -209,6 +641,7 @@ func GetGVRFromGeneratedCRD(specSchema []byte, gvk schema.GroupVersionKind) (sch
 	if err != nil {
 		return schema.GroupVersionResource{}, fmt.Errorf("error unmarshalling generated CRD for GVR fallback: %w", err)
 	}
+	applyOpts(crd, opts)
 	gvr := schema.GroupVersionResource{
 		Group:    crd.Spec.Group,
 		Version:  crd.Spec.Versions[0].Name,
@@ -217,13 +650,7 @@ func GetGVRFromGeneratedCRD(specSchema []byte, gvk schema.GroupVersionKind) (sch
 	return gvr, nil
 }
 
-func generateCRD(specSchema []byte, gvk schema.GroupVersionKind, onlyMetadata bool) ([]byte, error) {
-	var statusSchema []byte
-	var err error
-
-	// Read static status schema
-	statusSchema = statusJsonSchema
-
+func generateCRD(specSchema, statusSchema []byte, gvk schema.GroupVersionKind, onlyMetadata bool) ([]byte, error) {
 	if onlyMetadata {
 		specSchema = []byte(emptyJsonSchema)
 		statusSchema = []byte(emptyJsonSchema)
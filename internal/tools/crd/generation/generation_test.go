@@ -1,6 +1,7 @@
 package generation
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -39,38 +40,7 @@ func TestAppendVersion(t *testing.T) {
 				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
 					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
 						{Name: "v1alpha1", Served: true, Storage: false},
-						{Name: "v1alpha2", Served: true, Storage: false},
-						{
-							Name:    "vacuum",
-							Served:  false,
-							Storage: true,
-							Schema: &apiextensionsv1.CustomResourceValidation{
-								OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
-									Type:        "object",
-									Description: "This is a vacuum version to storage different versions",
-									Properties: map[string]apiextensionsv1.JSONSchemaProps{
-										"apiVersion": {
-											Type:        "string",
-											Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
-										},
-										"kind": {
-											Type: "string",
-										},
-										"metadata": {
-											Type: "object",
-										},
-										"spec": {
-											Type:                   "object",
-											XPreserveUnknownFields: &[]bool{true}[0],
-										},
-										"status": {
-											Type:                   "object",
-											XPreserveUnknownFields: &[]bool{true}[0],
-										},
-									},
-								},
-							},
-						},
+						{Name: "v1alpha2", Served: true, Storage: true},
 					},
 				},
 			},
@@ -104,7 +74,8 @@ func TestAppendVersion(t *testing.T) {
 			crd: apiextensionsv1.CustomResourceDefinition{
 				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
 					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
-						{Name: "v1alpha1", Served: true, Storage: true},
+						{Name: "v1alpha1", Served: true, Storage: false},
+						{Name: "vacuum", Served: false, Storage: true},
 					},
 				},
 			},
@@ -119,38 +90,8 @@ func TestAppendVersion(t *testing.T) {
 				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
 					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
 						{Name: "v1alpha1", Served: true, Storage: false},
-						{Name: "v1alpha2", Served: true, Storage: false},
-						{
-							Name:    "vacuum",
-							Served:  false,
-							Storage: true,
-							Schema: &apiextensionsv1.CustomResourceValidation{
-								OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
-									Type:        "object",
-									Description: "This is a vacuum version to storage different versions",
-									Properties: map[string]apiextensionsv1.JSONSchemaProps{
-										"apiVersion": {
-											Type:        "string",
-											Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
-										},
-										"kind": {
-											Type: "string",
-										},
-										"metadata": {
-											Type: "object",
-										},
-										"spec": {
-											Type:                   "object",
-											XPreserveUnknownFields: &[]bool{true}[0],
-										},
-										"status": {
-											Type:                   "object",
-											XPreserveUnknownFields: &[]bool{true}[0],
-										},
-									},
-								},
-							},
-						},
+						{Name: "vacuum", Served: false, Storage: false},
+						{Name: "v1alpha2", Served: true, Storage: true},
 					},
 				},
 			},
@@ -305,6 +246,95 @@ func TestUpdateStatus(t *testing.T) {
 			t.Fatalf("v2 status should be updated with 'healthy'")
 		}
 	})
+
+	t.Run("chart outputs are kept by each version", func(t *testing.T) {
+		outputs := func(name string) apiextensionsv1.JSONSchemaProps {
+			return apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				name: {Type: "string"},
+			}}
+		}
+		crd := makeCRD("crd",
+			apiextensionsv1.CustomResourceDefinitionVersion{
+				Name: "v1",
+				Schema: makeSchema(map[string]apiextensionsv1.JSONSchemaProps{
+					"status": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"digest":           {Type: "string"},
+						StatusOutputsField: outputs("endpoint"),
+					}},
+				}),
+			},
+			apiextensionsv1.CustomResourceDefinitionVersion{
+				Name: "v2",
+				Schema: makeSchema(map[string]apiextensionsv1.JSONSchemaProps{
+					"status": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"digest": {Type: "string"},
+					}},
+				}),
+			},
+		)
+		newStatusVersion := apiextensionsv1.CustomResourceDefinitionVersion{
+			Name: "v2",
+			Schema: makeSchema(map[string]apiextensionsv1.JSONSchemaProps{
+				"status": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"digest":           {Type: "string"},
+					"healthy":          {Type: "boolean"},
+					StatusOutputsField: outputs("url"),
+				}},
+			}),
+		}
+
+		require.NoError(t, UpdateStatus(crd, newStatusVersion))
+
+		v1 := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["status"]
+		v2 := crd.Spec.Versions[1].Schema.OpenAPIV3Schema.Properties["status"]
+		assert.Contains(t, v1.Properties, "healthy")
+		assert.Equal(t, outputs("endpoint"), v1.Properties[StatusOutputsField])
+		assert.Contains(t, v2.Properties, "healthy")
+		assert.Equal(t, outputs("url"), v2.Properties[StatusOutputsField])
+	})
+}
+
+func TestMergeStatusSchema(t *testing.T) {
+	got, err := MergeStatusSchema(nil)
+	require.NoError(t, err)
+	assert.Equal(t, statusJsonSchema, got)
+
+	got, err = MergeStatusSchema([]byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"endpoint": {"type": "string"}}}`))
+	require.NoError(t, err)
+	merged := apiextensionsv1.JSONSchemaProps{}
+	require.NoError(t, json.Unmarshal(got, &merged))
+	assert.Contains(t, merged.Properties, "managed")
+	assert.Equal(t, apiextensionsv1.JSONSchemaProps{
+		Type:        "object",
+		Description: "Outputs declared by the chart",
+		Properties:  map[string]apiextensionsv1.JSONSchemaProps{"endpoint": {Type: "string"}},
+	}, merged.Properties[StatusOutputsField])
+
+	_, err = MergeStatusSchema([]byte(`{"properties": {"endpoint": {"type": "string"}, "digest": {"type": "string"}, "conditions": {"type": "array"}}}`))
+	assert.EqualError(t, err, "chart status schema declares fields owned by the operator: conditions, digest")
+
+	_, err = MergeStatusSchema([]byte(`{"type": "string"}`))
+	assert.Error(t, err)
+}
+
+func TestStatusEqualIgnoresOutputs(t *testing.T) {
+	withStatus := func(status apiextensionsv1.JSONSchemaProps) *apiextensionsv1.CustomResourceDefinition {
+		crd := newDriftTestCRD()
+		crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["status"] = status
+		return crd
+	}
+	live := withStatus(apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"digest":           {Type: "string"},
+		StatusOutputsField: {Type: "object"},
+	}})
+	generated := withStatus(apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"digest": {Type: "string"},
+	}})
+
+	equal, err := StatusEqual(live, generated)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Contains(t, live.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["status"].Properties, StatusOutputsField)
 }
 
 func TestSetServedStorage(t *testing.T) {
@@ -407,7 +437,7 @@ func TestGenerateCRD_Success(t *testing.T) {
 		Kind:    "Widget",
 	}
 
-	crd, err := GenerateCRD(spec, gvk)
+	crd, err := GenerateCRD(spec, gvk, GenerateOpts{})
 	if err != nil {
 		t.Fatalf("GenerateCRD returned error: %v", err)
 	}
@@ -663,7 +693,7 @@ func TestGetGVRFromGeneratedCRD_Success(t *testing.T) {
 		"type": "object"
 	}`)
 
-	gvr, err := GetGVRFromGeneratedCRD(specSchema, gvk)
+	gvr, err := GetGVRFromGeneratedCRD(specSchema, gvk, GenerateOpts{})
 	require.NoError(t, err)
 
 	// Expect group and version to match the provided GVK and resource to be the pluralized kind
@@ -677,7 +707,7 @@ func TestGetGVRFromGeneratedCRD_GenerateError(t *testing.T) {
 
 	emptyGVK := schema.GroupVersionKind{}
 
-	_, err := GetGVRFromGeneratedCRD([]byte(`{}`), emptyGVK)
+	_, err := GetGVRFromGeneratedCRD([]byte(`{}`), emptyGVK, GenerateOpts{})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -770,3 +800,313 @@ func makeSchema(props map[string]apiextensionsv1.JSONSchemaProps) *apiextensions
 		},
 	}
 }
+
+func TestAppendVersionAfterStorageMigration(t *testing.T) {
+	crd := apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true, Storage: true},
+				{Name: VacuumVersion, Served: false, Storage: false},
+			},
+		},
+	}
+	toAdd := apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-1-0"},
+			},
+		},
+	}
+
+	result, err := AppendVersion(crd, toAdd)
+	require.NoError(t, err)
+
+	assert.Equal(t, "v1-1-0", StorageVersion(result))
+	assert.Equal(t, "v1-1-0", LatestVersion(result))
+}
+
+func TestDroppedFields(t *testing.T) {
+	preserve := true
+	object := func(props map[string]apiextensionsv1.JSONSchemaProps) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{Type: "object", Properties: props}
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true, Schema: makeSchema(map[string]apiextensionsv1.JSONSchemaProps{
+					"spec": object(map[string]apiextensionsv1.JSONSchemaProps{
+						"name":    {Type: "string"},
+						"legacy":  object(map[string]apiextensionsv1.JSONSchemaProps{"a": {Type: "string"}}),
+						"service": object(map[string]apiextensionsv1.JSONSchemaProps{"port": {Type: "integer"}, "type": {Type: "string"}}),
+						"extra":   object(map[string]apiextensionsv1.JSONSchemaProps{"any": {Type: "string"}}),
+					}),
+				})},
+				{Name: "v1-1-0", Served: true, Schema: makeSchema(map[string]apiextensionsv1.JSONSchemaProps{
+					"spec": object(map[string]apiextensionsv1.JSONSchemaProps{
+						"name":    {Type: "string"},
+						"service": object(map[string]apiextensionsv1.JSONSchemaProps{"port": {Type: "integer"}}),
+						"extra":   {Type: "object", XPreserveUnknownFields: &preserve},
+					}),
+				})},
+				vacuumVersion(),
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"v1-0-0 spec.legacy", "v1-0-0 spec.service.type"}, DroppedFields(crd, "v1-1-0", nil))
+	covered := func(from, to, path string) bool { return path == "spec.legacy" }
+	assert.Equal(t, []string{"v1-0-0 spec.service.type"}, DroppedFields(crd, "v1-1-0", covered))
+	assert.Empty(t, DroppedFields(crd, "v1-0-0", nil), "the vacuum version is never compared")
+}
+
+func TestHoldStorage(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true},
+				{Name: "v1-1-0", Served: true, Storage: true},
+			},
+		},
+	}
+
+	HoldStorage(crd)
+	HoldStorage(crd)
+	require.Len(t, crd.Spec.Versions, 3)
+	assert.Equal(t, VacuumVersion, StorageVersion(crd))
+	assert.False(t, crd.Spec.Versions[2].Served)
+	assert.Equal(t, "v1-1-0", LatestVersion(crd))
+}
+
+func TestStorageMigrated(t *testing.T) {
+	versions := []apiextensionsv1.CustomResourceDefinitionVersion{
+		{Name: "v1-0-0", Served: true},
+		{Name: "v1-1-0", Served: true},
+		{Name: VacuumVersion, Served: false},
+	}
+
+	tests := []struct {
+		name           string
+		storage        string
+		storedVersions []string
+		expected       bool
+	}{
+		{
+			name:           "Stored in vacuum",
+			storage:        VacuumVersion,
+			storedVersions: []string{VacuumVersion},
+			expected:       false,
+		},
+		{
+			name:           "Storage switched, objects not rewritten",
+			storage:        "v1-1-0",
+			storedVersions: []string{VacuumVersion, "v1-1-0"},
+			expected:       false,
+		},
+		{
+			name:           "Storage in an older version",
+			storage:        "v1-0-0",
+			storedVersions: []string{"v1-0-0"},
+			expected:       false,
+		},
+		{
+			name:           "Migrated",
+			storage:        "v1-1-0",
+			storedVersions: []string{"v1-1-0"},
+			expected:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Versions: append([]apiextensionsv1.CustomResourceDefinitionVersion{}, versions...),
+				},
+				Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: tt.storedVersions},
+			}
+			SetStorageVersion(crd, tt.storage)
+
+			assert.Equal(t, tt.storage, StorageVersion(crd))
+			assert.Equal(t, "v1-1-0", LatestVersion(crd))
+			assert.Equal(t, tt.expected, StorageMigrated(crd))
+		})
+	}
+}
+
+func newDriftTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "foos.example.test",
+			Labels: map[string]string{ManagedByLabel: ManagedByValue},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.test",
+			Scope: apiextensionsv1.NamespaceScoped,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:       "Foo",
+				ListKind:   "FooList",
+				Plural:     "foos",
+				Singular:   "foo",
+				Categories: []string{"compositions", "comps"},
+			},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {
+									Type:     "object",
+									Required: []string{"a", "b"},
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										"a": {Type: "string", Default: &apiextensionsv1.JSON{Raw: []byte(`{"x": 1}`)}},
+										"b": {Type: "integer"},
+									},
+								},
+							},
+						},
+					},
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "AGE", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+					},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{Status: &apiextensionsv1.CustomResourceSubresourceStatus{}},
+				},
+			},
+		},
+	}
+}
+
+func TestSpecDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		mutate   func(live *apiextensionsv1.CustomResourceDefinition)
+		expected []string
+	}{
+		{
+			name:     "No drift",
+			mutate:   func(live *apiextensionsv1.CustomResourceDefinition) {},
+			expected: []string{},
+		},
+		{
+			name: "Formatting, required order and other versions are ignored",
+			mutate: func(live *apiextensionsv1.CustomResourceDefinition) {
+				spec := live.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+				spec.Required = []string{"b", "a"}
+				a := spec.Properties["a"]
+				a.Default = &apiextensionsv1.JSON{Raw: []byte(`{"x":1}`)}
+				spec.Properties["a"] = a
+				live.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"] = spec
+				live.Spec.Versions[0].Storage = false
+				live.Spec.Versions = append(live.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: VacuumVersion, Storage: true})
+			},
+			expected: []string{},
+		},
+		{
+			name: "Edited schema and printer columns",
+			mutate: func(live *apiextensionsv1.CustomResourceDefinition) {
+				delete(live.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties, "b")
+				live.Spec.Versions[0].AdditionalPrinterColumns = nil
+			},
+			expected: []string{"spec.versions[v1].schema", "spec.versions[v1].additionalPrinterColumns"},
+		},
+		{
+			name: "Edited names",
+			mutate: func(live *apiextensionsv1.CustomResourceDefinition) {
+				live.Spec.Names.ShortNames = []string{"f"}
+			},
+			expected: []string{"spec.names"},
+		},
+		{
+			name: "Missing managed label",
+			mutate: func(live *apiextensionsv1.CustomResourceDefinition) {
+				live.Labels = nil
+			},
+			expected: []string{"metadata.labels[app.kubernetes.io/managed-by]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := newDriftTestCRD()
+			tt.mutate(live)
+			assert.Equal(t, tt.expected, SpecDrift(live, newDriftTestCRD()))
+		})
+	}
+}
+
+func TestRestoreSpec(t *testing.T) {
+	live := newDriftTestCRD()
+	live.Labels = map[string]string{"app": "demo"}
+	live.Spec.Names.ShortNames = []string{"f"}
+	live.Spec.Versions[0].Storage = false
+	live.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"] = apiextensionsv1.JSONSchemaProps{Type: "object"}
+	live.Spec.Versions[0].AdditionalPrinterColumns = nil
+	live.Spec.Versions = append(live.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: VacuumVersion, Storage: true})
+
+	RestoreSpec(live, newDriftTestCRD())
+
+	assert.Empty(t, SpecDrift(live, newDriftTestCRD()))
+	assert.Equal(t, VacuumVersion, StorageVersion(live))
+	assert.Len(t, live.Spec.Versions, 2)
+	assert.Equal(t, map[string]string{"app": "demo", ManagedByLabel: ManagedByValue}, live.Labels)
+}
+
+func TestApplyOpts(t *testing.T) {
+	crd := newDriftTestCRD()
+
+	applyOpts(crd, GenerateOpts{})
+	assert.Equal(t, "foos.example.test", crd.Name)
+	assert.Equal(t, "foos", crd.Spec.Names.Plural)
+
+	applyOpts(crd, GenerateOpts{Plural: "foobars"})
+	assert.Equal(t, "foobars.example.test", crd.Name)
+	assert.Equal(t, "foobars", crd.Spec.Names.Plural)
+	assert.Equal(t, "foo", crd.Spec.Names.Singular)
+	assert.Equal(t, apiextensionsv1.NamespaceScoped, crd.Spec.Scope)
+
+	crd = newDriftTestCRD()
+	applyOpts(crd, GenerateOpts{Scope: apiextensionsv1.ClusterScoped})
+	assert.Equal(t, apiextensionsv1.ClusterScoped, crd.Spec.Scope)
+	assert.Equal(t, []string{"spec.scope"}, SpecDrift(newDriftTestCRD(), crd))
+}
+
+func TestApplyOptsPrinterColumns(t *testing.T) {
+	crd := newDriftTestCRD()
+	crd.Spec.Versions = append(crd.Spec.Versions, *crd.Spec.Versions[0].DeepCopy())
+	crd.Spec.Versions[1].Name = "v2"
+	for i := range crd.Spec.Versions {
+		crd.Spec.Versions[i].AdditionalPrinterColumns = []apiextensionsv1.CustomResourceColumnDefinition{
+			{Name: "READY", Type: "string", JSONPath: ".status.conditions[?(@.type=='Ready')].status"},
+			{Name: "AGE", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+		}
+	}
+
+	applyOpts(crd, GenerateOpts{
+		ShortNames: []string{"fo"},
+		Categories: []string{"comps", "apps"},
+		PrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+			{Name: "READY", Type: "boolean", JSONPath: ".status.ready"},
+			{Name: "REPLICAS", Type: "integer", JSONPath: ".spec.replicas"},
+		},
+	})
+
+	assert.Equal(t, []string{"fo"}, crd.Spec.Names.ShortNames)
+	assert.Equal(t, []string{"compositions", "comps", "apps"}, crd.Spec.Names.Categories)
+	for _, v := range crd.Spec.Versions {
+		assert.Equal(t, []apiextensionsv1.CustomResourceColumnDefinition{
+			{Name: "READY", Type: "boolean", JSONPath: ".status.ready"},
+			{Name: "REPLICAS", Type: "integer", JSONPath: ".spec.replicas"},
+			{Name: "AGE", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+		}, v.AdditionalPrinterColumns, v.Name)
+	}
+
+	live := newDriftTestCRD()
+	assert.Equal(t, []string{"spec.names", "spec.versions[v1].additionalPrinterColumns", "spec.versions[v2]"}, SpecDrift(live, crd))
+
+	RestoreSpec(live, crd)
+	live.Spec.Versions = append(live.Spec.Versions, *crd.Spec.Versions[1].DeepCopy())
+	assert.Empty(t, SpecDrift(live, crd))
+}
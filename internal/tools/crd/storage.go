@@ -0,0 +1,248 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	contexttools "github.com/krateoplatformops/core-provider/internal/tools/context"
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+	"github.com/krateoplatformops/core-provider/internal/tools/retry"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	migrationPageSize = 100
+	// migrationPagesPerCall bounds the objects MigrateStorage rewrites in a call, the next call resumes after them.
+	migrationPagesPerCall = 10
+	// maxRecordedFailures bounds the objects that could not be rewritten recorded in a MigrationResult.
+	maxRecordedFailures = 10
+)
+
+// MigrationResult reports the progress of a storage version migration.
+type MigrationResult struct {
+	// StorageVersion is the version the objects are migrated to.
+	StorageVersion string
+	// Migrated is the number of objects rewritten in the storage version.
+	Migrated int
+	// Total is the number of objects to migrate, as estimated by the apiserver from the objects left to list.
+	Total int
+	// Continue is the continue token of the list of the objects left to migrate.
+	Continue string
+	// Failed is the number of objects that could not be rewritten in the current pass over the objects.
+	Failed int
+	// Failures describes the first objects that could not be rewritten, up to maxRecordedFailures.
+	Failures []string
+	// Held lists the fields that StorageVersion drops from the other versions, as reported by
+	// generation.DroppedFields. While it is not empty the storage is held on the vacuum version
+	// and no object is migrated.
+	Held []string
+	// Done is true once every object is stored in StorageVersion and
+	// the CRD status.storedVersions has been trimmed accordingly.
+	Done bool
+}
+
+// MigrateStorage moves the storage of the CRD identified by gr to its latest served version, resuming the
+// migration whose progress is prev.
+//
+// AppendVersion makes the latest version the storage version. The apiserver picks up a new storage version
+// asynchronously, so when the storage version is not the one prev migrates to, MigrateStorage only records it and
+// objects are rewritten from the next call. CRDs whose storage version is not the latest one, as those generated by
+// previous releases, are switched over first. Objects are then read page by page and written back unchanged, which
+// makes the apiserver persist them in the storage version. A call rewrites at most migrationPagesPerCall pages and
+// returns the continue token of the next one, so a partial migration resumes where it stopped instead of starting
+// over. Once every object is rewritten, status.storedVersions is trimmed to the storage version only, and older
+// versions can then be removed from the CRD without losing data.
+//
+// An object that cannot be rewritten, for instance because an admission webhook rejects it, is recorded in Failures
+// and the migration goes on with the next ones. The storedVersions are not trimmed after a pass with failures: the
+// next call starts a new pass over the objects.
+//
+// Rewriting an object in the latest version prunes the fields its schema does not declare. While the latest version
+// drops fields of the other versions that covered does not report as carried by the conversion rules, the storage is
+// held on the vacuum version instead, and the dropped fields are returned in Held.
+func MigrateStorage(ctx context.Context, cli client.Client, dyn dynamic.Interface, gr schema.GroupResource, prev MigrationResult, covered func(from, to, path string) bool) (MigrationResult, error) {
+	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
+
+	crd, err := Get(ctx, cli, gr)
+	if err != nil {
+		return MigrationResult{}, fmt.Errorf("error getting CRD: %w", err)
+	}
+	if crd == nil {
+		return MigrationResult{}, fmt.Errorf("CRD %s not found", gr.String())
+	}
+
+	res := MigrationResult{StorageVersion: generation.LatestVersion(crd)}
+	if res.StorageVersion == "" {
+		return res, fmt.Errorf("CRD %s has no served version to migrate to", crd.Name)
+	}
+
+	if generation.StorageMigrated(crd) {
+		res.Done = true
+		return res, nil
+	}
+
+	if res.Held = generation.DroppedFields(crd, res.StorageVersion, covered); len(res.Held) > 0 {
+		if generation.StorageVersion(crd) != generation.VacuumVersion {
+			log.Debug("Latest version drops fields, holding storage on the vacuum version", "crd", crd.Name, "version", res.StorageVersion, "fields", res.Held)
+			generation.HoldStorage(crd)
+			if err := cli.Update(ctx, crd); err != nil {
+				return res, fmt.Errorf("error holding storage on the vacuum version: %w", err)
+			}
+		}
+		return res, nil
+	}
+
+	if generation.StorageVersion(crd) != res.StorageVersion {
+		log.Debug("Switching CRD storage version", "crd", crd.Name, "from", generation.StorageVersion(crd), "to", res.StorageVersion)
+		generation.SetStorageVersion(crd, res.StorageVersion)
+		if err := cli.Update(ctx, crd); err != nil {
+			return res, fmt.Errorf("error setting storage version on CRD: %w", err)
+		}
+		return res, nil
+	}
+	if prev.StorageVersion != res.StorageVersion {
+		return res, nil
+	}
+
+	gvr := gr.WithVersion(res.StorageVersion)
+	opts := metav1.ListOptions{Limit: migrationPageSize}
+	if prev.Continue != "" {
+		res.Migrated, res.Total, res.Continue = prev.Migrated, prev.Total, prev.Continue
+		res.Failed, res.Failures = prev.Failed, slices.Clone(prev.Failures)
+		opts.Continue = prev.Continue
+	}
+	for pages := 0; ; {
+		if pages == migrationPagesPerCall {
+			log.Debug("Stored objects partially migrated", "gvr", gvr.String(), "migrated", res.Migrated)
+			return res, nil
+		}
+
+		ul, err := dyn.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, opts)
+		if apierrors.IsResourceExpired(err) && opts.Continue != "" {
+			// The continue token expired: objects are listed again from the start, rewriting them again is harmless.
+			log.Debug("Storage migration continue token expired, restarting", "gvr", gvr.String())
+			res.Migrated, res.Total, res.Continue, opts.Continue = 0, 0, "", ""
+			res.Failed, res.Failures = 0, nil
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("error listing objects to migrate: %w", err)
+		}
+
+		for i := range ul.Items {
+			err := rewriteObject(ctx, dyn, gvr, &ul.Items[i])
+			if err == nil {
+				res.Migrated++
+				continue
+			}
+			if ctx.Err() != nil {
+				return res, err
+			}
+			log.Debug("Stored object not migrated", "gvr", gvr.String(), "error", err)
+			res.Failed++
+			if len(res.Failures) < maxRecordedFailures {
+				res.Failures = append(res.Failures, err.Error())
+			}
+		}
+		res.Total = res.Migrated + res.Failed
+		if left := ul.GetRemainingItemCount(); left != nil {
+			res.Total += int(*left)
+		}
+		res.Continue = ul.GetContinue()
+		pages++
+
+		if res.Continue == "" {
+			break
+		}
+		opts.Continue = res.Continue
+	}
+	log.Debug("Stored objects migrated", "gvr", gvr.String(), "migrated", res.Migrated, "failed", res.Failed)
+	if res.Failed > 0 {
+		return res, nil
+	}
+
+	if err := setStoredVersions(ctx, cli, crd.Name, res.StorageVersion); err != nil {
+		return res, err
+	}
+	res.Done = true
+
+	return res, nil
+}
+
+// rewriteObject writes the object back unchanged so that it is persisted in the storage version.
+// The listed object is written first, and read again when it changed since it was listed.
+func rewriteObject(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	namespace, name := obj.GetNamespace(), obj.GetName()
+	u := obj
+	_, err := retry.Do[struct{}](ctx, retry.Config[struct{}]{
+		Attempts:     crdRetryAttempts,
+		InitialDelay: crdRetryInitialDelay,
+		MaximumDelay: crdRetryMaximumDelay,
+		Retryable:    isRetryableMigrationError,
+	}, func(context.Context) (struct{}, error) {
+		if u == nil {
+			var err error
+			u, err = dyn.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return struct{}{}, nil
+			}
+			if err != nil {
+				return struct{}{}, err
+			}
+		}
+
+		_, err := dyn.Resource(gvr).Namespace(namespace).Update(ctx, u, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			return struct{}{}, nil
+		}
+		if err != nil {
+			u = nil
+		}
+		return struct{}{}, err
+	})
+	if err != nil {
+		return fmt.Errorf("error migrating %s %s/%s: %w", gvr.Resource, namespace, name, err)
+	}
+	return nil
+}
+
+// setStoredVersions trims the CRD status.storedVersions to the given version.
+func setStoredVersions(ctx context.Context, cli client.Client, name, version string) error {
+	_, err := retry.Do[struct{}](ctx, retry.Config[struct{}]{
+		Attempts:     crdRetryAttempts,
+		InitialDelay: crdRetryInitialDelay,
+		MaximumDelay: crdRetryMaximumDelay,
+		Retryable:    isRetryableMigrationError,
+	}, func(context.Context) (struct{}, error) {
+		crd := apiextensionsv1.CustomResourceDefinition{}
+		if err := cli.Get(ctx, client.ObjectKey{Name: name}, &crd); err != nil {
+			return struct{}{}, err
+		}
+		if generation.StorageVersion(&crd) != version {
+			return struct{}{}, fmt.Errorf("storage version of CRD %s changed during migration", name)
+		}
+
+		crd.Status.StoredVersions = []string{version}
+		return struct{}{}, cli.Status().Update(ctx, &crd)
+	})
+	if err != nil {
+		return fmt.Errorf("error updating CRD stored versions: %w", err)
+	}
+	return nil
+}
+
+func isRetryableMigrationError(err error) bool {
+	if !isRetryableCRDError(err) {
+		return false
+	}
+
+	return !apierrors.IsForbidden(err) && !apierrors.IsUnauthorized(err) && !apierrors.IsInvalid(err)
+}
@@ -0,0 +1,368 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/krateoplatformops/core-provider/internal/tools/crd/generation"
+)
+
+func newStorageTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "examples.composition.krateo.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "composition.krateo.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Example", ListKind: "ExampleList", Plural: "examples", Singular: "example"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1-0-0", Served: true},
+				{Name: "v1-1-0", Served: true},
+				{Name: generation.VacuumVersion, Served: false, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: []string{generation.VacuumVersion},
+		},
+	}
+}
+
+func newStorageTestComposition(namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("composition.krateo.io/v1-1-0")
+	u.SetKind("Example")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func TestMigrateStorage(t *testing.T) {
+	require.NoError(t, registerEventually())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	crd := newStorageTestCRD()
+	cli := fakeclient.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd).
+		WithStatusSubresource(crd).
+		Build()
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-1-0", Resource: "examples"}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ExampleList"},
+		newStorageTestComposition("demo", "first"),
+		newStorageTestComposition("other", "second"),
+	)
+
+	ctx := context.Background()
+	gr := gvr.GroupResource()
+
+	// First call switches the storage version only
+	res, err := MigrateStorage(ctx, cli, dyn, gr, MigrationResult{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v1-1-0", res.StorageVersion)
+	assert.False(t, res.Done)
+	assert.Zero(t, res.Total)
+
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, "v1-1-0", generation.StorageVersion(got))
+	assert.Equal(t, []string{generation.VacuumVersion}, got.Status.StoredVersions)
+
+	// Second call rewrites the stored objects and trims the stored versions
+	res, err = MigrateStorage(ctx, cli, dyn, gr, res, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Done)
+	assert.Equal(t, 2, res.Total)
+	assert.Equal(t, 2, res.Migrated)
+
+	updates := 0
+	for _, a := range dyn.Actions() {
+		if a.GetVerb() == "update" {
+			updates++
+		}
+	}
+	assert.Equal(t, 2, updates)
+
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, []string{"v1-1-0"}, got.Status.StoredVersions)
+	assert.True(t, generation.StorageMigrated(got))
+
+	// Once migrated, nothing is rewritten
+	dyn.ClearActions()
+	res, err = MigrateStorage(ctx, cli, dyn, gr, res, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Done)
+	assert.Empty(t, dyn.Actions())
+}
+
+// pagedDynamicClient lists the objects of any resource with list, the fake dynamic client ignoring continue tokens.
+type pagedDynamicClient struct {
+	*dynamicfake.FakeDynamicClient
+	list func(opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}
+
+func (c *pagedDynamicClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return pagedResource{NamespaceableResourceInterface: c.FakeDynamicClient.Resource(gvr), list: c.list}
+}
+
+type pagedResource struct {
+	dynamic.NamespaceableResourceInterface
+	list func(opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}
+
+func (r pagedResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return pagedNamespacedResource{ResourceInterface: r.NamespaceableResourceInterface.Namespace(namespace), list: r.list}
+}
+
+type pagedNamespacedResource struct {
+	dynamic.ResourceInterface
+	list func(opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}
+
+func (r pagedNamespacedResource) List(_ context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return r.list(opts)
+}
+
+func TestMigrateStorageResumes(t *testing.T) {
+	require.NoError(t, registerEventually())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	// The storage version is set on the latest version as it is appended
+	crd := newStorageTestCRD()
+	generation.SetStorageVersion(crd, "v1-1-0")
+	crd.Status.StoredVersions = []string{generation.VacuumVersion, "v1-1-0"}
+	cli := fakeclient.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd).
+		WithStatusSubresource(crd).
+		Build()
+
+	const objects = 2*migrationPagesPerCall + 5
+	items := make([]runtime.Object, 0, objects)
+	for i := 0; i < objects; i++ {
+		items = append(items, newStorageTestComposition("demo", fmt.Sprintf("comp-%d", i)))
+	}
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-1-0", Resource: "examples"}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ExampleList"}, items...)
+
+	// Objects are listed one per page, the continue token being the index of the next one
+	expired := false
+	paged := &pagedDynamicClient{FakeDynamicClient: dyn, list: func(opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+		if opts.Continue == "expired" {
+			expired = true
+			return nil, apierrors.NewResourceExpired("the continue token expired")
+		}
+		i := 0
+		if opts.Continue != "" {
+			i, _ = strconv.Atoi(opts.Continue)
+		}
+		list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*items[i].(*unstructured.Unstructured)}}
+		if i+1 < objects {
+			list.SetContinue(strconv.Itoa(i + 1))
+			left := int64(objects - i - 1)
+			list.SetRemainingItemCount(&left)
+		}
+		return list, nil
+	}}
+
+	ctx := context.Background()
+	gr := gvr.GroupResource()
+
+	// A new storage version is only recorded, the apiserver may not persist objects in it yet
+	res, err := MigrateStorage(ctx, cli, paged, gr, MigrationResult{StorageVersion: "v1-0-0"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{StorageVersion: "v1-1-0"}, res)
+	assert.Empty(t, dyn.Actions())
+
+	// Each call rewrites a bounded number of pages and resumes from the previous one
+	res, err = MigrateStorage(ctx, cli, paged, gr, res, nil)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{StorageVersion: "v1-1-0", Migrated: migrationPagesPerCall, Total: objects, Continue: strconv.Itoa(migrationPagesPerCall)}, res)
+
+	res, err = MigrateStorage(ctx, cli, paged, gr, res, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2*migrationPagesPerCall, res.Migrated)
+	assert.False(t, res.Done)
+
+	res, err = MigrateStorage(ctx, cli, paged, gr, res, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Done)
+	assert.Equal(t, objects, res.Migrated)
+	assert.Equal(t, objects, res.Total)
+	assert.Empty(t, res.Continue)
+
+	updates := 0
+	for _, a := range dyn.Actions() {
+		if a.GetVerb() == "update" {
+			updates++
+		}
+	}
+	assert.Equal(t, objects, updates)
+
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, []string{"v1-1-0"}, got.Status.StoredVersions)
+
+	// An expired continue token restarts the migration from the first object
+	got.Status.StoredVersions = []string{generation.VacuumVersion, "v1-1-0"}
+	require.NoError(t, cli.Status().Update(ctx, got))
+	res, err = MigrateStorage(ctx, cli, paged, gr, MigrationResult{StorageVersion: "v1-1-0", Migrated: 3, Total: 3, Continue: "expired"}, nil)
+	require.NoError(t, err)
+	assert.True(t, expired)
+	assert.Equal(t, migrationPagesPerCall, res.Migrated)
+	assert.Equal(t, strconv.Itoa(migrationPagesPerCall), res.Continue)
+}
+
+func TestMigrateStorageRecordsRejectedObjects(t *testing.T) {
+	require.NoError(t, registerEventually())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	crd := newStorageTestCRD()
+	generation.SetStorageVersion(crd, "v1-1-0")
+	crd.Status.StoredVersions = []string{generation.VacuumVersion, "v1-1-0"}
+	cli := fakeclient.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd).
+		WithStatusSubresource(crd).
+		Build()
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-1-0", Resource: "examples"}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ExampleList"},
+		newStorageTestComposition("demo", "first"),
+		newStorageTestComposition("demo", "second"),
+		newStorageTestComposition("other", "third"),
+	)
+
+	// An admission webhook rejects the rewrite of a single object
+	rejected := true
+	dyn.PrependReactor("update", "examples", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+		if rejected && obj.GetName() == "second" {
+			return true, nil, apierrors.NewForbidden(gvr.GroupResource(), obj.GetName(), fmt.Errorf("admission webhook denied the request"))
+		}
+		return false, nil, nil
+	})
+
+	ctx := context.Background()
+	gr := gvr.GroupResource()
+
+	// The other objects are still migrated, the stored versions are not trimmed
+	res, err := MigrateStorage(ctx, cli, dyn, gr, MigrationResult{StorageVersion: "v1-1-0"}, nil)
+	require.NoError(t, err)
+	assert.False(t, res.Done)
+	assert.Equal(t, 2, res.Migrated)
+	assert.Equal(t, 1, res.Failed)
+	assert.Equal(t, 3, res.Total)
+	assert.Empty(t, res.Continue)
+	require.Len(t, res.Failures, 1)
+	assert.Contains(t, res.Failures[0], "demo/second")
+
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, []string{generation.VacuumVersion, "v1-1-0"}, got.Status.StoredVersions)
+
+	// Once the object is accepted, the next pass completes the migration
+	rejected = false
+	res, err = MigrateStorage(ctx, cli, dyn, gr, res, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Done)
+	assert.Equal(t, 3, res.Migrated)
+	assert.Zero(t, res.Failed)
+	assert.Empty(t, res.Failures)
+
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, []string{"v1-1-0"}, got.Status.StoredVersions)
+}
+
+func TestMigrateStorageHeldOnDroppedFields(t *testing.T) {
+	require.NoError(t, registerEventually())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	specOf := func(names ...string) *apiextensionsv1.CustomResourceValidation {
+		spec := apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{}}
+		for _, el := range names {
+			spec.Properties[el] = apiextensionsv1.JSONSchemaProps{Type: "string"}
+		}
+		return &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": spec},
+		}}
+	}
+	crd := newStorageTestCRD()
+	crd.Spec.Versions = []apiextensionsv1.CustomResourceDefinitionVersion{
+		{Name: "v1-0-0", Served: true, Storage: true, Schema: specOf("name", "legacy")},
+		{Name: "v1-1-0", Served: true, Schema: specOf("name")},
+	}
+	crd.Status.StoredVersions = []string{"v1-0-0"}
+	cli := fakeclient.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd).
+		WithStatusSubresource(crd).
+		Build()
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-1-0", Resource: "examples"}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ExampleList"}, newStorageTestComposition("demo", "first"))
+	ctx := context.Background()
+
+	// The fields dropped by the latest version hold the storage on the vacuum version
+	res, err := MigrateStorage(ctx, cli, dyn, gvr.GroupResource(), MigrationResult{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1-0-0 spec.legacy"}, res.Held)
+	assert.False(t, res.Done)
+	assert.Empty(t, dyn.Actions())
+
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, generation.VacuumVersion, generation.StorageVersion(got))
+	assert.Equal(t, "v1-1-0", generation.LatestVersion(got))
+
+	// Once the conversion rules carry them, the storage moves to the latest version
+	covered := func(from, to, path string) bool {
+		return from == "v1-0-0" && to == "v1-1-0" && path == "spec.legacy"
+	}
+	res, err = MigrateStorage(ctx, cli, dyn, gvr.GroupResource(), res, covered)
+	require.NoError(t, err)
+	assert.Empty(t, res.Held)
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(crd), got))
+	assert.Equal(t, "v1-1-0", generation.StorageVersion(got))
+}
+
+func TestMigrateStorageCRDNotFound(t *testing.T) {
+	require.NoError(t, registerEventually())
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	cli := fakeclient.NewClientBuilder().WithScheme(scheme).Build()
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	_, err := MigrateStorage(context.Background(), cli, dyn, schema.GroupResource{Group: "composition.krateo.io", Resource: "examples"}, MigrationResult{}, nil)
+	assert.Error(t, err)
+}
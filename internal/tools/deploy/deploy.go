@@ -23,6 +23,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
@@ -55,6 +56,8 @@ type UndeployOptions struct {
 	ConfigmapTemplatePath  string
 	JsonSchemaTemplatePath string
 	JsonSchemaBytes        []byte
+	// Scope is the scope of the composition CRD, rendered in the templates as .scope. Namespaced when not set
+	Scope apiextensionsv1.ResourceScope
 }
 
 type DeployOptions struct {
@@ -70,6 +73,8 @@ type DeployOptions struct {
 	JsonSchemaTemplatePath string
 	ServiceTemplatePath    string
 	JsonSchemaBytes        []byte
+	// Scope is the scope of the composition CRD, rendered in the templates as .scope. Namespaced when not set
+	Scope apiextensionsv1.ResourceScope
 	// DryRunServer is used to determine if the deployment should be applied in dry-run mode. This is ignored in lookup mode
 	DryRunServer bool
 }
@@ -78,33 +83,40 @@ func resourceNamer(resourceName string, chartVersion string) string {
 	return fmt.Sprintf("%s-%s", resourceName, chartVersion)
 }
 
-func createRBACResources(gvr schema.GroupVersionResource, rbacNSName types.NamespacedName, rbacFolderPath string) (corev1.ServiceAccount, rbacv1.ClusterRole, rbacv1.ClusterRoleBinding, rbacv1.Role, rbacv1.RoleBinding, error) {
+func scopeValue(scope apiextensionsv1.ResourceScope) string {
+	if scope == "" {
+		return string(apiextensionsv1.NamespaceScoped)
+	}
+	return string(scope)
+}
+
+func createRBACResources(gvr schema.GroupVersionResource, rbacNSName types.NamespacedName, rbacFolderPath string, scope apiextensionsv1.ResourceScope) (corev1.ServiceAccount, rbacv1.ClusterRole, rbacv1.ClusterRoleBinding, rbacv1.Role, rbacv1.RoleBinding, error) {
 	sa := corev1.ServiceAccount{}
-	err := objects.CreateK8sObject(&sa, gvr, rbacNSName, filepath.Join(rbacFolderPath, "serviceaccount.yaml"))
+	err := objects.CreateK8sObject(&sa, gvr, rbacNSName, filepath.Join(rbacFolderPath, "serviceaccount.yaml"), "scope", scopeValue(scope))
 	if err != nil {
 		return corev1.ServiceAccount{}, rbacv1.ClusterRole{}, rbacv1.ClusterRoleBinding{}, rbacv1.Role{}, rbacv1.RoleBinding{}, err
 	}
 
 	clusterrole := rbacv1.ClusterRole{}
-	err = objects.CreateK8sObject(&clusterrole, gvr, rbacNSName, filepath.Join(rbacFolderPath, "clusterrole.yaml"))
+	err = objects.CreateK8sObject(&clusterrole, gvr, rbacNSName, filepath.Join(rbacFolderPath, "clusterrole.yaml"), "scope", scopeValue(scope))
 	if err != nil {
 		return corev1.ServiceAccount{}, rbacv1.ClusterRole{}, rbacv1.ClusterRoleBinding{}, rbacv1.Role{}, rbacv1.RoleBinding{}, err
 	}
 
 	clusterrolebinding := rbacv1.ClusterRoleBinding{}
-	err = objects.CreateK8sObject(&clusterrolebinding, gvr, rbacNSName, filepath.Join(rbacFolderPath, "clusterrolebinding.yaml"), "serviceAccount", sa.Name, "saNamespace", sa.Namespace)
+	err = objects.CreateK8sObject(&clusterrolebinding, gvr, rbacNSName, filepath.Join(rbacFolderPath, "clusterrolebinding.yaml"), "serviceAccount", sa.Name, "saNamespace", sa.Namespace, "scope", scopeValue(scope))
 	if err != nil {
 		return corev1.ServiceAccount{}, rbacv1.ClusterRole{}, rbacv1.ClusterRoleBinding{}, rbacv1.Role{}, rbacv1.RoleBinding{}, err
 	}
 
 	role := rbacv1.Role{}
-	err = objects.CreateK8sObject(&role, gvr, rbacNSName, filepath.Join(rbacFolderPath, "compositiondefinition-role.yaml"))
+	err = objects.CreateK8sObject(&role, gvr, rbacNSName, filepath.Join(rbacFolderPath, "compositiondefinition-role.yaml"), "scope", scopeValue(scope))
 	if err != nil {
 		return corev1.ServiceAccount{}, rbacv1.ClusterRole{}, rbacv1.ClusterRoleBinding{}, rbacv1.Role{}, rbacv1.RoleBinding{}, err
 	}
 
 	rolebinding := rbacv1.RoleBinding{}
-	err = objects.CreateK8sObject(&rolebinding, gvr, rbacNSName, filepath.Join(rbacFolderPath, "compositiondefinition-rolebinding.yaml"), "serviceAccount", sa.Name, "saNamespace", sa.Namespace)
+	err = objects.CreateK8sObject(&rolebinding, gvr, rbacNSName, filepath.Join(rbacFolderPath, "compositiondefinition-rolebinding.yaml"), "serviceAccount", sa.Name, "saNamespace", sa.Namespace, "scope", scopeValue(scope))
 	if err != nil {
 		return corev1.ServiceAccount{}, rbacv1.ClusterRole{}, rbacv1.ClusterRoleBinding{}, rbacv1.Role{}, rbacv1.RoleBinding{}, err
 	}
@@ -316,24 +328,19 @@ func Deploy(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 
 	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
 
-	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath)
+	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Scope)
 	if err != nil {
 		return "", err
 	}
 
 	hsh := hasher.NewFNVObjectHash()
-	if opts.Spec.Credentials != nil {
-		role := rbacv1.Role{}
-		err = objects.CreateK8sObject(&role,
-			opts.GVR,
-			getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}),
-			filepath.Join(opts.RBACFolderPath, "secret-role.yaml"),
-			"secretName", opts.Spec.Credentials.PasswordRef.Name)
-		if err != nil {
-			log.Error(err, "creating role")
-			return "", err
-		}
-
+	secretRoles, secretRolebindings, err := createSecretRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Spec, sa)
+	if err != nil {
+		log.Error(err, "creating secret roles")
+		return "", err
+	}
+	for i := range secretRoles {
+		role, rolebinding := secretRoles[i], secretRolebindings[i]
 		err = kubecli.Apply(ctx, kube, &role, applyOpts)
 		if err != nil {
 			log.Error(err, "installing role")
@@ -346,18 +353,6 @@ func Deploy(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 
 		log.Debug("Role successfully hashed", "gvr", opts.GVR.String(), "name", role.Name, "namespace", role.Namespace, "digest", hsh.GetHash())
 
-		rolebinding := rbacv1.RoleBinding{}
-		err := objects.CreateK8sObject(&rolebinding,
-			opts.GVR,
-			getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}),
-			filepath.Join(opts.RBACFolderPath, "secret-rolebinding.yaml"),
-			"serviceAccount", sa.Name,
-			"saNamespace", sa.Namespace)
-		if err != nil {
-			log.Error(err, "creating rolebinding")
-			return "", err
-		}
-
 		err = kubecli.Apply(ctx, kube, &rolebinding, applyOpts)
 		if err != nil {
 			log.Error(err, "installing rolebinding")
@@ -416,7 +411,8 @@ func Deploy(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 		opts.GVR,
 		getCDCDeploymentNN(namespacedName),
 		opts.DeploymentTemplatePath,
-		"serviceAccountName", sa.Name)
+		"serviceAccountName", sa.Name,
+		"scope", scopeValue(opts.Scope))
 	if err != nil {
 		return "", err
 	}
@@ -495,7 +491,7 @@ func Undeploy(ctx context.Context, kube client.Client, opts UndeployOptions) err
 
 	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
 
-	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath)
+	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Scope)
 	if err != nil {
 		return err
 	}
@@ -520,7 +516,8 @@ func Undeploy(ctx context.Context, kube client.Client, opts UndeployOptions) err
 		opts.GVR,
 		getCDCDeploymentNN(namespacedName),
 		opts.DeploymentTemplatePath,
-		"serviceAccountName", sa.Name)
+		"serviceAccountName", sa.Name,
+		"scope", scopeValue(opts.Scope))
 	if err != nil {
 		return err
 	}
@@ -569,14 +566,13 @@ func Undeploy(ctx context.Context, kube client.Client, opts UndeployOptions) err
 		log.Debug("Service successfully uninstalled", "gvr", opts.GVR.String(), "name", svc.Name, "namespace", svc.Namespace)
 	}
 
-	if opts.Spec.Credentials != nil {
-		role := rbacv1.Role{}
-		err = objects.CreateK8sObject(&role, opts.GVR, getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}), filepath.Join(opts.RBACFolderPath, "secret-role.yaml"), "secretName", opts.Spec.Credentials.PasswordRef.Name)
-		if err != nil {
-			log.Error(err, "creating role")
-			return err
-		}
-
+	secretRoles, secretRolebindings, err := createSecretRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Spec, corev1.ServiceAccount{})
+	if err != nil {
+		log.Error(err, "creating secret roles")
+		return err
+	}
+	for i := range secretRoles {
+		role, rolebinding := secretRoles[i], secretRolebindings[i]
 		err = kubecli.Uninstall(ctx, opts.KubeClient, &role, kubecli.UninstallOptions{})
 		if err != nil {
 			log.Error(err, "uninstalling role")
@@ -584,13 +580,6 @@ func Undeploy(ctx context.Context, kube client.Client, opts UndeployOptions) err
 		}
 		log.Debug("Role successfully uninstalled", "gvr", opts.GVR.String(), "name", role.Name, "namespace", role.Namespace)
 
-		rolebinding := rbacv1.RoleBinding{}
-		err = objects.CreateK8sObject(&rolebinding, opts.GVR, getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}), filepath.Join(opts.RBACFolderPath, "secret-rolebinding.yaml"))
-		if err != nil {
-			log.Error(err, "creating rolebinding")
-			return err
-		}
-
 		err = kubecli.Uninstall(ctx, opts.KubeClient, &rolebinding, kubecli.UninstallOptions{})
 		if err != nil {
 			log.Error(err, "uninstalling rolebinding")
@@ -623,20 +612,19 @@ func Lookup(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 
 	log := contexttools.LoggerFromCtx(ctx, logging.NewNopLogger())
 
-	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath)
+	sa, clusterrole, clusterrolebinding, role, rolebinding, err := createRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Scope)
 	if err != nil {
 		return "", err
 	}
 
 	hsh := hasher.NewFNVObjectHash()
-	if opts.Spec.Credentials != nil {
-		role := rbacv1.Role{}
-		err = objects.CreateK8sObject(&role, opts.GVR, getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}), filepath.Join(opts.RBACFolderPath, "secret-role.yaml"), "secretName", opts.Spec.Credentials.PasswordRef.Name)
-		if err != nil {
-			log.Error(err, "creating role")
-			return "", err
-		}
-
+	secretRoles, secretRolebindings, err := createSecretRBACResources(opts.GVR, getCDCrbacNN(namespacedName), opts.RBACFolderPath, opts.Spec, sa)
+	if err != nil {
+		log.Error(err, "creating secret roles")
+		return "", err
+	}
+	for i := range secretRoles {
+		role, rolebinding := secretRoles[i], secretRolebindings[i]
 		err = kubecli.Get(ctx, kube, &role)
 		if err != nil {
 			log.Error(err, "fetching role")
@@ -648,13 +636,6 @@ func Lookup(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 		}
 		log.Debug("Role successfully fetched", "gvr", opts.GVR.String(), "name", role.Name, "namespace", role.Namespace, "digest", hsh.GetHash())
 
-		rolebinding := rbacv1.RoleBinding{}
-		err = objects.CreateK8sObject(&rolebinding, opts.GVR, getCDCrbacNN(types.NamespacedName{Namespace: opts.Spec.Credentials.PasswordRef.Namespace, Name: namespacedName.Name}), filepath.Join(opts.RBACFolderPath, "secret-rolebinding.yaml"), "serviceAccount", sa.Name, "saNamespace", sa.Namespace)
-		if err != nil {
-			log.Error(err, "creating rolebinding")
-			return "", err
-		}
-
 		err = kubecli.Get(ctx, kube, &rolebinding)
 		if err != nil {
 			log.Error(err, "fetching rolebinding")
@@ -724,7 +705,8 @@ func Lookup(ctx context.Context, kube client.Client, opts DeployOptions) (digest
 		opts.GVR,
 		getCDCDeploymentNN(namespacedName),
 		opts.DeploymentTemplatePath,
-		"serviceAccountName", sa.Name)
+		"serviceAccountName", sa.Name,
+		"scope", scopeValue(opts.Scope))
 	if err != nil {
 		return "", err
 	}
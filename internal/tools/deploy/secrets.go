@@ -0,0 +1,98 @@
+package deploy
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	definitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	"github.com/krateoplatformops/core-provider/internal/tools/objects"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// secretRefs returns the names of the secrets referenced by the chart source, by namespace.
+func secretRefs(nfo *definitionsv1alpha1.ChartInfo) map[string][]string {
+	refs := map[string][]string{}
+	add := func(namespace, name string) {
+		if name != "" && !slices.Contains(refs[namespace], name) {
+			refs[namespace] = append(refs[namespace], name)
+		}
+	}
+	if nfo == nil {
+		return refs
+	}
+	if rest, ok := strings.CutPrefix(nfo.Url, "secret://"); ok {
+		// The chart archive itself is stored in a secret://<namespace>/<name>/<key> Secret.
+		if parts := strings.Split(rest, "/"); len(parts) == 3 {
+			add(parts[0], parts[1])
+		}
+	}
+	if nfo.Credentials != nil {
+		add(nfo.Credentials.PasswordRef.Namespace, nfo.Credentials.PasswordRef.Name)
+	}
+	if nfo.BearerTokenRef != nil {
+		add(nfo.BearerTokenRef.Namespace, nfo.BearerTokenRef.Name)
+	}
+	if nfo.PullSecretRef != nil {
+		add(nfo.PullSecretRef.Namespace, nfo.PullSecretRef.Name)
+	}
+	if nfo.TLS != nil {
+		if nfo.TLS.ClientCertificateRef != nil {
+			add(nfo.TLS.ClientCertificateRef.Namespace, nfo.TLS.ClientCertificateRef.Name)
+		}
+		if nfo.TLS.CABundleRef != nil && nfo.TLS.CABundleRef.SecretKeyRef != nil {
+			add(nfo.TLS.CABundleRef.SecretKeyRef.Namespace, nfo.TLS.CABundleRef.SecretKeyRef.Name)
+		}
+	}
+	return refs
+}
+
+// createSecretRBACResources creates a Role and a RoleBinding for each namespace holding secrets referenced by the chart
+// source, granting the service account read access to them. The Role of a namespace lists all its secrets,
+// in the rules rendered from secret-role.yaml for each of them.
+func createSecretRBACResources(gvr schema.GroupVersionResource, rbacNSName types.NamespacedName, rbacFolderPath string, nfo *definitionsv1alpha1.ChartInfo, sa corev1.ServiceAccount) ([]rbacv1.Role, []rbacv1.RoleBinding, error) {
+	refs := secretRefs(nfo)
+	namespaces := make([]string, 0, len(refs))
+	for ns := range refs {
+		namespaces = append(namespaces, ns)
+	}
+	slices.Sort(namespaces)
+
+	roles := make([]rbacv1.Role, 0, len(namespaces))
+	rolebindings := make([]rbacv1.RoleBinding, 0, len(namespaces))
+	for _, ns := range namespaces {
+		nn := types.NamespacedName{Namespace: ns, Name: rbacNSName.Name}
+
+		role := rbacv1.Role{}
+		for _, name := range refs[ns] {
+			el := rbacv1.Role{}
+			err := objects.CreateK8sObject(&el, gvr, nn, filepath.Join(rbacFolderPath, "secret-role.yaml"), "secretName", name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if role.Name == "" {
+				role = el
+				continue
+			}
+			for i := range role.Rules {
+				if i < len(el.Rules) {
+					role.Rules[i].ResourceNames = append(role.Rules[i].ResourceNames, el.Rules[i].ResourceNames...)
+				}
+			}
+		}
+		roles = append(roles, role)
+
+		rolebinding := rbacv1.RoleBinding{}
+		err := objects.CreateK8sObject(&rolebinding, gvr, nn, filepath.Join(rbacFolderPath, "secret-rolebinding.yaml"),
+			"serviceAccount", sa.Name,
+			"saNamespace", sa.Namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		rolebindings = append(rolebindings, rolebinding)
+	}
+	return roles, rolebindings, nil
+}
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	definitionsv1alpha1 "github.com/krateoplatformops/core-provider/apis/compositiondefinitions/v1alpha1"
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const secretRoleTemplate = `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: {{ .resource }}-{{ .apiVersion }}-secret
+  namespace: {{ .namespace }}
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get", "list", "watch"]
+  resourceNames: ["{{ .secretName}}"]`
+
+const secretRoleBindingTemplate = `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: {{ .resource }}-{{ .apiVersion }}-secret
+  namespace: {{ .namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: {{ .resource }}-{{ .apiVersion }}-secret
+subjects:
+- kind: ServiceAccount
+  name: {{ .serviceAccount }}
+  namespace: {{ .saNamespace }}`
+
+func TestCreateSecretRBACResources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-role.yaml"), []byte(secretRoleTemplate), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-rolebinding.yaml"), []byte(secretRoleBindingTemplate), 0o600))
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "demos"}
+	nn := types.NamespacedName{Namespace: "krateo-system", Name: "demos-v1-2-0-controller"}
+	sa := corev1.ServiceAccount{}
+	sa.Name, sa.Namespace = "demos-v1-2-0-controller", "krateo-system"
+
+	t.Run("no secret references", func(t *testing.T) {
+		roles, rolebindings, err := createSecretRBACResources(gvr, nn, dir, &definitionsv1alpha1.ChartInfo{Url: "oci://example.com/charts/demo"}, sa)
+		require.NoError(t, err)
+		assert.Empty(t, roles)
+		assert.Empty(t, rolebindings)
+	})
+
+	t.Run("one role per namespace listing all its secrets", func(t *testing.T) {
+		nfo := &definitionsv1alpha1.ChartInfo{
+			Url:            "oci://example.com/charts/demo",
+			BearerTokenRef: &rtv1.SecretKeySelector{Reference: rtv1.Reference{Name: "token", Namespace: "team-b"}, Key: "token"},
+			TLS: &definitionsv1alpha1.SourceTLS{
+				ClientCertificateRef: &rtv1.Reference{Name: "client-cert", Namespace: "team-a"},
+				CABundleRef: &definitionsv1alpha1.CABundleRef{
+					SecretKeyRef: &rtv1.SecretKeySelector{Reference: rtv1.Reference{Name: "ca", Namespace: "team-a"}, Key: "ca.crt"},
+				},
+			},
+		}
+		roles, rolebindings, err := createSecretRBACResources(gvr, nn, dir, nfo, sa)
+		require.NoError(t, err)
+		require.Len(t, roles, 2)
+		require.Len(t, rolebindings, 2)
+
+		assert.Equal(t, "team-a", roles[0].Namespace)
+		assert.Equal(t, []string{"client-cert", "ca"}, roles[0].Rules[0].ResourceNames)
+		assert.Equal(t, "team-b", roles[1].Namespace)
+		assert.Equal(t, []string{"token"}, roles[1].Rules[0].ResourceNames)
+
+		for i, el := range rolebindings {
+			assert.Equal(t, roles[i].Namespace, el.Namespace)
+			assert.Equal(t, roles[i].Name, el.RoleRef.Name)
+			assert.Equal(t, sa.Name, el.Subjects[0].Name)
+		}
+	})
+
+	t.Run("charts stored in secrets", func(t *testing.T) {
+		nfo := &definitionsv1alpha1.ChartInfo{Url: "secret://team-a/demo-chart/chart.tgz"}
+		roles, _, err := createSecretRBACResources(gvr, nn, dir, nfo, sa)
+		require.NoError(t, err)
+		require.Len(t, roles, 1)
+		assert.Equal(t, "team-a", roles[0].Namespace)
+		assert.Equal(t, []string{"demo-chart"}, roles[0].Rules[0].ResourceNames)
+	})
+
+	t.Run("CA bundles in configmaps need no access to secrets", func(t *testing.T) {
+		nfo := &definitionsv1alpha1.ChartInfo{
+			Url:           "oci://example.com/charts/demo",
+			PullSecretRef: &rtv1.Reference{Name: "pull", Namespace: "team-a"},
+			TLS: &definitionsv1alpha1.SourceTLS{
+				CABundleRef: &definitionsv1alpha1.CABundleRef{
+					ConfigMapKeyRef: &rtv1.ConfigMapKeySelector{Reference: rtv1.Reference{Name: "ca", Namespace: "team-a"}, Key: "ca.crt"},
+				},
+			},
+		}
+		roles, _, err := createSecretRBACResources(gvr, nn, dir, nfo, sa)
+		require.NoError(t, err)
+		require.Len(t, roles, 1)
+		assert.Equal(t, []string{"pull"}, roles[0].Rules[0].ResourceNames)
+	})
+}
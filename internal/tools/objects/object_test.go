@@ -286,3 +286,31 @@ func TestObject(t *testing.T) {
 	fmt.Println(string(b))
 
 }
+
+func TestObjectScope(t *testing.T) {
+	gvr := schema.GroupVersionResource{
+		Group:    "composition.krateo.io",
+		Version:  "v1-0-0",
+		Resource: "tenants",
+	}
+	nn := types.NamespacedName{
+		Name:      "tenants-v1-0-0",
+		Namespace: "krateo-system",
+	}
+	path := "testdata/clusterrole_template.yaml"
+
+	namespaced := rbacv1.ClusterRole{}
+	err := CreateK8sObject(&namespaced, gvr, nn, path)
+	assert.NoError(t, err)
+	assert.Len(t, namespaced.Rules, 2)
+
+	cluster := rbacv1.ClusterRole{}
+	err = CreateK8sObject(&cluster, gvr, nn, path, "scope", "Cluster")
+	assert.NoError(t, err)
+	assert.Len(t, cluster.Rules, 3)
+	assert.Equal(t, rbacv1.PolicyRule{
+		APIGroups: []string{"composition.krateo.io"},
+		Resources: []string{"tenants", "tenants/status"},
+		Verbs:     []string{"get", "list", "watch", "update", "patch"},
+	}, cluster.Rules[2])
+}
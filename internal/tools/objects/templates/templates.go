@@ -14,6 +14,8 @@ type Renderoptions struct {
 	Resource  string
 	Namespace string
 	Name      string
+	// Scope is the scope of the composition CRD, Namespaced when not set.
+	Scope string
 }
 
 func Values(opts Renderoptions) map[string]any {
@@ -25,12 +27,17 @@ func Values(opts Renderoptions) map[string]any {
 		opts.Namespace = "default"
 	}
 
+	if len(opts.Scope) == 0 {
+		opts.Scope = "Namespaced"
+	}
+
 	values := map[string]any{
 		"apiGroup":   opts.Group,
 		"apiVersion": opts.Version,
 		"resource":   opts.Resource,
 		"name":       opts.Name,
 		"namespace":  opts.Namespace,
+		"scope":      opts.Scope,
 	}
 
 	return values
@@ -0,0 +1,26 @@
+package resolvers
+
+import (
+	"context"
+
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetConfigMapKey returns the value of the selected key of a configmap, looked up in its data and then in its binary data.
+func GetConfigMapKey(ctx context.Context, kube client.Client, configMapKeySelector rtv1.ConfigMapKeySelector) (string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := kube.Get(ctx, types.NamespacedName{
+		Name:      configMapKeySelector.Name,
+		Namespace: configMapKeySelector.Namespace,
+	}, cm); err != nil {
+		return "", err
+	}
+
+	if v, ok := cm.Data[configMapKeySelector.Key]; ok {
+		return v, nil
+	}
+	return string(cm.BinaryData[configMapKeySelector.Key]), nil
+}
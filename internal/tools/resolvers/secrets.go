@@ -20,3 +20,16 @@ func GetSecret(ctx context.Context, kube client.Client, secretKeySelector rtv1.S
 
 	return string(secret.Data[secretKeySelector.Key]), nil
 }
+
+// GetSecretData returns all the data of the referenced secret.
+func GetSecretData(ctx context.Context, kube client.Client, ref rtv1.Reference) (map[string][]byte, error) {
+	secret := &corev1.Secret{}
+	if err := kube.Get(ctx, types.NamespacedName{
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
+	}, secret); err != nil {
+		return nil, err
+	}
+
+	return secret.Data, nil
+}
@@ -2,6 +2,7 @@ package tgzfs
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 )
 
@@ -9,6 +10,9 @@ import (
 var (
 	ErrNotDir = errors.New("not a directory")
 	ErrDir    = errors.New("is a directory")
+	// ErrRejected matches the errors of the archives that New refuses to read: a *LimitError or an *EntryError.
+	// Reading such an archive again fails the same way.
+	ErrRejected = errors.New("archive rejected")
 )
 
 func newErrNotDir(op, name string) error {
@@ -18,3 +22,38 @@ func newErrNotDir(op, name string) error {
 func newErrDir(op, name string) error {
 	return &fs.PathError{Op: op, Path: name, Err: ErrDir}
 }
+
+// LimitError is returned when an archive exceeds one of its Limits.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. MaxFileSize.
+	Limit string
+	Max   int64
+	// Name is the entry that exceeded the limit, empty for the limits of the whole archive.
+	Name string
+}
+
+func (e *LimitError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("archive rejected: exceeds %s (%d)", e.Limit, e.Max)
+	}
+	return fmt.Sprintf("archive rejected: entry %q exceeds %s (%d)", e.Name, e.Limit, e.Max)
+}
+
+func (*LimitError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// EntryError is returned for an entry that could escape the root of the archive, such as an absolute path,
+// a path with .. elements or a link, or that is not a regular file nor a directory.
+type EntryError struct {
+	Name   string
+	Reason string
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("archive rejected: entry %q: %s", e.Name, e.Reason)
+}
+
+func (*EntryError) Is(target error) bool {
+	return target == ErrRejected
+}
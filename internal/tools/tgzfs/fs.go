@@ -16,18 +16,29 @@ type tarfs struct {
 	entries     map[string]fs.DirEntry
 	rootEntries []fs.DirEntry
 	rootEntry   fs.DirEntry
+	limits      Limits
 }
 
-// New creates a new tgz fs.FS from r
+// New creates a new tgz fs.FS from r, within DefaultLimits.
 func New(r io.Reader) (fs.FS, error) {
-	zip, err := gzip.NewReader(r)
+	return NewWithLimits(r, DefaultLimits)
+}
+
+// NewWithLimits creates a new tgz fs.FS from r, within l. Archives exceeding l fail with a *LimitError,
+// entries that are links, absolute paths or paths with .. elements fail with an *EntryError.
+func NewWithLimits(r io.Reader, l Limits) (fs.FS, error) {
+	l = l.WithDefaults()
+	cr := &compressedReader{r: r, max: l.MaxCompressedSize}
+	zip, err := gzip.NewReader(cr)
 	if err != nil {
 		return nil, err
 	}
 
 	tr := tar.NewReader(zip)
-	tfs := &tarfs{make(map[string]fs.DirEntry), make([]fs.DirEntry, 0, 10), nil}
+	tfs := &tarfs{make(map[string]fs.DirEntry), make([]fs.DirEntry, 0, 10), nil, l}
 
+	var files int
+	var size int64
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
@@ -37,13 +48,41 @@ func New(r io.Reader) (fs.FS, error) {
 			return nil, err
 		}
 
+		switch {
+		case h.Typeflag == tar.TypeXGlobalHeader:
+			// Global pax headers, e.g. the commit id written by git archive, hold no file.
+			continue
+		case h.Typeflag == tar.TypeSymlink || h.Typeflag == tar.TypeLink:
+			return nil, &EntryError{Name: h.Name, Reason: "links are not allowed"}
+		case h.Typeflag != tar.TypeDir && !h.FileInfo().Mode().IsRegular():
+			return nil, &EntryError{Name: h.Name, Reason: "only regular files and directories are allowed"}
+		}
+		if err := checkName(h.Name); err != nil {
+			return nil, err
+		}
+
 		name := path.Clean(h.Name)
 		if name == "." {
 			continue
 		}
+		if depth := strings.Count(name, "/") + 1; exceeds(int64(depth), int64(l.MaxDepth)) {
+			return nil, &LimitError{Limit: "MaxDepth", Max: int64(l.MaxDepth), Name: h.Name}
+		}
+		files++
+		if exceeds(int64(files), int64(l.MaxFiles)) {
+			return nil, &LimitError{Limit: "MaxFiles", Max: int64(l.MaxFiles)}
+		}
+		if exceeds(h.Size, l.MaxFileSize) {
+			return nil, &LimitError{Limit: "MaxFileSize", Max: l.MaxFileSize, Name: h.Name}
+		}
+		size += h.Size
+		if exceeds(size, l.MaxSize) {
+			return nil, &LimitError{Limit: "MaxSize", Max: l.MaxSize}
+		}
 
-		buf := bytes.NewBuffer(make([]byte, 0, int(h.Size)))
-		if _, err := io.Copy(buf, tr); err != nil {
+		// The buffer grows with what is read: the size in the header is not trusted to allocate it upfront.
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
 			return nil, err
 		}
 
@@ -51,10 +90,32 @@ func New(r io.Reader) (fs.FS, error) {
 
 		tfs.append(name, e)
 	}
+	// The decompressor reads ahead, so the end of an archive exceeding the limit may be read without an error.
+	if exceeds(cr.read, cr.max) {
+		return nil, &LimitError{Limit: "MaxCompressedSize", Max: cr.max}
+	}
 
 	return tfs, nil
 }
 
+// checkName rejects the entry names that could escape the root of the archive once extracted.
+func checkName(name string) error {
+	switch {
+	case name == "":
+		return &EntryError{Name: name, Reason: "empty name"}
+	case strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':'):
+		return &EntryError{Name: name, Reason: "absolute paths are not allowed"}
+	case strings.Contains(name, `\`):
+		return &EntryError{Name: name, Reason: "backslashes are not allowed"}
+	}
+	for _, el := range strings.Split(name, "/") {
+		if el == ".." {
+			return &EntryError{Name: name, Reason: "path traversal is not allowed"}
+		}
+	}
+	return nil
+}
+
 func (tfs *tarfs) append(name string, e fs.DirEntry) {
 	tfs.entries[name] = e
 
@@ -191,7 +252,7 @@ func (tfs *tarfs) Sub(dir string) (fs.FS, error) {
 		return nil, newErrNotDir("sub", dir)
 	}
 
-	subfs := &tarfs{make(map[string]fs.DirEntry), e.(entries).get(), e}
+	subfs := &tarfs{make(map[string]fs.DirEntry), e.(entries).get(), e, tfs.limits}
 	prefix := dir + "/"
 	for name, file := range tfs.entries {
 		if strings.HasPrefix(name, prefix) {
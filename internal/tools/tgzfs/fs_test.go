@@ -0,0 +1,130 @@
+package tgzfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archive builds a tgz holding hdrs, with content of their size.
+func archive(t *testing.T, hdrs ...*tar.Header) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, h := range hdrs {
+		if h.Mode == 0 && h.Typeflag != tar.TypeXGlobalHeader {
+			h.Mode = 0o644
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write(bytes.Repeat([]byte("x"), int(h.Size)))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func regular(name string, size int64) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Size: size}
+}
+
+func TestNew(t *testing.T) {
+	dat := archive(t,
+		&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123abcd"}},
+		&tar.Header{Name: "demo/", Typeflag: tar.TypeDir, Mode: 0o755},
+		regular("demo/Chart.yaml", 16),
+		regular("demo/templates/deployment.yaml", 32),
+		regular("./demo/values.yaml", 8),
+	)
+
+	pkg, err := New(bytes.NewReader(dat))
+	require.NoError(t, err)
+
+	all, err := fs.ReadDir(pkg, ".")
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "demo", all[0].Name())
+
+	b, err := fs.ReadFile(pkg, "demo/templates/deployment.yaml")
+	require.NoError(t, err)
+	assert.Len(t, b, 32)
+	_, err = fs.Stat(pkg, "demo/values.yaml")
+	assert.NoError(t, err)
+}
+
+func TestNewWithLimits(t *testing.T) {
+	limits := Limits{MaxCompressedSize: 4096, MaxSize: 1024, MaxFiles: 4, MaxFileSize: 512, MaxDepth: 3}
+
+	tests := []struct {
+		name  string
+		dat   []byte
+		limit string
+	}{
+		{name: "file too large", dat: archive(t, regular("demo/big.bin", 513)), limit: "MaxFileSize"},
+		{name: "archive too large once decompressed", dat: archive(t, regular("demo/a", 400), regular("demo/b", 400), regular("demo/c", 400)), limit: "MaxSize"},
+		{name: "too many files", dat: archive(t, regular("demo/a", 1), regular("demo/b", 1), regular("demo/c", 1), regular("demo/d", 1), regular("demo/e", 1)), limit: "MaxFiles"},
+		{name: "too deep", dat: archive(t, regular("demo/a/b/c", 1)), limit: "MaxDepth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWithLimits(bytes.NewReader(tt.dat), limits)
+			var lerr *LimitError
+			require.True(t, errors.As(err, &lerr), "expected a limit error, got: %v", err)
+			assert.Equal(t, tt.limit, lerr.Limit)
+			assert.ErrorIs(t, err, ErrRejected)
+		})
+	}
+
+	t.Run("compressed archive too large", func(t *testing.T) {
+		dat := archive(t, regular("demo/Chart.yaml", 16))
+		_, err := NewWithLimits(bytes.NewReader(dat), Limits{MaxCompressedSize: int64(len(dat) / 2)})
+		var lerr *LimitError
+		require.True(t, errors.As(err, &lerr), "expected a limit error, got: %v", err)
+		assert.Equal(t, "MaxCompressedSize", lerr.Limit)
+	})
+
+	t.Run("negative limits are disabled", func(t *testing.T) {
+		_, err := NewWithLimits(bytes.NewReader(archive(t, regular("demo/big.bin", 6<<20))), Limits{MaxFileSize: -1})
+		assert.NoError(t, err)
+	})
+
+	t.Run("archives keep their limits", func(t *testing.T) {
+		pkg, err := NewWithLimits(bytes.NewReader(archive(t, regular("demo/Chart.yaml", 1))), limits)
+		require.NoError(t, err)
+		assert.Equal(t, limits, LimitsOf(pkg))
+		assert.Equal(t, DefaultLimits, LimitsOf(fstest.MapFS{}))
+	})
+}
+
+func TestNewRejectsUnsafeEntries(t *testing.T) {
+	tests := map[string]*tar.Header{
+		"path traversal":    regular("demo/../../etc/passwd", 1),
+		"leading traversal": regular("../demo/Chart.yaml", 1),
+		"absolute path":     regular("/etc/passwd", 1),
+		"windows path":      regular(`demo\..\..\evil`, 1),
+		"symlink":           {Name: "demo/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		"hard link":         {Name: "demo/link", Typeflag: tar.TypeLink, Linkname: "demo/Chart.yaml"},
+		"device":            {Name: "demo/dev", Typeflag: tar.TypeChar},
+		"named pipe":        {Name: "demo/fifo", Typeflag: tar.TypeFifo},
+	}
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(bytes.NewReader(archive(t, regular("demo/Chart.yaml", 1), h)))
+			var eerr *EntryError
+			require.True(t, errors.As(err, &eerr), "expected an entry error, got: %v", err)
+			assert.Equal(t, h.Name, eerr.Name)
+			assert.ErrorIs(t, err, ErrRejected)
+		})
+	}
+}
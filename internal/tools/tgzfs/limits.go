@@ -0,0 +1,80 @@
+package tgzfs
+
+import (
+	"io"
+	"io/fs"
+)
+
+// Limits bounds what New reads from an archive. A zero limit is replaced by its default, a negative one disables the limit.
+type Limits struct {
+	// MaxCompressedSize is the maximum size of the archive, in bytes.
+	MaxCompressedSize int64
+	// MaxSize is the maximum size of all its files once decompressed, in bytes.
+	MaxSize int64
+	// MaxFiles is the maximum number of entries, files and directories.
+	MaxFiles int
+	// MaxFileSize is the maximum size of a file, in bytes.
+	MaxFileSize int64
+	// MaxDepth is the maximum number of elements of an entry path.
+	MaxDepth int
+}
+
+// DefaultLimits are the limits applied by New.
+// The size limits are those Helm applies when it loads a chart archive.
+var DefaultLimits = Limits{
+	MaxCompressedSize: 100 << 20,
+	MaxSize:           100 << 20,
+	MaxFiles:          10000,
+	MaxFileSize:       5 << 20,
+	MaxDepth:          32,
+}
+
+// LimitsOf returns the limits fsys was read with when it is an archive read by tgzfs, DefaultLimits otherwise,
+// so that the archives nested in an archive are read within the same limits.
+func LimitsOf(fsys fs.FS) Limits {
+	if tfs, ok := fsys.(*tarfs); ok {
+		return tfs.limits
+	}
+	return DefaultLimits
+}
+
+// WithDefaults replaces the zero limits with their defaults.
+func (l Limits) WithDefaults() Limits {
+	if l.MaxCompressedSize == 0 {
+		l.MaxCompressedSize = DefaultLimits.MaxCompressedSize
+	}
+	if l.MaxSize == 0 {
+		l.MaxSize = DefaultLimits.MaxSize
+	}
+	if l.MaxFiles == 0 {
+		l.MaxFiles = DefaultLimits.MaxFiles
+	}
+	if l.MaxFileSize == 0 {
+		l.MaxFileSize = DefaultLimits.MaxFileSize
+	}
+	if l.MaxDepth == 0 {
+		l.MaxDepth = DefaultLimits.MaxDepth
+	}
+	return l
+}
+
+// exceeds reports whether n is above the limit max, negative limits being disabled.
+func exceeds(n, max int64) bool {
+	return max >= 0 && n > max
+}
+
+// compressedReader fails with a *LimitError once more than max bytes are read from r.
+type compressedReader struct {
+	r    io.Reader
+	read int64
+	max  int64
+}
+
+func (c *compressedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if exceeds(c.read, c.max) {
+		return n, &LimitError{Limit: "MaxCompressedSize", Max: c.max}
+	}
+	return n, err
+}
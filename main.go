@@ -8,18 +8,24 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 
 	"github.com/krateoplatformops/core-provider/internal/controllers/certificates"
 	"github.com/krateoplatformops/core-provider/internal/controllers/compositiondefinitions"
+	charttelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/charts"
 	webhooktelemetry "github.com/krateoplatformops/core-provider/internal/telemetry/webhooks"
 	"github.com/krateoplatformops/core-provider/internal/tools/certs"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/chartcache"
+	"github.com/krateoplatformops/core-provider/internal/tools/chart/mirrors"
 	"github.com/krateoplatformops/core-provider/internal/tools/loghandler"
 	"github.com/krateoplatformops/core-provider/internal/tools/pluralizer"
+	"github.com/krateoplatformops/core-provider/internal/tools/tgzfs"
 	"github.com/krateoplatformops/plumbing/env"
 	"github.com/krateoplatformops/plumbing/ptr"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/config"
@@ -61,6 +67,19 @@ func main() {
 		env.Duration(fmt.Sprintf("%s_TLS_CERTIFICATE_LEASE_EXPIRATION_MARGIN", envVarPrefix),
 			16*time.Hour),
 		"The duration of the TLS certificate lease expiration margin. It represents the time before the certificate expires when the lease should be renewed. It must be less than the TLS certificate duration. Consider values of 2/3 or less of the TLS certificate duration.")
+	chartCacheEnabled := flag.Bool("chart-cache-enabled", env.Bool(fmt.Sprintf("%s_CHART_CACHE_ENABLED", envVarPrefix), true), "Share downloaded charts across reconciles through the chart cache.")
+	chartCacheTTL := flag.Duration("chart-cache-ttl", env.Duration(fmt.Sprintf("%s_CHART_CACHE_TTL", envVarPrefix), 10*time.Minute), "How long a cached chart is used before it is revalidated against its source.")
+	chartCacheMaxEntries := flag.Int("chart-cache-max-entries", env.Int(fmt.Sprintf("%s_CHART_CACHE_MAX_ENTRIES", envVarPrefix), 64), "The maximum number of charts held in memory by the chart cache. Zero means no limit.")
+	chartCacheMaxMemoryMB := flag.Int("chart-cache-max-memory-mb", env.Int(fmt.Sprintf("%s_CHART_CACHE_MAX_MEMORY_MB", envVarPrefix), 256), "The maximum size in MiB of the charts held in memory by the chart cache. Zero means no limit.")
+	chartCacheDir := flag.String("chart-cache-dir", env.String(fmt.Sprintf("%s_CHART_CACHE_DIR", envVarPrefix), ""), "The directory of the on-disk tier of the chart cache. The disk tier is disabled when empty.")
+	chartCacheMaxDiskMB := flag.Int("chart-cache-max-disk-mb", env.Int(fmt.Sprintf("%s_CHART_CACHE_MAX_DISK_MB", envVarPrefix), 1024), "The maximum size in MiB of the charts stored on disk by the chart cache. Zero means no limit.")
+	chartMirrorsConfigMap := flag.String("chart-mirrors-configmap", env.String(fmt.Sprintf("%s_CHART_MIRRORS_CONFIGMAP", envVarPrefix), ""), "The namespace/name of the ConfigMap holding the mirror rules applied to every chart source. Mirrors are disabled when empty.")
+	chartMirrorsKey := flag.String("chart-mirrors-key", env.String(fmt.Sprintf("%s_CHART_MIRRORS_KEY", envVarPrefix), mirrors.DefaultKey), "The key of the ConfigMap holding the mirror rules.")
+	chartMaxArchiveSizeMB := flag.Int("chart-max-archive-size-mb", env.Int(fmt.Sprintf("%s_CHART_MAX_ARCHIVE_SIZE_MB", envVarPrefix), 100), "The maximum size in MiB of a compressed chart archive. A negative value means no limit.")
+	chartMaxSizeMB := flag.Int("chart-max-size-mb", env.Int(fmt.Sprintf("%s_CHART_MAX_SIZE_MB", envVarPrefix), 100), "The maximum size in MiB of the files of a chart once decompressed. A negative value means no limit.")
+	chartMaxFiles := flag.Int("chart-max-files", env.Int(fmt.Sprintf("%s_CHART_MAX_FILES", envVarPrefix), 10000), "The maximum number of files and directories of a chart archive. A negative value means no limit.")
+	chartMaxFileSizeMB := flag.Int("chart-max-file-size-mb", env.Int(fmt.Sprintf("%s_CHART_MAX_FILE_SIZE_MB", envVarPrefix), 5), "The maximum size in MiB of a file of a chart archive. A negative value means no limit.")
+	chartMaxDepth := flag.Int("chart-max-depth", env.Int(fmt.Sprintf("%s_CHART_MAX_DEPTH", envVarPrefix), 32), "The maximum depth of the paths of a chart archive. A negative value means no limit.")
 	certificateSyncInterval := flag.Duration("certificate-sync-interval", env.Duration(fmt.Sprintf("%s_CERTIFICATE_SYNC_INTERVAL", envVarPrefix), 5*time.Minute), "The interval at which the certificate reconciler syncs certificates and updates resources.")
 
 	flag.Parse()
@@ -105,6 +124,19 @@ func main() {
 		"tls-certificate-duration", tlsCertificateDuration.String(),
 		"tls-certificate-lease-expiration-margin", tlsCertificateLeaseExpirationMargin.String(),
 		"certificate-sync-interval", certificateSyncInterval.String(),
+		"chart-cache-enabled", *chartCacheEnabled,
+		"chart-cache-ttl", chartCacheTTL.String(),
+		"chart-cache-max-entries", *chartCacheMaxEntries,
+		"chart-cache-max-memory-mb", *chartCacheMaxMemoryMB,
+		"chart-cache-dir", *chartCacheDir,
+		"chart-cache-max-disk-mb", *chartCacheMaxDiskMB,
+		"chart-mirrors-configmap", *chartMirrorsConfigMap,
+		"chart-mirrors-key", *chartMirrorsKey,
+		"chart-max-archive-size-mb", *chartMaxArchiveSizeMB,
+		"chart-max-size-mb", *chartMaxSizeMB,
+		"chart-max-files", *chartMaxFiles,
+		"chart-max-file-size-mb", *chartMaxFileSizeMB,
+		"chart-max-depth", *chartMaxDepth,
 		"otel-enabled", *metricsEnabled,
 		"otel-service-name", *metricsServiceName,
 		"otel-export-interval", metricsExportInterval.String())
@@ -126,6 +158,38 @@ func main() {
 		log.Error(err, "Cannot initialize webhook metrics")
 		os.Exit(1)
 	}
+	var chartCache *chartcache.Cache
+	if *chartCacheEnabled {
+		chartMetrics, err := charttelemetry.NewMetrics()
+		if err != nil {
+			log.Error(err, "Cannot initialize chart cache metrics")
+			os.Exit(1)
+		}
+		chartCache, err = chartcache.New(chartcache.Options{
+			TTL:          *chartCacheTTL,
+			MaxEntries:   *chartCacheMaxEntries,
+			MaxBytes:     int64(*chartCacheMaxMemoryMB) << 20,
+			Dir:          *chartCacheDir,
+			MaxDiskBytes: int64(*chartCacheMaxDiskMB) << 20,
+			Metrics:      chartMetrics,
+		})
+		if err != nil {
+			log.Error(err, "Cannot create chart cache")
+			os.Exit(1)
+		}
+	}
+	var chartMirrors *mirrors.Source
+	if *chartMirrorsConfigMap != "" {
+		ns, name, ok := strings.Cut(*chartMirrorsConfigMap, "/")
+		if !ok || ns == "" || name == "" {
+			log.Error(fmt.Errorf("expected namespace/name, got %q", *chartMirrorsConfigMap), "Invalid chart mirrors configmap")
+			os.Exit(1)
+		}
+		chartMirrors = &mirrors.Source{
+			ConfigMap: types.NamespacedName{Namespace: ns, Name: name},
+			Key:       *chartMirrorsKey,
+		}
+	}
 	defer func() {
 		if err := telemetryShutdown(context.Background()); err != nil {
 			log.Error(err, "Cannot shutdown OpenTelemetry metrics")
@@ -145,11 +209,12 @@ func main() {
 		LeaseExpirationMargin: *tlsCertificateLeaseExpirationMargin,
 	}
 	certMgr, err := certificates.NewCertManager(certificates.Opts{
-		WebhookServiceName:          *webhookServiceName,
-		WebhookServiceNamespace:     *webhookServiceNamespace,
-		MutatingWebhookTemplatePath: compositiondefinitions.MutatingWebhookPath,
-		CertOpts:                    certOpts,
-		RestConfig:                  cfg,
+		WebhookServiceName:            *webhookServiceName,
+		WebhookServiceNamespace:       *webhookServiceNamespace,
+		MutatingWebhookTemplatePath:   compositiondefinitions.MutatingWebhookPath,
+		ValidatingWebhookTemplatePath: compositiondefinitions.ValidatingWebhookPath,
+		CertOpts:                      certOpts,
+		RestConfig:                    cfg,
 	})
 	if err != nil {
 		log.Error(err, "Cannot create certificate manager")
@@ -200,9 +265,18 @@ func main() {
 		os.Exit(1)
 	}
 	if err := compositiondefinitions.Setup(mgr, compositiondefinitions.Options{
-		ControllerOptions:       o,
-		Metrics:                 telemetryMetrics,
-		WebhookMetrics:          webhookMetrics,
+		ControllerOptions: o,
+		Metrics:           telemetryMetrics,
+		WebhookMetrics:    webhookMetrics,
+		ChartCache:        chartCache,
+		ChartMirrors:      chartMirrors,
+		ArchiveLimits: tgzfs.Limits{
+			MaxCompressedSize: megabytes(*chartMaxArchiveSizeMB),
+			MaxSize:           megabytes(*chartMaxSizeMB),
+			MaxFiles:          *chartMaxFiles,
+			MaxFileSize:       megabytes(*chartMaxFileSizeMB),
+			MaxDepth:          *chartMaxDepth,
+		},
 		CertManager:             certMgr,
 		Pluralizer:              pluralizer.New(false),
 		CertificateSyncInterval: *certificateSyncInterval,
@@ -215,3 +289,11 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// megabytes converts a size in MiB to bytes, keeping negative sizes negative.
+func megabytes(mb int) int64 {
+	if mb < 0 {
+		return -1
+	}
+	return int64(mb) << 20
+}